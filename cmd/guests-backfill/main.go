@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"preactvillacarmen/internal/api"
+	"preactvillacarmen/internal/config"
+	"preactvillacarmen/internal/db"
+	"preactvillacarmen/internal/db/migrations"
+)
+
+func main() {
+	restaurantID := flag.Int("restaurant", 0, "Restaurant ID (0 = all restaurants)")
+	flag.Parse()
+
+	_ = godotenv.Overload("../.env")
+	_ = godotenv.Overload(".env")
+
+	cfg := config.Load()
+
+	sqlDB, err := db.OpenMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	if err := migrations.Apply(ctx, sqlDB); err != nil {
+		log.Fatalf("db migrations: %v", err)
+	}
+
+	s := api.NewServer(sqlDB, cfg)
+	defer s.Shutdown(context.Background())
+
+	res, err := s.BackfillGuests(ctx, *restaurantID)
+	if err != nil {
+		log.Fatalf("backfill: %v", err)
+	}
+	log.Printf("linked %d bookings and %d cancelled bookings to %d guests (%d skipped without contact details)",
+		res.Bookings, res.CancelledBookings, res.Guests, res.Skipped)
+}
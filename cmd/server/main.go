@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"preactvillacarmen/internal/api"
+	"preactvillacarmen/internal/config"
+	"preactvillacarmen/internal/db"
+	"preactvillacarmen/internal/db/migrations"
+)
+
+func main() {
+	_ = godotenv.Overload("../.env")
+	_ = godotenv.Overload(".env")
+
+	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	sqlDB, err := db.OpenMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := migrations.Apply(ctx, sqlDB); err != nil {
+			log.Fatalf("db migrations: %v", err)
+		}
+	}
+
+	s := api.NewServer(sqlDB, cfg)
+	s.Start()
+
+	httpServer := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           newRootHandler(s.Routes(), cfg.StaticDir),
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", cfg.Addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("http server: %v", err)
+		}
+		return
+	case sig := <-stop:
+		log.Printf("received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting new requests and drain in-flight ones first, then
+	// disconnect websocket clients and stop background jobs.
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("api shutdown: %v", err)
+	}
+	log.Printf("shutdown complete")
+}
+
+// newRootHandler mounts the API under /api and exposes legacy endpoints at the
+// root path (see ENDPOINTS.md). Anything else is served from staticDir as a SPA.
+func newRootHandler(apiHandler http.Handler, staticDir string) http.Handler {
+	apiPrefixed := http.StripPrefix("/api", apiHandler)
+
+	var spa http.Handler
+	if strings.TrimSpace(staticDir) != "" {
+		spa = api.SPAHandler(staticDir)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case path == "/api" || strings.HasPrefix(path, "/api/"):
+			apiPrefixed.ServeHTTP(w, r)
+		case isLegacyRootPath(path):
+			apiHandler.ServeHTTP(w, r)
+		case spa != nil:
+			spa.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// isLegacyRootPath limits root aliases to legacy-style endpoints so they don't
+// collide with SPA routes like /vinos.
+func isLegacyRootPath(path string) bool {
+	if strings.HasSuffix(path, ".php") {
+		return true
+	}
+	if path == "/menu-visibility" {
+		return true
+	}
+	for _, prefix := range []string{"/menuDeGruposBackend/", "/menuVisibilityBackend/", "/emailAdvertising/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
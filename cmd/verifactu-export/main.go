@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"preactvillacarmen/internal/api"
+	"preactvillacarmen/internal/config"
+	"preactvillacarmen/internal/db"
+	"preactvillacarmen/internal/db/migrations"
+)
+
+func main() {
+	var (
+		restaurantID = flag.Int("restaurant", 0, "Restaurant ID")
+		from         = flag.String("from", "", "First invoice date (YYYY-MM-DD)")
+		to           = flag.String("to", "", "Last invoice date (YYYY-MM-DD)")
+		out          = flag.String("out", "", "Output file (default stdout)")
+	)
+	flag.Parse()
+
+	if *restaurantID <= 0 {
+		log.Fatalf("missing -restaurant")
+	}
+
+	_ = godotenv.Overload("../.env")
+	_ = godotenv.Overload(".env")
+
+	cfg := config.Load()
+
+	sqlDB, err := db.OpenMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := migrations.Apply(ctx, sqlDB); err != nil {
+		log.Fatalf("db migrations: %v", err)
+	}
+
+	s := api.NewServer(sqlDB, cfg)
+	defer s.Shutdown(context.Background())
+
+	xml, err := s.ExportFiscalRecordsXML(ctx, *restaurantID, *from, *to)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+
+	if *out == "" {
+		_, _ = os.Stdout.Write(xml)
+		return
+	}
+	if err := os.WriteFile(*out, xml, 0o644); err != nil {
+		log.Fatalf("write %s: %v", *out, err)
+	}
+	log.Printf("wrote %d bytes to %s", len(xml), *out)
+}
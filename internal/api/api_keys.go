@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// API key scopes. A key only reaches the routes of its own restaurant.
+const (
+	apiScopeBookingsRead      = "bookings:read"
+	apiScopeBookingsWrite     = "bookings:write"
+	apiScopeAvailabilityRead  = "availability:read"
+	apiScopeAvailabilityWrite = "availability:write"
+	apiScopeAutomation        = "automation"
+)
+
+var apiKeyScopes = []string{apiScopeBookingsRead, apiScopeBookingsWrite, apiScopeAvailabilityRead, apiScopeAvailabilityWrite, apiScopeAutomation}
+
+const apiKeyTokenPrefix = "vck_"
+
+type apiKey struct {
+	ID           int
+	RestaurantID int
+	Scopes       []string
+}
+
+func (k apiKey) allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type apiKeyCtxKey int
+
+const apiKeyKey apiKeyCtxKey = 1
+
+func withAPIKey(ctx context.Context, k apiKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, k)
+}
+
+func apiKeyFromContext(ctx context.Context) (apiKey, bool) {
+	k, ok := ctx.Value(apiKeyKey).(apiKey)
+	return k, ok
+}
+
+func newAPIKeyToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return apiKeyTokenPrefix + base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// apiKeyPrefix is the part of a key shown in the backoffice.
+func apiKeyPrefix(token string) string {
+	if len(token) > 12 {
+		return token[:12]
+	}
+	return token
+}
+
+// normalizeAPIKeyScopes keeps the known scopes in canonical order. It returns
+// nil when nothing valid is left.
+func normalizeAPIKeyScopes(raw []string) []string {
+	var out []string
+	for _, scope := range apiKeyScopes {
+		for _, v := range raw {
+			if strings.EqualFold(strings.TrimSpace(v), scope) {
+				out = append(out, scope)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func parseAPIKeyScopes(stored string) []string {
+	return normalizeAPIKeyScopes(strings.Split(stored, ","))
+}
+
+func bearerToken(r *http.Request) string {
+	authz := strings.TrimSpace(r.Header.Get("Authorization"))
+	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
+		return strings.TrimSpace(authz[len("bearer "):])
+	}
+	return ""
+}
+
+// apiKeyTokenFromRequest finds an API key in X-Api-Key, or in the headers the
+// legacy callers already send (X-Admin-Token, X-Api-Token, Bearer) when the
+// value carries the key prefix.
+func apiKeyTokenFromRequest(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("X-Api-Key")); v != "" {
+		return v
+	}
+	for _, v := range []string{
+		strings.TrimSpace(r.Header.Get("X-Admin-Token")),
+		strings.TrimSpace(r.Header.Get("X-Api-Token")),
+		bearerToken(r),
+	} {
+		if strings.HasPrefix(v, apiKeyTokenPrefix) {
+			return v
+		}
+	}
+	return ""
+}
+
+var errAPIKeyInvalid = errors.New("invalid api key")
+
+// lookupAPIKey resolves an active key by its hash. last_used_at is refreshed
+// at most once a minute.
+func (s *Server) lookupAPIKey(ctx context.Context, token string) (apiKey, error) {
+	hash := sha256Hex(token)
+	var (
+		k      apiKey
+		scopes string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, restaurant_id, scopes
+		FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL
+		LIMIT 1
+	`, hash).Scan(&k.ID, &k.RestaurantID, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiKey{}, errAPIKeyInvalid
+	}
+	if err != nil {
+		return apiKey{}, err
+	}
+	k.Scopes = parseAPIKeyScopes(scopes)
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)
+	`, k.ID); err != nil {
+		log.Printf("[api-keys] touch %d: %v", k.ID, err)
+	}
+	return k, nil
+}
+
+// validAdminToken reports whether the request carries the global ADMIN_TOKEN.
+func (s *Server) validAdminToken(r *http.Request) bool {
+	expected := strings.TrimSpace(s.cfg.AdminToken)
+	if expected == "" {
+		return false
+	}
+	token := strings.TrimSpace(r.Header.Get("X-Admin-Token"))
+	if token == "" {
+		token = bearerToken(r)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// requireAPIScope gates a restaurant-scoped route for integrations: an API
+// key of the request's restaurant holding scope, or the global ADMIN_TOKEN.
+func (s *Server) requireAPIScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.cfg.AdminOpen || s.validAdminToken(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			k, ok := apiKeyFromContext(r.Context())
+			if !ok {
+				httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			restaurantID, _ := restaurantIDFromContext(r.Context())
+			if k.RestaurantID != restaurantID || !k.allows(scope) {
+				httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+					"success":    false,
+					"message":    "API key sin permiso",
+					"error_code": "SCOPE_FORBIDDEN",
+					"scope":      scope,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeAutomation accepts the global INTERNAL_API_TOKEN or an API key of
+// the request's restaurant with the automation scope.
+func (s *Server) authorizeAutomation(r *http.Request) bool {
+	if k, ok := apiKeyFromContext(r.Context()); ok {
+		restaurantID, _ := restaurantIDFromContext(r.Context())
+		return k.RestaurantID == restaurantID && k.allows(apiScopeAutomation)
+	}
+	return validateInternalAPIToken(r)
+}
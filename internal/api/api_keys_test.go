@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAPIKeyScopes(t *testing.T) {
+	got := normalizeAPIKeyScopes([]string{" automation", "availability:write", "BOOKINGS:READ", "bogus", "bookings:read"})
+	want := []string{apiScopeBookingsRead, apiScopeAvailabilityWrite, apiScopeAutomation}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := parseAPIKeyScopes(""); got != nil {
+		t.Errorf("empty column parsed as %v", got)
+	}
+}
+
+func TestAPIKeyTokenFromRequest(t *testing.T) {
+	token, err := newAPIKeyToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, apiKeyTokenPrefix) || len(apiKeyPrefix(token)) != 12 {
+		t.Fatalf("unexpected token %q", token)
+	}
+
+	cases := []struct {
+		header, value, want string
+	}{
+		{"X-Api-Key", token, token},
+		{"Authorization", "Bearer " + token, token},
+		{"X-Api-Token", token, token},
+		{"X-Admin-Token", "legacy-admin-token", ""},
+		{"X-Api-Token", "legacy-internal-token", ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/fetch_bookings.php", nil)
+		r.Header.Set(c.header, c.value)
+		if got := apiKeyTokenFromRequest(r); got != c.want {
+			t.Errorf("%s: %q, want %q", c.header, got, c.want)
+		}
+	}
+}
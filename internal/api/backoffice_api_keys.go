@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boAPIKeyInfo struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	Prefix          string   `json:"prefix"`
+	Scopes          []string `json:"scopes"`
+	CreatedByUserID *int     `json:"createdByUserId"`
+	CreatedAt       *string  `json:"createdAt"`
+	LastUsedAt      *string  `json:"lastUsedAt"`
+	RevokedAt       *string  `json:"revokedAt"`
+}
+
+func (s *Server) getBOAPIKey(ctx context.Context, restaurantID, id int) (boAPIKeyInfo, error) {
+	keys, err := s.listBOAPIKeys(ctx, restaurantID, id)
+	if err != nil {
+		return boAPIKeyInfo{}, err
+	}
+	if len(keys) == 0 {
+		return boAPIKeyInfo{}, sql.ErrNoRows
+	}
+	return keys[0], nil
+}
+
+// listBOAPIKeys lists the keys of a restaurant, or only id when it is > 0.
+func (s *Server) listBOAPIKeys(ctx context.Context, restaurantID, id int) ([]boAPIKeyInfo, error) {
+	query := `
+		SELECT id, name, key_prefix, scopes, created_by_user_id, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE restaurant_id = ?`
+	args := []any{restaurantID}
+	if id > 0 {
+		query += " AND id = ?"
+		args = append(args, id)
+	}
+	query += " ORDER BY revoked_at IS NOT NULL, id DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []boAPIKeyInfo{}
+	for rows.Next() {
+		var (
+			k                              boAPIKeyInfo
+			scopes                         string
+			createdBy                      sql.NullInt64
+			createdAt, lastUsed, revokedAt sql.NullTime
+		)
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &createdBy, &createdAt, &lastUsed, &revokedAt); err != nil {
+			return nil, err
+		}
+		k.Scopes = parseAPIKeyScopes(scopes)
+		if createdBy.Valid {
+			v := int(createdBy.Int64)
+			k.CreatedByUserID = &v
+		}
+		k.CreatedAt = formatNullTimeRFC3339(createdAt)
+		k.LastUsedAt = formatNullTimeRFC3339(lastUsed)
+		k.RevokedAt = formatNullTimeRFC3339(revokedAt)
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Server) handleBOAPIKeysList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keys, err := s.listBOAPIKeys(r.Context(), a.ActiveRestaurantID, 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando API keys")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"keys":            keys,
+		"availableScopes": apiKeyScopes,
+	})
+}
+
+// handleBOAPIKeyCreate issues a key. The token is returned once; only its
+// hash is stored.
+func (s *Server) handleBOAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if len(name) < 2 || len(name) > 120 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Nombre invalido (2-120 caracteres)",
+		})
+		return
+	}
+	scopes := normalizeAPIKeyScopes(req.Scopes)
+	if len(scopes) == 0 || len(scopes) != len(req.Scopes) {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Scopes invalidos",
+		})
+		return
+	}
+
+	token, err := newAPIKeyToken()
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error generando API key")
+		return
+	}
+	res, err := s.db.ExecContext(r.Context(), `
+		INSERT INTO api_keys (restaurant_id, name, key_prefix, key_hash, scopes, created_by_user_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, a.ActiveRestaurantID, name, apiKeyPrefix(token), sha256Hex(token), strings.Join(scopes, ","), a.User.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando API key")
+		return
+	}
+	id64, _ := res.LastInsertId()
+
+	key, err := s.getBOAPIKey(r.Context(), a.ActiveRestaurantID, int(id64))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo API key")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "api_key", EntityID: key.ID, After: key})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"key":     key,
+		"token":   token,
+	})
+}
+
+func (s *Server) handleBOAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	before, err := s.getBOAPIKey(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "API key no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo API key")
+		return
+	}
+	if before.RevokedAt != nil {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "key": before})
+		return
+	}
+
+	if _, err := s.db.ExecContext(r.Context(), `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = ? AND restaurant_id = ? AND revoked_at IS NULL
+	`, id, a.ActiveRestaurantID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error revocando API key")
+		return
+	}
+	after, err := s.getBOAPIKey(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo API key")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditDelete, Entity: "api_key", EntityID: id, Before: before, After: after})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"key":     after,
+	})
+}
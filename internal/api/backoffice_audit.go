@@ -0,0 +1,540 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+const (
+	boAuditCreate = "create"
+	boAuditUpdate = "update"
+	boAuditDelete = "delete"
+)
+
+// boAuditEntry describes one backoffice mutation. Before and After are
+// marshalled to JSON as they are; pass nil for the side that doesn't exist.
+type boAuditEntry struct {
+	Action   string
+	Entity   string
+	EntityID any
+	Before   any
+	After    any
+}
+
+type boAuditRecord struct {
+	ID          int64           `json:"id"`
+	ActorUserID *int            `json:"actorUserId"`
+	ActorName   string          `json:"actorName"`
+	Action      string          `json:"action"`
+	Entity      string          `json:"entity"`
+	EntityID    string          `json:"entityId"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Diff        json.RawMessage `json:"diff"`
+	IP          string          `json:"ip"`
+	CreatedAt   string          `json:"createdAt"`
+}
+
+// auditJSON marshals v, returning nil for nil or JSON null.
+func auditJSON(v any) []byte {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok && len(raw) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	return b
+}
+
+// boAuditDiff compares the top-level keys of two JSON objects and returns
+// {key: {before, after}} for the ones that changed. Creations and deletions
+// (one side missing) and non-object values produce no diff.
+func boAuditDiff(before, after []byte) map[string]any {
+	if len(before) == 0 || len(after) == 0 {
+		return nil
+	}
+	var b, a map[string]json.RawMessage
+	if json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil {
+		return nil
+	}
+	diff := map[string]any{}
+	for k, bv := range b {
+		av, ok := a[k]
+		if !ok {
+			diff[k] = map[string]any{"before": bv, "after": nil}
+			continue
+		}
+		if !jsonEqual(bv, av) {
+			diff[k] = map[string]any{"before": bv, "after": av}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = map[string]any{"before": nil, "after": av}
+		}
+	}
+	return diff
+}
+
+// jsonEqual compares two JSON values ignoring whitespace and key order.
+func jsonEqual(x, y json.RawMessage) bool {
+	if bytes.Equal(x, y) {
+		return true
+	}
+	var xv, yv any
+	if json.Unmarshal(x, &xv) != nil || json.Unmarshal(y, &yv) != nil {
+		return false
+	}
+	xb, _ := json.Marshal(xv)
+	yb, _ := json.Marshal(yv)
+	return bytes.Equal(xb, yb)
+}
+
+// recordBOAudit appends an audit_log row for a backoffice mutation made by
+// the session in r. It runs after the change is stored, so a failure is
+// logged rather than reported to the client.
+func (s *Server) recordBOAudit(r *http.Request, e boAuditEntry) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		return
+	}
+	before := auditJSON(e.Before)
+	after := auditJSON(e.After)
+	var diff []byte
+	if d := boAuditDiff(before, after); len(d) > 0 {
+		diff, _ = json.Marshal(d)
+	}
+	if e.Action == boAuditUpdate && before != nil && after != nil && diff == nil {
+		return // nothing changed
+	}
+	// Redact after diffing so a changed secret still shows up as changed.
+	before, after, diff = redactAuditSecrets(before), redactAuditSecrets(after), redactAuditSecrets(diff)
+
+	entityID := ""
+	if e.EntityID != nil {
+		entityID = fmt.Sprint(e.EntityID)
+	}
+	actorName := strings.TrimSpace(a.User.Name)
+	if actorName == "" {
+		actorName = a.User.Email
+	}
+	ip := clientIP(r)
+	if len(ip) > 64 {
+		ip = ip[:64]
+	}
+
+	if _, err := s.db.ExecContext(r.Context(), `
+		INSERT INTO audit_log (restaurant_id, actor_user_id, actor_name, action, entity, entity_id, before_json, after_json, diff_json, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.ActiveRestaurantID, a.User.ID, actorName, e.Action, e.Entity, nullableString(entityID),
+		nullableJSON(before), nullableJSON(after), nullableJSON(diff), nullableString(ip)); err != nil {
+		log.Printf("[audit] %s %s %s: %v", e.Action, e.Entity, entityID, err)
+	}
+}
+
+const boAuditRedacted = "[redacted]"
+
+// redactAuditSecrets replaces string values whose key names a token, secret
+// or password, at any depth, so credentials never reach the log.
+func redactAuditSecrets(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	var v any
+	if json.Unmarshal(b, &v) != nil {
+		return b
+	}
+	if !redactAuditValue(v, false) {
+		return b
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+// redactAuditValue redacts v in place and reports whether it changed. Under a
+// secret key every string is redacted, which covers diff {before, after}
+// pairs; flags such as n8nWebhookSecretSet stay readable.
+func redactAuditValue(v any, secret bool) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if _, ok := child.(string); ok && (secret || isAuditSecretKey(k)) {
+				t[k] = boAuditRedacted
+				changed = true
+				continue
+			}
+			if redactAuditValue(child, secret || isAuditSecretKey(k)) {
+				changed = true
+			}
+		}
+	case []any:
+		for i, child := range t {
+			if _, ok := child.(string); ok && secret {
+				t[i] = boAuditRedacted
+				changed = true
+				continue
+			}
+			if redactAuditValue(child, secret) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func isAuditSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	return strings.Contains(k, "token") || strings.Contains(k, "secret") || strings.Contains(k, "password")
+}
+
+func nullableJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// auditBOConfig records changes made through a config POST by snapshotting
+// the matching GET handler before and after it runs. The date comes from the
+// JSON body, as the config setters read it. Rejected writes leave both
+// snapshots equal and are skipped by recordBOAudit.
+func (s *Server) auditBOConfig(entity string, get http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				httpx.WriteError(w, http.StatusBadRequest, "Invalid body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var probe struct {
+				Date string `json:"date"`
+			}
+			_ = json.Unmarshal(body, &probe)
+			date := strings.TrimSpace(probe.Date)
+
+			snapshot := func() json.RawMessage {
+				gr := r.Clone(r.Context())
+				gr.Method = http.MethodGet
+				gr.Body = http.NoBody
+				gr.URL.RawQuery = ""
+				if date != "" {
+					gr.URL.RawQuery = url.Values{"date": {date}}.Encode()
+				}
+				rec := &boAuditRecorder{header: http.Header{}, status: http.StatusOK}
+				get(rec, gr)
+				if rec.status != http.StatusOK {
+					return nil
+				}
+				return rec.body.Bytes()
+			}
+
+			before := snapshot()
+			sw := &boAuditRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			if sw.status != http.StatusOK || before == nil {
+				return
+			}
+			s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: entity, EntityID: nullableString(date), Before: before, After: snapshot()})
+		})
+	}
+}
+
+// boAuditBodyLimit caps the request body auditBOWrite copies into a row.
+const boAuditBodyLimit = 64 << 10
+
+// auditBOWrite records successful writes on routes that have no before/after
+// snapshot of their own (menus, schedules, tables, website). The entity is
+// the route path without its parameters, joined with dots as the config
+// entities are; the id is the route parameters and After the JSON body the
+// actor sent. Error statuses and success:false responses are not recorded.
+func (s *Server) auditBOWrite(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body json.RawMessage
+			if r.Body != nil && isJSONContentType(r.Header.Get("Content-Type")) {
+				head, err := io.ReadAll(io.LimitReader(r.Body, boAuditBodyLimit+1))
+				if err != nil {
+					httpx.WriteError(w, http.StatusBadRequest, "Invalid body")
+					return
+				}
+				// The handler still reads the whole body, past the limit too.
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+				if len(head) <= boAuditBodyLimit && json.Valid(head) {
+					body = head
+				}
+			}
+
+			sw := &boAuditRecorder{ResponseWriter: w, status: http.StatusOK, keep: true}
+			next.ServeHTTP(sw, r)
+			if sw.status < 200 || sw.status >= 300 || boAuditResponseFailed(sw.body.Bytes()) {
+				return
+			}
+			entity, entityID := boAuditRouteEntity(chi.RouteContext(r.Context()))
+			s.recordBOAudit(r, boAuditEntry{Action: action, Entity: entity, EntityID: nullableString(entityID), After: body})
+		})
+	}
+}
+
+func isJSONContentType(ct string) bool {
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	return ct == "" || strings.HasPrefix(ct, "application/json")
+}
+
+// boAuditResponseFailed reports whether a 2xx body says success:false, as
+// many backoffice handlers answer validation errors.
+func boAuditResponseFailed(body []byte) bool {
+	var probe struct {
+		Success *bool `json:"success"`
+	}
+	if json.Unmarshal(body, &probe) != nil || probe.Success == nil {
+		return false
+	}
+	return !*probe.Success
+}
+
+// boAuditRouteEntity names a route for the log: "/menus/dia/dishes/{id}"
+// gives entity "menus.dia.dishes" and the id from the URL; several
+// parameters are joined with ":".
+func boAuditRouteEntity(rc *chi.Context) (entity, entityID string) {
+	if rc == nil {
+		return "", ""
+	}
+	pattern := rc.RoutePattern()
+	if i := strings.Index(pattern, "/admin/"); i >= 0 {
+		pattern = pattern[i+len("/admin/"):]
+	}
+	parts := []string{}
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "" || strings.HasPrefix(seg, "{") {
+			continue
+		}
+		parts = append(parts, seg)
+	}
+	ids := []string{}
+	for i, key := range rc.URLParams.Keys {
+		if key == "*" || i >= len(rc.URLParams.Values) {
+			continue
+		}
+		ids = append(ids, rc.URLParams.Values[i])
+	}
+	return strings.Join(parts, "."), strings.Join(ids, ":")
+}
+
+// boAuditRecorder captures the status of a wrapped response, or the whole
+// response when ResponseWriter is nil. With keep set it also copies up to
+// boAuditBodyLimit bytes of a wrapped response.
+type boAuditRecorder struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+	keep   bool
+}
+
+func (w *boAuditRecorder) Header() http.Header {
+	if w.ResponseWriter != nil {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *boAuditRecorder) WriteHeader(status int) {
+	w.status = status
+	if w.ResponseWriter != nil {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *boAuditRecorder) Write(b []byte) (int, error) {
+	if w.ResponseWriter != nil {
+		if w.keep && w.body.Len() < boAuditBodyLimit {
+			w.body.Write(b[:min(len(b), boAuditBodyLimit-w.body.Len())])
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Handle list of audit entries for the active restaurant, newest first.
+// Filters: entity, entityId, action, actorUserId, from/to (YYYY-MM-DD,
+// inclusive), beforeId for paging, limit.
+func (s *Server) handleBOAuditList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	query := `
+		SELECT id, actor_user_id, actor_name, action, entity, entity_id, before_json, after_json, diff_json, ip, created_at
+		FROM audit_log
+		WHERE restaurant_id = ?`
+	args := []any{a.ActiveRestaurantID}
+
+	if v := strings.TrimSpace(q.Get("entity")); v != "" {
+		query += " AND entity = ?"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(q.Get("entityId")); v != "" {
+		query += " AND entity_id = ?"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(q.Get("action")); v != "" {
+		query += " AND action = ?"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(q.Get("actorUserId")); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			httpx.WriteError(w, http.StatusBadRequest, "actorUserId invalido")
+			return
+		}
+		query += " AND actor_user_id = ?"
+		args = append(args, id)
+	}
+	if v := strings.TrimSpace(q.Get("from")); v != "" {
+		if !isValidISODate(v) {
+			httpx.WriteError(w, http.StatusBadRequest, "from invalido")
+			return
+		}
+		query += " AND created_at >= ?"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(q.Get("to")); v != "" {
+		if !isValidISODate(v) {
+			httpx.WriteError(w, http.StatusBadRequest, "to invalido")
+			return
+		}
+		query += " AND created_at < DATE_ADD(?, INTERVAL 1 DAY)"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(q.Get("beforeId")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			httpx.WriteError(w, http.StatusBadRequest, "beforeId invalido")
+			return
+		}
+		query += " AND id < ?"
+		args = append(args, id)
+	}
+	limit := clampInt(q.Get("limit"), 1, 200, 50)
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando auditoria")
+		return
+	}
+	defer rows.Close()
+
+	entries := []boAuditRecord{}
+	for rows.Next() {
+		var (
+			e                   boAuditRecord
+			actorID             sql.NullInt64
+			actorName, entityID sql.NullString
+			before, after, diff sql.NullString
+			ip                  sql.NullString
+			createdAt           sql.NullTime
+		)
+		if err := rows.Scan(&e.ID, &actorID, &actorName, &e.Action, &e.Entity, &entityID, &before, &after, &diff, &ip, &createdAt); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo auditoria")
+			return
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorUserID = &id
+		}
+		e.ActorName = actorName.String
+		e.EntityID = entityID.String
+		e.Before = rawJSONOrNull(before)
+		e.After = rawJSONOrNull(after)
+		e.Diff = rawJSONOrNull(diff)
+		e.IP = ip.String
+		if createdAt.Valid {
+			e.CreatedAt = createdAt.Time.Format(time.RFC3339)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo auditoria")
+		return
+	}
+
+	var nextBeforeID *int64
+	if len(entries) == limit {
+		nextBeforeID = &entries[len(entries)-1].ID
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":      true,
+		"entries":      entries,
+		"nextBeforeId": nextBeforeID,
+	})
+}
+
+// Handle list of entity names present in the log, for the filter dropdown.
+func (s *Server) handleBOAuditEntities(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), "SELECT DISTINCT entity FROM audit_log WHERE restaurant_id = ?", a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando auditoria")
+		return
+	}
+	defer rows.Close()
+
+	entities := []string{}
+	for rows.Next() {
+		var entity string
+		if err := rows.Scan(&entity); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo auditoria")
+			return
+		}
+		entities = append(entities, entity)
+	}
+	sort.Strings(entities)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"entities": entities,
+	})
+}
+
+func rawJSONOrNull(v sql.NullString) json.RawMessage {
+	if !v.Valid || v.String == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(v.String)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+func TestBOAuditDiff(t *testing.T) {
+	before := []byte(`{"a":1,"b":{"x":1,"y":2},"c":"same","gone":true}`)
+	after := []byte(`{"a":2,"b":{"y":2, "x":1},"c":"same","new":null}`)
+	diff := boAuditDiff(before, after)
+	if len(diff) != 3 {
+		t.Fatalf("diff = %v", diff)
+	}
+	for _, k := range []string{"a", "gone", "new"} {
+		if _, ok := diff[k]; !ok {
+			t.Errorf("missing key %q", k)
+		}
+	}
+	if boAuditDiff(nil, after) != nil {
+		t.Errorf("creation should have no diff")
+	}
+	if boAuditDiff([]byte(`[1]`), []byte(`[2]`)) != nil {
+		t.Errorf("non-objects should have no diff")
+	}
+}
+
+func TestAuditJSON(t *testing.T) {
+	if auditJSON(nil) != nil || auditJSON(json.RawMessage(nil)) != nil {
+		t.Errorf("nil should marshal to nil")
+	}
+	var p *struct{}
+	if auditJSON(p) != nil {
+		t.Errorf("nil pointer should marshal to nil")
+	}
+	if got := string(auditJSON(map[string]int{"a": 1})); got != `{"a":1}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestRedactAuditSecrets(t *testing.T) {
+	in := []byte(`{"uazapiToken":"tok","n8nWebhookSecretSet":true,"servers":[{"adminToken":"x","name":"a"}],"diff":{"password":{"before":"p1","after":"p2"}}}`)
+	var got map[string]any
+	if err := json.Unmarshal(redactAuditSecrets(in), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["uazapiToken"] != boAuditRedacted || got["n8nWebhookSecretSet"] != true {
+		t.Errorf("top level = %v", got)
+	}
+	if srv := got["servers"].([]any)[0].(map[string]any); srv["adminToken"] != boAuditRedacted || srv["name"] != "a" {
+		t.Errorf("nested = %v", srv)
+	}
+	if pw := got["diff"].(map[string]any)["password"].(map[string]any); pw["before"] != boAuditRedacted || pw["after"] != boAuditRedacted {
+		t.Errorf("diff = %v", pw)
+	}
+	if plain := []byte(`{"a":1}`); string(redactAuditSecrets(plain)) != `{"a":1}` {
+		t.Errorf("unchanged input was rewritten")
+	}
+}
+
+func TestBOAuditRouteEntity(t *testing.T) {
+	rc := chi.NewRouteContext()
+	rc.RoutePatterns = []string{"/admin/*", "/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}/image"}
+	rc.URLParams.Add("id", "3")
+	rc.URLParams.Add("sectionId", "5")
+	rc.URLParams.Add("dishId", "7")
+	entity, id := boAuditRouteEntity(rc)
+	if entity != "group-menus-v2.sections.dishes.image" || id != "3:5:7" {
+		t.Fatalf("got %q, %q", entity, id)
+	}
+}
+
+func TestAuditBOWriteKeepsBodyAndSkipsFailures(t *testing.T) {
+	s := &Server{}
+	big := `{"name":"` + strings.Repeat("x", boAuditBodyLimit) + `"}`
+	var read string
+	h := s.auditBOWrite(boAuditCreate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		read = string(b)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/platos", strings.NewReader(big)))
+	if read != big {
+		t.Fatalf("handler read %d bytes, want %d", len(read), len(big))
+	}
+
+	if !boAuditResponseFailed([]byte(`{"message":"no","success":false}`)) {
+		t.Errorf("success:false not detected")
+	}
+	if boAuditResponseFailed([]byte(`{"success":true}`)) || boAuditResponseFailed([]byte(`{"id":1}`)) {
+		t.Errorf("successful response treated as failure")
+	}
+}
@@ -67,6 +67,15 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+	if wait, err := s.boLoginThrottleWait(r.Context(), boLoginScopeIP, ip); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error comprobando intentos de acceso")
+		return
+	} else if wait > 0 {
+		writeBOLoginThrottled(w, wait)
+		return
+	}
+
 	var (
 		userID             int
 		dbEmail            string
@@ -75,6 +84,7 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 		hash               string
 		isSuper            int
 		mustChangePassword int
+		totpEnabled        int
 	)
 	err := s.db.QueryRowContext(r.Context(), `
 		SELECT
@@ -84,7 +94,8 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 			name,
 			password_hash,
 			is_superadmin,
-			must_change_password
+			must_change_password,
+			totp_enabled_at IS NOT NULL
 		FROM bo_users
 		WHERE LOWER(TRIM(email)) = LOWER(TRIM(?))
 			OR LOWER(TRIM(COALESCE(username, ''))) = LOWER(TRIM(?))
@@ -94,28 +105,65 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 				ELSE 1
 			END ASC
 		LIMIT 1
-	`, identifier, identifier, identifier).Scan(&userID, &dbEmail, &dbUsername, &name, &hash, &isSuper, &mustChangePassword)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			httpx.WriteJSON(w, http.StatusOK, map[string]any{
-				"success": false,
-				"message": "Credenciales invalidas",
-			})
-			return
-		}
+	`, identifier, identifier, identifier).Scan(&userID, &dbEmail, &dbUsername, &name, &hash, &isSuper, &mustChangePassword, &totpEnabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo usuario")
 		return
 	}
+	unknownUser := err != nil
+
+	// Unknown identifiers are throttled too, so lockouts don't reveal which
+	// accounts exist.
+	accountKey := boLoginAccountKey(userID, identifier)
+	if wait, err := s.boLoginThrottleWait(r.Context(), boLoginScopeAccount, accountKey); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error comprobando intentos de acceso")
+		return
+	} else if wait > 0 {
+		writeBOLoginThrottled(w, wait)
+		return
+	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+	if unknownUser || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		s.recordBOLoginFailures(r.Context(), accountKey, userID, ip)
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{
 			"success": false,
 			"message": "Credenciales invalidas",
 		})
 		return
 	}
+	// With 2FA the counter is only cleared once the code is accepted, so
+	// failed codes can't be reset by entering the password again.
+	if totpEnabled != 0 {
+		s.writeBOTwoFactorChallenge(w, r, userID)
+		return
+	}
+	s.clearBOLoginFailures(r.Context(), accountKey)
+
+	s.startBOSession(w, r, boLoginUser{
+		ID:                 userID,
+		Email:              dbEmail,
+		Username:           strings.TrimSpace(dbUsername.String),
+		Name:               name,
+		IsSuperadmin:       isSuper != 0,
+		MustChangePassword: mustChangePassword != 0,
+	})
+}
+
+type boLoginUser struct {
+	ID                 int
+	Email              string
+	Username           string
+	Name               string
+	IsSuperadmin       bool
+	MustChangePassword bool
+	TwoFactorEnabled   bool
+}
 
-	restaurants, err := s.listUserRestaurants(r.Context(), userID, isSuper != 0)
+// startBOSession creates the session of an authenticated user and writes the
+// login response. Users with 2FA only get here through the TOTP step, so
+// their sessions start verified.
+func (s *Server) startBOSession(w http.ResponseWriter, r *http.Request, u boLoginUser) {
+	restaurants, err := s.listUserRestaurants(r.Context(), u.ID, u.IsSuperadmin)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo restaurantes")
 		return
@@ -129,7 +177,7 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	activeRestaurantID := restaurants[0].ID
-	roleSlug, err := s.getBOUserRoleForRestaurant(r.Context(), userID, activeRestaurantID, isSuper != 0)
+	roleSlug, err := s.getBOUserRoleForRestaurant(r.Context(), u.ID, activeRestaurantID, u.IsSuperadmin)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo rol")
 		return
@@ -159,10 +207,14 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 		ua = ua[:250]
 	}
 
+	var mfaVerifiedAt any
+	if u.TwoFactorEnabled {
+		mfaVerifiedAt = time.Now()
+	}
 	_, err = s.db.ExecContext(r.Context(), `
-		INSERT INTO bo_sessions (token_sha256, user_id, active_restaurant_id, expires_at, ip, user_agent)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, tokenSHA, userID, activeRestaurantID, expiresAt, ip, ua)
+		INSERT INTO bo_sessions (token_sha256, user_id, active_restaurant_id, expires_at, ip, user_agent, mfa_verified_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, tokenSHA, u.ID, activeRestaurantID, expiresAt, ip, ua, mfaVerifiedAt)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando sesion")
 		return
@@ -173,14 +225,16 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 
 	sess := boSession{
 		User: boUser{
-			ID:             userID,
-			Email:          dbEmail,
-			Username:       strings.TrimSpace(dbUsername.String),
-			Name:           name,
-			Role:           roleSlug,
-			RoleImportance: roleImportance,
-			SectionAccess:  sectionAccess,
-			MustChangePass: mustChangePassword != 0,
+			ID:                u.ID,
+			Email:             u.Email,
+			Username:          u.Username,
+			Name:              u.Name,
+			Role:              roleSlug,
+			RoleImportance:    roleImportance,
+			SectionAccess:     sectionAccess,
+			MustChangePass:    u.MustChangePassword,
+			TwoFactorEnabled:  u.TwoFactorEnabled,
+			TwoFactorRequired: s.boTwoFactorRequired(roleImportance),
 		},
 		Restaurants:        restaurants,
 		ActiveRestaurantID: activeRestaurantID,
@@ -195,24 +249,29 @@ func (s *Server) handleBOLogin(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleBOLogout(w http.ResponseWriter, r *http.Request) {
 	// Idempotent: always clear cookie.
 	if c, err := r.Cookie(boSessionCookieName); err == nil && strings.TrimSpace(c.Value) != "" {
-		_, _ = s.db.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE token_sha256 = ?", sha256Hex(c.Value))
+		tokenSHA := sha256Hex(strings.TrimSpace(c.Value))
+		_, _ = s.db.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE token_sha256 = ?", tokenSHA)
+		s.authCache.dropSession(tokenSHA)
 	}
 
-	secure := boSessionCookieSecure(r)
+	clearBOSessionCookie(w, r)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+	})
+}
+
+func clearBOSessionCookie(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     boSessionCookieName,
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   secure,
+		Secure:   boSessionCookieSecure(r),
 		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Unix(0, 0),
 		MaxAge:   -1,
 	})
-
-	httpx.WriteJSON(w, http.StatusOK, map[string]any{
-		"success": true,
-	})
 }
 
 func (s *Server) handleBOMe(w http.ResponseWriter, r *http.Request) {
@@ -239,6 +298,7 @@ func (s *Server) handleBOMe(w http.ResponseWriter, r *http.Request) {
 	if activeID == 0 || !restaurantInList(restaurants, activeID) {
 		activeID = restaurants[0].ID
 		_, _ = s.db.ExecContext(r.Context(), "UPDATE bo_sessions SET active_restaurant_id = ? WHERE id = ?", activeID, a.SessionID)
+		s.authCache.dropSession(a.TokenSHA256)
 	}
 	roleSlug, err := s.getBOUserRoleForRestaurant(r.Context(), a.User.ID, activeID, a.User.isSuperadmin)
 	if err != nil {
@@ -260,14 +320,16 @@ func (s *Server) handleBOMe(w http.ResponseWriter, r *http.Request) {
 		"success": true,
 		"session": boSession{
 			User: boUser{
-				ID:             a.User.ID,
-				Email:          a.User.Email,
-				Username:       a.User.Username,
-				Name:           a.User.Name,
-				Role:           roleSlug,
-				RoleImportance: roleImportance,
-				SectionAccess:  sectionAccess,
-				MustChangePass: a.User.MustChangePass,
+				ID:                a.User.ID,
+				Email:             a.User.Email,
+				Username:          a.User.Username,
+				Name:              a.User.Name,
+				Role:              roleSlug,
+				RoleImportance:    roleImportance,
+				SectionAccess:     sectionAccess,
+				MustChangePass:    a.User.MustChangePass,
+				TwoFactorEnabled:  a.User.TwoFactorEnabled,
+				TwoFactorRequired: s.boTwoFactorRequired(roleImportance),
 			},
 			Restaurants:        restaurants,
 			ActiveRestaurantID: activeID,
@@ -350,13 +412,23 @@ func (s *Server) handleBOSetPassword(w http.ResponseWriter, r *http.Request) {
 			AND expires_at > NOW()
 	`, a.User.ID)
 
+	// A new password signs out every other device.
+	res, err := tx.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE user_id = ? AND id <> ?", a.User.ID, a.SessionID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cerrando sesiones")
+		return
+	}
+	revoked, _ := res.RowsAffected()
+
 	if err := tx.Commit(); err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando password")
 		return
 	}
+	s.invalidateBOUserAuth(a.User.ID)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
-		"success": true,
+		"success":         true,
+		"revokedSessions": revoked,
 	})
 }
 
@@ -400,6 +472,7 @@ func (s *Server) handleBOSetActiveRestaurant(w http.ResponseWriter, r *http.Requ
 		httpx.WriteError(w, http.StatusInternalServerError, "Error actualizando sesion")
 		return
 	}
+	s.authCache.dropSession(a.TokenSHA256)
 	roleSlug, err := s.getBOUserRoleForRestaurant(r.Context(), a.User.ID, req.RestaurantID, a.User.isSuperadmin)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo rol")
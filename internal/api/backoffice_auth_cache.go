@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// boAuthCache keeps what requireBOSession needs for a few seconds, so the
+// dashboards that poll every couple of seconds don't run the session join
+// and both role queries on every request. Writes that change a session,
+// its user or a role drop the affected entries; other instances catch up
+// when the TTL runs out.
+type boAuthCache struct {
+	mu       sync.RWMutex
+	sessions map[string]boSessionCacheEntry
+	roles    map[string]boRoleCacheEntry
+}
+
+type boSessionCacheEntry struct {
+	SessionID          int64
+	UserID             int
+	ActiveRestaurantID int
+	Email              string
+	Username           string
+	Name               string
+	IsSuperadmin       bool
+	MustChangePassword bool
+	Role               string
+	HasRole            bool
+	TwoFactorEnabled   bool
+	MFAVerifiedAt      time.Time // zero when the session never verified
+	ExpiresAt          time.Time // as stored in bo_sessions
+	cachedAt           time.Time
+}
+
+type boRoleCacheEntry struct {
+	importance int
+	sections   []string
+	cachedAt   time.Time
+}
+
+func (c *boAuthCache) getSession(tokenSHA string, now time.Time, ttl time.Duration) (boSessionCacheEntry, bool) {
+	if ttl <= 0 {
+		return boSessionCacheEntry{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ent, ok := c.sessions[tokenSHA]
+	if !ok || now.Sub(ent.cachedAt) >= ttl || !now.Before(ent.ExpiresAt) {
+		return boSessionCacheEntry{}, false
+	}
+	return ent, true
+}
+
+func (c *boAuthCache) setSession(tokenSHA string, ent boSessionCacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions = make(map[string]boSessionCacheEntry)
+	}
+	ent.cachedAt = now
+	c.sessions[tokenSHA] = ent
+}
+
+// touchSession records a heartbeat write without restarting the entry's TTL.
+func (c *boAuthCache) touchSession(tokenSHA string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ent, ok := c.sessions[tokenSHA]; ok {
+		ent.ExpiresAt = expiresAt
+		c.sessions[tokenSHA] = ent
+	}
+}
+
+func (c *boAuthCache) dropSession(tokenSHA string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, tokenSHA)
+}
+
+func (c *boAuthCache) dropUser(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, ent := range c.sessions {
+		if ent.UserID == userID {
+			delete(c.sessions, k)
+		}
+	}
+}
+
+func (c *boAuthCache) getRole(slug string, now time.Time, ttl time.Duration) (int, []string, bool) {
+	if ttl <= 0 {
+		return 0, nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ent, ok := c.roles[slug]
+	if !ok || now.Sub(ent.cachedAt) >= ttl {
+		return 0, nil, false
+	}
+	return ent.importance, slices.Clone(ent.sections), true
+}
+
+func (c *boAuthCache) setRole(slug string, importance int, sections []string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roles == nil {
+		c.roles = make(map[string]boRoleCacheEntry)
+	}
+	c.roles[slug] = boRoleCacheEntry{
+		importance: importance,
+		sections:   slices.Clone(sections),
+		cachedAt:   now,
+	}
+}
+
+// dropRoles forgets every role. Role edits are rare, and a permission change
+// on one role can matter to sessions holding any of them.
+func (c *boAuthCache) dropRoles() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roles = nil
+}
+
+// purge removes stale entries so revoked tokens don't pile up.
+func (c *boAuthCache) purge(now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, ent := range c.sessions {
+		if now.Sub(ent.cachedAt) >= ttl || !now.Before(ent.ExpiresAt) {
+			delete(c.sessions, k)
+		}
+	}
+	for k, ent := range c.roles {
+		if now.Sub(ent.cachedAt) >= ttl {
+			delete(c.roles, k)
+		}
+	}
+}
+
+// boSessionHeartbeatDue reports whether the renewed expiry moved far enough
+// from the stored one to be worth an UPDATE. Shrinking past the threshold
+// (a high-security page after a normal one) is written as well.
+func boSessionHeartbeatDue(stored, renewed time.Time, threshold time.Duration) bool {
+	if threshold <= 0 {
+		return true
+	}
+	d := renewed.Sub(stored)
+	return d >= threshold || d <= -threshold
+}
+
+// resolveBORole returns the importance and sections of a role, cached.
+func (s *Server) resolveBORole(ctx context.Context, slug string) (int, []string, error) {
+	now := time.Now()
+	if importance, sections, ok := s.authCache.getRole(slug, now, s.cfg.BOAuthCacheTTL); ok {
+		return importance, sections, nil
+	}
+	importance, err := s.roleImportance(ctx, slug)
+	if err != nil {
+		return 0, nil, err
+	}
+	sections, err := s.roleSections(ctx, slug)
+	if err != nil {
+		return 0, nil, err
+	}
+	if s.cfg.BOAuthCacheTTL > 0 {
+		s.authCache.setRole(slug, importance, sections, now)
+	}
+	return importance, sections, nil
+}
+
+// invalidateBOUserAuth must follow any write to a user's sessions, 2FA
+// state, profile or restaurant role.
+func (s *Server) invalidateBOUserAuth(userID int) {
+	s.authCache.dropUser(userID)
+}
+
+// invalidateBORoles must follow any write to bo_roles or bo_role_permissions.
+func (s *Server) invalidateBORoles() {
+	s.authCache.dropRoles()
+}
+
+func (s *Server) runBOAuthCachePurgeLoop(ctx context.Context) {
+	ttl := s.cfg.BOAuthCacheTTL
+	if ttl <= 0 {
+		return
+	}
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.authCache.purge(now, ttl)
+		}
+	}
+}
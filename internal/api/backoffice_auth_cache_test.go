@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBOSessionHeartbeatDue(t *testing.T) {
+	stored := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	threshold := time.Minute
+	if boSessionHeartbeatDue(stored, stored.Add(30*time.Second), threshold) {
+		t.Errorf("small extension should not write")
+	}
+	if !boSessionHeartbeatDue(stored, stored.Add(time.Minute), threshold) {
+		t.Errorf("extension at threshold should write")
+	}
+	if !boSessionHeartbeatDue(stored, stored.Add(-2*time.Hour), threshold) {
+		t.Errorf("shrinking to a high-security TTL should write")
+	}
+	if !boSessionHeartbeatDue(stored, stored, 0) {
+		t.Errorf("zero threshold always writes")
+	}
+}
+
+func TestBOAuthCacheSessions(t *testing.T) {
+	var c boAuthCache
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 10 * time.Second
+
+	c.setSession("a", boSessionCacheEntry{UserID: 1, ExpiresAt: now.Add(time.Hour)}, now)
+	c.setSession("b", boSessionCacheEntry{UserID: 2, ExpiresAt: now.Add(5 * time.Second)}, now)
+
+	if _, ok := c.getSession("a", now.Add(9*time.Second), ttl); !ok {
+		t.Fatalf("fresh entry missed")
+	}
+	if _, ok := c.getSession("a", now.Add(ttl), ttl); ok {
+		t.Errorf("entry served past its TTL")
+	}
+	if _, ok := c.getSession("b", now.Add(6*time.Second), ttl); ok {
+		t.Errorf("entry served past the session expiry")
+	}
+	if _, ok := c.getSession("a", now, 0); ok {
+		t.Errorf("disabled cache served an entry")
+	}
+
+	c.dropUser(1)
+	if _, ok := c.getSession("a", now, ttl); ok {
+		t.Errorf("dropUser kept the user's session")
+	}
+	if _, ok := c.getSession("b", now, ttl); !ok {
+		t.Errorf("dropUser removed another user's session")
+	}
+}
+
+func TestBOAuthCacheRoles(t *testing.T) {
+	var c boAuthCache
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 10 * time.Second
+
+	c.setRole("admin", 90, []string{"reservas"}, now)
+	imp, sections, ok := c.getRole("admin", now, ttl)
+	if !ok || imp != 90 || len(sections) != 1 {
+		t.Fatalf("getRole = %d %v %v", imp, sections, ok)
+	}
+	sections[0] = "mutated"
+	if _, again, _ := c.getRole("admin", now, ttl); again[0] != "reservas" {
+		t.Errorf("cached sections shared with caller")
+	}
+
+	c.dropRoles()
+	if _, _, ok := c.getRole("admin", now, ttl); ok {
+		t.Errorf("dropRoles kept an entry")
+	}
+}
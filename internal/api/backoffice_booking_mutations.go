@@ -149,12 +149,18 @@ func (s *Server) handleBOBookingCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id, err := s.boInsertBooking(r.Context(), a.ActiveRestaurantID, booking)
+	var capErr *bookingCapacityError
+	if errors.As(err, &capErr) {
+		writeBookingCapacityError(w, http.StatusConflict, capErr)
+		return
+	}
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error creando booking")
 		return
 	}
 
 	out, err := s.boFetchBookingByID(r.Context(), a.ActiveRestaurantID, id)
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "booking", EntityID: id, After: out})
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{
 			"success": true,
@@ -168,7 +174,7 @@ func (s *Server) handleBOBookingCreate(w http.ResponseWriter, r *http.Request) {
 		"booking": out,
 	})
 
-	s.emitN8nWebhookAsync(a.ActiveRestaurantID, "booking.created", map[string]any{
+	s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventBookingCreated, map[string]any{
 		"source":               "backoffice",
 		"bookingId":            id,
 		"reservationDate":      booking.ReservationDate,
@@ -180,6 +186,7 @@ func (s *Server) handleBOBookingCreate(w http.ResponseWriter, r *http.Request) {
 		"specialMenu":          booking.SpecialMenu,
 		"menuDeGrupoId":        booking.MenuDeGrupoID,
 		"preferredFloorNumber": nullableInt64OrNil(booking.PreferredFloorNumber),
+		"guestLinks":           s.guestLinksForBooking(publicBaseURL(r), a.ActiveRestaurantID, id, booking.ReservationDate),
 	})
 }
 
@@ -359,12 +366,15 @@ func (s *Server) handleBOBookingPatch(w http.ResponseWriter, r *http.Request) {
 		next.ArrozServingsJSON = current["arroz_servings"]
 	}
 
+	before, _ := s.loadWebhookBookingSnapshot(r.Context(), a.ActiveRestaurantID, id)
 	if err := s.boUpdateBooking(r.Context(), a.ActiveRestaurantID, id, next); err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error actualizando booking")
 		return
 	}
+	s.emitBookingUpdatedWebhooks(r.Context(), a.ActiveRestaurantID, id, "backoffice", before)
 
 	out, err := s.boFetchBookingByID(r.Context(), a.ActiveRestaurantID, id)
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "booking", EntityID: id, Before: current, After: out})
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
 		return
@@ -675,6 +685,14 @@ func (s *Server) boInsertBooking(ctx context.Context, restaurantID int, b boNorm
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := s.enforceBookingCapacityTx(ctx, tx, restaurantID, bookingCapacityRequest{
+		ReservationDate: b.ReservationDate,
+		ReservationTime: b.ReservationTime,
+		PartySize:       b.PartySize,
+	}); err != nil {
+		return 0, err
+	}
+
 	res, err := tx.ExecContext(ctx, `
 		INSERT INTO bookings (
 			restaurant_id,
@@ -723,6 +741,7 @@ func (s *Server) boInsertBooking(ctx context.Context, restaurantID int, b boNorm
 	if err != nil {
 		return 0, err
 	}
+	s.linkNewBookingGuest(ctx, tx, restaurantID, id64, b.CustomerName, b.ContactPhoneCountryCode, b.ContactPhone, b.ContactEmail)
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
@@ -771,7 +790,11 @@ func (s *Server) boUpdateBooking(ctx context.Context, restaurantID int, id int,
 		restaurantID,
 		id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	s.relinkBookingGuest(ctx, restaurantID, id, b.CustomerName, b.ContactPhoneCountryCode, b.ContactPhone, b.ContactEmail)
+	return nil
 }
 
 func (s *Server) boFetchBookingsForExport(ctx context.Context, restaurantID int, date string) ([]map[string]any, error) {
@@ -912,7 +935,9 @@ func (s *Server) boFetchBookingByID(ctx context.Context, restaurantID int, id in
 			DATE_FORMAT(added_date, '%Y-%m-%d %H:%i:%s') AS added_date,
 			special_menu,
 			menu_de_grupo_id,
-			principales_json
+			principales_json,
+			attendance,
+			confirmation_required
 		FROM bookings
 		WHERE restaurant_id = ? AND id = ?
 		LIMIT 1
@@ -940,6 +965,8 @@ func (s *Server) boFetchBookingByID(ctx context.Context, restaurantID int, id in
 		specialMenu     sql.NullInt64
 		menuDeGrupoID   sql.NullInt64
 		principalesJSON sql.NullString
+		attendance      sql.NullString
+		confirmRequired bool
 	)
 	if err := row.Scan(
 		&bookingID,
@@ -963,6 +990,8 @@ func (s *Server) boFetchBookingByID(ctx context.Context, restaurantID int, id in
 		&specialMenu,
 		&menuDeGrupoID,
 		&principalesJSON,
+		&attendance,
+		&confirmRequired,
 	); err != nil {
 		return nil, err
 	}
@@ -991,6 +1020,8 @@ func (s *Server) boFetchBookingByID(ctx context.Context, restaurantID int, id in
 		"special_menu":               isSpecialMenu,
 		"menu_de_grupo_id":           nullInt64OrNil(menuDeGrupoID),
 		"principales_json":           nullStringOrNil(principalesJSON),
+		"attendance":                 nullStringOrNil(attendance),
+		"confirmation_required":      confirmRequired,
 	}, nil
 }
 
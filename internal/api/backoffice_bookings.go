@@ -132,6 +132,8 @@ func (s *Server) handleBOBookingsList(w http.ResponseWriter, r *http.Request) {
 		SpecialMenu     sql.NullInt64
 		MenuDeGrupoID   sql.NullInt64
 		PrincipalesJSON sql.NullString
+		Attendance      sql.NullString
+		ConfirmRequired bool
 	}
 
 	searchPrefixClause, searchPrefixArgs := buildBookingSearchPrefixClause(q)
@@ -177,7 +179,9 @@ func (s *Server) handleBOBookingsList(w http.ResponseWriter, r *http.Request) {
 				DATE_FORMAT(added_date, '%Y-%m-%d %H:%i:%s') AS added_date,
 				special_menu,
 				menu_de_grupo_id,
-				principales_json
+				principales_json,
+				attendance,
+				confirmation_required
 			FROM bookings
 		` + where + `
 			ORDER BY ` + orderBy + `
@@ -215,6 +219,8 @@ func (s *Server) handleBOBookingsList(w http.ResponseWriter, r *http.Request) {
 				&b.SpecialMenu,
 				&b.MenuDeGrupoID,
 				&b.PrincipalesJSON,
+				&b.Attendance,
+				&b.ConfirmRequired,
 			); err != nil {
 				return nil, 0, err
 			}
@@ -246,6 +252,8 @@ func (s *Server) handleBOBookingsList(w http.ResponseWriter, r *http.Request) {
 				"special_menu":               isSpecialMenu,
 				"menu_de_grupo_id":           nullInt64OrNil(b.MenuDeGrupoID),
 				"principales_json":           nullStringOrNil(b.PrincipalesJSON),
+				"attendance":                 nullStringOrNil(b.Attendance),
+				"confirmation_required":      b.ConfirmRequired,
 			})
 		}
 
@@ -367,7 +375,10 @@ func (s *Server) handleBOBookingCancel(w http.ResponseWriter, r *http.Request) {
 		PrincipalesJSON sql.NullString
 	}
 
-	var cancelled booking
+	var (
+		cancelled booking
+		guestID   int
+	)
 	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
 		var b booking
 		row := tx.QueryRowContext(ctx, `
@@ -440,6 +451,7 @@ func (s *Server) handleBOBookingCancel(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return err
 		}
+		guestID = carryBookingGuestTx(ctx, tx, restaurantID, b.ID)
 
 		res, err := tx.ExecContext(ctx, "DELETE FROM bookings WHERE id = ? AND restaurant_id = ?", bookingID, restaurantID)
 		if err != nil {
@@ -462,8 +474,17 @@ func (s *Server) handleBOBookingCancel(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error cancelando booking")
 		return
 	}
-
-	s.emitN8nWebhookAsync(restaurantID, "booking.cancelled", map[string]any{
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditDelete, Entity: "booking", EntityID: cancelled.ID, Before: map[string]any{
+		"reservation_date": cancelled.ReservationDate,
+		"reservation_time": cancelled.ReservationTime,
+		"party_size":       cancelled.PartySize,
+		"customer_name":    cancelled.CustomerName,
+		"contact_phone":    cancelled.ContactPhone.String,
+		"contact_email":    cancelled.ContactEmail.String,
+		"commentary":       cancelled.Commentary.String,
+	}})
+
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCancelled, map[string]any{
 		"source":          "backoffice_cancel",
 		"cancelledBy":     "staff",
 		"bookingId":       cancelled.ID,
@@ -474,6 +495,9 @@ func (s *Server) handleBOBookingCancel(w http.ResponseWriter, r *http.Request) {
 		"contactPhone":    cancelled.ContactPhone.String,
 		"contactEmail":    cancelled.ContactEmail.String,
 	})
+	s.offerWaitlistAsync(restaurantID, cancelled.ReservationDate)
+	s.settleBookingDepositAsync(restaurantID, cancelled.ID, cancelled.ReservationDate, cancelled.ReservationTime)
+	s.refreshGuestStatsAsync(restaurantID, guestID)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
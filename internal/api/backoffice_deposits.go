@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boConfigDepositRulesSetRequest struct {
+	Rules []depositRuleInput `json:"rules"`
+}
+
+type boPaymentAmountRequest struct {
+	AmountCents int `json:"amountCents"`
+}
+
+// handleBOConfigDepositRulesGet lists the restaurant's deposit rules in the
+// order they are matched.
+func (s *Server) handleBOConfigDepositRulesGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rules, err := s.loadDepositRules(r.Context(), s.db, a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando reglas de señal")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"rules":           rules,
+		"paymentsEnabled": s.payments != nil,
+	})
+}
+
+// handleBOConfigDepositRulesSet replaces the rule list. Payments already
+// opened keep the terms they were created with.
+func (s *Server) handleBOConfigDepositRulesSet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boConfigDepositRulesSetRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	rules, msg := normalizeDepositRules(req.Rules)
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	restaurantID := a.ActiveRestaurantID
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM deposit_rules WHERE restaurant_id = ?", restaurantID); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO deposit_rules (
+					restaurant_id, name, kind, min_party_size, group_menu_only, menu_de_grupo_id, date_from, date_to,
+					weekdays, amount_cents, per_person, refund_cutoff_hours, sort_order, is_active
+				)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, restaurantID, rule.Name, rule.Kind, nullablePositiveInt(rule.MinPartySize), rule.GroupMenuOnly,
+				nullablePositiveInt(rule.MenuDeGrupoID), nullableString(rule.DateFrom), nullableString(rule.DateTo),
+				nullableString(formatDepositWeekdays(rule.Weekdays)), rule.AmountCents, rule.PerPerson,
+				rule.RefundCutoffHours, rule.SortOrder, rule.Active); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando reglas de señal")
+		return
+	}
+
+	saved, err := s.loadDepositRules(r.Context(), s.db, restaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando reglas de señal")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"rules":           saved,
+		"paymentsEnabled": s.payments != nil,
+	})
+}
+
+// handleBOBookingPayments lists the payments of a booking. They outlive the
+// booking, so this also works for cancelled bookings.
+func (s *Server) handleBOBookingPayments(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	bookingID, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	payments, err := s.loadBookingPayments(r.Context(), "restaurant_id = ? AND booking_id = ?", a.ActiveRestaurantID, bookingID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando pagos")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"payments": payments,
+	})
+}
+
+// loadBOPaymentForAction reads the payment in the URL and the optional
+// {amountCents} body. It writes the error response itself.
+func (s *Server) loadBOPaymentForAction(w http.ResponseWriter, r *http.Request) (bookingPayment, int, bool) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return bookingPayment{}, 0, false
+	}
+	if s.payments == nil {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Pagos no configurados",
+		})
+		return bookingPayment{}, 0, false
+	}
+	paymentID, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return bookingPayment{}, 0, false
+	}
+	var req boPaymentAmountRequest
+	if r.ContentLength != 0 {
+		if err := readJSONBody(r, &req); err != nil {
+			httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "Invalid JSON",
+			})
+			return bookingPayment{}, 0, false
+		}
+	}
+	if req.AmountCents < 0 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Importe invalido",
+		})
+		return bookingPayment{}, 0, false
+	}
+
+	p, err := s.loadBookingPayment(r.Context(), "restaurant_id = ? AND id = ?", a.ActiveRestaurantID, paymentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Pago no encontrado")
+		return bookingPayment{}, 0, false
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando pago")
+		return bookingPayment{}, 0, false
+	}
+	if p.Provider != s.payments.Name() {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "El pago pertenece a otro proveedor",
+		})
+		return bookingPayment{}, 0, false
+	}
+	return p, req.AmountCents, true
+}
+
+// handleBOPaymentRefund refunds a paid deposit (fully, or amountCents of it)
+// or releases a card guarantee.
+func (s *Server) handleBOPaymentRefund(w http.ResponseWriter, r *http.Request) {
+	p, amount, ok := s.loadBOPaymentForAction(w, r)
+	if !ok {
+		return
+	}
+	if p.Status != paymentPaid && p.Status != paymentCaptured && p.Status != paymentAuthorized {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "El pago no se puede devolver en estado " + p.Status,
+		})
+		return
+	}
+	if err := s.returnPaymentFunds(r.Context(), p, amount, "backoffice"); errors.Is(err, errPaymentChanged) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": "El pago ha cambiado mientras se procesaba. Recarga e intentalo de nuevo",
+		})
+		return
+	} else if err != nil {
+		httpx.WriteJSON(w, http.StatusBadGateway, map[string]any{
+			"success": false,
+			"message": "Error del proveedor de pagos: " + err.Error(),
+		})
+		return
+	}
+	s.writeBOPaymentAction(w, r, p)
+}
+
+// handleBOPaymentCapture charges an authorised card guarantee, fully or
+// amountCents of it.
+func (s *Server) handleBOPaymentCapture(w http.ResponseWriter, r *http.Request) {
+	p, amount, ok := s.loadBOPaymentForAction(w, r)
+	if !ok {
+		return
+	}
+	if p.Status != paymentAuthorized {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Solo se pueden cobrar garantias autorizadas",
+		})
+		return
+	}
+	if err := s.captureBookingPayment(r.Context(), p, amount); err != nil {
+		httpx.WriteJSON(w, http.StatusBadGateway, map[string]any{
+			"success": false,
+			"message": "Error del proveedor de pagos: " + err.Error(),
+		})
+		return
+	}
+	s.writeBOPaymentAction(w, r, p)
+}
+
+func (s *Server) writeBOPaymentAction(w http.ResponseWriter, r *http.Request, before bookingPayment) {
+	after, err := s.loadBookingPayment(r.Context(), "id = ?", before.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando pago")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "booking_payment", EntityID: after.ID, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"payment": after,
+	})
+}
@@ -173,6 +173,21 @@ func (h *boFichajeHub) broadcast(restaurantID int, payload any) {
 	}
 }
 
+func (h *boFichajeHub) closeAll() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	rooms := h.rooms
+	h.rooms = map[int]map[*boFichajeClient]struct{}{}
+	h.mu.Unlock()
+	for _, room := range rooms {
+		for c := range room {
+			_ = c.closeGoingAway()
+		}
+	}
+}
+
 func (c *boFichajeClient) writeText(raw []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -195,6 +210,13 @@ func (c *boFichajeClient) ping() error {
 	return c.conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(7*time.Second))
 }
 
+func (c *boFichajeClient) closeGoingAway() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(2*time.Second))
+	return c.conn.Close()
+}
+
 func (c *boFichajeClient) close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -210,7 +232,7 @@ var boFichajeWSUpgrader = websocket.Upgrader{
 	},
 }
 
-func (s *Server) runBOFichajeAutoCutLoop() {
+func (s *Server) runBOFichajeAutoCutLoop(ctx context.Context) {
 	if s == nil || s.db == nil {
 		return
 	}
@@ -218,10 +240,14 @@ func (s *Server) runBOFichajeAutoCutLoop() {
 	defer ticker.Stop()
 
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
-		_ = s.autoCutOpenEntries(ctx)
+		runCtx, cancel := context.WithTimeout(ctx, 12*time.Second)
+		_ = s.autoCutOpenEntries(runCtx)
 		cancel()
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -313,6 +339,7 @@ func (s *Server) autoCutOpenEntries(ctx context.Context) error {
 			StartAtISO: startAt.Format(time.RFC3339),
 		}
 		s.broadcastBOFichajeEvent(restaurantID, "clock_stopped", active, nil)
+		s.emitN8nWebhookAsync(restaurantID, webhookEventFichajeClockStopped, fichajeStoppedWebhookPayload(active, "autocut", 0, cutoffAt))
 	}
 	return rows.Err()
 }
@@ -396,6 +423,7 @@ func (s *Server) handleBOFichajeStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	started := false
 	if active == nil {
 		now := time.Now().In(boMadridTZ)
 		dateISO := now.Format("2006-01-02")
@@ -418,6 +446,7 @@ func (s *Server) handleBOFichajeStart(w http.ResponseWriter, r *http.Request) {
 			StartTime:  startClock[:5],
 			StartAtISO: now.Format(time.RFC3339),
 		}
+		started = true
 	}
 
 	activeEntries, err := s.listBOActiveEntries(r.Context(), a.ActiveRestaurantID)
@@ -433,6 +462,9 @@ func (s *Server) handleBOFichajeStart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_started", state.ActiveEntry, nil)
+	if started {
+		s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventFichajeClockStarted, fichajeWebhookPayload(active, "clock", a.User.ID))
+	}
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -499,6 +531,7 @@ func (s *Server) handleBOFichajeStop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_stopped", active, nil)
+	s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventFichajeClockStopped, fichajeStoppedWebhookPayload(active, "clock", a.User.ID, now))
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -547,6 +580,7 @@ func (s *Server) handleBOFichajeAdminStart(w http.ResponseWriter, r *http.Reques
 		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando fichaje")
 		return
 	}
+	started := false
 	if active == nil {
 		now := time.Now().In(boMadridTZ)
 		dateISO := now.Format("2006-01-02")
@@ -569,9 +603,14 @@ func (s *Server) handleBOFichajeAdminStart(w http.ResponseWriter, r *http.Reques
 			StartTime:  startClock[:5],
 			StartAtISO: now.Format(time.RFC3339),
 		}
+		started = true
 	}
 
 	s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_started", active, nil)
+	if started {
+		s.recordBOAudit(r, boAuditEntry{Action: "clock_start", Entity: "time_entry", EntityID: active.ID, After: active})
+		s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventFichajeClockStarted, fichajeWebhookPayload(active, "admin", a.User.ID))
+	}
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success":     true,
@@ -642,6 +681,12 @@ func (s *Server) handleBOFichajeAdminStop(w http.ResponseWriter, r *http.Request
 	}
 
 	s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_stopped", active, nil)
+	s.recordBOAudit(r, boAuditEntry{Action: "clock_stop", Entity: "time_entry", EntityID: active.ID, Before: active, After: map[string]any{
+		"memberId": active.MemberID,
+		"workDate": active.WorkDate,
+		"endTime":  now.Format("15:04"),
+	}})
+	s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventFichajeClockStopped, fichajeStoppedWebhookPayload(active, "admin", a.User.ID, now))
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success":     true,
@@ -814,20 +859,25 @@ func (s *Server) handleBOFichajeEntryPatch(w http.ResponseWriter, r *http.Reques
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo registro actualizado")
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "time_entry", EntityID: entryID, Before: current, After: updated})
 
 	if current.EndTime == nil && updated.EndTime != nil {
 		startAt, err := time.ParseInLocation("2006-01-02 15:04", current.WorkDate+" "+current.StartTime, boMadridTZ)
 		if err != nil {
 			startAt = time.Now().In(boMadridTZ)
 		}
-		s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_stopped", &boFichajeActiveEntry{
+		stopped := &boFichajeActiveEntry{
 			ID:         current.ID,
 			MemberID:   current.MemberID,
 			MemberName: current.MemberName,
 			WorkDate:   current.WorkDate,
 			StartTime:  current.StartTime,
 			StartAtISO: startAt.Format(time.RFC3339),
-		}, nil)
+		}
+		s.broadcastBOFichajeEvent(a.ActiveRestaurantID, "clock_stopped", stopped, nil)
+		if endAt, err := time.ParseInLocation("2006-01-02 15:04", current.WorkDate+" "+*updated.EndTime, boMadridTZ); err == nil {
+			s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventFichajeClockStopped, fichajeStoppedWebhookPayload(stopped, "entry_edit", a.User.ID, endAt))
+		}
 	}
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
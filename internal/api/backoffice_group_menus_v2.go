@@ -2037,6 +2037,24 @@ func (s *Server) handleBOGroupMenusV2Publish(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	var (
+		title    sql.NullString
+		price    sql.NullString
+		menuType sql.NullString
+	)
+	_ = s.db.QueryRowContext(r.Context(), `
+		SELECT menu_title, price, menu_type FROM menusDeGrupos WHERE id = ? AND restaurant_id = ?
+	`, menuID, a.ActiveRestaurantID).Scan(&title, &price, &menuType)
+	s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventMenuPublished, map[string]any{
+		"menuId":            menuID,
+		"menuTitle":         title.String,
+		"price":             price.String,
+		"menuType":          normalizeV2MenuType(menuType.String),
+		"sections":          sections,
+		"dishes":            dishes,
+		"publishedByUserId": a.User.ID,
+	})
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
 }
 
@@ -180,6 +180,21 @@ func (h *boGroupMenuV2AIHub) broadcast(restaurantID int, menuID int64, payload a
 	}
 }
 
+func (h *boGroupMenuV2AIHub) closeAll() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	rooms := h.rooms
+	h.rooms = map[string]map[*boGroupMenuV2AIClient]struct{}{}
+	h.mu.Unlock()
+	for _, room := range rooms {
+		for c := range room {
+			_ = c.closeGoingAway()
+		}
+	}
+}
+
 func (c *boGroupMenuV2AIClient) writeText(raw []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -202,6 +217,13 @@ func (c *boGroupMenuV2AIClient) ping() error {
 	return c.conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(7*time.Second))
 }
 
+func (c *boGroupMenuV2AIClient) closeGoingAway() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(2*time.Second))
+	return c.conn.Close()
+}
+
 func (c *boGroupMenuV2AIClient) close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boGuestPatchRequest struct {
+	Name      *string   `json:"name,omitempty"`
+	Email     *string   `json:"email,omitempty"`
+	Birthday  *string   `json:"birthday,omitempty"`
+	Tags      *[]string `json:"tags,omitempty"`
+	Allergies *string   `json:"allergies,omitempty"`
+	Notes     *string   `json:"notes,omitempty"`
+}
+
+type boGuestConsentRequest struct {
+	Channel string `json:"channel"`
+	Granted bool   `json:"granted"`
+}
+
+type boGuestMergeRequest struct {
+	GuestIDs []int `json:"guestIds"`
+}
+
+type boGuestBooking struct {
+	ID              int    `json:"id"`
+	ReservationDate string `json:"reservationDate"`
+	ReservationTime string `json:"reservationTime"`
+	PartySize       int    `json:"partySize"`
+	Status          string `json:"status"`
+	Attendance      string `json:"attendance,omitempty"`
+	Cancelled       bool   `json:"cancelled"`
+	CancelledBy     string `json:"cancelledBy,omitempty"`
+}
+
+// handleBOGuestsList searches guest profiles by name, email or phone prefix,
+// most recent visitors first.
+func (s *Server) handleBOGuestsList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	page := clampInt(q.Get("page"), 1, 1_000_000, 1)
+	count := clampInt(q.Get("count"), 1, 200, 50)
+
+	where := []string{"restaurant_id = ?", "merged_into_id IS NULL"}
+	args := []any{a.ActiveRestaurantID}
+	if term := strings.TrimSpace(q.Get("q")); term != "" {
+		prefix := term + "%"
+		clause := "name LIKE ? OR email LIKE ?"
+		args = append(args, prefix, strings.ToLower(prefix))
+		if digits := bookingSearchDigitsOnly(term); digits != "" {
+			clause += " OR phone_national LIKE ? OR phone_e164 LIKE ?"
+			args = append(args, digits+"%", digits+"%")
+		}
+		where = append(where, "("+clause+")")
+	}
+	if tag := strings.TrimSpace(q.Get("tag")); tag != "" {
+		quoted, _ := json.Marshal(tag)
+		where = append(where, "tags LIKE ?")
+		args = append(args, "%"+string(quoted)+"%")
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM guests WHERE "+cond, args...).Scan(&total); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando clientes")
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), "SELECT "+guestSelectColumns+" FROM guests WHERE "+cond+`
+		ORDER BY last_visit_date IS NULL, last_visit_date DESC, id DESC
+		LIMIT ? OFFSET ?`, append(args, count, (page-1)*count)...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando clientes")
+		return
+	}
+	defer rows.Close()
+
+	guests := []guestProfile{}
+	for rows.Next() {
+		g, err := scanGuestProfile(rows)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando clientes")
+			return
+		}
+		guests = append(guests, g)
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"guests":  guests,
+		"total":   total,
+		"page":    page,
+		"count":   count,
+	})
+}
+
+// handleBOGuestGet returns a guest with their bookings and cancellations,
+// newest first.
+func (s *Server) handleBOGuestGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	g, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+	if g.mergedIntoID > 0 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success":    false,
+			"message":    "Cliente fusionado",
+			"mergedInto": g.mergedIntoID,
+		})
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT id, DATE_FORMAT(reservation_date, '%Y-%m-%d'), TIME_FORMAT(reservation_time, '%H:%i'), party_size,
+			COALESCE(status, ''), COALESCE(attendance, ''), 0, ''
+		FROM bookings
+		WHERE restaurant_id = ? AND guest_id = ?
+		UNION ALL
+		SELECT booking_id, DATE_FORMAT(reservation_date, '%Y-%m-%d'), TIME_FORMAT(reservation_time, '%H:%i'), party_size,
+			'cancelled', '', 1, COALESCE(cancelled_by, '')
+		FROM cancelled_bookings
+		WHERE restaurant_id = ? AND guest_id = ?
+		ORDER BY 2 DESC, 3 DESC
+		LIMIT 100
+	`, a.ActiveRestaurantID, id, a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando reservas del cliente")
+		return
+	}
+	defer rows.Close()
+	bookings := []boGuestBooking{}
+	for rows.Next() {
+		var b boGuestBooking
+		if err := rows.Scan(&b.ID, &b.ReservationDate, &b.ReservationTime, &b.PartySize, &b.Status, &b.Attendance, &b.Cancelled, &b.CancelledBy); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando reservas del cliente")
+			return
+		}
+		bookings = append(bookings, b)
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"guest":    g,
+		"bookings": bookings,
+	})
+}
+
+// handleBOGuestPatch edits the staff-maintained fields of a guest. Phone
+// numbers are not editable: they are the key bookings are matched on.
+func (s *Server) handleBOGuestPatch(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	var req boGuestPatchRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	before, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.mergedIntoID > 0) {
+		httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+
+	after := before
+	if req.Name != nil {
+		after.Name = strings.TrimSpace(*req.Name)
+		if after.Name == "" || len(after.Name) > 255 {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Nombre invalido"})
+			return
+		}
+	}
+	if req.Email != nil {
+		after.Email = normalizeGuestEmail(*req.Email)
+		if after.Email == "" && strings.TrimSpace(*req.Email) != "" {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Email invalido"})
+			return
+		}
+	}
+	if req.Birthday != nil {
+		after.Birthday = nil
+		if v := strings.TrimSpace(*req.Birthday); v != "" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Fecha de nacimiento invalida"})
+				return
+			}
+			after.Birthday = &v
+		}
+	}
+	if req.Tags != nil {
+		tags, msg := normalizeGuestTags(*req.Tags)
+		if msg != "" {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+			return
+		}
+		after.Tags = tags
+	}
+	if req.Allergies != nil {
+		after.Allergies = strings.TrimSpace(*req.Allergies)
+	}
+	if req.Notes != nil {
+		after.Notes = strings.TrimSpace(*req.Notes)
+	}
+	if len(after.Allergies) > 2000 || len(after.Notes) > 5000 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Texto demasiado largo"})
+		return
+	}
+
+	tags, _ := json.Marshal(after.Tags)
+	if _, err := s.db.ExecContext(r.Context(), `
+		UPDATE guests SET name = ?, email = ?, birthday = ?, tags = ?, allergies = ?, notes = ? WHERE restaurant_id = ? AND id = ?
+	`, after.Name, nullableString(after.Email), after.Birthday, string(tags), nullableString(after.Allergies), nullableString(after.Notes),
+		a.ActiveRestaurantID, id); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando cliente")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "guest", EntityID: id, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"guest":   after,
+	})
+}
+
+// handleBOGuestMerge folds duplicate guests into the one in the URL.
+func (s *Server) handleBOGuestMerge(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	var req boGuestMergeRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	if len(req.GuestIDs) == 0 || len(req.GuestIDs) > 50 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Lista de clientes invalida"})
+		return
+	}
+
+	before, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+
+	if err := s.mergeGuests(r.Context(), a.ActiveRestaurantID, id, req.GuestIDs); err != nil {
+		var mergeErr *guestMergeError
+		if errors.As(err, &mergeErr) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": mergeErr.Message})
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+			return
+		}
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fusionando clientes")
+		return
+	}
+
+	after, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+	merged := make([]string, 0, len(req.GuestIDs))
+	for _, gid := range req.GuestIDs {
+		merged = append(merged, strconv.Itoa(gid))
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "guest", EntityID: id, Before: before, After: map[string]any{
+		"guest":  after,
+		"merged": strings.Join(merged, ","),
+	}})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"guest":   after,
+	})
+}
+
+// handleBOGuestConsentsGet lists a guest's marketing consent ledger, newest
+// first.
+func (s *Server) handleBOGuestConsentsGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	g, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+	entries, err := s.loadMarketingConsents(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando consentimientos")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":             true,
+		"marketingEmailAt":    g.MarketingEmailAt,
+		"marketingWhatsappAt": g.MarketingWhatsAppAt,
+		"entries":             entries,
+	})
+}
+
+// handleBOGuestConsentSet records a consent given or withdrawn through
+// staff, e.g. on the phone.
+func (s *Server) handleBOGuestConsentSet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	var req boGuestConsentRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	channel, ok := normalizeMarketingChannel(req.Channel)
+	if !ok {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Canal invalido"})
+		return
+	}
+
+	before, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.mergedIntoID > 0) {
+		httpx.WriteError(w, http.StatusNotFound, "Cliente no encontrado")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+	if req.Granted && ((channel == marketingChannelEmail && before.Email == "") || (channel == marketingChannelWhatsApp && before.PhoneE164 == "")) {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "El cliente no tiene contacto para ese canal"})
+		return
+	}
+
+	if err := recordMarketingConsent(r.Context(), s.db, a.ActiveRestaurantID, id, marketingConsentChange{
+		Channel:     channel,
+		Granted:     req.Granted,
+		Source:      marketingSourceBackoffice,
+		ActorUserID: a.User.ID,
+		IP:          clientIP(r),
+	}); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando consentimiento")
+		return
+	}
+	after, err := s.loadGuest(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando cliente")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "guest", EntityID: id, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"guest":   after,
+	})
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// Spanish NIF/CIF/NIE: 9 alphanumerics.
+var fiscalNIFRe = regexp.MustCompile(`^[A-Z0-9]{9}$`)
+
+type fiscalProfileInput struct {
+	IssuerNIF     string `json:"issuerNif"`
+	IssuerName    string `json:"issuerName"`
+	IssuerAddress string `json:"issuerAddress"`
+}
+
+// loadFiscalProfile returns the issuer identity of a restaurant; the zero
+// value when it has none yet.
+func (s *Server) loadFiscalProfile(ctx context.Context, restaurantID int) (fiscalProfileInput, error) {
+	var (
+		p       fiscalProfileInput
+		address sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT issuer_nif, issuer_name, issuer_address FROM restaurant_fiscal_profiles WHERE restaurant_id = ?
+	`, restaurantID).Scan(&p.IssuerNIF, &p.IssuerName, &address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiscalProfileInput{}, nil
+	}
+	p.IssuerAddress = address.String
+	return p, err
+}
+
+// Handle get fiscal profile (issuer identity used in fiscal records)
+func (s *Server) handleBOInvoiceFiscalProfileGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	p, err := s.loadFiscalProfile(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal profile: "+err.Error())
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":       true,
+		"issuerNif":     p.IssuerNIF,
+		"issuerName":    p.IssuerName,
+		"issuerAddress": p.IssuerAddress,
+		"submitter":     s.cfg.VerifactuSubmitter,
+	})
+}
+
+// Handle update fiscal profile. Existing records keep the identity they were
+// hashed with.
+func (s *Server) handleBOInvoiceFiscalProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input fiscalProfileInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	input.IssuerNIF = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(input.IssuerNIF), "-", ""))
+	input.IssuerName = strings.TrimSpace(input.IssuerName)
+	input.IssuerAddress = strings.TrimSpace(input.IssuerAddress)
+	if !fiscalNIFRe.MatchString(input.IssuerNIF) {
+		httpx.WriteError(w, http.StatusBadRequest, "issuerNif must be a valid NIF/CIF")
+		return
+	}
+	if input.IssuerName == "" || len([]rune(input.IssuerName)) > 120 {
+		httpx.WriteError(w, http.StatusBadRequest, "issuerName is required (max 120 chars)")
+		return
+	}
+	if len([]rune(input.IssuerAddress)) > 255 {
+		httpx.WriteError(w, http.StatusBadRequest, "issuerAddress is too long (max 255 chars)")
+		return
+	}
+
+	_, err := s.db.ExecContext(r.Context(), `
+		INSERT INTO restaurant_fiscal_profiles (restaurant_id, issuer_nif, issuer_name, issuer_address)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE issuer_nif = VALUES(issuer_nif), issuer_name = VALUES(issuer_name), issuer_address = VALUES(issuer_address)
+	`, a.ActiveRestaurantID, input.IssuerNIF, input.IssuerName, nullableString(input.IssuerAddress))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error saving fiscal profile: "+err.Error())
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":       true,
+		"issuerNif":     input.IssuerNIF,
+		"issuerName":    input.IssuerName,
+		"issuerAddress": input.IssuerAddress,
+	})
+}
+
+// Handle get fiscal record of an issued invoice
+func (s *Server) handleBOInvoiceFiscalRecordGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invoiceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	rec, err := s.loadFiscalRecord(r.Context(), a.ActiveRestaurantID, invoiceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Fiscal record not found")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal record: "+err.Error())
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"record":  rec,
+		"qrUrl":   fiscalQRURL(s.cfg.VerifactuQRBaseURL, rec),
+	})
+}
+
+// Handle submit fiscal record (retry after a failed submission)
+func (s *Server) handleBOInvoiceFiscalRecordSubmit(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invoiceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+	if s.fiscalSubmitter == nil {
+		httpx.WriteError(w, http.StatusConflict, "Fiscal submission is not configured")
+		return
+	}
+
+	err = s.submitFiscalRecord(r.Context(), a.ActiveRestaurantID, invoiceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Fiscal record not found")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadGateway, "Error submitting fiscal record: "+err.Error())
+		return
+	}
+
+	rec, err := s.loadFiscalRecord(r.Context(), a.ActiveRestaurantID, invoiceID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal record: "+err.Error())
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"record":  rec,
+	})
+}
+
+// Handle export fiscal records as registration XML
+func (s *Server) handleBOInvoiceFiscalRecordsExport(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	from := strings.TrimSpace(r.URL.Query().Get("from"))
+	to := strings.TrimSpace(r.URL.Query().Get("to"))
+	if (from != "" && !isValidISODate(from)) || (to != "" && !isValidISODate(to)) {
+		httpx.WriteError(w, http.StatusBadRequest, "from/to must be YYYY-MM-DD")
+		return
+	}
+
+	records, err := s.loadFiscalRecords(r.Context(), a.ActiveRestaurantID, from, to)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal records: "+err.Error())
+		return
+	}
+	if len(records) == 0 {
+		httpx.WriteError(w, http.StatusNotFound, "No fiscal records in range")
+		return
+	}
+	out, err := buildVerifactuXML(records, s.verifactuSystem())
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error building XML: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": fiscalRecordFilename(a.ActiveRestaurantID, from, to),
+	}))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out)
+}
+
+// Handle verify fiscal chain (recompute every hash and link)
+func (s *Server) handleBOInvoiceFiscalRecordsVerify(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	records, err := s.loadFiscalRecords(r.Context(), a.ActiveRestaurantID, "", "")
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal records: "+err.Error())
+		return
+	}
+
+	resp := map[string]any{
+		"success": true,
+		"records": len(records),
+		"valid":   true,
+	}
+	if badID := verifyFiscalChain(records); badID != 0 {
+		resp["valid"] = false
+		resp["firstInvalidRecordId"] = badID
+	}
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
@@ -44,8 +44,24 @@ type Invoice struct {
 	PdfURL                    *string `json:"pdf_url"`
 	CreatedAt                 string  `json:"created_at"`
 	UpdatedAt                 string  `json:"updated_at"`
+	InvoiceType               string  `json:"invoice_type"`
+	InvoiceNumber             *string `json:"invoice_number"`
+	IssuedAt                  *string `json:"issued_at"`
+	RectifiesInvoiceID        *int    `json:"rectifies_invoice_id"`
+	RectifiesInvoiceNumber    *string `json:"rectifies_invoice_number"`
+	RectificationReason       *string `json:"rectification_reason"`
+	TaxBase                   float64 `json:"tax_base"`
+	TaxAmount                 float64 `json:"tax_amount"`
+
+	// Only filled for single-invoice reads.
+	Lines        []InvoiceLine         `json:"lines,omitempty"`
+	TaxBreakdown []InvoiceTaxBreakdown `json:"tax_breakdown,omitempty"`
 }
 
+// Amount is ignored when Lines are given: totals are always computed
+// server-side from the lines. Without lines it is taken as a tax-included
+// total at the default rate (older clients).
+
 type InvoiceInput struct {
 	CustomerName              string  `json:"customer_name"`
 	CustomerSurname           *string `json:"customer_surname"`
@@ -69,6 +85,8 @@ type InvoiceInput struct {
 	ReservationDate           *string `json:"reservation_date"`
 	ReservationCustomerName   *string `json:"reservation_customer_name"`
 	ReservationPartySize      *int    `json:"reservation_party_size"`
+
+	Lines []InvoiceLineInput `json:"lines"`
 }
 
 type InvoiceListParams struct {
@@ -100,6 +118,65 @@ type Restaurant struct {
 	Avatar *string `json:"avatar"`
 }
 
+const invoiceSelectColumns = `
+	id, restaurant_id,
+	customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
+	customer_address_street, customer_address_number, customer_address_postal_code,
+	customer_address_city, customer_address_province, customer_address_country,
+	amount, payment_method, account_image_url, invoice_date, payment_date,
+	status, is_reservation, reservation_id, reservation_date,
+	reservation_customer_name, reservation_party_size, pdf_url,
+	created_at, updated_at,
+	invoice_type, invoice_number, issued_at, rectifies_invoice_id,
+	(SELECT o.invoice_number FROM invoices o WHERE o.id = invoices.rectifies_invoice_id),
+	rectification_reason, tax_base, tax_amount`
+
+type invoiceScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvoice(scanner invoiceScanner) (Invoice, error) {
+	var inv Invoice
+	err := scanner.Scan(
+		&inv.ID, &inv.RestaurantID,
+		&inv.CustomerName, &inv.CustomerSurname, &inv.CustomerEmail, &inv.CustomerDniCif, &inv.CustomerPhone,
+		&inv.CustomerAddressStreet, &inv.CustomerAddressNumber, &inv.CustomerAddressPostalCode,
+		&inv.CustomerAddressCity, &inv.CustomerAddressProvince, &inv.CustomerAddressCountry,
+		&inv.Amount, &inv.PaymentMethod, &inv.AccountImageURL, &inv.InvoiceDate, &inv.PaymentDate,
+		&inv.Status, &inv.IsReservation, &inv.ReservationID, &inv.ReservationDate,
+		&inv.ReservationCustomerName, &inv.ReservationPartySize, &inv.PdfURL,
+		&inv.CreatedAt, &inv.UpdatedAt,
+		&inv.InvoiceType, &inv.InvoiceNumber, &inv.IssuedAt, &inv.RectifiesInvoiceID,
+		&inv.RectifiesInvoiceNumber,
+		&inv.RectificationReason, &inv.TaxBase, &inv.TaxAmount,
+	)
+	return inv, err
+}
+
+// loadInvoice reads one invoice with its lines and VAT breakdown.
+func (s *Server) loadInvoice(ctx context.Context, restaurantID, invoiceID int) (Invoice, error) {
+	inv, err := scanInvoice(s.db.QueryRowContext(ctx, "SELECT "+invoiceSelectColumns+" FROM invoices WHERE id = ? AND restaurant_id = ?", invoiceID, restaurantID))
+	if err != nil {
+		return inv, err
+	}
+	inv.Lines, err = s.loadInvoiceLines(ctx, inv.ID)
+	if err != nil {
+		return inv, err
+	}
+	inv.TaxBreakdown = computeInvoiceTotals(inv.Lines).Breakdown
+	return inv, nil
+}
+
+// invoiceAuditSnapshot is loadInvoice for the audit log: nil when the
+// invoice can't be read.
+func (s *Server) invoiceAuditSnapshot(ctx context.Context, restaurantID, invoiceID int) any {
+	inv, err := s.loadInvoice(ctx, restaurantID, invoiceID)
+	if err != nil {
+		return nil
+	}
+	return inv
+}
+
 // Handle invoice list with filters
 func (s *Server) handleBOInvoicesList(w http.ResponseWriter, r *http.Request) {
 	a, ok := boAuthFromContext(r.Context())
@@ -146,8 +223,8 @@ func (s *Server) handleBOInvoicesList(w http.ResponseWriter, r *http.Request) {
 
 	if params.Search != "" {
 		prefix := params.Search + "%"
-		baseWhere += " AND (customer_name LIKE ? OR customer_email LIKE ?)"
-		args = append(args, prefix, prefix)
+		baseWhere += " AND (customer_name LIKE ? OR customer_email LIKE ? OR invoice_number LIKE ?)"
+		args = append(args, prefix, prefix, prefix)
 	}
 
 	if params.Status != "" {
@@ -194,17 +271,7 @@ func (s *Server) handleBOInvoicesList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	offset := (params.Page - 1) * params.Limit
-	query := `
-		SELECT 
-			id, restaurant_id,
-			customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
-			customer_address_street, customer_address_number, customer_address_postal_code,
-			customer_address_city, customer_address_province, customer_address_country,
-			amount, payment_method, account_image_url, invoice_date, payment_date,
-			status, is_reservation, reservation_id, reservation_date,
-			reservation_customer_name, reservation_party_size, pdf_url,
-			created_at, updated_at
-	` + baseWhere + orderBy + " LIMIT ? OFFSET ?"
+	query := "SELECT " + invoiceSelectColumns + baseWhere + orderBy + " LIMIT ? OFFSET ?"
 	queryArgs := append(append([]any{}, args...), params.Limit, offset)
 
 	// Execute query
@@ -217,17 +284,7 @@ func (s *Server) handleBOInvoicesList(w http.ResponseWriter, r *http.Request) {
 
 	var invoices []Invoice
 	for rows.Next() {
-		var inv Invoice
-		err := rows.Scan(
-			&inv.ID, &inv.RestaurantID,
-			&inv.CustomerName, &inv.CustomerSurname, &inv.CustomerEmail, &inv.CustomerDniCif, &inv.CustomerPhone,
-			&inv.CustomerAddressStreet, &inv.CustomerAddressNumber, &inv.CustomerAddressPostalCode,
-			&inv.CustomerAddressCity, &inv.CustomerAddressProvince, &inv.CustomerAddressCountry,
-			&inv.Amount, &inv.PaymentMethod, &inv.AccountImageURL, &inv.InvoiceDate, &inv.PaymentDate,
-			&inv.Status, &inv.IsReservation, &inv.ReservationID, &inv.ReservationDate,
-			&inv.ReservationCustomerName, &inv.ReservationPartySize, &inv.PdfURL,
-			&inv.CreatedAt, &inv.UpdatedAt,
-		)
+		inv, err := scanInvoice(rows)
 		if err != nil {
 			httpx.WriteError(w, http.StatusInternalServerError, "Error scanning invoice: "+err.Error())
 			return
@@ -264,29 +321,7 @@ func (s *Server) handleBOInvoiceGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var inv Invoice
-	err = s.db.QueryRowContext(r.Context(), `
-		SELECT 
-			id, restaurant_id,
-			customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
-			customer_address_street, customer_address_number, customer_address_postal_code,
-			customer_address_city, customer_address_province, customer_address_country,
-			amount, payment_method, account_image_url, invoice_date, payment_date,
-			status, is_reservation, reservation_id, reservation_date,
-			reservation_customer_name, reservation_party_size, pdf_url,
-			created_at, updated_at
-		FROM invoices
-		WHERE id = ? AND restaurant_id = ?
-	`, invoiceID, a.ActiveRestaurantID).Scan(
-		&inv.ID, &inv.RestaurantID,
-		&inv.CustomerName, &inv.CustomerSurname, &inv.CustomerEmail, &inv.CustomerDniCif, &inv.CustomerPhone,
-		&inv.CustomerAddressStreet, &inv.CustomerAddressNumber, &inv.CustomerAddressPostalCode,
-		&inv.CustomerAddressCity, &inv.CustomerAddressProvince, &inv.CustomerAddressCountry,
-		&inv.Amount, &inv.PaymentMethod, &inv.AccountImageURL, &inv.InvoiceDate, &inv.PaymentDate,
-		&inv.Status, &inv.IsReservation, &inv.ReservationID, &inv.ReservationDate,
-		&inv.ReservationCustomerName, &inv.ReservationPartySize, &inv.PdfURL,
-		&inv.CreatedAt, &inv.UpdatedAt,
-	)
+	inv, err := s.loadInvoice(r.Context(), a.ActiveRestaurantID, invoiceID)
 
 	if err == sql.ErrNoRows {
 		httpx.WriteError(w, http.StatusNotFound, "Invoice not found")
@@ -335,29 +370,47 @@ func (s *Server) handleBOInvoiceCreate(w http.ResponseWriter, r *http.Request) {
 		input.Status = "borrador"
 	}
 
-	result, err := s.db.ExecContext(r.Context(), `
-		INSERT INTO invoices (
-			restaurant_id, customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
-			customer_address_street, customer_address_number, customer_address_postal_code,
-			customer_address_city, customer_address_province, customer_address_country,
-			amount, payment_method, account_image_url, invoice_date, payment_date,
-			status, is_reservation, reservation_id, reservation_date,
-			reservation_customer_name, reservation_party_size
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, a.ActiveRestaurantID,
-		input.CustomerName, input.CustomerSurname, input.CustomerEmail, input.CustomerDniCif, input.CustomerPhone,
-		input.CustomerAddressStreet, input.CustomerAddressNumber, input.CustomerAddressPostalCode,
-		input.CustomerAddressCity, input.CustomerAddressProvince, input.CustomerAddressCountry,
-		input.Amount, input.PaymentMethod, input.AccountImageURL, input.InvoiceDate, input.PaymentDate,
-		input.Status, input.IsReservation, input.ReservationID, input.ReservationDate,
-		input.ReservationCustomerName, input.ReservationPartySize)
+	lines, err := invoiceLinesFromInput(input)
+	if err != nil {
+		writeInvoiceFiscalError(w, err)
+		return
+	}
+	totals := computeInvoiceTotals(lines)
+
+	var id int64
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO invoices (
+				restaurant_id, customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
+				customer_address_street, customer_address_number, customer_address_postal_code,
+				customer_address_city, customer_address_province, customer_address_country,
+				amount, tax_base, tax_amount, payment_method, account_image_url, invoice_date, payment_date,
+				status, invoice_type, is_reservation, reservation_id, reservation_date,
+				reservation_customer_name, reservation_party_size
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.ActiveRestaurantID,
+			input.CustomerName, input.CustomerSurname, input.CustomerEmail, input.CustomerDniCif, input.CustomerPhone,
+			input.CustomerAddressStreet, input.CustomerAddressNumber, input.CustomerAddressPostalCode,
+			input.CustomerAddressCity, input.CustomerAddressProvince, input.CustomerAddressCountry,
+			totals.Total, totals.TaxBase, totals.TaxAmount, input.PaymentMethod, input.AccountImageURL, input.InvoiceDate, input.PaymentDate,
+			input.Status, invoiceTypeOrdinary, input.IsReservation, input.ReservationID, input.ReservationDate,
+			input.ReservationCustomerName, input.ReservationPartySize)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return replaceInvoiceLinesTx(ctx, tx, a.ActiveRestaurantID, int(id), lines)
+	})
 
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error creating invoice: "+err.Error())
 		return
 	}
-
-	id, _ := result.LastInsertId()
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "invoice", EntityID: id,
+		After: s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, int(id))})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -399,27 +452,45 @@ func (s *Server) handleBOInvoiceUpdate(w http.ResponseWriter, r *http.Request) {
 		input.Status = "borrador"
 	}
 
-	_, err = s.db.ExecContext(r.Context(), `
-		UPDATE invoices SET
-			customer_name = ?, customer_surname = ?, customer_email = ?, customer_dni_cif = ?, customer_phone = ?,
-			customer_address_street = ?, customer_address_number = ?, customer_address_postal_code = ?,
-			customer_address_city = ?, customer_address_province = ?, customer_address_country = ?,
-			amount = ?, payment_method = ?, account_image_url = ?, invoice_date = ?, payment_date = ?,
-			status = ?, is_reservation = ?, reservation_id = ?, reservation_date = ?,
-			reservation_customer_name = ?, reservation_party_size = ?
-		WHERE id = ? AND restaurant_id = ?
-	`, input.CustomerName, input.CustomerSurname, input.CustomerEmail, input.CustomerDniCif, input.CustomerPhone,
-		input.CustomerAddressStreet, input.CustomerAddressNumber, input.CustomerAddressPostalCode,
-		input.CustomerAddressCity, input.CustomerAddressProvince, input.CustomerAddressCountry,
-		input.Amount, input.PaymentMethod, input.AccountImageURL, input.InvoiceDate, input.PaymentDate,
-		input.Status, input.IsReservation, input.ReservationID, input.ReservationDate,
-		input.ReservationCustomerName, input.ReservationPartySize,
-		invoiceID, a.ActiveRestaurantID)
+	lines, err := invoiceLinesFromInput(input)
+	if err != nil {
+		writeInvoiceFiscalError(w, err)
+		return
+	}
+	totals := computeInvoiceTotals(lines)
+
+	before := s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, invoiceID)
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := lockDraftInvoiceTx(ctx, tx, a.ActiveRestaurantID, invoiceID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE invoices SET
+				customer_name = ?, customer_surname = ?, customer_email = ?, customer_dni_cif = ?, customer_phone = ?,
+				customer_address_street = ?, customer_address_number = ?, customer_address_postal_code = ?,
+				customer_address_city = ?, customer_address_province = ?, customer_address_country = ?,
+				amount = ?, tax_base = ?, tax_amount = ?, payment_method = ?, account_image_url = ?, invoice_date = ?, payment_date = ?,
+				status = ?, is_reservation = ?, reservation_id = ?, reservation_date = ?,
+				reservation_customer_name = ?, reservation_party_size = ?
+			WHERE id = ? AND restaurant_id = ?
+		`, input.CustomerName, input.CustomerSurname, input.CustomerEmail, input.CustomerDniCif, input.CustomerPhone,
+			input.CustomerAddressStreet, input.CustomerAddressNumber, input.CustomerAddressPostalCode,
+			input.CustomerAddressCity, input.CustomerAddressProvince, input.CustomerAddressCountry,
+			totals.Total, totals.TaxBase, totals.TaxAmount, input.PaymentMethod, input.AccountImageURL, input.InvoiceDate, input.PaymentDate,
+			input.Status, input.IsReservation, input.ReservationID, input.ReservationDate,
+			input.ReservationCustomerName, input.ReservationPartySize,
+			invoiceID, a.ActiveRestaurantID); err != nil {
+			return err
+		}
+		return replaceInvoiceLinesTx(ctx, tx, a.ActiveRestaurantID, invoiceID, lines)
+	})
 
 	if err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, "Error updating invoice: "+err.Error())
+		writeInvoiceFiscalError(w, err)
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "invoice", EntityID: invoiceID, Before: before,
+		After: s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, invoiceID)})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -441,20 +512,24 @@ func (s *Server) handleBOInvoiceDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := s.db.ExecContext(r.Context(), `
-		DELETE FROM invoices WHERE id = ? AND restaurant_id = ?
-	`, invoiceID, a.ActiveRestaurantID)
+	// Only drafts can be deleted; issued invoices keep their number and are
+	// corrected with POST /invoices/{id}/rectify.
+	before := s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, invoiceID)
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := lockDraftInvoiceTx(ctx, tx, a.ActiveRestaurantID, invoiceID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM invoices WHERE id = ? AND restaurant_id = ?
+		`, invoiceID, a.ActiveRestaurantID)
+		return err
+	})
 
 	if err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, "Error deleting invoice: "+err.Error())
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		httpx.WriteError(w, http.StatusNotFound, "Invoice not found")
+		writeInvoiceFiscalError(w, err)
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditDelete, Entity: "invoice", EntityID: invoiceID, Before: before})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -558,57 +633,98 @@ func (s *Server) handleBOInvoiceSend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get invoice
-	var inv Invoice
-	var restaurant Restaurant
-	err = s.db.QueryRowContext(r.Context(), `
-		SELECT 
-			i.id, i.restaurant_id,
-			i.customer_name, i.customer_surname, i.customer_email, i.customer_dni_cif, i.customer_phone,
-			i.customer_address_street, i.customer_address_number, i.customer_address_postal_code,
-			i.customer_address_city, i.customer_address_province, i.customer_address_country,
-			i.amount, i.payment_method, i.account_image_url, i.invoice_date, i.payment_date,
-			i.status, i.is_reservation, i.reservation_id, i.reservation_date,
-			i.reservation_customer_name, i.reservation_party_size, i.pdf_url,
-			i.created_at, i.updated_at,
-			r.id, r.slug, r.name, r.avatar
-		FROM invoices i
-		JOIN restaurants r ON i.restaurant_id = r.id
-		WHERE i.id = ? AND i.restaurant_id = ?
-	`, invoiceID, a.ActiveRestaurantID).Scan(
-		&inv.ID, &inv.RestaurantID,
-		&inv.CustomerName, &inv.CustomerSurname, &inv.CustomerEmail, &inv.CustomerDniCif, &inv.CustomerPhone,
-		&inv.CustomerAddressStreet, &inv.CustomerAddressNumber, &inv.CustomerAddressPostalCode,
-		&inv.CustomerAddressCity, &inv.CustomerAddressProvince, &inv.CustomerAddressCountry,
-		&inv.Amount, &inv.PaymentMethod, &inv.AccountImageURL, &inv.InvoiceDate, &inv.PaymentDate,
-		&inv.Status, &inv.IsReservation, &inv.ReservationID, &inv.ReservationDate,
-		&inv.ReservationCustomerName, &inv.ReservationPartySize, &inv.PdfURL,
-		&inv.CreatedAt, &inv.UpdatedAt,
-		&restaurant.ID, &restaurant.Slug, &restaurant.Name, &restaurant.Avatar,
-	)
-
-	if err == sql.ErrNoRows {
-		httpx.WriteError(w, http.StatusNotFound, "Invoice not found")
+	// Sending is what makes an invoice official: give it its number first so
+	// it appears on the PDF.
+	var number string
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		number, err = issueInvoiceTx(ctx, tx, a.ActiveRestaurantID, invoiceID)
+		return err
+	})
+	if err != nil {
+		writeInvoiceFiscalError(w, err)
 		return
 	}
+	s.submitFiscalRecordAsync(a.ActiveRestaurantID, invoiceID)
+
+	inv, err := s.loadInvoice(r.Context(), a.ActiveRestaurantID, invoiceID)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching invoice: "+err.Error())
 		return
 	}
+	restaurant, err := s.getRestaurant(r.Context(), a.ActiveRestaurantID)
+	if err != nil || restaurant == nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching restaurant")
+		return
+	}
 
-	// Generate PDF (placeholder - would need PDF generation library)
-	// For now, just update status to 'enviada'
-	pdfURL := fmt.Sprintf("https://villacarmenmedia.b-cdn.net/%d/facturas/pdf/pdf_%d.pdf", restaurant.ID, inv.ID)
+	branding, err := s.loadRestaurantBranding(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error loading branding: "+err.Error())
+		return
+	}
+
+	fiscal, err := s.loadFiscalProfile(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error fetching fiscal profile: "+err.Error())
+		return
+	}
+
+	doc := invoicePDFDocFromInvoice(inv, branding, restaurant.Name)
+	doc.Issuer = invoicePDFIssuer(fiscal)
+	doc.QRPayload = s.fiscalQRPayload(r.Context(), a.ActiveRestaurantID, invoiceID)
+	if doc.QRPayload != "" && s.fiscalSubmitter != nil {
+		doc.QRCaption = "VERI*FACTU"
+	}
+	pdf, err := renderInvoicePDF(doc)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error generating PDF: "+err.Error())
+		return
+	}
+
+	objectPath := fmt.Sprintf("%d/facturas/pdf/pdf_%d.pdf", restaurant.ID, inv.ID)
+	if err := s.bunnyPut(r.Context(), objectPath, pdf, "application/pdf"); err != nil {
+		httpx.WriteError(w, http.StatusBadGateway, "Error storing PDF: "+err.Error())
+		return
+	}
+	pdfURL := s.bunnyPullURL(objectPath)
+
+	// Keep the stored PDF linked even if the e-mail fails, so it can be downloaded.
+	if _, err := s.db.ExecContext(r.Context(), "UPDATE invoices SET pdf_url = ? WHERE id = ? AND restaurant_id = ?", pdfURL, invoiceID, a.ActiveRestaurantID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error updating invoice: "+err.Error())
+		return
+	}
+
+	if err := s.sendInvoiceEmail(r.Context(), inv, branding, restaurant.Name, pdf, pdfURL); err != nil {
+		httpx.WriteJSON(w, http.StatusBadGateway, map[string]any{
+			"success": false,
+			"message": "Error sending invoice e-mail: " + err.Error(),
+			"pdf_url": pdfURL,
+		})
+		return
+	}
 
 	_, err = s.db.ExecContext(r.Context(), `
-		UPDATE invoices SET status = 'enviada', pdf_url = ? WHERE id = ?
-	`, pdfURL, invoiceID)
+		UPDATE invoices SET status = 'enviada' WHERE id = ? AND restaurant_id = ?
+	`, invoiceID, a.ActiveRestaurantID)
 
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error updating invoice status: "+err.Error())
 		return
 	}
 
+	s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventInvoiceSent, map[string]any{
+		"invoiceId":     inv.ID,
+		"invoiceNumber": number,
+		"customerName":  inv.CustomerName,
+		"customerEmail": inv.CustomerEmail,
+		"amount":        inv.Amount,
+		"invoiceDate":   inv.InvoiceDate,
+		"isReservation": inv.IsReservation,
+		"reservationId": inv.ReservationID,
+		"pdfUrl":        pdfURL,
+	})
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
 		"message": "Invoice sent successfully",
@@ -616,6 +732,53 @@ func (s *Server) handleBOInvoiceSend(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// sendInvoiceEmail mails the PDF to the customer and records the attempt in
+// message_deliveries (channel "email", event "invoice.sent").
+func (s *Server) sendInvoiceEmail(ctx context.Context, inv Invoice, branding restaurantBrandingCfg, restaurantName string, pdf []byte, pdfURL string) error {
+	brand := strings.TrimSpace(branding.BrandName)
+	if brand == "" {
+		brand = restaurantName
+	}
+	fromName := strings.TrimSpace(branding.EmailFromName)
+	if fromName == "" {
+		fromName = brand
+	}
+
+	number := invoiceDisplayNumber(inv)
+	subject := fmt.Sprintf("Factura %s - %s", number, brand)
+	body := fmt.Sprintf(
+		"Hola %s,\n\nAdjuntamos la factura %s con fecha %s por un importe de %s.\n\nGracias por su visita.\n\n%s\n",
+		strings.TrimSpace(inv.CustomerName), number, formatInvoicePDFDate(inv.InvoiceDate), formatEuros(inv.Amount), brand,
+	)
+
+	payloadRaw, _ := json.Marshal(map[string]any{
+		"invoiceId":     inv.ID,
+		"invoiceNumber": number,
+		"subject":       subject,
+		"pdfUrl":        pdfURL,
+	})
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO message_deliveries (restaurant_id, channel, event, recipient, payload_json, status, attempts, last_attempt_at)
+		VALUES (?, 'email', ?, ?, ?, 'pending', 1, NOW())
+	`, inv.RestaurantID, webhookEventInvoiceSent, inv.CustomerEmail, string(payloadRaw))
+	if err != nil {
+		return err
+	}
+	deliveryID, _ := res.LastInsertId()
+
+	sendErr := sendSMTPMailWithAttachment(inv.CustomerEmail, fromName, branding.EmailFromAddress, subject, body, mailAttachment{
+		Filename:    "factura_" + number + ".pdf",
+		ContentType: "application/pdf",
+		Data:        pdf,
+	})
+	if sendErr != nil {
+		_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'failed', error = ? WHERE id = ?", sendErr.Error(), deliveryID)
+		return sendErr
+	}
+	_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'sent', sent_at = NOW(), error = NULL WHERE id = ?", deliveryID)
+	return nil
+}
+
 // Get restaurant by ID
 func (s *Server) getRestaurant(ctx context.Context, restaurantID int) (*Restaurant, error) {
 	var r Restaurant
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// Login throttling is persisted in bo_login_throttles so it holds across
+// server instances. Failures are counted per account and per client IP:
+//   - account: after boLoginDelayAfter failures each attempt must wait an
+//     increasing delay; at cfg.BOLoginMaxFailures the account is locked.
+//   - ip: no delay (staff often share one IP), locked at cfg.BOLoginIPMaxFailures.
+//
+// Counters reset after cfg.BOLoginLockout without failures, when a lock
+// expires, or on a successful login (account only).
+
+const (
+	boLoginScopeAccount = "account"
+	boLoginScopeIP      = "ip"
+
+	boLoginDelayAfter = 3
+	boLoginMaxDelay   = 30 * time.Second
+
+	boLoginThrottleCleanupPoll = time.Hour
+)
+
+// boLoginAccountKey identifies the account being attempted. Known users are
+// keyed by ID so email and username share one counter.
+func boLoginAccountKey(userID int, identifier string) string {
+	if userID > 0 {
+		return "user:" + strconv.Itoa(userID)
+	}
+	key := "id:" + identifier
+	if len(key) > 191 {
+		key = key[:191]
+	}
+	return key
+}
+
+// boLoginProgressiveDelay is 1s, 2s, 4s... from the boLoginDelayAfter-th
+// failure on, capped at boLoginMaxDelay.
+func boLoginProgressiveDelay(failures int) time.Duration {
+	if failures < boLoginDelayAfter {
+		return 0
+	}
+	shift := failures - boLoginDelayAfter
+	if shift > 10 {
+		return boLoginMaxDelay
+	}
+	d := time.Second << shift
+	if d > boLoginMaxDelay {
+		return boLoginMaxDelay
+	}
+	return d
+}
+
+// boLoginWait returns how long the client must wait before the next attempt.
+func boLoginWait(failures int, lockedFor, sinceLastFailure, window time.Duration, progressive bool) time.Duration {
+	if lockedFor > 0 {
+		return lockedFor
+	}
+	if !progressive || sinceLastFailure >= window {
+		return 0
+	}
+	if d := boLoginProgressiveDelay(failures); sinceLastFailure < d {
+		return d - sinceLastFailure
+	}
+	return 0
+}
+
+func (s *Server) boLoginThrottleWait(ctx context.Context, scope, key string) (time.Duration, error) {
+	var failures, lockedSecs, sinceSecs int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			failures,
+			GREATEST(COALESCE(TIMESTAMPDIFF(SECOND, NOW(), locked_until), 0), 0),
+			TIMESTAMPDIFF(SECOND, last_failure_at, NOW())
+		FROM bo_login_throttles
+		WHERE scope = ? AND throttle_key = ?
+	`, scope, key).Scan(&failures, &lockedSecs, &sinceSecs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return boLoginWait(
+		failures,
+		time.Duration(lockedSecs)*time.Second,
+		time.Duration(sinceSecs)*time.Second,
+		s.cfg.BOLoginLockout,
+		scope == boLoginScopeAccount,
+	), nil
+}
+
+// recordBOLoginFailure counts a failed attempt and locks the key once it
+// reaches max failures. userID is 0 when the identifier matched no user.
+func (s *Server) recordBOLoginFailure(ctx context.Context, scope, key string, max int, userID int, ip string) error {
+	lockSecs := int(s.cfg.BOLoginLockout / time.Second)
+	return withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO bo_login_throttles (scope, throttle_key, failures, last_failure_at)
+			VALUES (?, ?, 1, NOW())
+			ON DUPLICATE KEY UPDATE
+				failures = IF(
+					last_failure_at < NOW() - INTERVAL ? SECOND OR (locked_until IS NOT NULL AND locked_until <= NOW()),
+					1,
+					failures + 1
+				),
+				last_failure_at = NOW(),
+				locked_until = IF(failures >= ?, NOW() + INTERVAL ? SECOND, NULL)
+		`, scope, key, lockSecs, max, lockSecs); err != nil {
+			return err
+		}
+
+		var failures int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT failures FROM bo_login_throttles WHERE scope = ? AND throttle_key = ?
+		`, scope, key).Scan(&failures); err != nil {
+			return err
+		}
+		if failures != max {
+			return nil
+		}
+
+		var uid any
+		if userID > 0 {
+			uid = userID
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO bo_login_events (event, scope, throttle_key, user_id, ip, failures)
+			VALUES ('locked', ?, ?, ?, ?, ?)
+		`, scope, key, uid, nullableString(ip), failures); err != nil {
+			return err
+		}
+		log.Printf("bo login locked: scope=%s key=%s ip=%s failures=%d", scope, key, ip, failures)
+		return nil
+	})
+}
+
+func (s *Server) recordBOLoginFailures(ctx context.Context, accountKey string, userID int, ip string) {
+	if err := s.recordBOLoginFailure(ctx, boLoginScopeAccount, accountKey, s.cfg.BOLoginMaxFailures, userID, ip); err != nil {
+		log.Printf("bo login throttle (account): %v", err)
+	}
+	if ip == "" {
+		return
+	}
+	if err := s.recordBOLoginFailure(ctx, boLoginScopeIP, ip, s.cfg.BOLoginIPMaxFailures, 0, ip); err != nil {
+		log.Printf("bo login throttle (ip): %v", err)
+	}
+}
+
+func (s *Server) clearBOLoginFailures(ctx context.Context, accountKey string) {
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM bo_login_throttles WHERE scope = ? AND throttle_key = ?
+	`, boLoginScopeAccount, accountKey); err != nil {
+		log.Printf("bo login throttle reset: %v", err)
+	}
+}
+
+func writeBOLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	msg := fmt.Sprintf("Demasiados intentos. Prueba de nuevo en %d segundos", secs)
+	if secs > 90 {
+		msg = fmt.Sprintf("Demasiados intentos. Acceso bloqueado durante %d minutos", (secs+59)/60)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	httpx.WriteJSON(w, http.StatusTooManyRequests, map[string]any{
+		"success":    false,
+		"message":    msg,
+		"error_code": "LOGIN_THROTTLED",
+		"retryAfter": secs,
+	})
+}
+
+// Handle unlock of a backoffice user locked out by failed logins.
+func (s *Server) handleBOUserUnlock(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, err := strconv.Atoi(strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil || userID <= 0 {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "id invalido",
+		})
+		return
+	}
+
+	var found int
+	err = s.db.QueryRowContext(r.Context(), `
+		SELECT u.id
+		FROM bo_users u
+		LEFT JOIN bo_user_restaurants ur
+			ON ur.user_id = u.id AND ur.restaurant_id = ?
+		LEFT JOIN restaurant_members m
+			ON m.restaurant_id = ?
+			AND m.is_active = 1
+			AND (
+				m.bo_user_id = u.id
+				OR (
+					m.bo_user_id IS NULL
+					AND m.email IS NOT NULL
+					AND LOWER(TRIM(m.email)) = LOWER(TRIM(u.email))
+				)
+			)
+		WHERE
+			u.id = ?
+			AND (ur.user_id IS NOT NULL OR m.id IS NOT NULL)
+		LIMIT 1
+	`, a.ActiveRestaurantID, a.ActiveRestaurantID, userID).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.WriteJSON(w, http.StatusNotFound, map[string]any{
+				"success": false,
+				"message": "Usuario no encontrado",
+			})
+			return
+		}
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando usuario")
+		return
+	}
+
+	key := boLoginAccountKey(userID, "")
+	var wasLocked bool
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var failures int
+		var locked bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT failures, COALESCE(locked_until > NOW(), 0)
+			FROM bo_login_throttles
+			WHERE scope = ? AND throttle_key = ?
+			FOR UPDATE
+		`, boLoginScopeAccount, key).Scan(&failures, &locked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		wasLocked = locked
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM bo_login_throttles WHERE scope = ? AND throttle_key = ?
+		`, boLoginScopeAccount, key); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO bo_login_events (event, scope, throttle_key, user_id, actor_user_id, ip, failures)
+			VALUES ('unlocked', ?, ?, ?, ?, ?, ?)
+		`, boLoginScopeAccount, key, userID, a.User.ID, nullableString(clientIP(r)), failures)
+		return err
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error desbloqueando usuario")
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":   true,
+		"wasLocked": wasLocked,
+	})
+}
+
+// runBOLoginThrottleCleanupLoop drops counters that can no longer affect a
+// login. bo_login_events is kept as the audit trail.
+func (s *Server) runBOLoginThrottleCleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(boLoginThrottleCleanupPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := s.db.ExecContext(ctx, `
+			DELETE FROM bo_login_throttles
+			WHERE last_failure_at < NOW() - INTERVAL ? SECOND
+				AND (locked_until IS NULL OR locked_until < NOW())
+		`, int(s.cfg.BOLoginLockout/time.Second))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("bo login throttle cleanup: %v", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBOLoginProgressiveDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		6:  8 * time.Second,
+		8:  boLoginMaxDelay,
+		50: boLoginMaxDelay,
+	}
+	for failures, want := range cases {
+		if got := boLoginProgressiveDelay(failures); got != want {
+			t.Errorf("boLoginProgressiveDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestBOLoginWait(t *testing.T) {
+	window := 15 * time.Minute
+	if got := boLoginWait(10, 5*time.Minute, 0, window, true); got != 5*time.Minute {
+		t.Errorf("locked: got %v", got)
+	}
+	if got := boLoginWait(5, 0, time.Second, window, true); got != 3*time.Second {
+		t.Errorf("progressive delay: got %v", got)
+	}
+	if got := boLoginWait(5, 0, 10*time.Second, window, true); got != 0 {
+		t.Errorf("delay elapsed: got %v", got)
+	}
+	if got := boLoginWait(40, 0, time.Second, window, false); got != 0 {
+		t.Errorf("ip scope has no delay: got %v", got)
+	}
+	if got := boLoginWait(9, 0, window, window, true); got != 0 {
+		t.Errorf("stale counter: got %v", got)
+	}
+}
+
+func TestBOLoginAccountKey(t *testing.T) {
+	if got := boLoginAccountKey(42, "ana@example.com"); got != "user:42" {
+		t.Errorf("known user key = %q", got)
+	}
+	if got := boLoginAccountKey(0, "ana@example.com"); got != "id:ana@example.com" {
+		t.Errorf("unknown user key = %q", got)
+	}
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if got := boLoginAccountKey(0, string(long)); len(got) != 191 {
+		t.Errorf("key length = %d", len(got))
+	}
+}
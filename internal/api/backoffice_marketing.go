@@ -0,0 +1,676 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+var marketingCampaignStatuses = []string{campaignDraft, campaignScheduled, campaignSending, campaignSent, campaignCancelled}
+
+type boMarketingAudienceRequest struct {
+	Channel  string            `json:"channel"`
+	Audience marketingAudience `json:"audience"`
+}
+
+type boMarketingCampaignRequest struct {
+	Name       *string            `json:"name"`
+	TemplateID *int               `json:"templateId"`
+	Audience   *marketingAudience `json:"audience"`
+}
+
+type boMarketingScheduleRequest struct {
+	ScheduledAt string `json:"scheduledAt"`
+}
+
+type boMarketingDelivery struct {
+	ID         int64   `json:"id"`
+	GuestID    *int    `json:"guestId"`
+	Recipient  string  `json:"recipient"`
+	Status     string  `json:"status"`
+	Attempts   int     `json:"attempts"`
+	Error      string  `json:"error,omitempty"`
+	SentAt     *string `json:"sentAt"`
+	ClickedAt  *string `json:"clickedAt"`
+	ClickCount int     `json:"clickCount"`
+}
+
+// parseMarketingSchedule turns a requested send time into a delay from
+// now. Empty means now; times without an offset are Madrid time.
+func parseMarketingSchedule(raw string, now time.Time) (time.Duration, string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, ""
+	}
+	at, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		at, err = time.ParseInLocation("2006-01-02T15:04", raw, boMadridTZ)
+	}
+	if err != nil {
+		return 0, "Fecha programada invalida"
+	}
+	delay := at.Sub(now)
+	if delay < -time.Minute {
+		return 0, "La fecha programada ya ha pasado"
+	}
+	if delay > 365*24*time.Hour {
+		return 0, "La fecha programada es demasiado lejana"
+	}
+	return max(delay, 0), ""
+}
+
+func (s *Server) handleBOMarketingTemplatesList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	templates, err := s.loadMarketingTemplates(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantillas")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":      true,
+		"templates":    templates,
+		"placeholders": marketingPlaceholders,
+	})
+}
+
+// readMarketingTemplate parses and validates a template body, writing the
+// error response itself when it can't.
+func readMarketingTemplate(w http.ResponseWriter, r *http.Request) (marketingTemplateInput, bool) {
+	var in marketingTemplateInput
+	if err := readJSONBody(r, &in); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return in, false
+	}
+	if msg := in.normalize(); msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return in, false
+	}
+	return in, true
+}
+
+func (s *Server) handleBOMarketingTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	in, ok := readMarketingTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `
+		INSERT INTO marketing_templates (restaurant_id, name, channel, subject, body) VALUES (?, ?, ?, ?, ?)
+	`, a.ActiveRestaurantID, in.Name, in.Channel, nullableString(in.Subject), in.Body)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando plantilla")
+		return
+	}
+	id, _ := res.LastInsertId()
+	t, err := s.loadMarketingTemplate(r.Context(), a.ActiveRestaurantID, int(id))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "marketing_template", EntityID: t.ID, After: t})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"template": t,
+	})
+}
+
+// handleBOMarketingTemplateUpdate replaces a template. Campaigns already
+// saved keep the text they copied.
+func (s *Server) handleBOMarketingTemplateUpdate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	in, ok := readMarketingTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := s.loadMarketingTemplate(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Plantilla no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `
+		UPDATE marketing_templates SET name = ?, channel = ?, subject = ?, body = ? WHERE restaurant_id = ? AND id = ?
+	`, in.Name, in.Channel, nullableString(in.Subject), in.Body, a.ActiveRestaurantID, id); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando plantilla")
+		return
+	}
+	after, err := s.loadMarketingTemplate(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "marketing_template", EntityID: id, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"template": after,
+	})
+}
+
+func (s *Server) handleBOMarketingTemplateDelete(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	before, err := s.loadMarketingTemplate(r.Context(), a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Plantilla no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE marketing_campaigns SET template_id = NULL WHERE restaurant_id = ? AND template_id = ?", a.ActiveRestaurantID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM marketing_templates WHERE restaurant_id = ? AND id = ?", a.ActiveRestaurantID, id)
+		return err
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error eliminando plantilla")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditDelete, Entity: "marketing_template", EntityID: id, Before: before})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+// handleBOMarketingAudiencePreview counts the guests an audience reaches on
+// a channel today, with a sample of them.
+func (s *Server) handleBOMarketingAudiencePreview(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req boMarketingAudienceRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	channel, ok := normalizeMarketingChannel(req.Channel)
+	if !ok {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Canal invalido"})
+		return
+	}
+	if msg := req.Audience.normalize(); msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return
+	}
+
+	where, args := marketingAudienceWhere(a.ActiveRestaurantID, channel, req.Audience, time.Now().In(boMadridTZ))
+	var total int
+	if err := s.db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM guests g WHERE "+where, args...).Scan(&total); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando audiencia")
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), "SELECT "+guestSelectColumns+" FROM guests g WHERE "+where+`
+		ORDER BY g.last_visit_date IS NULL, g.last_visit_date DESC, g.id DESC
+		LIMIT 20`, args...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando audiencia")
+		return
+	}
+	defer rows.Close()
+	sample := []guestProfile{}
+	for rows.Next() {
+		g, err := scanGuestProfile(rows)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando audiencia")
+			return
+		}
+		sample = append(sample, g)
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"channel":  channel,
+		"audience": req.Audience,
+		"total":    total,
+		"sample":   sample,
+	})
+}
+
+func (s *Server) handleBOMarketingCampaignsList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	where := "restaurant_id = ?"
+	args := []any{a.ActiveRestaurantID}
+	if status := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("status"))); status != "" {
+		if !slices.Contains(marketingCampaignStatuses, status) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Invalid status",
+			})
+			return
+		}
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+	rows, err := s.db.QueryContext(r.Context(), "SELECT "+marketingCampaignColumns+" FROM marketing_campaigns WHERE "+where+" ORDER BY id DESC LIMIT 200", args...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campanas")
+		return
+	}
+	defer rows.Close()
+	campaigns := []marketingCampaign{}
+	for rows.Next() {
+		c, err := scanMarketingCampaign(rows)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campanas")
+			return
+		}
+		campaigns = append(campaigns, c)
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":   true,
+		"campaigns": campaigns,
+	})
+}
+
+// applyMarketingCampaignRequest merges a create or update request into in,
+// copying the template's channel and text. It returns a message when the
+// request is invalid.
+func (s *Server) applyMarketingCampaignRequest(ctx context.Context, restaurantID int, req boMarketingCampaignRequest, in *marketingCampaignInput) (string, error) {
+	if req.Name != nil {
+		in.Name = strings.TrimSpace(*req.Name)
+	}
+	if in.Name == "" || len(in.Name) > 120 {
+		return "Nombre invalido", nil
+	}
+	if req.Audience != nil {
+		in.Audience = *req.Audience
+	}
+	if msg := in.Audience.normalize(); msg != "" {
+		return msg, nil
+	}
+	if req.TemplateID != nil {
+		t, err := s.loadMarketingTemplate(ctx, restaurantID, *req.TemplateID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "Plantilla no encontrada", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		in.TemplateID, in.Channel, in.Subject, in.Body = t.ID, t.Channel, t.Subject, t.Body
+	}
+	if in.Body == "" {
+		return "Elige una plantilla", nil
+	}
+	return "", nil
+}
+
+// handleBOMarketingCampaignCreate saves a draft campaign from a template.
+func (s *Server) handleBOMarketingCampaignCreate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req boMarketingCampaignRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	in := marketingCampaignInput{BaseURL: publicBaseURL(r), UserID: a.User.ID}
+	msg, err := s.applyMarketingCampaignRequest(r.Context(), a.ActiveRestaurantID, req, &in)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return
+	}
+	if s.marketingChannelUnavailable(in.Channel) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{"success": false, "message": marketingEmailUnsignedMsg})
+		return
+	}
+	id, err := s.insertMarketingCampaign(r.Context(), a.ActiveRestaurantID, in)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando campana")
+		return
+	}
+	c, err := s.loadMarketingCampaign(r.Context(), a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "marketing_campaign", EntityID: c.ID, After: c})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"campaign": c,
+	})
+}
+
+// loadBOMarketingCampaign loads the campaign in the URL, writing the error
+// response itself when it can't.
+func (s *Server) loadBOMarketingCampaign(w http.ResponseWriter, r *http.Request, restaurantID int) (marketingCampaign, bool) {
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return marketingCampaign{}, false
+	}
+	c, err := s.loadMarketingCampaign(r.Context(), restaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Campana no encontrada")
+		return marketingCampaign{}, false
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return marketingCampaign{}, false
+	}
+	return c, true
+}
+
+func (s *Server) handleBOMarketingCampaignGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	c, ok := s.loadBOMarketingCampaign(w, r, a.ActiveRestaurantID)
+	if !ok {
+		return
+	}
+	stats, err := s.loadMarketingCampaignStats(r.Context(), c.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return
+	}
+	c.Stats = &stats
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"campaign": c,
+	})
+}
+
+// handleBOMarketingCampaignUpdate edits a campaign that hasn't started.
+func (s *Server) handleBOMarketingCampaignUpdate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req boMarketingCampaignRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	before, ok := s.loadBOMarketingCampaign(w, r, a.ActiveRestaurantID)
+	if !ok {
+		return
+	}
+	if before.Status != campaignDraft && before.Status != campaignScheduled {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "La campana ya se ha enviado"})
+		return
+	}
+
+	in := marketingCampaignInput{
+		Name:     before.Name,
+		Channel:  before.Channel,
+		Subject:  before.Subject,
+		Body:     before.Body,
+		Audience: before.Audience,
+	}
+	msg, err := s.applyMarketingCampaignRequest(r.Context(), a.ActiveRestaurantID, req, &in)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plantilla")
+		return
+	}
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return
+	}
+	if s.marketingChannelUnavailable(in.Channel) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{"success": false, "message": marketingEmailUnsignedMsg})
+		return
+	}
+	templateID := 0
+	if before.TemplateID != nil {
+		templateID = *before.TemplateID
+	}
+	if in.TemplateID > 0 {
+		templateID = in.TemplateID
+	}
+	audience, _ := json.Marshal(in.Audience)
+	res, err := s.db.ExecContext(r.Context(), `
+		UPDATE marketing_campaigns
+		SET name = ?, channel = ?, template_id = ?, subject = ?, body = ?, audience_json = ?
+		WHERE restaurant_id = ? AND id = ? AND status IN (?, ?)
+	`, in.Name, in.Channel, nullablePositiveInt(templateID), nullableString(in.Subject), in.Body, string(audience),
+		a.ActiveRestaurantID, before.ID, campaignDraft, campaignScheduled)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando campana")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "La campana ya se ha enviado"})
+		return
+	}
+	after, err := s.loadMarketingCampaign(r.Context(), a.ActiveRestaurantID, before.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "marketing_campaign", EntityID: before.ID, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"campaign": after,
+	})
+}
+
+// handleBOMarketingCampaignSchedule queues a draft for a time, or moves a
+// scheduled campaign that hasn't started yet.
+func (s *Server) handleBOMarketingCampaignSchedule(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req boMarketingScheduleRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	delay, msg := parseMarketingSchedule(req.ScheduledAt, time.Now())
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return
+	}
+	before, ok := s.loadBOMarketingCampaign(w, r, a.ActiveRestaurantID)
+	if !ok {
+		return
+	}
+	if s.marketingChannelUnavailable(before.Channel) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{"success": false, "message": marketingEmailUnsignedMsg})
+		return
+	}
+
+	scheduled, err := s.scheduleMarketingCampaign(r.Context(), a.ActiveRestaurantID, before.ID, delay)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error programando campana")
+		return
+	}
+	if !scheduled {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "La campana ya se ha enviado"})
+		return
+	}
+	after, err := s.loadMarketingCampaign(r.Context(), a.ActiveRestaurantID, before.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "schedule", Entity: "marketing_campaign", EntityID: before.ID, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"campaign": after,
+	})
+}
+
+func (s *Server) handleBOMarketingCampaignCancel(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	before, ok := s.loadBOMarketingCampaign(w, r, a.ActiveRestaurantID)
+	if !ok {
+		return
+	}
+
+	cancelled, err := s.cancelMarketingCampaign(r.Context(), a.ActiveRestaurantID, before.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cancelando campana")
+		return
+	}
+	if !cancelled {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "La campana ya ha terminado"})
+		return
+	}
+	after, err := s.loadMarketingCampaign(r.Context(), a.ActiveRestaurantID, before.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando campana")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "cancel", Entity: "marketing_campaign", EntityID: before.ID, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"campaign": after,
+	})
+}
+
+// handleBOMarketingCampaignDeliveries lists a campaign's recipients with
+// their delivery and click state.
+func (s *Server) handleBOMarketingCampaignDeliveries(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	c, ok := s.loadBOMarketingCampaign(w, r, a.ActiveRestaurantID)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	page := clampInt(q.Get("page"), 1, 1_000_000, 1)
+	count := clampInt(q.Get("count"), 1, 200, 50)
+	where := "restaurant_id = ? AND campaign_id = ?"
+	args := []any{a.ActiveRestaurantID, c.ID}
+	switch status := strings.ToLower(strings.TrimSpace(q.Get("status"))); status {
+	case "", "all":
+	case "clicked":
+		where += " AND click_count > 0"
+	case "pending":
+		where += " AND status IN ('pending', 'retrying')"
+	case "sent", "failed", "skipped", "cancelled":
+		where += " AND status = ?"
+		args = append(args, status)
+	default:
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Invalid status",
+		})
+		return
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM message_deliveries WHERE "+where, args...).Scan(&total); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando envios")
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT id, guest_id, recipient, status, attempts, COALESCE(error, ''), sent_at, clicked_at, click_count
+		FROM message_deliveries
+		WHERE `+where+`
+		ORDER BY id ASC
+		LIMIT ? OFFSET ?`, append(args, count, (page-1)*count)...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando envios")
+		return
+	}
+	defer rows.Close()
+	deliveries := []boMarketingDelivery{}
+	for rows.Next() {
+		var (
+			d               boMarketingDelivery
+			guestID         sql.NullInt64
+			sentAt, clicked sql.NullTime
+		)
+		if err := rows.Scan(&d.ID, &guestID, &d.Recipient, &d.Status, &d.Attempts, &d.Error, &sentAt, &clicked, &d.ClickCount); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando envios")
+			return
+		}
+		if guestID.Valid {
+			id := int(guestID.Int64)
+			d.GuestID = &id
+		}
+		d.SentAt = formatNullTimeRFC3339(sentAt)
+		d.ClickedAt = formatNullTimeRFC3339(clicked)
+		deliveries = append(deliveries, d)
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"count":      count,
+	})
+}
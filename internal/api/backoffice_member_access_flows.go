@@ -4,9 +4,11 @@ import (
 	"context"
 	crand "crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/mail"
 	"net/smtp"
@@ -242,6 +244,7 @@ func (s *Server) createBOMemberAndBootstrapAccess(ctx context.Context, a boAuth,
 	if err := tx.Commit(); err != nil {
 		return boMemberCreateResult{}, err
 	}
+	s.invalidateBOUserAuth(user.UserID)
 
 	member, err := s.getBOMemberByID(ctx, a.ActiveRestaurantID, memberID)
 	if err != nil {
@@ -686,32 +689,52 @@ func errorString(err error) string {
 	return err.Error()
 }
 
-func sendSMTPMailBestEffort(to string, subject string, body string) error {
-	to = strings.TrimSpace(to)
-	if to == "" {
-		return errors.New("destinatario vacio")
-	}
-	if _, err := mail.ParseAddress(to); err != nil {
-		return errors.New("email invalido")
-	}
+type smtpSettings struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
 
+func smtpSettingsFromEnv() (smtpSettings, error) {
 	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
 	port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
 	from := strings.TrimSpace(os.Getenv("SMTP_FROM"))
 	user := strings.TrimSpace(os.Getenv("SMTP_USER"))
 	pass := strings.TrimSpace(os.Getenv("SMTP_PASS"))
 	if host == "" || port == "" || from == "" {
-		return errors.New("smtp no configurado")
+		return smtpSettings{}, errors.New("smtp no configurado")
 	}
 
-	addr := host + ":" + port
 	auth := smtp.Auth(nil)
 	if user != "" && pass != "" {
 		auth = smtp.PlainAuth("", user, pass, host)
 	}
+	return smtpSettings{Addr: host + ":" + port, From: from, Auth: auth}, nil
+}
+
+func validateMailRecipient(to string) (string, error) {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return "", errors.New("destinatario vacio")
+	}
+	if _, err := mail.ParseAddress(to); err != nil {
+		return "", errors.New("email invalido")
+	}
+	return to, nil
+}
+
+func sendSMTPMailBestEffort(to string, subject string, body string) error {
+	to, err := validateMailRecipient(to)
+	if err != nil {
+		return err
+	}
+	cfg, err := smtpSettingsFromEnv()
+	if err != nil {
+		return err
+	}
 
 	msg := strings.Builder{}
-	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("From: " + cfg.From + "\r\n")
 	msg.WriteString("To: " + to + "\r\n")
 	msg.WriteString("Subject: " + mimeSafeSubject(subject) + "\r\n")
 	msg.WriteString("MIME-Version: 1.0\r\n")
@@ -719,7 +742,72 @@ func sendSMTPMailBestEffort(to string, subject string, body string) error {
 	msg.WriteString("\r\n")
 	msg.WriteString(body)
 
-	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg.String()))
+	return smtp.SendMail(cfg.Addr, cfg.Auth, cfg.From, []string{to}, []byte(msg.String()))
+}
+
+type mailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// sendSMTPMailWithAttachment sends a multipart/mixed message with a plain-text
+// body. fromName and replyTo are optional and only change the headers; the
+// envelope sender is always SMTP_FROM.
+func sendSMTPMailWithAttachment(to, fromName, replyTo, subject, body string, att mailAttachment) error {
+	to, err := validateMailRecipient(to)
+	if err != nil {
+		return err
+	}
+	cfg, err := smtpSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	from := cfg.From
+	if name := strings.TrimSpace(fromName); name != "" {
+		from = (&mail.Address{Name: name, Address: cfg.From}).String()
+	}
+	boundary := "mixed-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	msg := strings.Builder{}
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	if rt := strings.TrimSpace(replyTo); rt != "" {
+		if _, err := mail.ParseAddress(rt); err == nil {
+			msg.WriteString("Reply-To: " + rt + "\r\n")
+		}
+	}
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", mimeSafeSubject(subject)) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n")
+	msg.WriteString("\r\n")
+
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	msg.WriteString("\r\n")
+
+	contentType := att.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: " + mime.FormatMediaType(contentType, map[string]string{"name": att.Filename}) + "\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n")
+	msg.WriteString("Content-Disposition: " + mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}) + "\r\n")
+	msg.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString(att.Data)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	msg.WriteString("--" + boundary + "--\r\n")
+
+	return smtp.SendMail(cfg.Addr, cfg.Auth, cfg.From, []string{to}, []byte(msg.String()))
 }
 
 func mimeSafeSubject(subject string) string {
@@ -956,6 +1044,7 @@ func (s *Server) handleBOMemberInvitationResend(w http.ResponseWriter, r *http.R
 		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando invitacion")
 		return
 	}
+	s.invalidateBOUserAuth(userID)
 
 	invURL := buildBackofficeAbsoluteURL(r, "/invitacion/"+token)
 	delivery := s.sendMemberInvitation(r.Context(), a.ActiveRestaurantID, email, rec.Phone, invURL)
@@ -1615,6 +1704,7 @@ func (s *Server) handleBOInvitationOnboardingPassword(w http.ResponseWriter, r *
 		httpx.WriteError(w, http.StatusInternalServerError, "Error finalizando onboarding")
 		return
 	}
+	s.invalidateBOUserAuth(rec.BOUserID)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -1820,10 +1910,17 @@ func (s *Server) handleBOPasswordResetConfirm(w http.ResponseWriter, r *http.Req
 			AND expires_at > NOW()
 	`, rec.BOUserID)
 
+	// Whoever asked for the reset may not be the one holding the open sessions.
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE user_id = ?", rec.BOUserID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "No se pudo finalizar reset")
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error finalizando reset")
 		return
 	}
+	s.invalidateBOUserAuth(rec.BOUserID)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -146,6 +146,11 @@ func (s *Server) handleBOMemberCreate(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "member", EntityID: out.Member.ID, After: map[string]any{
+		"member": out.Member,
+		"user":   out.User,
+		"role":   out.RoleSlug,
+	}})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success":      true,
@@ -339,6 +344,7 @@ func (s *Server) handleBOMemberPatch(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo miembro")
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "member", EntityID: memberID, Before: current, After: member})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
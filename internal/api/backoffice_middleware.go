@@ -31,96 +31,143 @@ func (s *Server) requireBOSession(next http.Handler) http.Handler {
 		token := strings.TrimSpace(c.Value)
 		tokenSHA := sha256Hex(token)
 
-		var (
-			sessionID          int64
-			userID             int
-			activeRestaurantID int
-			email              string
-			username           sql.NullString
-			name               string
-			isSuper            int
-			mustChangePassword int
-			role               sql.NullString
-		)
-		err = s.db.QueryRowContext(r.Context(), `
-			SELECT
-				s.id,
-				s.user_id,
-				s.active_restaurant_id,
-				u.email,
-				u.username,
-				u.name,
-				u.is_superadmin,
-				u.must_change_password,
-				ur.role
-			FROM bo_sessions s
-			JOIN bo_users u ON u.id = s.user_id
-			LEFT JOIN bo_user_restaurants ur
-				ON ur.user_id = s.user_id AND ur.restaurant_id = s.active_restaurant_id
-			WHERE s.token_sha256 = ? AND s.expires_at > NOW()
-			LIMIT 1
-		`, tokenSHA).Scan(&sessionID, &userID, &activeRestaurantID, &email, &username, &name, &isSuper, &mustChangePassword, &role)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				log.Printf("[requireBOSession] token not found in DB, tokenSHA=%s", tokenSHA[:16])
-				httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		now := time.Now()
+		sess, cached := s.authCache.getSession(tokenSHA, now, s.cfg.BOAuthCacheTTL)
+		if !cached {
+			var (
+				username      sql.NullString
+				isSuper       int
+				mustChange    int
+				role          sql.NullString
+				totpEnabled   int
+				mfaAgeSeconds sql.NullInt64
+				expiresIn     int64
+			)
+			err = s.db.QueryRowContext(r.Context(), `
+				SELECT
+					s.id,
+					s.user_id,
+					s.active_restaurant_id,
+					u.email,
+					u.username,
+					u.name,
+					u.is_superadmin,
+					u.must_change_password,
+					ur.role,
+					u.totp_enabled_at IS NOT NULL,
+					TIMESTAMPDIFF(SECOND, s.mfa_verified_at, NOW()),
+					TIMESTAMPDIFF(SECOND, NOW(), s.expires_at)
+				FROM bo_sessions s
+				JOIN bo_users u ON u.id = s.user_id
+				LEFT JOIN bo_user_restaurants ur
+					ON ur.user_id = s.user_id AND ur.restaurant_id = s.active_restaurant_id
+				WHERE s.token_sha256 = ? AND s.expires_at > NOW()
+				LIMIT 1
+			`, tokenSHA).Scan(&sess.SessionID, &sess.UserID, &sess.ActiveRestaurantID, &sess.Email, &username, &sess.Name, &isSuper, &mustChange, &role, &totpEnabled, &mfaAgeSeconds, &expiresIn)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					log.Printf("[requireBOSession] token not found in DB, tokenSHA=%s", tokenSHA[:16])
+					httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+					return
+				}
+				log.Printf("[requireBOSession] DB error: %v", err)
+				httpx.WriteError(w, http.StatusInternalServerError, "Error validating session")
 				return
 			}
-			log.Printf("[requireBOSession] DB error: %v", err)
-			httpx.WriteError(w, http.StatusInternalServerError, "Error validating session")
-			return
+			sess.Username = strings.TrimSpace(username.String)
+			sess.IsSuperadmin = isSuper != 0
+			sess.MustChangePassword = mustChange != 0
+			sess.Role = role.String
+			sess.HasRole = role.Valid
+			sess.TwoFactorEnabled = totpEnabled != 0
+			if mfaAgeSeconds.Valid {
+				sess.MFAVerifiedAt = now.Add(-time.Duration(mfaAgeSeconds.Int64) * time.Second)
+			}
+			// Relative to NOW() on the DB side, so clock skew between the
+			// app and MySQL doesn't leak into the heartbeat threshold.
+			sess.ExpiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+			if s.cfg.BOAuthCacheTTL > 0 {
+				s.authCache.setSession(tokenSHA, sess, now)
+			}
 		}
 
-		if isSuper == 0 && !role.Valid {
+		if !sess.IsSuperadmin && !sess.HasRole {
 			httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		roleSlug := normalizeBORole(role.String)
-		if isSuper != 0 {
+		roleSlug := normalizeBORole(sess.Role)
+		if sess.IsSuperadmin {
 			roleSlug = "root"
 		} else if roleSlug == "" {
 			roleSlug = "admin"
 		}
 
-		roleImportance, err := s.roleImportance(r.Context(), roleSlug)
+		roleImportance, sectionAccess, err := s.resolveBORole(r.Context(), roleSlug)
 		if err != nil {
 			httpx.WriteError(w, http.StatusInternalServerError, "Error validating session role")
 			return
 		}
-		sectionAccess, err := s.roleSections(r.Context(), roleSlug)
-		if err != nil {
-			httpx.WriteError(w, http.StatusInternalServerError, "Error validating session role")
+
+		if !sess.TwoFactorEnabled && s.boTwoFactorRequired(roleImportance) && !boTwoFactorSetupPath(r.URL.Path) {
+			httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+				"success":    false,
+				"message":    "Tu rol requiere activar la verificacion en dos pasos",
+				"error_code": "TWO_FACTOR_SETUP_REQUIRED",
+			})
+			return
+		}
+		// High-security paths also require a recent second factor, within
+		// the same window as their shorter session TTL.
+		if sess.TwoFactorEnabled && boSessionIsHighSecurityPath(strings.ToLower(r.URL.Path)) &&
+			(sess.MFAVerifiedAt.IsZero() || now.Sub(sess.MFAVerifiedAt) > boSessionHighSecurityTTL()) {
+			httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+				"success":    false,
+				"message":    "Confirma tu codigo de verificacion para continuar",
+				"error_code": "TWO_FACTOR_STEP_UP_REQUIRED",
+			})
 			return
 		}
 
+		// The heartbeat only writes when the expiry moves by more than
+		// BOSessionHeartbeat; otherwise the stored expiry is what the client
+		// is told, so moving_expiration_date always matches the DB.
 		ttl := boSessionTTLForRequest(r)
-		movingExpiresAt := time.Now().Add(ttl).Truncate(time.Second)
-		if _, err := s.db.ExecContext(r.Context(), "UPDATE bo_sessions SET last_seen_at = NOW(), expires_at = ? WHERE id = ?", movingExpiresAt, sessionID); err != nil {
-			log.Printf("[requireBOSession] DB heartbeat error: %v", err)
-			httpx.WriteError(w, http.StatusInternalServerError, "Error validating session")
-			return
+		movingExpiresAt := now.Add(ttl).Truncate(time.Second)
+		if boSessionHeartbeatDue(sess.ExpiresAt, movingExpiresAt, s.cfg.BOSessionHeartbeat) {
+			if _, err := s.db.ExecContext(r.Context(), "UPDATE bo_sessions SET last_seen_at = NOW(), expires_at = ? WHERE id = ?", movingExpiresAt, sess.SessionID); err != nil {
+				log.Printf("[requireBOSession] DB heartbeat error: %v", err)
+				httpx.WriteError(w, http.StatusInternalServerError, "Error validating session")
+				return
+			}
+			s.authCache.touchSession(tokenSHA, movingExpiresAt)
+		} else {
+			movingExpiresAt = sess.ExpiresAt.Truncate(time.Second)
+			ttl = max(movingExpiresAt.Sub(now), time.Second)
 		}
 
 		setBOSessionCookie(w, r, token, movingExpiresAt, ttl)
 		w.Header().Set(boSessionMovingExpirationHeader, movingExpiresAt.UTC().Format(time.RFC3339))
 
 		a := boAuth{
-			SessionID:   sessionID,
+			SessionID:   sess.SessionID,
 			TokenSHA256: tokenSHA,
 			User: boUser{
-				ID:             userID,
-				Email:          email,
-				Username:       strings.TrimSpace(username.String),
-				Name:           name,
+				ID:             sess.UserID,
+				Email:          sess.Email,
+				Username:       sess.Username,
+				Name:           sess.Name,
 				Role:           roleSlug,
 				RoleImportance: roleImportance,
 				SectionAccess:  sectionAccess,
-				MustChangePass: mustChangePassword != 0,
-				isSuperadmin:   isSuper != 0,
+				MustChangePass: sess.MustChangePassword,
+				isSuperadmin:   sess.IsSuperadmin,
+
+				TwoFactorEnabled:  sess.TwoFactorEnabled,
+				TwoFactorRequired: s.boTwoFactorRequired(roleImportance),
 			},
 			Role:               roleSlug,
-			ActiveRestaurantID: activeRestaurantID,
+			ActiveRestaurantID: sess.ActiveRestaurantID,
 		}
 		next.ServeHTTP(w, r.WithContext(withBOAuth(r.Context(), a)))
 	})
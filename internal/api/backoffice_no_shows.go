@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boConfigNoShowPoliciesSetRequest struct {
+	Policies []noShowPolicyInput `json:"policies"`
+}
+
+type boBookingAttendanceRequest struct {
+	Attendance string `json:"attendance"`
+}
+
+// handleBOBookingAttendance marks a booking arrived or no-show, or clears
+// the mark, from the bookings list.
+func (s *Server) handleBOBookingAttendance(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	bookingID, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	var req boBookingAttendanceRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	attendance, ok := normalizeBookingAttendance(req.Attendance)
+	if !ok {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Asistencia invalida"})
+		return
+	}
+
+	booking, err := s.setBookingAttendance(r, a.ActiveRestaurantID, bookingID, attendance)
+	switch code, message := bookingAttendanceErrorMessage(err); code {
+	case "":
+	case "NOT_FOUND":
+		httpx.WriteError(w, http.StatusNotFound, message)
+		return
+	case "ATTENDANCE_FAILED":
+		httpx.WriteError(w, http.StatusInternalServerError, message)
+		return
+	default:
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "code": code, "message": message})
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"booking": booking,
+	})
+}
+
+// handleBOConfigNoShowPoliciesGet lists the restaurant's no-show policies by
+// threshold.
+func (s *Server) handleBOConfigNoShowPoliciesGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	policies, err := s.loadNoShowPolicies(r.Context(), s.db, a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando politicas de no presentados")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"policies":        policies,
+		"paymentsEnabled": s.payments != nil,
+	})
+}
+
+// handleBOConfigNoShowPoliciesSet replaces the policy list.
+func (s *Server) handleBOConfigNoShowPoliciesSet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boConfigNoShowPoliciesSetRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	policies, msg := normalizeNoShowPolicies(req.Policies)
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	restaurantID := a.ActiveRestaurantID
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM no_show_policies WHERE restaurant_id = ?", restaurantID); err != nil {
+			return err
+		}
+		for _, p := range policies {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO no_show_policies
+					(restaurant_id, min_no_shows, action, amount_cents, per_person, refund_cutoff_hours, is_active)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, restaurantID, p.MinNoShows, p.Action, nullablePositiveInt(p.AmountCents), p.PerPerson,
+				p.RefundCutoffHours, p.Active); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando politicas de no presentados")
+		return
+	}
+
+	saved, err := s.loadNoShowPolicies(r.Context(), s.db, restaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando politicas de no presentados")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"policies":        saved,
+		"paymentsEnabled": s.payments != nil,
+	})
+}
@@ -208,6 +208,21 @@ func (h *boTablesHub) broadcast(restaurantID int, payload any) {
 	}
 }
 
+func (h *boTablesHub) closeAll() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	rooms := h.rooms
+	h.rooms = map[int]map[*boTablesClient]struct{}{}
+	h.mu.Unlock()
+	for _, room := range rooms {
+		for c := range room {
+			_ = c.closeGoingAway()
+		}
+	}
+}
+
 func (c *boTablesClient) writeText(raw []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -230,6 +245,13 @@ func (c *boTablesClient) ping() error {
 	return c.conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(7*time.Second))
 }
 
+func (c *boTablesClient) closeGoingAway() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(2*time.Second))
+	return c.conn.Close()
+}
+
 func (c *boTablesClient) close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -1575,12 +1597,23 @@ func (s *Server) handleBOPremiumTablesWS(w http.ResponseWriter, r *http.Request)
 				continue
 			}
 			var msg struct {
-				Type string `json:"type"`
+				Type       string `json:"type"`
+				BookingID  int    `json:"bookingId"`
+				State      string `json:"state"`
+				Attendance string `json:"attendance"`
 			}
 			if err := json.Unmarshal(raw, &msg); err != nil {
 				continue
 			}
 			typ := strings.ToLower(strings.TrimSpace(msg.Type))
+			if typ == "booking_state" {
+				_ = client.writeJSON(s.handleBOTablesWSBookingState(r, a, msg.BookingID, msg.State))
+				continue
+			}
+			if typ == "booking_attendance" {
+				_ = client.writeJSON(s.handleBOTablesWSBookingAttendance(r, a, msg.BookingID, msg.Attendance))
+				continue
+			}
 			if typ != "sync" && typ != "refresh" && typ != "join_tables" {
 				continue
 			}
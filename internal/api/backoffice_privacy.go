@@ -0,0 +1,186 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// boPrivacySubjectRequest identifies a data subject. The details go in the
+// body rather than the query string so they stay out of access logs.
+type boPrivacySubjectRequest struct {
+	CountryCode string `json:"countryCode"`
+	Phone       string `json:"phone"`
+	Email       string `json:"email"`
+}
+
+// readPrivacySubject parses the request body into a subject, writing the
+// error response itself when it can't.
+func readPrivacySubject(w http.ResponseWriter, r *http.Request) (privacySubject, bool) {
+	var req boPrivacySubjectRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return privacySubject{}, false
+	}
+	subject, msg := newPrivacySubject(req.CountryCode, req.Phone, req.Email)
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": msg})
+		return privacySubject{}, false
+	}
+	return subject, true
+}
+
+// handleBOPrivacySubjectExport returns everything the restaurant holds
+// about a phone and/or email, grouped by table.
+func (s *Server) handleBOPrivacySubjectExport(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	subject, ok := readPrivacySubject(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := s.exportPrivacySubject(r.Context(), a.ActiveRestaurantID, subject)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error exportando datos personales")
+		return
+	}
+	counts := make(map[string]int, len(data))
+	for k, rows := range data {
+		counts[k] = len(rows)
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "export", Entity: "privacy_subject", EntityID: subject.ref(), After: counts})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":     true,
+		"subject":     subject,
+		"generatedAt": time.Now().UTC().Format(time.RFC3339),
+		"data":        data,
+	})
+}
+
+// handleBOPrivacySubjectAnonymise scrubs a subject's details from the
+// restaurant's records.
+func (s *Server) handleBOPrivacySubjectAnonymise(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	subject, ok := readPrivacySubject(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.anonymisePrivacySubject(r.Context(), a.ActiveRestaurantID, subject)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error anonimizando datos personales")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "anonymise", Entity: "privacy_subject", EntityID: subject.ref(), After: result})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"result":  result,
+	})
+}
+
+func (s *Server) handleBOPrivacyRetentionGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := s.loadPrivacyRetention(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plazos de conservacion")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":   true,
+		"retention": settings,
+	})
+}
+
+// handleBOPrivacyRetentionSet saves the retention periods, which also opts
+// the restaurant into the nightly purge.
+func (s *Server) handleBOPrivacyRetentionSet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req := defaultPrivacyRetention()
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	if err := s.savePrivacyRetention(r.Context(), a.ActiveRestaurantID, req); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando plazos de conservacion")
+		return
+	}
+	settings, err := s.loadPrivacyRetention(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plazos de conservacion")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":   true,
+		"retention": settings,
+	})
+}
+
+// handleBOPrivacyRetentionRun applies the saved periods now instead of
+// waiting for the nightly run.
+func (s *Server) handleBOPrivacyRetentionRun(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := s.loadPrivacyRetention(r.Context(), a.ActiveRestaurantID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando plazos de conservacion")
+		return
+	}
+	if !settings.Configured {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Guarda los plazos de conservacion primero",
+		})
+		return
+	}
+
+	result, err := s.purgePersonalData(r.Context(), a.ActiveRestaurantID, settings.privacyRetention)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error aplicando plazos de conservacion")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "purge", Entity: "privacy_retention", EntityID: a.ActiveRestaurantID, After: result})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"result":  result,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
 
@@ -113,6 +114,31 @@ var defaultRoleImportance = map[string]int{
 	"fregaplatos":       30,
 }
 
+const (
+	boActionView   = "view"
+	boActionCreate = "create"
+	boActionEdit   = "edit"
+	boActionDelete = "delete"
+	boActionExport = "export"
+)
+
+// boActions is the canonical order used when storing and listing actions.
+var boActions = []string{boActionView, boActionCreate, boActionEdit, boActionDelete, boActionExport}
+
+// defaultRoleActions narrows what a role may do inside a section it can
+// access. Sections not listed here allow every action. A non-NULL
+// bo_role_permissions.actions overrides these.
+var defaultRoleActions = map[string]map[string][]string{
+	"metre": {
+		boSectionMenus:        {boActionView, boActionCreate, boActionEdit},
+		boSectionFacturas:     {boActionView, boActionCreate, boActionEdit, boActionExport},
+		boSectionEstadoCuenta: {boActionView, boActionExport},
+	},
+	"jefe_cocina": {
+		boSectionReservas: {boActionView},
+	},
+}
+
 func isRoleSlugValid(slug string) bool {
 	if len(slug) < 2 || len(slug) > 32 {
 		return false
@@ -171,29 +197,77 @@ func normalizeBOSection(section string) string {
 	}
 }
 
-func (s *Server) roleCanAccessSection(ctx context.Context, role, section string) (bool, error) {
-	role = normalizeBORole(role)
-	section = normalizeBOSection(section)
-	if role == "" || section == "" {
-		return false, nil
+func normalizeBOAction(action string) string {
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case boActionView:
+		return boActionView
+	case boActionCreate:
+		return boActionCreate
+	case boActionEdit:
+		return boActionEdit
+	case boActionDelete:
+		return boActionDelete
+	case boActionExport:
+		return boActionExport
+	default:
+		return ""
 	}
+}
 
-	var allowed int
-	err := s.db.QueryRowContext(ctx, `
-		SELECT is_allowed
-		FROM bo_role_permissions
-		WHERE role_slug = ? AND section_key = ?
-		LIMIT 1
-	`, role, section).Scan(&allowed)
-	if err == nil {
-		return allowed != 0, nil
+// normalizeBOActions dedupes and orders actions. Every section grant
+// includes view, so it is added when missing.
+func normalizeBOActions(input []string) []string {
+	seen := map[string]bool{boActionView: true}
+	for _, raw := range input {
+		if action := normalizeBOAction(raw); action != "" {
+			seen[action] = true
+		}
 	}
-	if err != sql.ErrNoRows {
-		return false, err
+	out := make([]string, 0, len(boActions))
+	for _, action := range boActions {
+		if seen[action] {
+			out = append(out, action)
+		}
+	}
+	return out
+}
+
+// roleSectionActions resolves the actions a role has in a section it can
+// access. stored is bo_role_permissions.actions.
+func roleSectionActions(role, section string, stored sql.NullString) []string {
+	if stored.Valid && strings.TrimSpace(stored.String) != "" {
+		return normalizeBOActions(strings.Split(stored.String, ","))
+	}
+	if actions, ok := defaultRoleActions[role][section]; ok {
+		return normalizeBOActions(actions)
+	}
+	return append([]string(nil), boActions...)
+}
+
+// boActionsColumn is what gets stored for a grant: NULL when it allows
+// every action, so widening boActions later reaches existing roles.
+func boActionsColumn(actions []string) any {
+	actions = normalizeBOActions(actions)
+	if len(actions) == len(boActions) {
+		return nil
 	}
+	return strings.Join(actions, ",")
+}
 
-	perms := defaultRolePermissions[role]
-	return perms != nil && perms[section], nil
+func boSectionScope(section, action string) string {
+	return section + ":" + action
+}
+
+// boSectionAccessHas checks the bare section entry in the resolved
+// sectionAccess list.
+func boSectionAccessHas(sectionAccess []string, section string) bool {
+	return slices.Contains(sectionAccess, section)
+}
+
+// boSectionAccessAllows checks a "section:action" entry in the resolved
+// sectionAccess list.
+func boSectionAccessAllows(sectionAccess []string, section, action string) bool {
+	return slices.Contains(sectionAccess, boSectionScope(section, action))
 }
 
 func (s *Server) roleImportance(ctx context.Context, role string) (int, error) {
@@ -251,6 +325,8 @@ func (s *Server) roleExists(ctx context.Context, role string) (bool, error) {
 	return false, err
 }
 
+// roleSections lists the sections a role can access, followed by one
+// "section:action" entry per allowed action so the UI can hide buttons.
 func (s *Server) roleSections(ctx context.Context, role string) ([]string, error) {
 	role = normalizeBORole(role)
 	if role == "" {
@@ -258,9 +334,9 @@ func (s *Server) roleSections(ctx context.Context, role string) ([]string, error
 	}
 
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT section_key
+		SELECT section_key, is_allowed, actions
 		FROM bo_role_permissions
-		WHERE role_slug = ? AND is_allowed = 1
+		WHERE role_slug = ?
 		ORDER BY section_key ASC
 	`, role)
 	if err != nil {
@@ -268,31 +344,45 @@ func (s *Server) roleSections(ctx context.Context, role string) ([]string, error
 	}
 	defer rows.Close()
 
-	out := make([]string, 0, 8)
+	out := make([]string, 0, 32)
+	seen := make(map[string]bool)
 	for rows.Next() {
-		var section string
-		if err := rows.Scan(&section); err != nil {
+		var (
+			section string
+			allowed int
+			actions sql.NullString
+		)
+		if err := rows.Scan(&section, &allowed, &actions); err != nil {
 			return nil, err
 		}
 		section = normalizeBOSection(section)
-		if section == "" {
+		if section == "" || seen[section] {
+			continue
+		}
+		// A denied row still counts as seen so the defaults below cannot
+		// grant back a section the role was explicitly refused.
+		seen[section] = true
+		if allowed == 0 {
 			continue
 		}
 		out = append(out, section)
+		for _, action := range roleSectionActions(role, section, actions) {
+			out = append(out, boSectionScope(section, action))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	// Always include default permissions as fallback/base.
 	// This ensures all standard sections are available even if DB is incomplete.
-	perms := defaultRolePermissions[role]
-	if len(perms) > 0 {
-		seen := make(map[string]bool)
-		for _, s := range out {
-			seen[s] = true
+	for section, allowed := range defaultRolePermissions[role] {
+		if !allowed || seen[section] {
+			continue
 		}
-		for section, allowed := range perms {
-			if allowed && !seen[section] {
-				out = append(out, section)
-			}
+		out = append(out, section)
+		for _, action := range roleSectionActions(role, section, sql.NullString{}) {
+			out = append(out, boSectionScope(section, action))
 		}
 	}
 
@@ -316,12 +406,7 @@ func (s *Server) requireBORoleImportanceAtLeast(minImportance int) func(http.Han
 				return
 			}
 
-			importance, err := s.roleImportance(r.Context(), a.Role)
-			if err != nil {
-				httpx.WriteError(w, http.StatusInternalServerError, "Error validating role importance")
-				return
-			}
-			if importance < minImportance {
+			if a.User.RoleImportance < minImportance {
 				httpx.WriteError(w, http.StatusForbidden, "Forbidden")
 				return
 			}
@@ -346,12 +431,7 @@ func (s *Server) requireBOSection(section string) func(http.Handler) http.Handle
 				return
 			}
 
-			allowed, err := s.roleCanAccessSection(r.Context(), a.Role, normalized)
-			if err != nil {
-				httpx.WriteError(w, http.StatusInternalServerError, "Error validating permissions")
-				return
-			}
-			if !allowed {
+			if !boSectionAccessHas(a.User.SectionAccess, normalized) {
 				httpx.WriteError(w, http.StatusForbidden, "Forbidden")
 				return
 			}
@@ -360,3 +440,85 @@ func (s *Server) requireBOSection(section string) func(http.Handler) http.Handle
 		})
 	}
 }
+
+// requireBOPermission gates a route on a section and one action in it.
+// Access to the section itself is still checked by requireBOSection; the
+// action comes from the sectionAccess resolved with the session.
+func (s *Server) requireBOPermission(section, action string) func(http.Handler) http.Handler {
+	sectionGate := s.requireBOSection(section)
+	normalizedSection := normalizeBOSection(section)
+	normalizedAction := normalizeBOAction(action)
+	return func(next http.Handler) http.Handler {
+		checkAction := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if normalizedAction == "" {
+				httpx.WriteError(w, http.StatusInternalServerError, "Invalid RBAC action")
+				return
+			}
+			a, ok := boAuthFromContext(r.Context())
+			if !ok {
+				httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if !boSectionAccessAllows(a.User.SectionAccess, normalizedSection, normalizedAction) {
+				httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+					"success":    false,
+					"message":    "Tu rol no permite esta accion",
+					"error_code": "ACTION_FORBIDDEN",
+					"section":    normalizedSection,
+					"action":     normalizedAction,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+		return sectionGate(checkAction)
+	}
+}
+
+// boPermissionGate holds one middleware per action of a section, so routes
+// read as reservasGate.Edit.
+type boPermissionGate struct {
+	View   func(http.Handler) http.Handler
+	Create func(http.Handler) http.Handler
+	Edit   func(http.Handler) http.Handler
+	Delete func(http.Handler) http.Handler
+	Export func(http.Handler) http.Handler
+	// ByMethod picks the action from the HTTP method, for mounted
+	// sub-routers whose routes aren't listed in Routes.
+	ByMethod func(http.Handler) http.Handler
+}
+
+func (s *Server) boPermissionGate(section string) boPermissionGate {
+	g := boPermissionGate{
+		View:   s.requireBOPermission(section, boActionView),
+		Create: s.requireBOPermission(section, boActionCreate),
+		Edit:   s.requireBOPermission(section, boActionEdit),
+		Delete: s.requireBOPermission(section, boActionDelete),
+		Export: s.requireBOPermission(section, boActionExport),
+	}
+	g.ByMethod = func(next http.Handler) http.Handler {
+		byAction := map[string]http.Handler{
+			boActionView:   g.View(next),
+			boActionCreate: g.Create(next),
+			boActionEdit:   g.Edit(next),
+			boActionDelete: g.Delete(next),
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			byAction[boActionForMethod(r.Method)].ServeHTTP(w, r)
+		})
+	}
+	return g
+}
+
+func boActionForMethod(method string) string {
+	switch method {
+	case http.MethodPost:
+		return boActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return boActionEdit
+	case http.MethodDelete:
+		return boActionDelete
+	default:
+		return boActionView
+	}
+}
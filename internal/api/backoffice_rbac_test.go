@@ -0,0 +1,91 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRoleSectionActions(t *testing.T) {
+	cases := []struct {
+		role, section string
+		stored        sql.NullString
+		want          []string
+	}{
+		{"admin", boSectionFacturas, sql.NullString{}, boActions},
+		{"metre", boSectionFacturas, sql.NullString{}, []string{boActionView, boActionCreate, boActionEdit, boActionExport}},
+		{"metre", boSectionFacturas, sql.NullString{String: "export, delete", Valid: true}, []string{boActionView, boActionDelete, boActionExport}},
+		{"custom", boSectionMenus, sql.NullString{String: "bogus", Valid: true}, []string{boActionView}},
+	}
+	for _, c := range cases {
+		if got := roleSectionActions(c.role, c.section, c.stored); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("roleSectionActions(%q, %q, %q) = %v, want %v", c.role, c.section, c.stored.String, got, c.want)
+		}
+	}
+}
+
+func TestBOActionsColumn(t *testing.T) {
+	if got := boActionsColumn(boActions); got != nil {
+		t.Errorf("all actions should store NULL, got %v", got)
+	}
+	if got := boActionsColumn([]string{boActionEdit}); got != "view,edit" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestBOSectionAccessAllows(t *testing.T) {
+	access := []string{boSectionFacturas, "facturas:view", "facturas:edit"}
+	if !boSectionAccessAllows(access, boSectionFacturas, boActionEdit) {
+		t.Errorf("edit should be allowed")
+	}
+	if boSectionAccessAllows(access, boSectionFacturas, boActionDelete) {
+		t.Errorf("delete should be denied")
+	}
+}
+
+func TestBOActionForMethod(t *testing.T) {
+	cases := map[string]string{
+		http.MethodGet:    boActionView,
+		http.MethodHead:   boActionView,
+		http.MethodPost:   boActionCreate,
+		http.MethodPut:    boActionEdit,
+		http.MethodPatch:  boActionEdit,
+		http.MethodDelete: boActionDelete,
+	}
+	for method, want := range cases {
+		if got := boActionForMethod(method); got != want {
+			t.Errorf("boActionForMethod(%s) = %s, want %s", method, got, want)
+		}
+	}
+}
+
+func TestRequireBOSectionUsesSessionAccess(t *testing.T) {
+	s := &Server{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	serve := func(h http.Handler, u boUser) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(withBOAuth(req.Context(), boAuth{User: u}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// s.db is nil: any lookup outside the session would panic.
+	section := s.requireBOSection(boSectionFacturas)(ok)
+	if got := serve(section, boUser{SectionAccess: []string{boSectionFacturas}}); got != http.StatusNoContent {
+		t.Errorf("section granted: status = %d", got)
+	}
+	if got := serve(section, boUser{SectionAccess: []string{"facturas:view"}}); got != http.StatusForbidden {
+		t.Errorf("section missing: status = %d", got)
+	}
+
+	importance := s.requireBORoleImportanceAtLeast(90)(ok)
+	if got := serve(importance, boUser{RoleImportance: 90}); got != http.StatusNoContent {
+		t.Errorf("importance 90: status = %d", got)
+	}
+	if got := serve(importance, boUser{RoleImportance: 89}); got != http.StatusForbidden {
+		t.Errorf("importance 89: status = %d", got)
+	}
+}
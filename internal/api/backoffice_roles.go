@@ -22,6 +22,8 @@ type boRoleCatalogItem struct {
 	IconKey     string   `json:"iconKey"`
 	IsSystem    bool     `json:"isSystem"`
 	Permissions []string `json:"permissions"`
+	// Scopes maps each permitted section to its allowed actions.
+	Scopes map[string][]string `json:"scopes"`
 }
 
 type boRoleUserItem struct {
@@ -48,6 +50,9 @@ type boCreateRoleRequest struct {
 	Importance  *int     `json:"importance"`
 	IconKey     *string  `json:"iconKey"`
 	Permissions []string `json:"permissions"`
+	// Scopes optionally limits the actions per section; sections left out
+	// allow every action.
+	Scopes map[string][]string `json:"scopes"`
 }
 
 func defaultRoleLabel(role string) string {
@@ -276,7 +281,7 @@ func (s *Server) handleBORolesGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	permRows, err := s.db.QueryContext(r.Context(), `
-		SELECT role_slug, section_key
+		SELECT role_slug, section_key, actions
 		FROM bo_role_permissions
 		WHERE is_allowed = 1
 	`)
@@ -287,9 +292,11 @@ func (s *Server) handleBORolesGet(w http.ResponseWriter, r *http.Request) {
 	defer permRows.Close()
 
 	permsByRole := map[string][]string{}
+	scopesByRole := map[string]map[string][]string{}
 	for permRows.Next() {
 		var roleSlug, section string
-		if err := permRows.Scan(&roleSlug, &section); err != nil {
+		var actions sql.NullString
+		if err := permRows.Scan(&roleSlug, &section, &actions); err != nil {
 			httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo permisos")
 			return
 		}
@@ -299,21 +306,29 @@ func (s *Server) handleBORolesGet(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		permsByRole[roleSlug] = append(permsByRole[roleSlug], section)
+		if scopesByRole[roleSlug] == nil {
+			scopesByRole[roleSlug] = map[string][]string{}
+		}
+		scopesByRole[roleSlug][section] = roleSectionActions(roleSlug, section, actions)
 	}
 	for i := range catalog {
 		if perms, ok := permsByRole[catalog[i].Slug]; ok {
 			sort.Strings(perms)
 			catalog[i].Permissions = perms
+			catalog[i].Scopes = scopesByRole[catalog[i].Slug]
 			continue
 		}
 		fallback := make([]string, 0, 8)
+		scopes := map[string][]string{}
 		for section, allowed := range defaultRolePermissions[catalog[i].Slug] {
 			if allowed {
 				fallback = append(fallback, section)
+				scopes[section] = roleSectionActions(catalog[i].Slug, section, sql.NullString{})
 			}
 		}
 		sort.Strings(fallback)
 		catalog[i].Permissions = fallback
+		catalog[i].Scopes = scopes
 	}
 
 	rows, err := s.db.QueryContext(r.Context(), `
@@ -516,6 +531,31 @@ func (s *Server) handleBORoleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scopes := make(map[string][]string, len(permissions))
+	for _, section := range permissions {
+		scopes[section] = append([]string(nil), boActions...)
+	}
+	for rawSection, actions := range req.Scopes {
+		section := normalizeBOSection(rawSection)
+		if _, ok := scopes[section]; !ok {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Scopes solo puede limitar secciones incluidas en permissions",
+			})
+			return
+		}
+		for _, action := range actions {
+			if normalizeBOAction(action) == "" {
+				httpx.WriteJSON(w, http.StatusOK, map[string]any{
+					"success": false,
+					"message": "Accion invalida: " + action,
+				})
+				return
+			}
+		}
+		scopes[section] = normalizeBOActions(actions)
+	}
+
 	tx, err := s.db.BeginTx(r.Context(), nil)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error iniciando transacción")
@@ -539,10 +579,10 @@ func (s *Server) handleBORoleCreate(w http.ResponseWriter, r *http.Request) {
 
 	for _, section := range permissions {
 		if _, err := tx.ExecContext(r.Context(), `
-			INSERT INTO bo_role_permissions (role_slug, section_key, is_allowed)
-			VALUES (?, ?, 1)
-			ON DUPLICATE KEY UPDATE is_allowed = VALUES(is_allowed)
-		`, roleSlug, section); err != nil {
+			INSERT INTO bo_role_permissions (role_slug, section_key, is_allowed, actions)
+			VALUES (?, ?, 1, ?)
+			ON DUPLICATE KEY UPDATE is_allowed = VALUES(is_allowed), actions = VALUES(actions)
+		`, roleSlug, section, boActionsColumn(scopes[section])); err != nil {
 			httpx.WriteError(w, http.StatusInternalServerError, "Error creando permisos de rol")
 			return
 		}
@@ -552,6 +592,13 @@ func (s *Server) handleBORoleCreate(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error finalizando transacción")
 		return
 	}
+	s.invalidateBORoles()
+	s.recordBOAudit(r, boAuditEntry{
+		Action:   boAuditCreate,
+		Entity:   "role",
+		EntityID: roleSlug,
+		After:    map[string]any{"label": label, "importance": importance, "iconKey": iconKey, "permissions": permissions, "scopes": scopes},
+	})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -563,6 +610,7 @@ func (s *Server) handleBORoleCreate(w http.ResponseWriter, r *http.Request) {
 			IconKey:     iconKey,
 			IsSystem:    false,
 			Permissions: permissions,
+			Scopes:      scopes,
 		},
 	})
 }
@@ -735,6 +783,15 @@ func (s *Server) handleBOMemberEnsureUser(w http.ResponseWriter, r *http.Request
 	if strings.TrimSpace(userEmail) == "" {
 		userEmail = email
 	}
+	var before any
+	if memberUserID.Valid {
+		before = map[string]any{"boUserId": memberUserID.Int64}
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "ensure_user", Entity: "member", EntityID: memberID, Before: before, After: map[string]any{
+		"boUserId":    userID,
+		"email":       strings.TrimSpace(userEmail),
+		"userCreated": created,
+	}})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -896,6 +953,14 @@ func (s *Server) handleBOUserRolePatch(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error actualizando rol")
 		return
 	}
+	s.invalidateBOUserAuth(userID)
+	s.recordBOAudit(r, boAuditEntry{
+		Action:   boAuditUpdate,
+		Entity:   "user_role",
+		EntityID: userID,
+		Before:   map[string]any{"role": nullableString(targetRole), "roleImportance": targetImportance},
+		After:    map[string]any{"role": roleSlug, "roleImportance": newImportance},
+	})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
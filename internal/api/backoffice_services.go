@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boServiceInput struct {
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	StartTime    string `json:"startTime"`
+	EndTime      string `json:"endTime"`
+	CoversLimit  int    `json:"coversLimit"`
+	PacingLimit  int    `json:"pacingLimit"`
+	MinPartySize int    `json:"minPartySize"`
+	MaxPartySize int    `json:"maxPartySize"`
+	Active       *bool  `json:"active,omitempty"`
+}
+
+type boConfigServicesSetRequest struct {
+	Services []boServiceInput `json:"services"`
+}
+
+type boConfigServiceDayRequest struct {
+	Date        string `json:"date"`
+	Key         string `json:"key"`
+	CoversLimit *int   `json:"coversLimit"`
+	Closed      bool   `json:"closed"`
+}
+
+// normalizeBOServices validates a full service list. It returns a message
+// for the first invalid entry. Active services must not overlap, so every
+// hour belongs to at most one.
+func normalizeBOServices(in []boServiceInput) ([]reservationService, string) {
+	out := make([]reservationService, 0, len(in))
+	seen := map[string]bool{}
+	for i, item := range in {
+		name := strings.TrimSpace(item.Name)
+		if name == "" || len(name) > 64 {
+			return nil, "Nombre de servicio invalido"
+		}
+		key := normalizeServiceKey(item.Key)
+		if strings.TrimSpace(item.Key) == "" {
+			key = normalizeServiceKey(name)
+		}
+		if key == "" || seen[key] {
+			return nil, "Clave de servicio invalida o repetida: " + name
+		}
+		seen[key] = true
+
+		start, errStart := normalizeHHMM(item.StartTime)
+		end, errEnd := normalizeHHMM(item.EndTime)
+		_, okStart := hhmmToMinutes(start)
+		_, okEnd := hhmmToMinutes(end)
+		if errStart != nil || errEnd != nil || !okStart || !okEnd || serviceHourSortKey(start) > serviceHourSortKey(end) {
+			return nil, "Horario invalido en " + name
+		}
+		if item.CoversLimit < 0 || item.CoversLimit > 500 || item.PacingLimit < 0 || item.PacingLimit > 500 {
+			return nil, "Limite de cubiertos invalido en " + name
+		}
+		if item.MinPartySize < 0 || item.MaxPartySize < 0 || (item.MaxPartySize > 0 && item.MinPartySize > item.MaxPartySize) {
+			return nil, "Tamaño de mesa invalido en " + name
+		}
+
+		active := true
+		if item.Active != nil {
+			active = *item.Active
+		}
+		out = append(out, reservationService{
+			Key:          key,
+			Name:         name,
+			StartTime:    start,
+			EndTime:      end,
+			CoversLimit:  item.CoversLimit,
+			PacingLimit:  item.PacingLimit,
+			MinPartySize: item.MinPartySize,
+			MaxPartySize: item.MaxPartySize,
+			SortOrder:    i,
+			Active:       active,
+		})
+	}
+
+	for i, a := range out {
+		for _, b := range out[i+1:] {
+			if !a.Active || !b.Active {
+				continue
+			}
+			if serviceHourSortKey(a.StartTime) <= serviceHourSortKey(b.EndTime) && serviceHourSortKey(b.StartTime) <= serviceHourSortKey(a.EndTime) {
+				return nil, "Los servicios " + a.Name + " y " + b.Name + " se solapan"
+			}
+		}
+	}
+	return out, ""
+}
+
+func nullablePositiveInt(v int) any {
+	if v <= 0 {
+		return nil
+	}
+	return v
+}
+
+// Handle list of reservation services. With ?date= it also returns each
+// active service's limit, bookings and closed flag for that day.
+func (s *Server) handleBOConfigServicesGet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	services, err := s.loadReservationServices(r.Context(), s.db, a.ActiveRestaurantID, false)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando servicios")
+		return
+	}
+	resp := map[string]any{
+		"success":  true,
+		"services": services,
+	}
+
+	if date := strings.TrimSpace(r.URL.Query().Get("date")); date != "" {
+		if !isValidISODate(date) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Invalid date",
+			})
+			return
+		}
+		day, err := s.loadServiceDay(r.Context(), s.db, a.ActiveRestaurantID, date, 0)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando servicios")
+			return
+		}
+		if day == nil {
+			day = []serviceDayCapacity{}
+		}
+		resp["date"] = date
+		resp["day"] = day
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+// handleBOConfigServicesSet replaces the service list. Services left out are
+// deactivated rather than deleted, so their day overrides survive.
+func (s *Server) handleBOConfigServicesSet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boConfigServicesSetRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	services, msg := normalizeBOServices(req.Services)
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	restaurantID := a.ActiveRestaurantID
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE restaurant_services SET is_active = 0 WHERE restaurant_id = ?", restaurantID); err != nil {
+			return err
+		}
+		for _, svc := range services {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO restaurant_services (
+					restaurant_id, service_key, name, start_time, end_time, covers_limit, pacing_limit, min_party_size, max_party_size, sort_order, is_active
+				)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+					name = VALUES(name),
+					start_time = VALUES(start_time),
+					end_time = VALUES(end_time),
+					covers_limit = VALUES(covers_limit),
+					pacing_limit = VALUES(pacing_limit),
+					min_party_size = VALUES(min_party_size),
+					max_party_size = VALUES(max_party_size),
+					sort_order = VALUES(sort_order),
+					is_active = VALUES(is_active)
+			`, restaurantID, svc.Key, svc.Name, svc.StartTime, svc.EndTime, svc.CoversLimit,
+				nullablePositiveInt(svc.PacingLimit), nullablePositiveInt(svc.MinPartySize), nullablePositiveInt(svc.MaxPartySize),
+				svc.SortOrder, svc.Active); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando servicios")
+		return
+	}
+
+	saved, err := s.loadReservationServices(r.Context(), s.db, restaurantID, false)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando servicios")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"services": saved,
+	})
+}
+
+// handleBOConfigServiceDaySet overrides one service on one date: a different
+// covers limit, or closed. Sending neither clears the override.
+func (s *Server) handleBOConfigServiceDaySet(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boConfigServiceDayRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	date := strings.TrimSpace(req.Date)
+	if !isValidISODate(date) {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Invalid date",
+		})
+		return
+	}
+	if req.CoversLimit != nil && (*req.CoversLimit < 0 || *req.CoversLimit > 500) {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Invalid coversLimit",
+		})
+		return
+	}
+
+	restaurantID := a.ActiveRestaurantID
+	var serviceID int
+	err := s.db.QueryRowContext(r.Context(), `
+		SELECT id FROM restaurant_services
+		WHERE restaurant_id = ? AND service_key = ?
+		LIMIT 1
+	`, restaurantID, normalizeServiceKey(req.Key)).Scan(&serviceID)
+	if err == sql.ErrNoRows {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Servicio no encontrado",
+		})
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando servicios")
+		return
+	}
+
+	if req.CoversLimit == nil && !req.Closed {
+		_, err = s.db.ExecContext(r.Context(), `
+			DELETE FROM restaurant_service_days
+			WHERE restaurant_id = ? AND service_id = ? AND date = ?
+		`, restaurantID, serviceID, date)
+	} else {
+		var limit any
+		if req.CoversLimit != nil {
+			limit = *req.CoversLimit
+		}
+		_, err = s.db.ExecContext(r.Context(), `
+			INSERT INTO restaurant_service_days (restaurant_id, service_id, date, covers_limit, is_closed)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE covers_limit = VALUES(covers_limit), is_closed = VALUES(is_closed)
+		`, restaurantID, serviceID, date, limit, req.Closed)
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando servicio")
+		return
+	}
+
+	day, err := s.loadServiceDay(r.Context(), s.db, restaurantID, date, 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando servicios")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"date":    date,
+		"day":     day,
+	})
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+var (
+	errBOUserNotFound = errors.New("Usuario no encontrado")
+	errBOUserOutranks = errors.New("Tu rol debe tener una importancia superior al del usuario objetivo")
+)
+
+type boSessionInfo struct {
+	ID                 int64  `json:"id"`
+	Current            bool   `json:"current"`
+	Device             string `json:"device"`
+	IP                 string `json:"ip"`
+	UserAgent          string `json:"userAgent"`
+	ActiveRestaurantID int    `json:"activeRestaurantId"`
+	CreatedAt          string `json:"createdAt"`
+	LastSeenAt         string `json:"lastSeenAt"`
+	ExpiresAt          string `json:"expiresAt"`
+}
+
+// boDeviceLabel turns a User-Agent into a short label like "Chrome en
+// Android". Unknown parts are left out.
+func boDeviceLabel(ua string) string {
+	l := strings.ToLower(ua)
+	browser := ""
+	switch {
+	case strings.Contains(l, "edg/"):
+		browser = "Edge"
+	case strings.Contains(l, "opr/") || strings.Contains(l, "opera"):
+		browser = "Opera"
+	case strings.Contains(l, "firefox/") || strings.Contains(l, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(l, "chrome/") || strings.Contains(l, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(l, "safari/"):
+		browser = "Safari"
+	}
+	platform := ""
+	switch {
+	case strings.Contains(l, "iphone") || strings.Contains(l, "ipad"):
+		platform = "iOS"
+	case strings.Contains(l, "android"):
+		platform = "Android"
+	case strings.Contains(l, "windows"):
+		platform = "Windows"
+	case strings.Contains(l, "mac os x") || strings.Contains(l, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(l, "linux"):
+		platform = "Linux"
+	}
+	switch {
+	case browser != "" && platform != "":
+		return browser + " en " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Desconocido"
+	}
+}
+
+func (s *Server) listBOSessions(ctx context.Context, userID int, currentID int64) ([]boSessionInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, active_restaurant_id, created_at, last_seen_at, expires_at, ip, user_agent
+		FROM bo_sessions
+		WHERE user_id = ? AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []boSessionInfo{}
+	for rows.Next() {
+		var (
+			si                  boSessionInfo
+			createdAt, lastSeen sql.NullTime
+			expiresAt           time.Time
+			ip, ua              sql.NullString
+		)
+		if err := rows.Scan(&si.ID, &si.ActiveRestaurantID, &createdAt, &lastSeen, &expiresAt, &ip, &ua); err != nil {
+			return nil, err
+		}
+		si.Current = si.ID == currentID
+		si.IP = ip.String
+		si.UserAgent = ua.String
+		si.Device = boDeviceLabel(ua.String)
+		if createdAt.Valid {
+			si.CreatedAt = createdAt.Time.UTC().Format(time.RFC3339)
+		}
+		if lastSeen.Valid {
+			si.LastSeenAt = lastSeen.Time.UTC().Format(time.RFC3339)
+		}
+		si.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		out = append(out, si)
+	}
+	return out, rows.Err()
+}
+
+// checkBOManagedUser verifies that userID belongs to the active restaurant
+// and that the caller outranks them there.
+func (s *Server) checkBOManagedUser(ctx context.Context, a boAuth, userID int) error {
+	var isSuper int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.is_superadmin
+		FROM bo_users u
+		JOIN bo_user_restaurants ur ON ur.user_id = u.id AND ur.restaurant_id = ?
+		WHERE u.id = ?
+	`, a.ActiveRestaurantID, userID).Scan(&isSuper)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errBOUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	role, err := s.getBOUserRoleForRestaurant(ctx, userID, a.ActiveRestaurantID, isSuper != 0)
+	if err != nil {
+		return err
+	}
+	importance, err := s.roleImportance(ctx, role)
+	if err != nil {
+		return err
+	}
+	if a.User.RoleImportance <= importance {
+		return errBOUserOutranks
+	}
+	return nil
+}
+
+func writeBOManagedUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBOUserNotFound):
+		httpx.WriteJSON(w, http.StatusNotFound, map[string]any{
+			"success": false,
+			"message": err.Error(),
+		})
+	case errors.Is(err, errBOUserOutranks):
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": err.Error(),
+		})
+	default:
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando usuario")
+	}
+}
+
+func parseBOUserIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil || userID <= 0 {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "id invalido",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+// Handle list of the current user's active sessions
+func (s *Server) handleBOMySessionsList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessions, err := s.listBOSessions(r.Context(), a.User.ID, a.SessionID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo sesiones")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"sessions": sessions,
+	})
+}
+
+// Handle revoke one of the current user's sessions. Revoking the current one
+// is the same as logging out.
+func (s *Server) handleBOMySessionRevoke(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(strings.TrimSpace(chi.URLParam(r, "id")), 10, 64)
+	if err != nil || sessionID <= 0 {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "id invalido",
+		})
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE id = ? AND user_id = ?", sessionID, a.User.ID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cerrando sesion")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteJSON(w, http.StatusNotFound, map[string]any{
+			"success": false,
+			"message": "Sesion no encontrada",
+		})
+		return
+	}
+	s.invalidateBOUserAuth(a.User.ID)
+	if sessionID == a.SessionID {
+		clearBOSessionCookie(w, r)
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+	})
+}
+
+// Handle "log out everywhere else": revoke every session but the current one.
+func (s *Server) handleBOMySessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE user_id = ? AND id <> ?", a.User.ID, a.SessionID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cerrando sesiones")
+		return
+	}
+	s.invalidateBOUserAuth(a.User.ID)
+	n, _ := res.RowsAffected()
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"revoked": n,
+	})
+}
+
+// Handle list of another user's active sessions
+func (s *Server) handleBOUserSessionsList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, ok := parseBOUserIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.checkBOManagedUser(r.Context(), a, userID); err != nil {
+		writeBOManagedUserError(w, err)
+		return
+	}
+
+	sessions, err := s.listBOSessions(r.Context(), userID, 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo sesiones")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"sessions": sessions,
+	})
+}
+
+// Handle revoke all sessions of another user (e.g. when a member leaves).
+func (s *Server) handleBOUserSessionsRevoke(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, ok := parseBOUserIDParam(w, r)
+	if !ok {
+		return
+	}
+	if userID == a.User.ID {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Usa /me/sessions para tus propias sesiones",
+		})
+		return
+	}
+	if err := s.checkBOManagedUser(r.Context(), a, userID); err != nil {
+		writeBOManagedUserError(w, err)
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), "DELETE FROM bo_sessions WHERE user_id = ?", userID)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cerrando sesiones")
+		return
+	}
+	s.invalidateBOUserAuth(userID)
+	n, _ := res.RowsAffected()
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"revoked": n,
+	})
+}
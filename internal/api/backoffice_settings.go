@@ -17,6 +17,8 @@ type boIntegrations struct {
 	UazapiURL      string   `json:"uazapiUrl"`
 	UazapiToken    string   `json:"uazapiToken"`
 	RestaurantWhatsappNumbers []string `json:"restaurantWhatsappNumbers"`
+	// The signing secret itself is only returned when it is rotated.
+	N8nWebhookSecretSet bool `json:"n8nWebhookSecretSet"`
 }
 
 type boBranding struct {
@@ -41,12 +43,13 @@ func (s *Server) handleBOIntegrationsGet(w http.ResponseWriter, r *http.Request)
 	var uazURL sql.NullString
 	var uazToken sql.NullString
 	var numbersRaw sql.NullString
+	var webhookSecret sql.NullString
 	err := s.db.QueryRowContext(r.Context(), `
-		SELECT n8n_webhook_url, enabled_events_json, uazapi_url, uazapi_token, restaurant_whatsapp_numbers_json
+		SELECT n8n_webhook_url, enabled_events_json, uazapi_url, uazapi_token, restaurant_whatsapp_numbers_json, n8n_webhook_secret
 		FROM restaurant_integrations
 		WHERE restaurant_id = ?
 		LIMIT 1
-	`, restaurantID).Scan(&webhook, &enabledRaw, &uazURL, &uazToken, &numbersRaw)
+	`, restaurantID).Scan(&webhook, &enabledRaw, &uazURL, &uazToken, &numbersRaw, &webhookSecret)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando integraciones")
 		return
@@ -70,6 +73,7 @@ func (s *Server) handleBOIntegrationsGet(w http.ResponseWriter, r *http.Request)
 			UazapiURL:     strings.TrimSpace(uazURL.String),
 			UazapiToken:   strings.TrimSpace(uazToken.String),
 			RestaurantWhatsappNumbers: restaurantNumbers,
+			N8nWebhookSecretSet:       strings.TrimSpace(webhookSecret.String) != "",
 		},
 	})
 }
@@ -110,6 +114,16 @@ func (s *Server) handleBOIntegrationsSet(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	for _, ev := range input.EnabledEvents {
+		if !validWebhookSubscription(ev) {
+			httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "Evento desconocido: " + ev,
+			})
+			return
+		}
+	}
+
 	enabledJSON, _ := json.Marshal(input.EnabledEvents)
 	uazURL := strings.TrimSpace(input.UazapiURL)
 	uazToken := strings.TrimSpace(input.UazapiToken)
@@ -131,6 +145,9 @@ func (s *Server) handleBOIntegrationsSet(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var webhookSecret sql.NullString
+	_ = s.db.QueryRowContext(r.Context(), "SELECT n8n_webhook_secret FROM restaurant_integrations WHERE restaurant_id = ? LIMIT 1", restaurantID).Scan(&webhookSecret)
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
 		"integrations": boIntegrations{
@@ -139,6 +156,7 @@ func (s *Server) handleBOIntegrationsSet(w http.ResponseWriter, r *http.Request)
 			UazapiURL:     uazURL,
 			UazapiToken:   uazToken,
 			RestaurantWhatsappNumbers: input.RestaurantWhatsappNumbers,
+			N8nWebhookSecretSet:       strings.TrimSpace(webhookSecret.String) != "",
 		},
 	})
 }
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boTableAssignRequest struct {
+	Date    string `json:"date"`
+	Service string `json:"service"`
+	// TurnMinutes fixes the turn for every party. When 0 the turns learnt
+	// from history are used.
+	TurnMinutes int `json:"turnMinutes"`
+	// Reassign drops the current tables of the bookings in scope that
+	// haven't arrived yet and seats them again. Otherwise only bookings
+	// without a table are placed.
+	Reassign bool `json:"reassign"`
+}
+
+// loadAssignableTables returns the active tables of a restaurant with the
+// assignment attributes read from their metadata.
+func (s *Server) loadAssignableTables(ctx context.Context, restaurantID int) ([]assignableTable, error) {
+	rows, err := s.queryAllAsMaps(ctx, `SELECT * FROM restaurant_tables WHERE restaurant_id = ? ORDER BY id ASC`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]assignableTable, 0, len(rows))
+	for _, row := range rows {
+		if v, ok := row["is_active"]; ok && v != nil && !anyToBool(v) {
+			continue
+		}
+		table := normalizeBOPremiumTableRow(row)
+		id, _ := anyToInt64OK(table["id"])
+		capacity, _ := anyToInt64OK(table["capacity"])
+		if id <= 0 || capacity <= 0 {
+			continue
+		}
+		t := assignableTable{
+			ID:       id,
+			Name:     firstStringFromMap(table, "name"),
+			Capacity: int(capacity),
+			Order:    len(out),
+		}
+		if order, ok := anyToInt64OK(row["display_order"]); ok {
+			t.Order = int(order)
+		}
+		if meta, ok := asStringAnyMap(table["metadata"]); ok {
+			if floor, ok := anyToInt64OK(meta["floor_number"]); ok && floor >= 0 {
+				t.Floor = int(floor)
+			}
+			t.Group = strings.TrimSpace(firstStringFromMap(meta, "combine_group"))
+			t.Accessible = anyToBool(meta["accessible"])
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// loadAssignableBookings returns the bookings of date ordered by time.
+func (s *Server) loadAssignableBookings(ctx context.Context, restaurantID int, date string) ([]assignableBooking, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			customer_name,
+			TIME_FORMAT(reservation_time, '%H:%i'),
+			party_size,
+			preferred_floor_number,
+			COALESCE(highChairs, 0) + COALESCE(babyStrollers, 0),
+			table_number,
+			seat_status,
+			TIME_FORMAT(seated_at, '%H:%i'),
+			TIME_FORMAT(left_at, '%H:%i')
+		FROM bookings
+		WHERE restaurant_id = ? AND reservation_date = ?
+		ORDER BY reservation_time ASC, id ASC
+	`, restaurantID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []assignableBooking{}
+	for rows.Next() {
+		var (
+			b                            assignableBooking
+			floor                        sql.NullInt64
+			table, state, seated, leftAt sql.NullString
+		)
+		if err := rows.Scan(&b.ID, &b.CustomerName, &b.Time, &b.PartySize, &floor, &b.Extras, &table, &state, &seated, &leftAt); err != nil {
+			return nil, err
+		}
+		if floor.Valid {
+			v := int(floor.Int64)
+			b.PreferredFloor = &v
+		}
+		b.TableNumber = strings.TrimSpace(table.String)
+		b.SeatState = state.String
+		b.SeatedAt = seated.String
+		b.LeftAt = leftAt.String
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// planBOTableAssignments builds the plan for a request. It returns a message
+// when the request is invalid, and the table_number each booking had so apply
+// can skip rows changed in the meantime.
+func (s *Server) planBOTableAssignments(ctx context.Context, restaurantID int, req boTableAssignRequest) (tableAssignmentPlan, map[int]string, string, error) {
+	date := strings.TrimSpace(req.Date)
+	if !isValidISODate(date) {
+		return tableAssignmentPlan{}, nil, "Invalid date", nil
+	}
+	if req.TurnMinutes != 0 && (req.TurnMinutes < 30 || req.TurnMinutes > 360) {
+		return tableAssignmentPlan{}, nil, "turnMinutes invalido (30-360)", nil
+	}
+
+	var service *reservationService
+	if key := normalizeServiceKey(req.Service); key != "" {
+		services, err := s.loadReservationServices(ctx, s.db, restaurantID, true)
+		if err != nil {
+			return tableAssignmentPlan{}, nil, "", err
+		}
+		for i := range services {
+			if services[i].Key == key {
+				service = &services[i]
+				break
+			}
+		}
+		if service == nil {
+			return tableAssignmentPlan{}, nil, "Servicio no encontrado", nil
+		}
+	}
+
+	turns := fixedTurnTimes(req.TurnMinutes)
+	if req.TurnMinutes == 0 {
+		learnt, err := s.loadTurnTimes(ctx, restaurantID, turnHistoryDays)
+		if err != nil {
+			return tableAssignmentPlan{}, nil, "", err
+		}
+		turns = learnt
+	}
+
+	tables, err := s.loadAssignableTables(ctx, restaurantID)
+	if err != nil {
+		return tableAssignmentPlan{}, nil, "", err
+	}
+	all, err := s.loadAssignableBookings(ctx, restaurantID, date)
+	if err != nil {
+		return tableAssignmentPlan{}, nil, "", err
+	}
+
+	inScope := func(hhmm string) bool { return service == nil || service.containsHour(hhmm) }
+	bookings, previous := scopeAssignableBookings(all, tables, inScope, req.Reassign)
+	return planTableAssignments(tables, bookings, turns), previous, "", nil
+}
+
+// scopeAssignableBookings picks the bookings a plan works on and the
+// table_number each in-scope one had. Bookings outside the scope only
+// matter for the tables they hold. With reassign, in-scope bookings lose
+// their tables unless they have a seat state: guests already there (or
+// gone) keep theirs.
+func scopeAssignableBookings(all []assignableBooking, tables []assignableTable, inScope func(hhmm string) bool, reassign bool) ([]assignableBooking, map[int]string) {
+	previous := map[int]string{}
+	bookings := make([]assignableBooking, 0, len(all))
+	for _, b := range all {
+		if inScope(b.Time) {
+			previous[b.ID] = b.TableNumber
+			if reassign && b.SeatState == "" {
+				b.TableNumber = ""
+			}
+		} else if b.TableNumber == "" {
+			continue
+		}
+		b.TableIDs = resolveTableNumber(b.TableNumber, tables)
+		bookings = append(bookings, b)
+	}
+	return bookings, previous
+}
+
+// releasedTableBookings returns the unassigned bookings that still hold a
+// table in the database: a reassign took it from them and may have given
+// it to someone else, so apply clears it.
+func releasedTableBookings(plan tableAssignmentPlan, previous map[int]string) []int {
+	out := []int{}
+	for _, miss := range plan.Unassigned {
+		if previous[miss.BookingID] != "" {
+			out = append(out, miss.BookingID)
+		}
+	}
+	return out
+}
+
+func (s *Server) handleBOTablesAutoAssignPreview(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boTableAssignRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", "JSON inválido")
+		return
+	}
+	plan, _, msg, err := s.planBOTableAssignments(r.Context(), a.ActiveRestaurantID, req)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_ASSIGN_FAILED", "No se pudo calcular la asignacion")
+		return
+	}
+	if msg != "" {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", msg)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"date":    strings.TrimSpace(req.Date),
+		"service": normalizeServiceKey(req.Service),
+		"plan":    plan,
+	})
+}
+
+// handleBOTablesAutoAssignApply recomputes the plan and writes it. Bookings
+// a reassign left without a table have their old one cleared. Bookings whose
+// table_number changed since it was read are left alone and reported as
+// skipped.
+func (s *Server) handleBOTablesAutoAssignApply(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boTableAssignRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", "JSON inválido")
+		return
+	}
+	restaurantID := a.ActiveRestaurantID
+	plan, previous, msg, err := s.planBOTableAssignments(r.Context(), restaurantID, req)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_ASSIGN_FAILED", "No se pudo calcular la asignacion")
+		return
+	}
+	if msg != "" {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", msg)
+		return
+	}
+
+	toRelease := releasedTableBookings(plan, previous)
+	before := map[int]webhookBookingSnapshot{}
+	for _, as := range plan.Assignments {
+		before[as.BookingID], _ = s.loadWebhookBookingSnapshot(r.Context(), restaurantID, as.BookingID)
+	}
+	for _, id := range toRelease {
+		before[id], _ = s.loadWebhookBookingSnapshot(r.Context(), restaurantID, id)
+	}
+
+	applied := []tableAssignment{}
+	released := []int{}
+	skipped := []int{}
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		// Released first, so no table is held twice even for a moment.
+		for _, id := range toRelease {
+			res, err := tx.ExecContext(ctx, `
+				UPDATE bookings SET table_number = NULL
+				WHERE restaurant_id = ? AND id = ? AND TRIM(COALESCE(table_number, '')) = ?
+			`, restaurantID, id, previous[id])
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				skipped = append(skipped, id)
+				continue
+			}
+			released = append(released, id)
+		}
+		for _, as := range plan.Assignments {
+			res, err := tx.ExecContext(ctx, `
+				UPDATE bookings SET table_number = ?
+				WHERE restaurant_id = ? AND id = ? AND TRIM(COALESCE(table_number, '')) = ?
+			`, as.TableNumber, restaurantID, as.BookingID, previous[as.BookingID])
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				skipped = append(skipped, as.BookingID)
+				continue
+			}
+			applied = append(applied, as)
+		}
+		return nil
+	})
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_ASSIGN_FAILED", "No se pudo guardar la asignacion")
+		return
+	}
+
+	for _, as := range applied {
+		s.recordBOAudit(r, boAuditEntry{
+			Action:   boAuditUpdate,
+			Entity:   "booking",
+			EntityID: as.BookingID,
+			Before:   map[string]any{"table_number": previous[as.BookingID]},
+			After:    map[string]any{"table_number": as.TableNumber},
+		})
+		s.emitBookingUpdatedWebhooks(r.Context(), restaurantID, as.BookingID, "backoffice_table_auto_assign", before[as.BookingID])
+	}
+	for _, id := range released {
+		s.recordBOAudit(r, boAuditEntry{
+			Action:   boAuditUpdate,
+			Entity:   "booking",
+			EntityID: id,
+			Before:   map[string]any{"table_number": previous[id]},
+			After:    map[string]any{"table_number": nil},
+		})
+		s.emitBookingUpdatedWebhooks(r.Context(), restaurantID, id, "backoffice_table_auto_assign", before[id])
+	}
+	plan.Assignments = applied
+
+	date := strings.TrimSpace(req.Date)
+	service := normalizeServiceKey(req.Service)
+	s.broadcastBOTablesEvent(restaurantID, "tables_auto_assigned", map[string]any{
+		"date":        date,
+		"service":     service,
+		"assignments": plan.Assignments,
+		"unassigned":  plan.Unassigned,
+		"released":    released,
+	})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"date":     date,
+		"service":  service,
+		"plan":     plan,
+		"released": released,
+		"skipped":  skipped,
+	})
+}
+
+// handleBOTablesTurnTimes returns the turn durations learnt from history.
+func (s *Server) handleBOTablesTurnTimes(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	days := clampInt(r.URL.Query().Get("days"), 7, 365, turnHistoryDays)
+	turns, err := s.loadTurnTimes(r.Context(), a.ActiveRestaurantID, days)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_READ_FAILED", "No se pudieron calcular los turnos")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"days":       days,
+		"minSamples": minTurnSamples,
+		"turns":      turns,
+	})
+}
+
+// handleBOTablesFree lists the tables and combinations free for a new party
+// at a time, taking into account when the tables already in use are
+// expected to be released.
+func (s *Server) handleBOTablesFree(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	date := strings.TrimSpace(q.Get("date"))
+	if !isValidISODate(date) {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", "date invalida")
+		return
+	}
+	hhmm, err := normalizeHHMM(q.Get("time"))
+	if _, ok := hhmmToMinutes(hhmm); err != nil || !ok {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", "time invalida")
+		return
+	}
+	partySize := clampInt(q.Get("partySize"), 1, 100, 0)
+	if partySize <= 0 {
+		writeBOPremiumError(w, http.StatusBadRequest, "BAD_REQUEST", "partySize invalido")
+		return
+	}
+
+	restaurantID := a.ActiveRestaurantID
+	turns, err := s.loadTurnTimes(r.Context(), restaurantID, turnHistoryDays)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_READ_FAILED", "No se pudieron calcular los turnos")
+		return
+	}
+	tables, err := s.loadAssignableTables(r.Context(), restaurantID)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_READ_FAILED", "No se pudieron cargar mesas")
+		return
+	}
+	bookings, err := s.loadAssignableBookings(r.Context(), restaurantID, date)
+	if err != nil {
+		writeBOPremiumError(w, http.StatusInternalServerError, "TABLES_READ_FAILED", "No se pudieron cargar reservas")
+		return
+	}
+	for i := range bookings {
+		bookings[i].TableIDs = resolveTableNumber(bookings[i].TableNumber, tables)
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":     true,
+		"date":        date,
+		"time":        hhmm,
+		"partySize":   partySize,
+		"turnMinutes": turns.forParty(partySize),
+		"options":     freeTablesFor(tables, bookings, turns, hhmm, partySize),
+	})
+}
+
+// handleBOTablesWSBookingState applies a booking_state message from the
+// tables websocket and returns the reply for the sender. Everyone else gets
+// the change through the broadcast.
+func (s *Server) handleBOTablesWSBookingState(r *http.Request, a boAuth, bookingID int, rawState string) map[string]any {
+	reply := map[string]any{"type": "booking_state_result", "bookingId": bookingID}
+	fail := func(code, message string) map[string]any {
+		reply["success"] = false
+		reply["code"] = code
+		reply["message"] = message
+		return reply
+	}
+
+	if !boSectionAccessAllows(a.User.SectionAccess, boSectionReservas, boActionEdit) {
+		return fail("ACTION_FORBIDDEN", "Tu rol no permite esta accion")
+	}
+	state, ok := normalizeBookingSeatState(rawState)
+	if !ok || bookingID <= 0 {
+		return fail("BAD_REQUEST", "Estado invalido")
+	}
+	booking, err := s.setBookingSeatState(r, a.ActiveRestaurantID, bookingID, state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail("NOT_FOUND", "Reserva no encontrada")
+	}
+	if err != nil {
+		return fail("BOOKING_STATE_FAILED", "No se pudo guardar el estado")
+	}
+	reply["success"] = true
+	reply["booking"] = booking
+	return reply
+}
+
+// handleBOTablesWSBookingAttendance applies a booking_attendance message
+// (arrived, no_show or "" to clear) from the tables websocket.
+func (s *Server) handleBOTablesWSBookingAttendance(r *http.Request, a boAuth, bookingID int, rawAttendance string) map[string]any {
+	reply := map[string]any{"type": "booking_attendance_result", "bookingId": bookingID}
+	fail := func(code, message string) map[string]any {
+		reply["success"] = false
+		reply["code"] = code
+		reply["message"] = message
+		return reply
+	}
+
+	if !boSectionAccessAllows(a.User.SectionAccess, boSectionReservas, boActionEdit) {
+		return fail("ACTION_FORBIDDEN", "Tu rol no permite esta accion")
+	}
+	attendance, ok := normalizeBookingAttendance(rawAttendance)
+	if !ok || bookingID <= 0 {
+		return fail("BAD_REQUEST", "Asistencia invalida")
+	}
+	booking, err := s.setBookingAttendance(r, a.ActiveRestaurantID, bookingID, attendance)
+	if code, message := bookingAttendanceErrorMessage(err); code != "" {
+		return fail(code, message)
+	}
+	reply["success"] = true
+	reply["booking"] = booking
+	return reply
+}
@@ -0,0 +1,707 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"preactvillacarmen/internal/httpx"
+	"preactvillacarmen/internal/lib/qrcode"
+)
+
+const (
+	boLoginChallengeTTL         = 5 * time.Minute
+	boLoginChallengeMaxAttempts = 5
+)
+
+var (
+	errBOTwoFactorNotEnabled = errors.New("2FA no activado")
+	errBOTwoFactorInvalid    = errors.New("Codigo de verificacion incorrecto")
+)
+
+type boTwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type boLoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type boTwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// boTwoFactorRequired reports whether a role must have 2FA enrolled.
+// BO_2FA_REQUIRED_IMPORTANCE=0 turns enforcement off.
+func (s *Server) boTwoFactorRequired(roleImportance int) bool {
+	min := s.cfg.BOTwoFactorImportance
+	return min > 0 && roleImportance >= min
+}
+
+// boTwoFactorSetupPath lists what a session that still has to enrol can reach.
+func boTwoFactorSetupPath(path string) bool {
+	path = strings.TrimPrefix(strings.ToLower(path), "/api")
+	return path == "/admin/me" ||
+		path == "/admin/active-restaurant" ||
+		path == "/admin/me/password" ||
+		strings.HasPrefix(path, "/admin/me/2fa")
+}
+
+// writeBOTwoFactorChallenge answers a correct password of a 2FA user with a
+// short-lived challenge to redeem at /login/2fa.
+func (s *Server) writeBOTwoFactorChallenge(w http.ResponseWriter, r *http.Request, userID int) {
+	token, tokenSHA, err := newBOSessionToken()
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error creando sesion")
+		return
+	}
+	_, err = s.db.ExecContext(r.Context(), `
+		INSERT INTO bo_login_challenges (token_sha256, user_id, expires_at)
+		VALUES (?, ?, ?)
+	`, tokenSHA, userID, time.Now().Add(boLoginChallengeTTL))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error creando sesion")
+		return
+	}
+	_, _ = s.db.ExecContext(r.Context(), "DELETE FROM bo_login_challenges WHERE expires_at < NOW()")
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":           false,
+		"twoFactorRequired": true,
+		"challengeToken":    token,
+		"message":           "Introduce el codigo de tu app de autenticacion",
+	})
+}
+
+// verifyBOSecondFactorTx accepts either a TOTP code or an unused recovery
+// code of a user with 2FA enabled, and consumes it. secretKey is
+// BO_2FA_SECRET_KEY, used to open the stored secret.
+func verifyBOSecondFactorTx(ctx context.Context, tx *sql.Tx, secretKey string, userID int, code string) (usedRecovery bool, err error) {
+	var (
+		secret   sql.NullString
+		enabled  bool
+		lastStep sql.NullInt64
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step
+		FROM bo_users
+		WHERE id = ?
+		FOR UPDATE
+	`, userID).Scan(&secret, &enabled, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, errBOTwoFactorNotEnabled
+	}
+	if err != nil {
+		return false, err
+	}
+	if !enabled || !secret.Valid {
+		return false, errBOTwoFactorNotEnabled
+	}
+
+	plainSecret, plain, err := openTOTPSecret(secretKey, userID, secret.String)
+	if err != nil {
+		return false, err
+	}
+	if step, ok := totpVerify(plainSecret, code, time.Now(), lastStep.Int64); ok {
+		stored := secret.String
+		if plain && secretKey != "" {
+			if stored, err = sealTOTPSecret(secretKey, userID, plainSecret); err != nil {
+				return false, err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE bo_users SET totp_last_step = ?, totp_secret = ? WHERE id = ?", step, stored, userID)
+		return false, err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != 10 {
+		return false, errBOTwoFactorInvalid
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE bo_user_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = ? AND code_sha256 = ? AND used_at IS NULL
+	`, userID, sha256Hex(normalized))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return false, errBOTwoFactorInvalid
+	}
+	return true, nil
+}
+
+// replaceBORecoveryCodesTx discards the user's recovery codes and returns a
+// fresh set. Only hashes are stored.
+func replaceBORecoveryCodesTx(ctx context.Context, tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := newRecoveryCodes(boRecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM bo_user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO bo_user_recovery_codes (user_id, code_sha256) VALUES (?, ?)
+		`, userID, sha256Hex(normalizeRecoveryCode(c))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func writeBOTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBOTwoFactorInvalid):
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": err.Error(),
+		})
+	case errors.Is(err, errBOTwoFactorNotEnabled):
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": err.Error(),
+		})
+	default:
+		httpx.WriteError(w, http.StatusInternalServerError, "Error verificando 2FA")
+	}
+}
+
+// boTwoFactorThrottled applies the login lockout, per IP and per account,
+// to session endpoints that check a code, so a stolen session cookie can't
+// brute-force codes there either. It writes the 429 and returns true when
+// the request has to wait.
+func (s *Server) boTwoFactorThrottled(w http.ResponseWriter, r *http.Request, userID int) bool {
+	for _, k := range []struct{ scope, key string }{
+		{boLoginScopeIP, clientIP(r)},
+		{boLoginScopeAccount, boLoginAccountKey(userID, "")},
+	} {
+		wait, err := s.boLoginThrottleWait(r.Context(), k.scope, k.key)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error comprobando intentos de acceso")
+			return true
+		}
+		if wait > 0 {
+			writeBOLoginThrottled(w, wait)
+			return true
+		}
+	}
+	return false
+}
+
+// recordBOTwoFactorAttempt counts a wrong code (or password) against the
+// account and IP, and clears the account counter once a code is accepted.
+func (s *Server) recordBOTwoFactorAttempt(r *http.Request, userID int, err error) {
+	accountKey := boLoginAccountKey(userID, "")
+	switch {
+	case err == nil:
+		s.clearBOLoginFailures(r.Context(), accountKey)
+	case errors.Is(err, errBOTwoFactorInvalid):
+		s.recordBOLoginFailures(r.Context(), accountKey, userID, clientIP(r))
+	}
+}
+
+func writeBOLoginChallengeExpired(w http.ResponseWriter) {
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":    false,
+		"message":    "La verificacion ha caducado. Inicia sesion de nuevo",
+		"error_code": "CHALLENGE_EXPIRED",
+	})
+}
+
+// Handle second login step: redeem the challenge with a TOTP or recovery code.
+func (s *Server) handleBOLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req boLoginTwoFactorRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	token := strings.TrimSpace(req.ChallengeToken)
+	if token == "" || strings.TrimSpace(req.Code) == "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Codigo requerido",
+		})
+		return
+	}
+
+	ip := clientIP(r)
+	if wait, err := s.boLoginThrottleWait(r.Context(), boLoginScopeIP, ip); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error comprobando intentos de acceso")
+		return
+	} else if wait > 0 {
+		writeBOLoginThrottled(w, wait)
+		return
+	}
+
+	// The account lockout applies to the second step too: otherwise a
+	// stolen password could keep trying codes from fresh challenges.
+	var userID int
+	err := s.db.QueryRowContext(r.Context(), `
+		SELECT user_id FROM bo_login_challenges WHERE token_sha256 = ? AND expires_at > NOW()
+	`, sha256Hex(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeBOLoginChallengeExpired(w)
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error verificando 2FA")
+		return
+	}
+	accountKey := boLoginAccountKey(userID, "")
+	if wait, err := s.boLoginThrottleWait(r.Context(), boLoginScopeAccount, accountKey); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error comprobando intentos de acceso")
+		return
+	} else if wait > 0 {
+		writeBOLoginThrottled(w, wait)
+		return
+	}
+
+	var (
+		expired  bool
+		verified bool
+	)
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var challengeID int64
+		var attempts int
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, user_id, attempts
+			FROM bo_login_challenges
+			WHERE token_sha256 = ? AND expires_at > NOW()
+			FOR UPDATE
+		`, sha256Hex(token)).Scan(&challengeID, &userID, &attempts)
+		if errors.Is(err, sql.ErrNoRows) {
+			expired = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = verifyBOSecondFactorTx(ctx, tx, s.cfg.BOTwoFactorSecretKey, userID, req.Code)
+		if errors.Is(err, errBOTwoFactorInvalid) {
+			if attempts+1 >= boLoginChallengeMaxAttempts {
+				_, err = tx.ExecContext(ctx, "DELETE FROM bo_login_challenges WHERE id = ?", challengeID)
+			} else {
+				_, err = tx.ExecContext(ctx, "UPDATE bo_login_challenges SET attempts = attempts + 1 WHERE id = ?", challengeID)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		verified = true
+		_, err = tx.ExecContext(ctx, "DELETE FROM bo_login_challenges WHERE id = ?", challengeID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errBOTwoFactorNotEnabled) {
+			expired = true
+		} else {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error verificando 2FA")
+			return
+		}
+	}
+	if expired {
+		writeBOLoginChallengeExpired(w)
+		return
+	}
+
+	if !verified {
+		s.recordBOLoginFailures(r.Context(), accountKey, userID, ip)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": errBOTwoFactorInvalid.Error(),
+		})
+		return
+	}
+	s.clearBOLoginFailures(r.Context(), accountKey)
+
+	var (
+		u                  = boLoginUser{ID: userID, TwoFactorEnabled: true}
+		username           sql.NullString
+		isSuper            int
+		mustChangePassword int
+	)
+	err = s.db.QueryRowContext(r.Context(), `
+		SELECT email, username, name, is_superadmin, must_change_password
+		FROM bo_users
+		WHERE id = ?
+	`, userID).Scan(&u.Email, &username, &u.Name, &isSuper, &mustChangePassword)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo usuario")
+		return
+	}
+	u.Username = strings.TrimSpace(username.String)
+	u.IsSuperadmin = isSuper != 0
+	u.MustChangePassword = mustChangePassword != 0
+
+	s.startBOSession(w, r, u)
+}
+
+// Handle get 2FA status of the current user
+func (s *Server) handleBOTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var pending bool
+	var remaining int
+	err := s.db.QueryRowContext(r.Context(), `
+		SELECT
+			u.totp_secret IS NOT NULL AND u.totp_enabled_at IS NULL,
+			(SELECT COUNT(*) FROM bo_user_recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM bo_users u
+		WHERE u.id = ?
+	`, a.User.ID).Scan(&pending, &remaining)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo 2FA")
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":                true,
+		"enabled":                a.User.TwoFactorEnabled,
+		"required":               s.boTwoFactorRequired(a.User.RoleImportance),
+		"pendingSetup":           pending,
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// Handle start 2FA enrolment: generate a secret to scan with an
+// authenticator app. It only takes effect once confirmed via /enable.
+func (s *Server) handleBOTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if a.User.TwoFactorEnabled {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": "2FA ya esta activado",
+		})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error generando secreto")
+		return
+	}
+	stored, err := sealTOTPSecret(s.cfg.BOTwoFactorSecretKey, a.User.ID, secret)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error generando secreto")
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `
+		UPDATE bo_users SET totp_secret = ?, totp_last_step = NULL WHERE id = ? AND totp_enabled_at IS NULL
+	`, stored, a.User.ID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando secreto")
+		return
+	}
+
+	account := a.User.Email
+	if account == "" {
+		account = a.User.Username
+	}
+	uri := totpProvisioningURI(s.cfg.BOTwoFactorIssuer, account, secret)
+	resp := map[string]any{
+		"success":    true,
+		"secret":     secret,
+		"otpauthUri": uri,
+	}
+	if code, err := qrcode.Encode([]byte(uri)); err == nil {
+		resp["qrSvg"] = code.SVG(4)
+	}
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+// Handle confirm 2FA enrolment with a first code. Returns the recovery codes
+// (shown once) and signs out the user's other sessions.
+func (s *Server) handleBOTwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boTwoFactorCodeRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	if s.boTwoFactorThrottled(w, r, a.User.ID) {
+		return
+	}
+
+	var codes []string
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var secret sql.NullString
+		var enabled bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT totp_secret, totp_enabled_at IS NOT NULL FROM bo_users WHERE id = ? FOR UPDATE
+		`, a.User.ID).Scan(&secret, &enabled); err != nil {
+			return err
+		}
+		if enabled || !secret.Valid {
+			return errBOTwoFactorNotEnabled
+		}
+		plainSecret, _, err := openTOTPSecret(s.cfg.BOTwoFactorSecretKey, a.User.ID, secret.String)
+		if err != nil {
+			return err
+		}
+		step, ok := totpVerify(plainSecret, req.Code, time.Now(), 0)
+		if !ok {
+			return errBOTwoFactorInvalid
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE bo_users SET totp_enabled_at = NOW(), totp_last_step = ? WHERE id = ?
+		`, step, a.User.ID); err != nil {
+			return err
+		}
+		codes, err = replaceBORecoveryCodesTx(ctx, tx, a.User.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE bo_sessions SET mfa_verified_at = ? WHERE id = ?
+		`, time.Now(), a.SessionID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM bo_sessions WHERE user_id = ? AND id <> ?", a.User.ID, a.SessionID)
+		return err
+	})
+	s.recordBOTwoFactorAttempt(r, a.User.ID, err)
+	if errors.Is(err, errBOTwoFactorNotEnabled) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": "Inicia la configuracion de 2FA primero",
+		})
+		return
+	}
+	if err != nil {
+		writeBOTwoFactorError(w, err)
+		return
+	}
+	s.invalidateBOUserAuth(a.User.ID)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+// Handle disable 2FA (password and a current code required). Not allowed
+// while the user's role requires 2FA.
+func (s *Server) handleBOTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if s.boTwoFactorRequired(a.User.RoleImportance) {
+		httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"message": "Tu rol requiere 2FA",
+		})
+		return
+	}
+
+	var req boTwoFactorDisableRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	if s.boTwoFactorThrottled(w, r, a.User.ID) {
+		return
+	}
+
+	var hash string
+	if err := s.db.QueryRowContext(r.Context(), "SELECT password_hash FROM bo_users WHERE id = ?", a.User.ID).Scan(&hash); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo usuario")
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		s.recordBOTwoFactorAttempt(r, a.User.ID, errBOTwoFactorInvalid)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Password incorrecto",
+		})
+		return
+	}
+
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := verifyBOSecondFactorTx(ctx, tx, s.cfg.BOTwoFactorSecretKey, a.User.ID, req.Code); err != nil {
+			return err
+		}
+		return clearBOTwoFactorTx(ctx, tx, a.User.ID)
+	})
+	s.recordBOTwoFactorAttempt(r, a.User.ID, err)
+	if err != nil {
+		writeBOTwoFactorError(w, err)
+		return
+	}
+	s.invalidateBOUserAuth(a.User.ID)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+	})
+}
+
+func clearBOTwoFactorTx(ctx context.Context, tx *sql.Tx, userID int) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE bo_users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = ?
+	`, userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM bo_user_recovery_codes WHERE user_id = ?", userID)
+	return err
+}
+
+// Handle regenerate recovery codes (invalidates the previous ones)
+func (s *Server) handleBOTwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boTwoFactorCodeRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	if s.boTwoFactorThrottled(w, r, a.User.ID) {
+		return
+	}
+
+	var codes []string
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := verifyBOSecondFactorTx(ctx, tx, s.cfg.BOTwoFactorSecretKey, a.User.ID, req.Code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceBORecoveryCodesTx(ctx, tx, a.User.ID)
+		return err
+	})
+	s.recordBOTwoFactorAttempt(r, a.User.ID, err)
+	if err != nil {
+		writeBOTwoFactorError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+// Handle step-up verification for high-security paths (invoices, account
+// statements): refreshes the session's 2FA timestamp.
+func (s *Server) handleBOTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req boTwoFactorCodeRequest
+	if err := readJSONBody(r, &req); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+
+	if s.boTwoFactorThrottled(w, r, a.User.ID) {
+		return
+	}
+
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := verifyBOSecondFactorTx(ctx, tx, s.cfg.BOTwoFactorSecretKey, a.User.ID, req.Code); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE bo_sessions SET mfa_verified_at = ? WHERE id = ?", time.Now(), a.SessionID)
+		return err
+	})
+	s.recordBOTwoFactorAttempt(r, a.User.ID, err)
+	if err != nil {
+		writeBOTwoFactorError(w, err)
+		return
+	}
+	s.invalidateBOUserAuth(a.User.ID)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+	})
+}
+
+// Handle reset of another user's 2FA (lost device). The user has to enrol
+// again on next login and all their sessions are closed.
+func (s *Server) handleBOUserTwoFactorReset(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, ok := parseBOUserIDParam(w, r)
+	if !ok {
+		return
+	}
+	if userID == a.User.ID {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Usa /me/2fa para gestionar tu propio 2FA",
+		})
+		return
+	}
+	if err := s.checkBOManagedUser(r.Context(), a, userID); err != nil {
+		writeBOManagedUserError(w, err)
+		return
+	}
+
+	err := withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := clearBOTwoFactorTx(ctx, tx, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM bo_sessions WHERE user_id = ?", userID)
+		return err
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error reseteando 2FA")
+		return
+	}
+	s.invalidateBOUserAuth(userID)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+	})
+}
@@ -12,6 +12,9 @@ type boUser struct {
 	SectionAccess  []string `json:"sectionAccess"`
 	MustChangePass bool     `json:"mustChangePassword"`
 
+	TwoFactorEnabled  bool `json:"twoFactorEnabled"`
+	TwoFactorRequired bool `json:"twoFactorRequired"`
+
 	// Internal flags (not returned to clients).
 	isSuperadmin bool
 }
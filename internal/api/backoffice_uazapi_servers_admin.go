@@ -231,6 +231,7 @@ func (s *Server) handleBOUAZAPIServersCreate(w http.ResponseWriter, r *http.Requ
 		writeBOUAZAPIServerError(w, http.StatusInternalServerError, "UAZAPI_SERVER_READ_FAILED", "No se pudo cargar servidor UAZAPI")
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "uazapi_server", EntityID: server.ID, After: server})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
@@ -278,7 +279,7 @@ func (s *Server) handleBOUAZAPIServersPatch(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, found, err := s.loadBOUAZAPIServerByID(r.Context(), id)
+	before, found, err := s.loadBOUAZAPIServerByID(r.Context(), id)
 	if err != nil {
 		if isSQLSchemaError(err) {
 			writeBOUAZAPIServerError(w, http.StatusServiceUnavailable, "UAZAPI_POOL_UNAVAILABLE", "Pool UAZAPI no disponible")
@@ -430,6 +431,7 @@ func (s *Server) handleBOUAZAPIServersPatch(w http.ResponseWriter, r *http.Reque
 		writeBOUAZAPIServerError(w, http.StatusNotFound, "NOT_FOUND", "Servidor UAZAPI no encontrado")
 		return
 	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "uazapi_server", EntityID: id, Before: before, After: server})
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success": true,
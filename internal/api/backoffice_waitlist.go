@@ -0,0 +1,254 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// handleBOWaitlistList lists the waitlist of a date (or every upcoming date
+// without ?date=), optionally filtered by status.
+func (s *Server) handleBOWaitlistList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	var (
+		where []string
+		args  []any
+	)
+	if date := strings.TrimSpace(q.Get("date")); date != "" {
+		if !isValidISODate(date) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Invalid date",
+			})
+			return
+		}
+		where = append(where, "reservation_date = ?")
+		args = append(args, date)
+	} else {
+		where = append(where, "reservation_date >= ?")
+		args = append(args, time.Now().In(boMadridTZ).Format("2006-01-02"))
+	}
+	if status := strings.ToLower(strings.TrimSpace(q.Get("status"))); status != "" {
+		if !slices.Contains(waitlistStatuses, status) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Invalid status",
+			})
+			return
+		}
+		where = append(where, "status = ?")
+		args = append(args, status)
+	}
+
+	entries, err := s.loadWaitlistEntries(r.Context(), a.ActiveRestaurantID, strings.Join(where, " AND "), args...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando lista de espera")
+		return
+	}
+	setWaitlistPositions(entries)
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"waitlist": entries,
+	})
+}
+
+// handleBOWaitlistCreate adds an entry taken by phone. Unlike the public
+// endpoint it does not check whether the window still has room.
+func (s *Server) handleBOWaitlistCreate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var in waitlistInput
+	if err := readJSONBody(r, &in); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	e, msg := normalizeWaitlistInput(in, time.Now().In(boMadridTZ).Format("2006-01-02"))
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	entry, created, err := s.insertWaitlistEntry(r.Context(), a.ActiveRestaurantID, e, publicBaseURL(r))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando lista de espera")
+		return
+	}
+	entry.Position = s.waitlistPosition(r.Context(), a.ActiveRestaurantID, entry)
+	if created {
+		s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "waitlist", EntityID: entry.ID, After: entry})
+		s.emitN8nWebhookAsync(a.ActiveRestaurantID, webhookEventWaitlistJoined, waitlistWebhookPayload("backoffice", entry))
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"created":  created,
+		"waitlist": entry,
+	})
+}
+
+// handleBOWaitlistOffer sends the claim link to a waiting or expired entry.
+// Without a time it picks the first free hour of the entry's window; with
+// one it is offered as is, like staff bookings may overbook.
+func (s *Server) handleBOWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+	var req struct {
+		Time string `json:"time"`
+	}
+	if r.ContentLength != 0 {
+		if err := readJSONBody(r, &req); err != nil {
+			httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "Invalid JSON",
+			})
+			return
+		}
+	}
+
+	ctx := r.Context()
+	before, err := s.loadWaitlistEntry(ctx, a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Entrada no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo lista de espera")
+		return
+	}
+	if before.Status != waitlistWaiting && before.Status != waitlistExpired {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "La entrada no esta en espera",
+		})
+		return
+	}
+
+	hhmm := ""
+	if strings.TrimSpace(req.Time) != "" {
+		v, err := normalizeHHMM(req.Time)
+		if _, ok := hhmmToMinutes(v); err != nil || !ok {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "Hora invalida",
+			})
+			return
+		}
+		hhmm = v
+	} else {
+		hours, err := s.computeAvailableHoursForPartySize(r, before.Date, before.PartySize)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando disponibilidad")
+			return
+		}
+		held, err := s.waitlistHeldCovers(ctx, a.ActiveRestaurantID, before.Date)
+		if err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error consultando disponibilidad")
+			return
+		}
+		hhmm = pickWaitlistOfferTime(hours, held, before.TimeFrom, before.TimeTo, before.PartySize)
+		if hhmm == "" {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"success": false,
+				"message": "No hay hueco en la franja de la entrada",
+			})
+			return
+		}
+	}
+
+	after, sent, err := s.sendWaitlistOffer(ctx, a.ActiveRestaurantID, before, hhmm)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error enviando oferta")
+		return
+	}
+	if !sent {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "La entrada no esta en espera",
+		})
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "waitlist", EntityID: id, Before: before, After: after})
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"waitlist": after,
+	})
+}
+
+// handleBOWaitlistCancel takes an entry off the waitlist. Cancelling an open
+// offer releases its covers to the next entries.
+func (s *Server) handleBOWaitlistCancel(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	ctx := r.Context()
+	before, err := s.loadWaitlistEntry(ctx, a.ActiveRestaurantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Entrada no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo lista de espera")
+		return
+	}
+	if before.Status != waitlistWaiting && before.Status != waitlistOffered {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "waitlist": before})
+		return
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE waitlist_entries SET status = ?
+		WHERE restaurant_id = ? AND id = ? AND status IN (?, ?)
+	`, waitlistCancelled, a.ActiveRestaurantID, id, waitlistWaiting, waitlistOffered); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error cancelando entrada")
+		return
+	}
+	after, err := s.loadWaitlistEntry(ctx, a.ActiveRestaurantID, id)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo lista de espera")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "waitlist", EntityID: id, Before: before, After: after})
+	if before.Status == waitlistOffered {
+		s.offerWaitlistAsync(a.ActiveRestaurantID, before.Date)
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"waitlist": after,
+	})
+}
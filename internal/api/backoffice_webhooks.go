@@ -0,0 +1,202 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+type boWebhookDelivery struct {
+	ID            int64   `json:"id"`
+	Event         string  `json:"event"`
+	EventID       string  `json:"eventId"`
+	Recipient     string  `json:"recipient"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	Error         *string `json:"error"`
+	CreatedAt     string  `json:"createdAt"`
+	SentAt        *string `json:"sentAt"`
+	LastAttemptAt *string `json:"lastAttemptAt"`
+	NextAttemptAt *string `json:"nextAttemptAt"`
+}
+
+func newWebhookSecret() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// handleBOWebhookSecretRotate generates a new signing secret. It is returned
+// once; afterwards the integrations endpoint only reports that one is set.
+func (s *Server) handleBOWebhookSecretRotate(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error generando secreto")
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `
+		INSERT INTO restaurant_integrations (restaurant_id, n8n_webhook_secret)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE n8n_webhook_secret = VALUES(n8n_webhook_secret)
+	`, a.ActiveRestaurantID, secret); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando secreto")
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "rotate", Entity: "webhook_secret", EntityID: a.ActiveRestaurantID})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"secret":  secret,
+	})
+}
+
+func (s *Server) handleBOWebhookDeliveriesList(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("status")))
+	if status == "" {
+		status = "failed"
+	}
+	switch status {
+	case "all", "pending", "retrying", "sent", "failed":
+	default:
+		httpx.WriteError(w, http.StatusBadRequest, "status invalido")
+		return
+	}
+	limit := clampInt(r.URL.Query().Get("limit"), 1, 200, 50)
+
+	query := `
+		SELECT id, event, event_id, recipient, status, attempts, error, created_at, sent_at, last_attempt_at, next_attempt_at
+		FROM message_deliveries
+		WHERE restaurant_id = ? AND channel = 'webhook'`
+	args := []any{a.ActiveRestaurantID}
+	if status != "all" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando entregas")
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []boWebhookDelivery{}
+	for rows.Next() {
+		var (
+			d             boWebhookDelivery
+			eventID       sql.NullString
+			errText       sql.NullString
+			createdAt     sql.NullTime
+			sentAt        sql.NullTime
+			lastAttemptAt sql.NullTime
+			nextAttemptAt sql.NullTime
+		)
+		if err := rows.Scan(&d.ID, &d.Event, &eventID, &d.Recipient, &d.Status, &d.Attempts, &errText, &createdAt, &sentAt, &lastAttemptAt, &nextAttemptAt); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo entregas")
+			return
+		}
+		d.EventID = eventID.String
+		if errText.Valid {
+			d.Error = &errText.String
+		}
+		if createdAt.Valid {
+			d.CreatedAt = createdAt.Time.Format(time.RFC3339)
+		}
+		d.SentAt = formatNullTimeRFC3339(sentAt)
+		d.LastAttemptAt = formatNullTimeRFC3339(lastAttemptAt)
+		d.NextAttemptAt = formatNullTimeRFC3339(nextAttemptAt)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error leyendo entregas")
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"deliveries": deliveries,
+	})
+}
+
+// handleBOWebhookDeliveryReplay resends a stored delivery right away, keeping
+// its event ID so receivers can deduplicate. On failure it goes back into the
+// retry queue with a fresh attempt budget.
+func (s *Server) handleBOWebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := parseBOIDParam(r, "id")
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "id invalido")
+		return
+	}
+
+	var status string
+	err = s.db.QueryRowContext(r.Context(), `
+		SELECT status
+		FROM message_deliveries
+		WHERE id = ? AND restaurant_id = ? AND channel = 'webhook'
+		LIMIT 1
+	`, id, a.ActiveRestaurantID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, http.StatusNotFound, "Entrega no encontrada")
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando entrega")
+		return
+	}
+
+	// Take the row out of the retry queue so the loop doesn't send it in parallel.
+	_, _ = s.db.ExecContext(r.Context(), `
+		UPDATE message_deliveries
+		SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE id = ?
+	`, int(webhookClaimLease/time.Second), id)
+
+	sendErr := s.redeliverWebhook(r.Context(), int64(id), true)
+
+	_ = s.db.QueryRowContext(r.Context(), "SELECT status FROM message_deliveries WHERE id = ?", id).Scan(&status)
+	resp := map[string]any{
+		"success": sendErr == nil,
+		"id":      id,
+		"status":  status,
+	}
+	if sendErr != nil {
+		resp["message"] = "Reenvio fallido: " + sendErr.Error()
+	}
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func formatNullTimeRFC3339(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.Format(time.RFC3339)
+	return &v
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+const (
+	bookingCapacityDayFull       = "DAY_FULL"
+	bookingCapacitySlotFull      = "SLOT_FULL"
+	bookingCapacityTwoTopsFull   = "TWO_TOPS_FULL"
+	bookingCapacityThreeTopsFull = "THREE_TOPS_FULL"
+	bookingCapacityServiceFull   = "SERVICE_FULL"
+	bookingCapacityServiceClosed = "SERVICE_CLOSED"
+	bookingCapacityPartySize     = "SERVICE_PARTY_SIZE"
+
+	// mesas_de_dos / mesas_de_tres store 999 (legacy "sin_limite") for no limit.
+	unlimitedMesasLimit = 999
+)
+
+// bookingCapacityError is returned by the insert/update paths when a booking
+// doesn't fit in the requested day, hour slot or small-table quota.
+type bookingCapacityError struct {
+	Code      string
+	Message   string
+	Limit     int
+	Booked    int
+	Requested int
+}
+
+func (e *bookingCapacityError) Error() string {
+	return e.Message
+}
+
+func (e *bookingCapacityError) payload() map[string]any {
+	return map[string]any{
+		"limit":     e.Limit,
+		"booked":    e.Booked,
+		"requested": e.Requested,
+		"free":      max(e.Limit-e.Booked, 0),
+	}
+}
+
+func writeBookingCapacityError(w http.ResponseWriter, status int, err *bookingCapacityError) {
+	httpx.WriteJSON(w, status, map[string]any{
+		"success":    false,
+		"message":    err.Message,
+		"error_code": err.Code,
+		"capacity":   err.payload(),
+	})
+}
+
+type bookingCapacityRequest struct {
+	ReservationDate string
+	ReservationTime string
+	PartySize       int
+	// ExcludeBookingID skips the booking being modified when counting covers.
+	ExcludeBookingID int
+}
+
+type bookingSlotCapacity struct {
+	Hour          string
+	Closed        bool
+	TotalCapacity int
+	Booked        int
+}
+
+type bookingCapacitySnapshot struct {
+	DailyLimit int
+	DayBooked  int
+	// Services is set when the restaurant has services configured. The
+	// booking's service then replaces the daily limit; Service is nil when
+	// no service covers the requested hour.
+	Services []serviceDayCapacity
+	Service  *serviceDayCapacity
+	// Slot is nil when hour_configuration doesn't define the requested hour;
+	// in that case only the daily limit applies.
+	Slot *bookingSlotCapacity
+	// TableLimit < 0 means no small-table quota applies to this party size.
+	TableLimit  int
+	TableBooked int
+	TableCode   string
+}
+
+func (c bookingCapacitySnapshot) check(partySize int) *bookingCapacityError {
+	if len(c.Services) > 0 {
+		if capErr := c.checkService(partySize); capErr != nil {
+			return capErr
+		}
+	} else if c.DayBooked+partySize > c.DailyLimit {
+		return &bookingCapacityError{
+			Code:      bookingCapacityDayFull,
+			Message:   "No quedan plazas disponibles para la fecha seleccionada",
+			Limit:     c.DailyLimit,
+			Booked:    c.DayBooked,
+			Requested: partySize,
+		}
+	}
+	if c.Slot != nil {
+		if c.Slot.Closed {
+			return &bookingCapacityError{
+				Code:      bookingCapacitySlotFull,
+				Message:   "La hora seleccionada no está disponible",
+				Limit:     0,
+				Booked:    c.Slot.Booked,
+				Requested: partySize,
+			}
+		}
+		if c.Slot.Booked+partySize > c.Slot.TotalCapacity {
+			return &bookingCapacityError{
+				Code:      bookingCapacitySlotFull,
+				Message:   "No quedan plazas disponibles a las " + c.Slot.Hour,
+				Limit:     c.Slot.TotalCapacity,
+				Booked:    c.Slot.Booked,
+				Requested: partySize,
+			}
+		}
+	}
+	if c.TableLimit >= 0 && c.TableBooked+1 > c.TableLimit {
+		msg := "No quedan mesas de dos disponibles para la fecha seleccionada"
+		if c.TableCode == bookingCapacityThreeTopsFull {
+			msg = "No quedan mesas de tres disponibles para la fecha seleccionada"
+		}
+		return &bookingCapacityError{
+			Code:      c.TableCode,
+			Message:   msg,
+			Limit:     c.TableLimit,
+			Booked:    c.TableBooked,
+			Requested: 1,
+		}
+	}
+	return nil
+}
+
+func (c bookingCapacitySnapshot) checkService(partySize int) *bookingCapacityError {
+	svc := c.Service
+	if svc == nil || svc.Closed {
+		return &bookingCapacityError{
+			Code:      bookingCapacityServiceClosed,
+			Message:   "No hay servicio a la hora seleccionada",
+			Requested: partySize,
+		}
+	}
+	if !svc.acceptsPartySize(partySize) {
+		return &bookingCapacityError{
+			Code:      bookingCapacityPartySize,
+			Message:   "El servicio de " + svc.Name + " no admite mesas de " + strconv.Itoa(partySize) + " personas",
+			Limit:     svc.MaxPartySize,
+			Booked:    0,
+			Requested: partySize,
+		}
+	}
+	if svc.Booked+partySize > svc.Limit {
+		return &bookingCapacityError{
+			Code:      bookingCapacityServiceFull,
+			Message:   "No quedan plazas disponibles para el servicio de " + svc.Name,
+			Limit:     svc.Limit,
+			Booked:    svc.Booked,
+			Requested: partySize,
+		}
+	}
+	return nil
+}
+
+func hourSlotTotalCapacity(percentage float64, dailyLimit int) int {
+	return int(math.Ceil((percentage / 100.0) * float64(dailyLimit)))
+}
+
+// enforceBookingCapacityTx locks the day's capacity row and re-checks the daily
+// limit, hour slot capacity and mesas-de-dos/tres quotas inside tx. Callers must
+// write the booking in the same transaction so the check and the write are atomic.
+func (s *Server) enforceBookingCapacityTx(ctx context.Context, tx *sql.Tx, restaurantID int, req bookingCapacityRequest) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO booking_capacity_locks (restaurant_id, reservation_date)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE locked_at = CURRENT_TIMESTAMP
+	`, restaurantID, req.ReservationDate); err != nil {
+		return err
+	}
+
+	snap, err := s.loadBookingCapacitySnapshotTx(ctx, tx, restaurantID, req)
+	if err != nil {
+		return err
+	}
+	if capErr := snap.check(req.PartySize); capErr != nil {
+		return capErr
+	}
+	return nil
+}
+
+// loadBookingCapacitySnapshotTx reads current usage. It runs after the lock row
+// is held, so the InnoDB read view already includes every committed booking for
+// the day.
+func (s *Server) loadBookingCapacitySnapshotTx(ctx context.Context, tx *sql.Tx, restaurantID int, req bookingCapacityRequest) (bookingCapacitySnapshot, error) {
+	out := bookingCapacitySnapshot{TableLimit: -1}
+
+	defaults, err := s.loadReservationDefaults(ctx, restaurantID)
+	if err != nil {
+		return out, err
+	}
+
+	out.DailyLimit = defaults.DailyLimit
+	var override sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT dailyLimit
+		FROM reservation_manager
+		WHERE restaurant_id = ? AND reservationDate = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, restaurantID, req.ReservationDate).Scan(&override)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return out, err
+	}
+	if override.Valid {
+		out.DailyLimit = int(override.Int64)
+	}
+	if out.DailyLimit <= 0 {
+		out.DailyLimit = defaultDailyLimit
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(party_size), 0)
+		FROM bookings
+		WHERE restaurant_id = ? AND reservation_date = ? AND id <> ?
+	`, restaurantID, req.ReservationDate, req.ExcludeBookingID).Scan(&out.DayBooked); err != nil {
+		return out, err
+	}
+
+	hour, err := normalizeHHMM(req.ReservationTime)
+	if err != nil {
+		return out, err
+	}
+
+	out.Services, err = s.loadServiceDay(ctx, tx, restaurantID, req.ReservationDate, req.ExcludeBookingID)
+	if err != nil {
+		return out, err
+	}
+	if i := serviceForHour(out.Services, hour); i >= 0 {
+		out.Service = &out.Services[i]
+	}
+
+	var hourDataRaw sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT hourData FROM hour_configuration WHERE restaurant_id = ? AND date = ? LIMIT 1", restaurantID, req.ReservationDate).Scan(&hourDataRaw)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return out, err
+	}
+	var hourData map[string]HourSlot
+	if hourDataRaw.Valid && strings.TrimSpace(hourDataRaw.String) != "" {
+		if err := json.Unmarshal([]byte(hourDataRaw.String), &hourData); err != nil {
+			return out, errors.New("Invalid hourData JSON in database")
+		}
+	}
+	slot, configured := hourData[hour]
+	if configured || (out.Service != nil && out.Service.PacingLimit > 0) {
+		sc := &bookingSlotCapacity{
+			Hour:          hour,
+			Closed:        slot.IsClosed || strings.EqualFold(slot.Status, "closed"),
+			TotalCapacity: hourSlotTotalCapacity(slot.Percentage, out.DailyLimit),
+		}
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(party_size), 0)
+			FROM bookings
+			WHERE restaurant_id = ? AND reservation_date = ? AND TIME_FORMAT(reservation_time, '%H:%i') = ? AND id <> ?
+		`, restaurantID, req.ReservationDate, hour, req.ExcludeBookingID).Scan(&sc.Booked); err != nil {
+			return out, err
+		}
+		if out.Service != nil {
+			// Slot totals come from the service: its pacing limit or this
+			// hour's share of the service covers.
+			if hourData == nil {
+				hourData = map[string]HourSlot{}
+			}
+			hourData[hour] = slot
+			applyServiceCapacity(hourData, out.Services)
+			sc.TotalCapacity = hourData[hour].TotalCapacity
+		}
+		out.Slot = sc
+	}
+
+	var table, fallback string
+	switch req.PartySize {
+	case 2:
+		table, fallback, out.TableCode = "mesas_de_dos", defaults.MesasDeDosLimit, bookingCapacityTwoTopsFull
+	case 3:
+		table, fallback, out.TableCode = "mesas_de_tres", defaults.MesasDeTresLimit, bookingCapacityThreeTopsFull
+	default:
+		return out, nil
+	}
+
+	var limitRaw sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT dailyLimit FROM "+table+" WHERE restaurant_id = ? AND reservationDate = ? LIMIT 1", restaurantID, req.ReservationDate).Scan(&limitRaw)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return out, err
+	}
+	limitStr := fallback
+	if limitRaw.Valid {
+		limitStr = normalizeLimitOrFallback(limitRaw.String, fallback)
+	}
+	limit, convErr := strconv.Atoi(limitStr)
+	if convErr != nil || limit >= unlimitedMesasLimit {
+		return out, nil
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM bookings
+		WHERE restaurant_id = ? AND reservation_date = ? AND party_size = ? AND id <> ?
+	`, restaurantID, req.ReservationDate, req.PartySize, req.ExcludeBookingID).Scan(&out.TableBooked); err != nil {
+		return out, err
+	}
+	out.TableLimit = limit
+	return out, nil
+}
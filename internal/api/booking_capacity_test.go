@@ -0,0 +1,91 @@
+package api
+
+import "testing"
+
+func TestBookingCapacitySnapshotCheckDayFull(t *testing.T) {
+	snap := bookingCapacitySnapshot{DailyLimit: 45, DayBooked: 42, TableLimit: -1}
+
+	if err := snap.check(3); err != nil {
+		t.Fatalf("check(3) = %v, want nil", err)
+	}
+	err := snap.check(4)
+	if err == nil || err.Code != bookingCapacityDayFull {
+		t.Fatalf("check(4) = %v, want %s", err, bookingCapacityDayFull)
+	}
+	if err.Limit != 45 || err.Booked != 42 || err.Requested != 4 {
+		t.Fatalf("check(4) details = %+v", err)
+	}
+}
+
+func TestBookingCapacitySnapshotCheckSlot(t *testing.T) {
+	snap := bookingCapacitySnapshot{
+		DailyLimit: 40,
+		DayBooked:  10,
+		Slot:       &bookingSlotCapacity{Hour: "14:00", TotalCapacity: hourSlotTotalCapacity(25, 40), Booked: 8},
+		TableLimit: -1,
+	}
+	if err := snap.check(2); err != nil {
+		t.Fatalf("check(2) = %v, want nil", err)
+	}
+	if err := snap.check(3); err == nil || err.Code != bookingCapacitySlotFull {
+		t.Fatalf("check(3) = %v, want %s", err, bookingCapacitySlotFull)
+	}
+
+	snap.Slot = &bookingSlotCapacity{Hour: "14:00", Closed: true, TotalCapacity: 10}
+	if err := snap.check(2); err == nil || err.Code != bookingCapacitySlotFull {
+		t.Fatalf("closed slot check(2) = %v, want %s", err, bookingCapacitySlotFull)
+	}
+}
+
+func TestBookingCapacitySnapshotCheckSmallTables(t *testing.T) {
+	snap := bookingCapacitySnapshot{
+		DailyLimit:  45,
+		DayBooked:   10,
+		TableLimit:  5,
+		TableBooked: 5,
+		TableCode:   bookingCapacityTwoTopsFull,
+	}
+	if err := snap.check(2); err == nil || err.Code != bookingCapacityTwoTopsFull {
+		t.Fatalf("check(2) = %v, want %s", err, bookingCapacityTwoTopsFull)
+	}
+
+	snap.TableBooked = 4
+	if err := snap.check(2); err != nil {
+		t.Fatalf("check(2) with a free two-top = %v, want nil", err)
+	}
+}
+
+func TestHourSlotTotalCapacityRoundsUp(t *testing.T) {
+	if got := hourSlotTotalCapacity(25, 45); got != 12 {
+		t.Fatalf("hourSlotTotalCapacity(25, 45) = %d, want 12", got)
+	}
+	if got := hourSlotTotalCapacity(10, 45); got != 5 {
+		t.Fatalf("hourSlotTotalCapacity(10, 45) = %d, want 5", got)
+	}
+}
+
+func TestBookingCapacitySnapshotCheckService(t *testing.T) {
+	services := []serviceDayCapacity{
+		{reservationService: reservationService{Name: "comida", StartTime: "13:00", EndTime: "15:30", MaxPartySize: 8}, Limit: 40, Booked: 40},
+		{reservationService: reservationService{Name: "cena", StartTime: "20:00", EndTime: "23:00"}, Limit: 30, Booked: 5},
+	}
+	// The day as a whole is over its limit, but dinner still has room.
+	snap := bookingCapacitySnapshot{DailyLimit: 45, DayBooked: 45, Services: services, Service: &services[1], TableLimit: -1}
+	if err := snap.check(4); err != nil {
+		t.Fatalf("dinner check(4) = %v, want nil", err)
+	}
+
+	snap.Service = &services[0]
+	if err := snap.check(2); err == nil || err.Code != bookingCapacityServiceFull {
+		t.Fatalf("lunch check(2) = %v, want %s", err, bookingCapacityServiceFull)
+	}
+	services[0].Booked = 0
+	if err := snap.check(10); err == nil || err.Code != bookingCapacityPartySize {
+		t.Fatalf("lunch check(10) = %v, want %s", err, bookingCapacityPartySize)
+	}
+
+	snap.Service = nil
+	if err := snap.check(2); err == nil || err.Code != bookingCapacityServiceClosed {
+		t.Fatalf("no service check(2) = %v, want %s", err, bookingCapacityServiceClosed)
+	}
+}
@@ -0,0 +1,772 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// A booking that matches a deposit rule is held in payment_status
+// 'pending_payment' while the guest pays at the provider's checkout. If the
+// hold expires unpaid the booking is cancelled; once paid (or, for
+// guarantees, authorised) it is confirmed. A timely cancellation returns the
+// money.
+const (
+	depositHoldPoll     = time.Minute
+	depositSettleWait   = 30 * time.Second
+	paymentWebhookLimit = 1 << 20
+)
+
+type bookingPayment struct {
+	ID                int     `json:"id"`
+	BookingID         int     `json:"bookingId"`
+	RuleID            *int    `json:"ruleId"`
+	Kind              string  `json:"kind"`
+	Provider          string  `json:"provider"`
+	ProviderRef       string  `json:"providerRef"`
+	PaymentRef        string  `json:"providerPaymentRef"`
+	AmountCents       int     `json:"amountCents"`
+	Currency          string  `json:"currency"`
+	RefundCutoffHours int     `json:"refundCutoffHours"`
+	Status            string  `json:"status"`
+	CheckoutURL       string  `json:"checkoutUrl"`
+	HoldExpiresAt     *string `json:"holdExpiresAt"`
+	PaidAt            *string `json:"paidAt"`
+	RefundedCents     int     `json:"refundedCents"`
+	RefundRef         string  `json:"refundRef"`
+	ClosedAt          *string `json:"closedAt"`
+	LastError         string  `json:"lastError"`
+	CreatedAt         *string `json:"createdAt"`
+
+	restaurantID int
+}
+
+const bookingPaymentSelectColumns = `
+	id,
+	restaurant_id,
+	booking_id,
+	rule_id,
+	kind,
+	provider,
+	provider_ref,
+	COALESCE(provider_payment_ref, ''),
+	amount_cents,
+	currency,
+	refund_cutoff_hours,
+	status,
+	COALESCE(checkout_url, ''),
+	hold_expires_at,
+	paid_at,
+	refunded_cents,
+	COALESCE(refund_ref, ''),
+	closed_at,
+	COALESCE(last_error, ''),
+	created_at`
+
+func scanBookingPayment(scanner waitlistScanner) (bookingPayment, error) {
+	var (
+		p                             bookingPayment
+		ruleID                        sql.NullInt64
+		holdExpires, paidAt, closedAt sql.NullTime
+		createdAt                     sql.NullTime
+	)
+	err := scanner.Scan(&p.ID, &p.restaurantID, &p.BookingID, &ruleID, &p.Kind, &p.Provider, &p.ProviderRef,
+		&p.PaymentRef, &p.AmountCents, &p.Currency, &p.RefundCutoffHours, &p.Status, &p.CheckoutURL,
+		&holdExpires, &paidAt, &p.RefundedCents, &p.RefundRef, &closedAt, &p.LastError, &createdAt)
+	if err != nil {
+		return bookingPayment{}, err
+	}
+	if ruleID.Valid {
+		id := int(ruleID.Int64)
+		p.RuleID = &id
+	}
+	p.HoldExpiresAt = formatNullTimeRFC3339(holdExpires)
+	p.PaidAt = formatNullTimeRFC3339(paidAt)
+	p.ClosedAt = formatNullTimeRFC3339(closedAt)
+	p.CreatedAt = formatNullTimeRFC3339(createdAt)
+	return p, nil
+}
+
+// loadBookingPayments lists payments matching where (an SQL condition on
+// booking_payments), newest first. Callers scope it to a restaurant; the
+// provider webhook looks payments up by ref across restaurants.
+func (s *Server) loadBookingPayments(ctx context.Context, where string, args ...any) ([]bookingPayment, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+bookingPaymentSelectColumns+" FROM booking_payments WHERE "+where+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []bookingPayment{}
+	for rows.Next() {
+		p, err := scanBookingPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Server) loadBookingPayment(ctx context.Context, where string, args ...any) (bookingPayment, error) {
+	list, err := s.loadBookingPayments(ctx, where, args...)
+	if err != nil {
+		return bookingPayment{}, err
+	}
+	if len(list) == 0 {
+		return bookingPayment{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// startBookingDeposit opens a checkout for a new web booking when a deposit
+// rule matches, and puts the booking in pending_payment. imposed, when not
+// nil, applies if no rule does (a no-show policy). It returns nil when no
+// payment is needed (no provider, no rules, no match).
+func (s *Server) startBookingDeposit(r *http.Request, restaurantID, bookingID int, facts depositBookingFacts, email string, imposed *depositRule) (*bookingPayment, error) {
+	if s.payments == nil {
+		return nil, nil
+	}
+	ctx := r.Context()
+	rules, err := s.loadDepositRules(ctx, s.db, restaurantID)
+	if err != nil && !isSQLSchemaError(err) {
+		return nil, err
+	}
+	rule, ok := matchDepositRule(rules, facts)
+	if !ok && imposed != nil {
+		rule, ok = *imposed, true
+	}
+	if !ok {
+		return nil, nil
+	}
+	amount := rule.amountFor(facts.PartySize)
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	description := fmt.Sprintf("Señal reserva #%d (%s, %d personas)", bookingID, facts.Date, facts.PartySize)
+	if rule.Kind == depositKindGuarantee {
+		description = fmt.Sprintf("Garantía reserva #%d (%s, %d personas)", bookingID, facts.Date, facts.PartySize)
+	}
+	link := s.guestLinkURL(publicBaseURL(r), restaurantID, bookingID, guestLinkPayment, facts.Date)
+	ttl := s.cfg.DepositHoldTTL
+	checkout, err := s.payments.CreateCheckout(ctx, paymentCheckoutRequest{
+		RestaurantID:  restaurantID,
+		BookingID:     bookingID,
+		Kind:          rule.Kind,
+		AmountCents:   amount,
+		Currency:      depositCurrency,
+		Description:   description,
+		CustomerEmail: email,
+		SuccessURL:    link + "&result=success",
+		CancelURL:     link + "&result=cancel",
+		ExpiresAt:     time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO booking_payments
+			(restaurant_id, booking_id, rule_id, kind, provider, provider_ref, amount_cents, currency,
+			 refund_cutoff_hours, status, checkout_url, hold_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))
+	`, restaurantID, bookingID, nullablePositiveInt(rule.ID), rule.Kind, s.payments.Name(), checkout.Ref, amount, depositCurrency,
+		rule.RefundCutoffHours, paymentPending, checkout.URL, int(ttl.Seconds()))
+	if err != nil {
+		_ = s.payments.ExpireCheckout(context.Background(), checkout.Ref)
+		return nil, err
+	}
+	paymentID, _ := res.LastInsertId()
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE bookings SET payment_status = ? WHERE restaurant_id = ? AND id = ?
+	`, bookingPaymentPending, restaurantID, bookingID); err != nil {
+		return nil, err
+	}
+
+	p, err := s.loadBookingPayment(ctx, "id = ?", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// discardUnpaidBooking removes a booking whose checkout could not be opened.
+// The guest never saw it confirmed, so it doesn't go to cancelled_bookings.
+func (s *Server) discardUnpaidBooking(ctx context.Context, restaurantID int, bookingID int64) {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, bookingID); err != nil {
+		log.Printf("[payments] discard booking %d: %v", bookingID, err)
+	}
+}
+
+type cancelledBookingSummary struct {
+	ID              int
+	GuestID         int
+	ReservationDate string
+	ReservationTime string
+	PartySize       int
+	CustomerName    string
+	ContactPhone    string
+	ContactEmail    string
+}
+
+// moveBookingToCancelledTx copies a booking into cancelled_bookings and
+// deletes it, the same way the cancel endpoints do.
+func moveBookingToCancelledTx(ctx context.Context, tx *sql.Tx, restaurantID, bookingID int, cancelledBy string) (cancelledBookingSummary, error) {
+	var (
+		b                                      cancelledBookingSummary
+		phone, email, commentary               sql.NullString
+		arrozType, arrozServings, principales  sql.NullString
+		strollers, chairs, specialMenu, menuID sql.NullInt64
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, DATE_FORMAT(reservation_date, '%Y-%m-%d'), party_size,
+			TIME_FORMAT(reservation_time, '%H:%i:%s'), customer_name, contact_phone, contact_email,
+			commentary, arroz_type, arroz_servings, babyStrollers, highChairs, special_menu,
+			menu_de_grupo_id, principales_json
+		FROM bookings
+		WHERE restaurant_id = ? AND id = ?
+		FOR UPDATE
+	`, restaurantID, bookingID).Scan(&b.ID, &b.ReservationDate, &b.PartySize, &b.ReservationTime, &b.CustomerName,
+		&phone, &email, &commentary, &arrozType, &arrozServings, &strollers, &chairs, &specialMenu, &menuID, &principales)
+	if err != nil {
+		return cancelledBookingSummary{}, err
+	}
+	b.ContactPhone, b.ContactEmail = phone.String, email.String
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO cancelled_bookings
+			(restaurant_id, booking_id, reservation_date, party_size, reservation_time, customer_name,
+			 contact_phone, contact_email, commentary, arroz_type, arroz_servings,
+			 babyStrollers, highChairs, cancellation_date, cancelled_by,
+			 special_menu, menu_de_grupo_id, principales_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), ?, ?, ?, ?)
+	`, restaurantID, b.ID, b.ReservationDate, b.PartySize, b.ReservationTime, b.CustomerName,
+		phone.String, email.String, commentary.String, nullStringOrNil(arrozType), nullStringOrNil(arrozServings),
+		nullIntToInt(strollers), nullIntToInt(chairs), cancelledBy,
+		int64OrZero(specialMenu), nullInt64OrNil(menuID), nullStringOrNil(principales)); err != nil {
+		return cancelledBookingSummary{}, err
+	}
+	b.GuestID = carryBookingGuestTx(ctx, tx, restaurantID, b.ID)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, b.ID); err != nil {
+		return cancelledBookingSummary{}, err
+	}
+	return b, nil
+}
+
+func paymentWebhookPayload(source string, p bookingPayment) map[string]any {
+	return map[string]any{
+		"source":        source,
+		"paymentId":     p.ID,
+		"bookingId":     p.BookingID,
+		"kind":          p.Kind,
+		"provider":      p.Provider,
+		"status":        p.Status,
+		"amountCents":   p.AmountCents,
+		"refundedCents": p.RefundedCents,
+		"currency":      p.Currency,
+	}
+}
+
+func (s *Server) emitPaymentWebhook(event string, source string, id int) {
+	p, err := s.loadBookingPayment(context.Background(), "id = ?", id)
+	if err != nil {
+		log.Printf("[payments] load payment %d for %s: %v", id, event, err)
+		return
+	}
+	s.emitN8nWebhookAsync(p.restaurantID, event, paymentWebhookPayload(source, p))
+}
+
+// expireBookingPayment closes an unpaid hold and cancels its booking.
+func (s *Server) expireBookingPayment(ctx context.Context, p bookingPayment, source string) error {
+	var (
+		cancelled cancelledBookingSummary
+		expired   bool
+	)
+	err := withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE booking_payments SET status = ?, closed_at = NOW() WHERE id = ? AND status = ?
+		`, paymentExpired, p.ID, paymentPending)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		expired = true
+		// The guest let the hold lapse, so it counts as their cancellation.
+		cancelled, err = moveBookingToCancelledTx(ctx, tx, p.restaurantID, p.BookingID, "customer")
+		if errors.Is(err, sql.ErrNoRows) {
+			cancelled = cancelledBookingSummary{}
+			return nil
+		}
+		return err
+	})
+	if err != nil || !expired {
+		return err
+	}
+	if source != "provider" {
+		if err := s.payments.ExpireCheckout(ctx, p.ProviderRef); err != nil {
+			log.Printf("[payments] expire checkout %s: %v", p.ProviderRef, err)
+		}
+	}
+
+	s.emitPaymentWebhook(webhookEventPaymentExpired, source, p.ID)
+	if cancelled.ID > 0 {
+		s.emitN8nWebhookAsync(p.restaurantID, webhookEventBookingCancelled, map[string]any{
+			"source":          "payment_expired",
+			"cancelledBy":     "customer",
+			"bookingId":       cancelled.ID,
+			"reservationDate": cancelled.ReservationDate,
+			"reservationTime": cancelled.ReservationTime,
+			"partySize":       cancelled.PartySize,
+			"customerName":    cancelled.CustomerName,
+			"contactPhone":    cancelled.ContactPhone,
+			"contactEmail":    cancelled.ContactEmail,
+		})
+		s.offerWaitlistAsync(p.restaurantID, cancelled.ReservationDate)
+		s.refreshGuestStatsAsync(p.restaurantID, cancelled.GuestID)
+	}
+	return nil
+}
+
+// expireDepositHolds cancels bookings whose payment hold ran out.
+func (s *Server) expireDepositHolds(ctx context.Context) error {
+	if s.payments == nil {
+		return nil
+	}
+	list, err := s.loadBookingPayments(ctx, "status = ? AND hold_expires_at <= NOW()", paymentPending)
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		if err := s.expireBookingPayment(ctx, p, "hold_expired"); err != nil {
+			log.Printf("[payments] expire payment %d: %v", p.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) runDepositHoldExpiryLoop(ctx context.Context) {
+	t := time.NewTicker(depositHoldPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.expireDepositHolds(ctx); err != nil && !isSQLSchemaError(err) {
+				log.Printf("[payments] expire holds: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Server) recordPaymentError(id int, err error) {
+	msg := err.Error()
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	_, _ = s.db.ExecContext(context.Background(), "UPDATE booking_payments SET last_error = ? WHERE id = ?", msg, id)
+}
+
+// errPaymentChanged means another refund or release of the same payment
+// got there first.
+var errPaymentChanged = errors.New("el pago ha cambiado mientras se procesaba")
+
+// returnPaymentFunds refunds amountCents of a paid deposit (0 = whatever is
+// left) or releases a card guarantee. The row is claimed before calling the
+// provider, against the status and refunded amount p was read with, so two
+// concurrent refunds can't both reach the provider. The claim is only undone
+// when the provider certainly rejected the call; after a timeout or a 5xx
+// the money may have moved, so the row keeps it and the error is left in
+// last_error for staff to check.
+func (s *Server) returnPaymentFunds(ctx context.Context, p bookingPayment, amountCents int, source string) error {
+	switch p.Status {
+	case paymentPaid, paymentCaptured:
+		remaining := p.AmountCents - p.RefundedCents
+		if amountCents <= 0 || amountCents > remaining {
+			amountCents = remaining
+		}
+		if amountCents <= 0 {
+			return nil
+		}
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments SET refunded_cents = refunded_cents + ?
+			WHERE id = ? AND status = ? AND refunded_cents = ?
+		`, amountCents, p.ID, p.Status, p.RefundedCents)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return errPaymentChanged
+		}
+		refundRef, err := s.payments.Refund(ctx, p.PaymentRef, amountCents, paymentRefundIdempotencyKey(p, amountCents))
+		if err != nil {
+			if paymentRejected(err) {
+				_, _ = s.db.ExecContext(context.Background(), `
+					UPDATE booking_payments SET refunded_cents = refunded_cents - ? WHERE id = ?
+				`, amountCents, p.ID)
+			}
+			s.recordPaymentError(p.ID, err)
+			return err
+		}
+		status := p.Status
+		if p.RefundedCents+amountCents >= p.AmountCents {
+			status = paymentRefunded
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments
+			SET status = ?, refund_ref = ?, last_error = NULL,
+				closed_at = IF(? = ?, NOW(), closed_at)
+			WHERE id = ?
+		`, status, refundRef, status, paymentRefunded, p.ID); err != nil {
+			return err
+		}
+	case paymentAuthorized:
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments SET status = ?, closed_at = NOW() WHERE id = ? AND status = ?
+		`, paymentReleased, p.ID, paymentAuthorized)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return errPaymentChanged
+		}
+		if err := s.payments.Release(ctx, p.PaymentRef); err != nil {
+			if paymentRejected(err) {
+				_, _ = s.db.ExecContext(context.Background(), `
+					UPDATE booking_payments SET status = ?, closed_at = NULL WHERE id = ? AND status = ?
+				`, paymentAuthorized, p.ID, paymentReleased)
+			}
+			s.recordPaymentError(p.ID, err)
+			return err
+		}
+		if _, err := s.db.ExecContext(ctx, "UPDATE booking_payments SET last_error = NULL WHERE id = ?", p.ID); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	s.emitPaymentWebhook(webhookEventPaymentRefunded, source, p.ID)
+	return nil
+}
+
+// paymentRefundIdempotencyKey names one refund of p: the payment and what it
+// had refunded before, plus the amount, which Stripe requires to match when
+// a key is reused.
+func paymentRefundIdempotencyKey(p bookingPayment, amountCents int) string {
+	return fmt.Sprintf("booking_payment_%d_refund_%d_%d", p.ID, p.RefundedCents, amountCents)
+}
+
+// captureBookingPayment charges an authorised card guarantee, e.g. after a
+// no-show.
+func (s *Server) captureBookingPayment(ctx context.Context, p bookingPayment, amountCents int) error {
+	if amountCents <= 0 || amountCents > p.AmountCents {
+		amountCents = p.AmountCents
+	}
+	if err := s.payments.Capture(ctx, p.PaymentRef, amountCents); err != nil {
+		s.recordPaymentError(p.ID, err)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE booking_payments SET status = ?, amount_cents = ?, last_error = NULL WHERE id = ?
+	`, paymentCaptured, amountCents, p.ID)
+	return err
+}
+
+// settleBookingDeposit applies a cancellation to the booking's payments:
+// open checkouts are closed, and paid deposits or guarantees are returned if
+// the guest cancelled before the rule's cutoff. Later cancellations keep the
+// money; staff can still refund by hand.
+func (s *Server) settleBookingDeposit(ctx context.Context, restaurantID, bookingID int, date, hhmm string) error {
+	list, err := s.loadBookingPayments(ctx, "restaurant_id = ? AND booking_id = ? AND status IN (?, ?, ?)",
+		restaurantID, bookingID, paymentPending, paymentPaid, paymentAuthorized)
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		switch p.Status {
+		case paymentPending:
+			res, err := s.db.ExecContext(ctx, `
+				UPDATE booking_payments SET status = ?, closed_at = NOW() WHERE id = ? AND status = ?
+			`, paymentExpired, p.ID, paymentPending)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				if err := s.payments.ExpireCheckout(ctx, p.ProviderRef); err != nil {
+					log.Printf("[payments] expire checkout %s: %v", p.ProviderRef, err)
+				}
+				s.emitPaymentWebhook(webhookEventPaymentExpired, "booking_cancelled", p.ID)
+			}
+		default:
+			if !depositRefundable(date, hhmm, p.RefundCutoffHours, time.Now()) {
+				continue
+			}
+			if err := s.returnPaymentFunds(ctx, p, 0, "timely_cancellation"); err != nil && !errors.Is(err, errPaymentChanged) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) settleBookingDepositAsync(restaurantID, bookingID int, date, hhmm string) {
+	if s.payments == nil || restaurantID <= 0 || bookingID <= 0 {
+		return
+	}
+	// Shutdown waits for it, and doesn't cancel it: a refund stopped between
+	// its claim and the provider call would leave the row saying refunded.
+	s.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), depositSettleWait)
+		defer cancel()
+		if err := s.settleBookingDeposit(ctx, restaurantID, bookingID, date, hhmm); err != nil && !isSQLSchemaError(err) {
+			log.Printf("[payments] settle booking %d: %v", bookingID, err)
+		}
+	})
+}
+
+// applyPaymentEvent reconciles one provider event with the stored payment.
+func (s *Server) applyPaymentEvent(ctx context.Context, p bookingPayment, ev paymentEvent) error {
+	switch reconcilePaymentOp(p.Status, ev) {
+	case paymentOpMarkPaid:
+		status := paidStatusFor(p.Kind)
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments SET status = ?, provider_payment_ref = ?, paid_at = NOW(), last_error = NULL
+			WHERE id = ? AND status = ?
+		`, status, nullableString(ev.PaymentRef), p.ID, paymentPending)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE bookings SET payment_status = ?, status = 'confirmed' WHERE restaurant_id = ? AND id = ?
+		`, bookingPaymentStatusFor(status), p.restaurantID, p.BookingID); err != nil {
+			return err
+		}
+		s.emitPaymentWebhook(webhookEventPaymentCompleted, "provider", p.ID)
+	case paymentOpMarkPaidAndReturn:
+		status := paidStatusFor(p.Kind)
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments SET status = ?, provider_payment_ref = ?, paid_at = NOW()
+			WHERE id = ? AND status = ?
+		`, status, nullableString(ev.PaymentRef), p.ID, paymentExpired)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		p.Status, p.PaymentRef = status, ev.PaymentRef
+		return s.returnPaymentFunds(ctx, p, 0, "late_payment")
+	case paymentOpExpire:
+		return s.expireBookingPayment(ctx, p, "provider")
+	case paymentOpMarkRefunded:
+		// Echo of a refund made here, or one made in the provider's dashboard.
+		refunded := ev.AmountCents
+		if refunded <= p.RefundedCents {
+			return nil
+		}
+		status := p.Status
+		if refunded >= p.AmountCents {
+			status = paymentRefunded
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE booking_payments
+			SET status = ?, refunded_cents = ?, closed_at = IF(? = ?, COALESCE(closed_at, NOW()), closed_at)
+			WHERE id = ? AND refunded_cents < ?
+		`, status, refunded, status, paymentRefunded, p.ID, refunded); err != nil {
+			return err
+		}
+		s.emitPaymentWebhook(webhookEventPaymentRefunded, "provider", p.ID)
+	}
+	return nil
+}
+
+// handlePaymentWebhook receives provider callbacks. It isn't tied to a
+// restaurant host: payments are found by the provider's refs.
+func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.payments == nil {
+		httpx.WriteError(w, http.StatusNotFound, "Payments not configured")
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(r.Body, paymentWebhookLimit))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid body")
+		return
+	}
+	ev, err := s.payments.ParseWebhook(payload, r.Header)
+	if err != nil {
+		if errors.Is(err, errPaymentWebhookSignature) {
+			httpx.WriteError(w, http.StatusBadRequest, "Invalid signature")
+			return
+		}
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if ev.Type == "" {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "ignored": true})
+		return
+	}
+
+	var p bookingPayment
+	if ev.Ref != "" {
+		p, err = s.loadBookingPayment(r.Context(), "provider = ? AND provider_ref = ?", s.payments.Name(), ev.Ref)
+	} else {
+		p, err = s.loadBookingPayment(r.Context(), "provider = ? AND provider_payment_ref = ?", s.payments.Name(), ev.PaymentRef)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not ours (e.g. another integration on the same account).
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "ignored": true})
+		return
+	}
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando pago")
+		return
+	}
+	if err := s.applyPaymentEvent(r.Context(), p, ev); err != nil {
+		log.Printf("[payments] event %s (%s) on payment %d: %v", ev.ID, ev.Type, p.ID, err)
+		httpx.WriteError(w, http.StatusInternalServerError, "Error aplicando evento")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+var paymentResultTmpl = template.Must(template.New("payment_result").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+  <title>Pago de la reserva - {{.BrandName}}</title>
+  <style>
+    :root { --primary:#4a6741; --danger:#dc3545; --success:#28a745; --bg1:#e8f5e9; --bg2:#c8e6c9; --bg3:#a5d6a7; --text:#2d3748; --muted:#718096; }
+    * { box-sizing:border-box; }
+    body { margin:0; font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,Oxygen,Ubuntu,sans-serif; min-height:100vh; display:flex; align-items:center; justify-content:center; padding:16px; background:linear-gradient(135deg,var(--bg1),var(--bg2),var(--bg3)); background-attachment:fixed; color:var(--text); }
+    .card { width:100%; max-width:560px; background:rgba(255,255,255,0.75); border:1px solid rgba(255,255,255,0.35); border-radius:18px; padding:24px; box-shadow:0 8px 32px rgba(0,0,0,0.08); backdrop-filter: blur(18px); }
+    .logo { display:block; margin:0 auto 10px; width:120px; height:auto; }
+    h1 { margin:0 0 6px; font-size:22px; text-align:center; }
+    .msg { padding:12px 14px; border-radius:12px; margin:14px 0; border:1px solid rgba(0,0,0,0.08); background:rgba(255,255,255,0.55); }
+    .msg.success { border-color: rgba(40,167,69,0.35); background: rgba(40,167,69,0.12); }
+    .msg.error { border-color: rgba(220,53,69,0.35); background: rgba(220,53,69,0.10); }
+    .details { background:rgba(255,255,255,0.55); border:1px solid rgba(74,103,65,0.22); border-radius:14px; padding:14px; margin:14px 0; }
+    .details p { margin:6px 0; }
+    .btn { display:inline-block; width:100%; text-align:center; border:none; border-radius:12px; padding:12px 14px; cursor:pointer; font-size:16px; background:var(--success); color:white; text-decoration:none; }
+    .btn.secondary { background:rgba(74,103,65,0.12); color:var(--primary); border:1px solid rgba(74,103,65,0.35); }
+  </style>
+</head>
+<body>
+  <main class="card">
+    <img class="logo" src="{{.LogoURL}}" alt="{{.BrandName}}" />
+    <h1>Pago de la reserva</h1>
+
+    {{if .Message}}
+      <div class="msg {{if .Success}}success{{else}}error{{end}}">{{.Message}}</div>
+    {{end}}
+
+    {{if .HasPayment}}
+      <section class="details">
+        <p><strong>Reserva:</strong> #{{.BookingID}}</p>
+        <p><strong>Importe:</strong> {{.AmountDisplay}}</p>
+        {{if .ExpiresDisplay}}<p><strong>Pagar antes de:</strong> {{.ExpiresDisplay}}</p>{{end}}
+      </section>
+    {{end}}
+
+    {{if .CheckoutURL}}
+      <a class="btn" href="{{.CheckoutURL}}">Pagar ahora</a>
+      <div style="height:10px"></div>
+    {{end}}
+    <a class="btn secondary" href="index.php">Volver a la página principal</a>
+  </main>
+</body>
+</html>`))
+
+// handlePaymentResultPage is where the checkout sends the guest back. The
+// webhook is what confirms the booking; this page only reports the state.
+func (s *Server) handlePaymentResultPage(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := restaurantIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusNotFound, "Unknown restaurant")
+		return
+	}
+
+	branding, _ := s.loadRestaurantBranding(r.Context(), restaurantID)
+	brandName := strings.TrimSpace(branding.BrandName)
+	if brandName == "" {
+		brandName = "Restaurante"
+	}
+	logoURL := strings.TrimSpace(branding.LogoURL)
+	if logoURL == "" {
+		logoURL = "/media/logos/logo-negro.png"
+	}
+	data := map[string]any{
+		"BrandName":   brandName,
+		"LogoURL":     logoURL,
+		"Message":     "",
+		"Success":     false,
+		"HasPayment":  false,
+		"CheckoutURL": "",
+	}
+
+	bookingID, _, errMsg := s.authorizeGuestLink(r, restaurantID, guestLinkPayment)
+	if errMsg != "" {
+		data["Message"] = errMsg
+		writeHTMLTemplate(w, paymentResultTmpl, data)
+		return
+	}
+	p, err := s.loadBookingPayment(r.Context(), "restaurant_id = ? AND booking_id = ?", restaurantID, bookingID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			data["Message"] = "Esta reserva no tiene ningún pago pendiente."
+		} else {
+			data["Message"] = "Error al cargar el pago. Por favor, inténtelo de nuevo."
+		}
+		writeHTMLTemplate(w, paymentResultTmpl, data)
+		return
+	}
+
+	data["HasPayment"] = true
+	data["BookingID"] = p.BookingID
+	data["AmountDisplay"] = strconv.FormatFloat(float64(p.AmountCents)/100, 'f', 2, 64) + " " + strings.ToUpper(p.Currency)
+	data["ExpiresDisplay"] = ""
+
+	switch p.Status {
+	case paymentPaid, paymentCaptured:
+		data["Success"] = true
+		data["Message"] = "Hemos recibido el pago de la señal. Su reserva está confirmada."
+	case paymentAuthorized:
+		data["Success"] = true
+		data["Message"] = "Su tarjeta ha quedado registrada como garantía. Su reserva está confirmada."
+	case paymentRefunded, paymentReleased:
+		data["Success"] = true
+		data["Message"] = "El importe de la reserva ha sido devuelto."
+	case paymentExpired:
+		data["Message"] = "El plazo para completar el pago ha terminado y la reserva se ha cancelado."
+	default:
+		if strings.TrimSpace(r.URL.Query().Get("result")) == "success" {
+			data["Success"] = true
+			data["Message"] = "Estamos confirmando su pago. Recibirá la confirmación en unos minutos."
+			break
+		}
+		data["Message"] = "El pago no se ha completado. Su reserva queda pendiente hasta que lo finalice."
+		data["CheckoutURL"] = p.CheckoutURL
+		if p.HoldExpiresAt != nil {
+			if t, err := time.Parse(time.RFC3339, *p.HoldExpiresAt); err == nil {
+				data["ExpiresDisplay"] = t.In(boMadridTZ).Format("15:04")
+			}
+		}
+	}
+	writeHTMLTemplate(w, paymentResultTmpl, data)
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -182,25 +183,49 @@ func (s *Server) handleInsertBookingFront(w http.ResponseWriter, r *http.Request
 
 	}
 
+	// Guests with past no-shows may be held to stricter terms.
+	policy, hasPolicy := s.noShowPolicyFor(r.Context(), restaurantID,
+		newGuestIdentity(customerName, cc, nationalPhone, r.FormValue("contact_email"), ""))
+	if hasPolicy && policy.Action == noShowActionBlock {
+		httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+			"success":    false,
+			"message":    "No es posible reservar online. Por favor, llame al restaurante.",
+			"error_code": "NO_SHOW_BLOCKED",
+		})
+		return
+	}
+	confirmationRequired := hasPolicy && policy.Action == noShowActionConfirm
+	var imposedDeposit *depositRule
+	if hasPolicy && policy.Action == noShowActionDeposit {
+		rule := policy.depositRule()
+		imposedDeposit = &rule
+	}
+
 	bookingID, err := s.insertBooking(r, bookingInsertParams{
-		ReservationDate:   resDate,
-		ReservationTime:   resTime,
-		PartySize:         partySize,
-		Children:          children,
-		CustomerName:      customerName,
-		ContactPhone:      nationalPhone,
-		ContactPhoneCC:    cc,
-		ContactEmail:      contactEmail,
-		Commentary:        commentary,
-		BabyStrollers:     babyStrollers,
-		HighChairs:        highChairs,
-		ArrozTypeJSON:     arrozTypeJSON,
-		ArrozServingsJSON: arrozServingsJSON,
-		SpecialMenu:       boolToTinyint(specialMenu),
-		MenuDeGrupoID:     nullIntOrNil(menuDeGrupoID),
-		PrincipalesJSON:   principalesJSON,
-		PreferredFloorNum: preferredFloorNumber,
+		ReservationDate:      resDate,
+		ReservationTime:      resTime,
+		PartySize:            partySize,
+		Children:             children,
+		CustomerName:         customerName,
+		ContactPhone:         nationalPhone,
+		ContactPhoneCC:       cc,
+		ContactEmail:         contactEmail,
+		Commentary:           commentary,
+		BabyStrollers:        babyStrollers,
+		HighChairs:           highChairs,
+		ArrozTypeJSON:        arrozTypeJSON,
+		ArrozServingsJSON:    arrozServingsJSON,
+		SpecialMenu:          boolToTinyint(specialMenu),
+		MenuDeGrupoID:        nullIntOrNil(menuDeGrupoID),
+		PrincipalesJSON:      principalesJSON,
+		PreferredFloorNum:    preferredFloorNumber,
+		ConfirmationRequired: confirmationRequired,
 	})
+	var capErr *bookingCapacityError
+	if errors.As(err, &capErr) {
+		writeBookingCapacityError(w, http.StatusConflict, capErr)
+		return
+	}
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"success":    false,
@@ -210,17 +235,51 @@ func (s *Server) handleInsertBookingFront(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Bookings matching a deposit rule stay pending until the guest pays.
+	payment, err := s.startBookingDeposit(r, restaurantID, int(bookingID), depositBookingFacts{
+		Date:          resDate,
+		PartySize:     partySize,
+		SpecialMenu:   specialMenu,
+		MenuDeGrupoID: menuDeGrupoID,
+	}, strings.TrimSpace(r.FormValue("contact_email")), imposedDeposit)
+	if err != nil {
+		log.Printf("[payments] start deposit for booking %d: %v", bookingID, err)
+		s.discardUnpaidBooking(context.Background(), restaurantID, bookingID)
+		httpx.WriteJSON(w, http.StatusBadGateway, map[string]any{
+			"success":    false,
+			"message":    "No se pudo iniciar el pago de la reserva. Por favor, inténtelo de nuevo.",
+			"error_code": "PAYMENT_START_FAILED",
+		})
+		return
+	}
+	s.recordBookingMarketingConsent(r, restaurantID, bookingID, bookingFormMarketingChannels(r.Form))
+
+	paymentStatus := ""
+	message := "¡Reserva realizada con éxito!"
+	switch {
+	case payment != nil:
+		paymentStatus = bookingPaymentPending
+		message = "Reserva pendiente de pago. Complete el pago para confirmarla."
+	case confirmationRequired:
+		message = "Reserva recibida. El restaurante le llamará para confirmarla."
+	}
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
-		"success":            true,
-		"message":            "¡Reserva realizada con éxito!",
-		"booking_id":         bookingID,
-		"notifications_sent": false,
-		"email_sent":         false,
-		"whatsapp_sent":      false,
+		"success":               true,
+		"message":               message,
+		"booking_id":            bookingID,
+		"notifications_sent":    false,
+		"email_sent":            false,
+		"whatsapp_sent":         false,
+		"payment_required":      payment != nil,
+		"payment":               payment,
+		"confirmation_required": confirmationRequired,
 	})
 
-	s.emitN8nWebhookAsync(restaurantID, "booking.created", map[string]any{
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCreated, map[string]any{
 		"source":                  "front",
+		"paymentStatus":           paymentStatus,
+		"confirmationRequired":    confirmationRequired,
 		"bookingId":               bookingID,
 		"reservationDate":         resDate,
 		"reservationTime":         resTime,
@@ -234,6 +293,7 @@ func (s *Server) handleInsertBookingFront(w http.ResponseWriter, r *http.Request
 		"specialMenu":             specialMenu,
 		"menuDeGrupoId":           menuDeGrupoID,
 		"preferredFloorNumber":    preferredFloorNumber,
+		"guestLinks":              s.guestLinksForBooking(publicBaseURL(r), restaurantID, int(bookingID), resDate),
 	})
 }
 
@@ -390,6 +450,11 @@ func (s *Server) handleInsertBookingAdmin(w http.ResponseWriter, r *http.Request
 		MenuDeGrupoID:     nullIntOrNil(menuDeGrupoID),
 		PrincipalesJSON:   principalesJSON,
 	})
+	var capErr *bookingCapacityError
+	if errors.As(err, &capErr) {
+		writeBookingCapacityError(w, http.StatusConflict, capErr)
+		return
+	}
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"success": false,
@@ -404,7 +469,7 @@ func (s *Server) handleInsertBookingAdmin(w http.ResponseWriter, r *http.Request
 		"whatsapp_sent": false,
 	})
 
-	s.emitN8nWebhookAsync(restaurantID, "booking.created", map[string]any{
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCreated, map[string]any{
 		"source":                  "admin",
 		"bookingId":               bookingID,
 		"reservationDate":         resDate,
@@ -418,6 +483,7 @@ func (s *Server) handleInsertBookingAdmin(w http.ResponseWriter, r *http.Request
 		"contactEmail":            contactEmail,
 		"specialMenu":             specialMenu,
 		"menuDeGrupoId":           menuDeGrupoID,
+		"guestLinks":              s.guestLinksForBooking(publicBaseURL(r), restaurantID, int(bookingID), resDate),
 	})
 }
 
@@ -439,6 +505,9 @@ type bookingInsertParams struct {
 	MenuDeGrupoID     any
 	PrincipalesJSON   any
 	PreferredFloorNum any
+	// ConfirmationRequired keeps the guest's own link from confirming the
+	// booking (a no-show policy); staff confirm it after calling.
+	ConfirmationRequired bool
 }
 
 func (s *Server) insertBooking(r *http.Request, p bookingInsertParams) (int64, error) {
@@ -453,6 +522,14 @@ func (s *Server) insertBooking(r *http.Request, p bookingInsertParams) (int64, e
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := s.enforceBookingCapacityTx(r.Context(), tx, restaurantID, bookingCapacityRequest{
+		ReservationDate: p.ReservationDate,
+		ReservationTime: p.ReservationTime,
+		PartySize:       p.PartySize,
+	}); err != nil {
+		return 0, err
+	}
+
 	res, err := tx.ExecContext(r.Context(), `
 		INSERT INTO bookings (
 			restaurant_id,
@@ -472,9 +549,10 @@ func (s *Server) insertBooking(r *http.Request, p bookingInsertParams) (int64, e
 			special_menu,
 			menu_de_grupo_id,
 			principales_json,
-			preferred_floor_number
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, restaurantID, p.ReservationDate, p.PartySize, p.Children, p.ReservationTime, p.CustomerName, p.ContactPhone, p.ContactPhoneCC, p.Commentary, p.ArrozTypeJSON, p.ArrozServingsJSON, p.BabyStrollers, p.HighChairs, p.ContactEmail, p.SpecialMenu, p.MenuDeGrupoID, p.PrincipalesJSON, p.PreferredFloorNum)
+			preferred_floor_number,
+			confirmation_required
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, restaurantID, p.ReservationDate, p.PartySize, p.Children, p.ReservationTime, p.CustomerName, p.ContactPhone, p.ContactPhoneCC, p.Commentary, p.ArrozTypeJSON, p.ArrozServingsJSON, p.BabyStrollers, p.HighChairs, p.ContactEmail, p.SpecialMenu, p.MenuDeGrupoID, p.PrincipalesJSON, p.PreferredFloorNum, p.ConfirmationRequired)
 	if err != nil {
 		return 0, err
 	}
@@ -482,6 +560,7 @@ func (s *Server) insertBooking(r *http.Request, p bookingInsertParams) (int64, e
 	if err != nil {
 		return 0, err
 	}
+	s.linkNewBookingGuest(r.Context(), tx, restaurantID, id, p.CustomerName, p.ContactPhoneCC, p.ContactPhone, p.ContactEmail)
 
 	if err := tx.Commit(); err != nil {
 		return 0, err
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Floor lifecycle of a booking, set by staff from the tables map. It is
+// separate from bookings.status (pending/confirmed).
+const (
+	bookingSeatArrived    = "arrived"
+	bookingSeatSeated     = "seated"
+	bookingSeatMainCourse = "main_course"
+	bookingSeatPaid       = "paid"
+	bookingSeatLeft       = "left"
+)
+
+// bookingSeatStates is in lifecycle order; bookingSeatColumns holds the
+// timestamp column of each state in the same order.
+var (
+	bookingSeatStates  = []string{bookingSeatArrived, bookingSeatSeated, bookingSeatMainCourse, bookingSeatPaid, bookingSeatLeft}
+	bookingSeatColumns = []string{"arrived_at", "seated_at", "main_course_at", "paid_at", "left_at"}
+)
+
+func normalizeBookingSeatState(raw string) (string, bool) {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	return v, slices.Contains(bookingSeatStates, v)
+}
+
+// tableStatusForSeatState is the restaurant_tables.status a booking's tables
+// take in each state.
+func tableStatusForSeatState(state string) string {
+	switch state {
+	case bookingSeatArrived:
+		return "reserved"
+	case bookingSeatLeft:
+		return "available"
+	default:
+		return "occupied"
+	}
+}
+
+// bookingSeatStateSQL builds the UPDATE for moving to state. The state's own
+// timestamp is kept if already set; later ones are cleared so going back a
+// step (a mistaken "left") reopens the turn. Any step also marks the guest
+// arrived.
+func bookingSeatStateSQL(state string) string {
+	idx := slices.Index(bookingSeatStates, state)
+	sets := []string{
+		"attendance_at = IF(attendance <=> 'arrived', attendance_at, NOW())",
+		"attendance = 'arrived'",
+		"seat_status = ?",
+	}
+	for i, col := range bookingSeatColumns {
+		switch {
+		case i == idx:
+			sets = append(sets, col+" = COALESCE("+col+", NOW())")
+		case i > idx:
+			sets = append(sets, col+" = NULL")
+		}
+	}
+	return "UPDATE bookings SET " + strings.Join(sets, ", ") + " WHERE restaurant_id = ? AND id = ?"
+}
+
+type bookingSeatInfo struct {
+	BookingID    int     `json:"bookingId"`
+	Date         string  `json:"date"`
+	Time         string  `json:"time"`
+	PartySize    int     `json:"partySize"`
+	CustomerName string  `json:"customerName"`
+	TableNumber  string  `json:"tableNumber"`
+	State        *string `json:"state"`
+	Attendance   *string `json:"attendance"`
+	ArrivedAt    *string `json:"arrivedAt"`
+	SeatedAt     *string `json:"seatedAt"`
+	MainCourseAt *string `json:"mainCourseAt"`
+	PaidAt       *string `json:"paidAt"`
+	LeftAt       *string `json:"leftAt"`
+}
+
+func (s *Server) loadBookingSeatInfo(ctx context.Context, restaurantID, bookingID int) (bookingSeatInfo, error) {
+	var (
+		b                                         bookingSeatInfo
+		table, state, attendance                  sql.NullString
+		arrived, seated, mainCourse, paid, leftAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			id,
+			DATE_FORMAT(reservation_date, '%Y-%m-%d'),
+			TIME_FORMAT(reservation_time, '%H:%i'),
+			party_size,
+			customer_name,
+			table_number,
+			seat_status,
+			attendance,
+			arrived_at,
+			seated_at,
+			main_course_at,
+			paid_at,
+			left_at
+		FROM bookings
+		WHERE restaurant_id = ? AND id = ?
+		LIMIT 1
+	`, restaurantID, bookingID).Scan(&b.BookingID, &b.Date, &b.Time, &b.PartySize, &b.CustomerName, &table, &state,
+		&attendance, &arrived, &seated, &mainCourse, &paid, &leftAt)
+	if err != nil {
+		return bookingSeatInfo{}, err
+	}
+	b.TableNumber = strings.TrimSpace(table.String)
+	if state.Valid && state.String != "" {
+		b.State = &state.String
+	}
+	if attendance.Valid && attendance.String != "" {
+		b.Attendance = &attendance.String
+	}
+	b.ArrivedAt = formatNullTimeRFC3339(arrived)
+	b.SeatedAt = formatNullTimeRFC3339(seated)
+	b.MainCourseAt = formatNullTimeRFC3339(mainCourse)
+	b.PaidAt = formatNullTimeRFC3339(paid)
+	b.LeftAt = formatNullTimeRFC3339(leftAt)
+	return b, nil
+}
+
+// setBookingSeatState moves a booking to state, updates the status of the
+// tables it sits at and broadcasts both to the tables map. It returns
+// sql.ErrNoRows for an unknown booking.
+func (s *Server) setBookingSeatState(r *http.Request, restaurantID, bookingID int, state string) (bookingSeatInfo, error) {
+	ctx := r.Context()
+	before, err := s.loadBookingSeatInfo(ctx, restaurantID, bookingID)
+	if err != nil {
+		return bookingSeatInfo{}, err
+	}
+	if _, err := s.db.ExecContext(ctx, bookingSeatStateSQL(state), state, restaurantID, bookingID); err != nil {
+		return bookingSeatInfo{}, err
+	}
+	after, err := s.loadBookingSeatInfo(ctx, restaurantID, bookingID)
+	if err != nil {
+		return bookingSeatInfo{}, err
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "booking", EntityID: bookingID, Before: before, After: after})
+	if before.State == nil {
+		s.refreshBookingGuestAsync(restaurantID, bookingID)
+	}
+
+	if after.TableNumber != "" {
+		if err := s.syncSeatTableStatus(ctx, restaurantID, after.TableNumber, tableStatusForSeatState(state)); err != nil {
+			log.Printf("[tables] sync status booking %d: %v", bookingID, err)
+		}
+	}
+	s.broadcastBOTablesEvent(restaurantID, "booking_state_changed", after)
+	return after, nil
+}
+
+// syncSeatTableStatus sets the runtime status of the tables named by a
+// booking's table_number and broadcasts each as table_updated.
+func (s *Server) syncSeatTableStatus(ctx context.Context, restaurantID int, tableNumber, status string) error {
+	tables, err := s.loadAssignableTables(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	for _, id := range resolveTableNumber(tableNumber, tables) {
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE restaurant_tables SET status = ?, updated_at = NOW()
+			WHERE restaurant_id = ? AND id = ?
+		`, status, restaurantID, id); err != nil {
+			if isSQLSchemaError(err) {
+				return nil
+			}
+			return err
+		}
+		rows, err := s.queryAllAsMaps(ctx, `SELECT * FROM restaurant_tables WHERE restaurant_id = ? AND id = ?`, restaurantID, id)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			s.broadcastBOTablesEvent(restaurantID, "table_updated", rows[0])
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
@@ -435,6 +436,8 @@ func (s *Server) handleEditBooking(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	before, _ := s.loadWebhookBookingSnapshot(r.Context(), restaurantID, id)
+
 	_, err = s.db.ExecContext(r.Context(), `
 		UPDATE bookings SET
 			reservation_date = ?,
@@ -458,6 +461,8 @@ func (s *Server) handleEditBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.emitBookingUpdatedWebhooks(r.Context(), restaurantID, id, "legacy_admin_edit_booking", before)
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true})
 }
 
@@ -580,6 +585,7 @@ func (s *Server) handleDeleteBooking(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Error: " + err.Error()})
 		return
 	}
+	guestID := carryBookingGuestTx(ctx, tx, restaurantID, b.ID)
 
 	res, err := tx.ExecContext(ctx, "DELETE FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, id)
 	if err != nil {
@@ -597,7 +603,7 @@ func (s *Server) handleDeleteBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.emitN8nWebhookAsync(restaurantID, "booking.cancelled", map[string]any{
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCancelled, map[string]any{
 		"source":          "legacy_admin_delete_booking",
 		"cancelledBy":     "staff",
 		"bookingId":       b.ID,
@@ -608,6 +614,9 @@ func (s *Server) handleDeleteBooking(w http.ResponseWriter, r *http.Request) {
 		"contactPhone":    b.ContactPhone.String,
 		"contactEmail":    b.ContactEmail.String,
 	})
+	s.offerWaitlistAsync(restaurantID, b.ReservationDate)
+	s.settleBookingDepositAsync(restaurantID, b.ID, b.ReservationDate, b.ReservationTime)
+	s.refreshGuestStatsAsync(restaurantID, guestID)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Booking cancelled and saved successfully."})
 }
@@ -630,10 +639,12 @@ func (s *Server) handleUpdateTableNumber(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	before, _ := s.loadWebhookBookingSnapshot(r.Context(), restaurantID, bookingID)
 	if _, err := s.db.ExecContext(r.Context(), "UPDATE bookings SET table_number = ? WHERE restaurant_id = ? AND id = ?", tableNumber, restaurantID, bookingID); err != nil {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": err.Error()})
 		return
 	}
+	s.emitBookingUpdatedWebhooks(r.Context(), restaurantID, bookingID, "legacy_admin_table_number", before)
 
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Table number updated successfully"})
 }
@@ -922,6 +933,13 @@ func (s *Server) handleReactivateBooking(w http.ResponseWriter, r *http.Request)
 	}
 	newID, _ := res2.LastInsertId()
 
+	var guestID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, "SELECT guest_id FROM cancelled_bookings WHERE restaurant_id = ? AND id = ?", restaurantID, cancelledID).Scan(&guestID); err == nil && guestID.Valid {
+		if _, err := tx.ExecContext(ctx, "UPDATE bookings SET guest_id = ? WHERE restaurant_id = ? AND id = ?", guestID.Int64, restaurantID, newID); err != nil {
+			log.Printf("[guests] carry guest to reactivated booking %d: %v", newID, err)
+		}
+	}
+
 	if _, err := tx.ExecContext(ctx, "DELETE FROM cancelled_bookings WHERE restaurant_id = ? AND id = ?", restaurantID, cancelledID); err != nil {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{"success": false, "message": "Error eliminando registro de cancelación: " + err.Error()})
 		return
@@ -932,6 +950,22 @@ func (s *Server) handleReactivateBooking(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if guestID.Valid {
+		s.refreshGuestStatsAsync(restaurantID, int(guestID.Int64))
+	}
+
+	if snap, err := s.loadWebhookBookingSnapshot(ctx, restaurantID, int(newID)); err == nil {
+		payload := map[string]any{
+			"source":             "legacy_admin_reactivate_booking",
+			"bookingId":          newID,
+			"cancelledBookingId": cancelledID,
+		}
+		for k, v := range snap {
+			payload[k] = v
+		}
+		s.emitN8nWebhookAsync(restaurantID, webhookEventBookingReactivated, payload)
+	}
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success":        true,
 		"message":        "Reserva reactivada correctamente",
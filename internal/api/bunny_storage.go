@@ -88,6 +88,64 @@ func bunnyPutWithCredentials(ctx context.Context, zone, accessKey, objectPath st
 	return fmt.Errorf("bunny upload failed (%d): %s", res.StatusCode, msg)
 }
 
+// bunnyDeleteURL removes the object behind a URL built by bunnyPullURL.
+// URLs pointing elsewhere are left alone, and a missing object is not an
+// error.
+func (s *Server) bunnyDeleteURL(ctx context.Context, pullURL string) error {
+	if !s.bunnyConfigured() {
+		return nil
+	}
+	objectPath, ok := bunnyObjectPath(s.cfg.BunnyPullBaseURL, pullURL)
+	if !ok {
+		return nil
+	}
+	return bunnyDeleteWithCredentials(ctx, strings.TrimSpace(s.cfg.BunnyStorageZone), strings.TrimSpace(s.cfg.BunnyStorageKey), objectPath)
+}
+
+// bunnyObjectPath returns the storage path of a pull URL under base.
+func bunnyObjectPath(base, pullURL string) (string, bool) {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	pullURL = strings.TrimSpace(pullURL)
+	if base == "" || !strings.HasPrefix(pullURL, base+"/") {
+		return "", false
+	}
+	p := strings.TrimLeft(strings.TrimPrefix(pullURL, base+"/"), "/")
+	if p == "" {
+		return "", false
+	}
+	return p, true
+}
+
+func bunnyDeleteWithCredentials(ctx context.Context, zone, accessKey, objectPath string) error {
+	if strings.TrimSpace(zone) == "" || strings.TrimSpace(accessKey) == "" {
+		return errors.New("invalid bunny credentials")
+	}
+	u := "https://storage.bunnycdn.com/" + url.PathEscape(zone) + "/" + bunnyEscapePath(objectPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("AccessKey", accessKey)
+
+	cli := &http.Client{Timeout: 30 * time.Second}
+	res, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if (res.StatusCode >= 200 && res.StatusCode < 300) || res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 8<<10))
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		msg = res.Status
+	}
+	return fmt.Errorf("bunny delete failed (%d): %s", res.StatusCode, msg)
+}
+
 func bunnyEscapePath(p string) string {
 	p = strings.TrimSpace(p)
 	p = strings.TrimLeft(p, "/")
@@ -3,6 +3,7 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -289,11 +290,23 @@ func (s *Server) handleSaveConversationMessage(w http.ResponseWriter, r *http.Re
 		  AND sender_number = ?
 	`, sessionID, restaurantID, senderNumber)
 
+	// STOP-style replies withdraw WhatsApp marketing consent; the flow can
+	// answer with a confirmation when marketing_opt_out is set.
+	optedOut := false
+	if msgType == "user" && isMarketingStopKeyword(content) {
+		var err error
+		optedOut, err = s.optOutWhatsAppSender(r.Context(), restaurantID, senderNumber)
+		if err != nil && !isSQLSchemaError(err) {
+			log.Printf("[marketing] whatsapp opt-out %s: %v", senderNumber, err)
+		}
+	}
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
-		"success":      true,
-		"message_id":   insertedID,
-		"session_id":   sessionID,
-		"message_type": msgType,
-		"timestamp":    time.Now().Format("2006-01-02 15:04:05"),
+		"success":           true,
+		"message_id":        insertedID,
+		"session_id":        sessionID,
+		"message_type":      msgType,
+		"timestamp":         time.Now().Format("2006-01-02 15:04:05"),
+		"marketing_opt_out": optedOut,
 	})
 }
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deposit kinds.
+const (
+	depositKindDeposit   = "deposit"
+	depositKindGuarantee = "guarantee"
+)
+
+// booking_payments.status values.
+const (
+	paymentPending    = "pending"
+	paymentPaid       = "paid"
+	paymentAuthorized = "authorized"
+	paymentCaptured   = "captured"
+	paymentRefunded   = "refunded"
+	paymentReleased   = "released"
+	paymentExpired    = "expired"
+)
+
+// bookings.payment_status values.
+const (
+	bookingPaymentPending    = "pending_payment"
+	bookingPaymentPaid       = "paid"
+	bookingPaymentGuaranteed = "guaranteed"
+)
+
+const depositCurrency = "eur"
+
+type depositRule struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Kind              string `json:"kind"`
+	MinPartySize      int    `json:"minPartySize"`
+	GroupMenuOnly     bool   `json:"groupMenuOnly"`
+	MenuDeGrupoID     int    `json:"menuDeGrupoId"`
+	DateFrom          string `json:"dateFrom"`
+	DateTo            string `json:"dateTo"`
+	Weekdays          []int  `json:"weekdays"`
+	AmountCents       int    `json:"amountCents"`
+	PerPerson         bool   `json:"perPerson"`
+	RefundCutoffHours int    `json:"refundCutoffHours"`
+	SortOrder         int    `json:"sortOrder"`
+	Active            bool   `json:"active"`
+}
+
+// depositBookingFacts is what the rules look at.
+type depositBookingFacts struct {
+	Date          string
+	PartySize     int
+	SpecialMenu   bool
+	MenuDeGrupoID int
+}
+
+// matches reports whether every condition set on the rule holds.
+func (r depositRule) matches(b depositBookingFacts) bool {
+	if !r.Active {
+		return false
+	}
+	if r.MinPartySize > 0 && b.PartySize < r.MinPartySize {
+		return false
+	}
+	if r.GroupMenuOnly && !b.SpecialMenu {
+		return false
+	}
+	if r.MenuDeGrupoID > 0 && b.MenuDeGrupoID != r.MenuDeGrupoID {
+		return false
+	}
+	if r.DateFrom != "" && b.Date < r.DateFrom {
+		return false
+	}
+	if r.DateTo != "" && b.Date > r.DateTo {
+		return false
+	}
+	if len(r.Weekdays) > 0 {
+		d, err := time.Parse("2006-01-02", b.Date)
+		if err != nil || !slices.Contains(r.Weekdays, int(d.Weekday())) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r depositRule) amountFor(partySize int) int {
+	if r.PerPerson {
+		return r.AmountCents * partySize
+	}
+	return r.AmountCents
+}
+
+// matchDepositRule returns the first matching rule in list order.
+func matchDepositRule(rules []depositRule, b depositBookingFacts) (depositRule, bool) {
+	for _, r := range rules {
+		if r.matches(b) {
+			return r, true
+		}
+	}
+	return depositRule{}, false
+}
+
+// depositRuleInput is a rule as sent by the backoffice; active defaults to
+// true when omitted.
+type depositRuleInput struct {
+	Name              string `json:"name"`
+	Kind              string `json:"kind"`
+	MinPartySize      int    `json:"minPartySize"`
+	GroupMenuOnly     bool   `json:"groupMenuOnly"`
+	MenuDeGrupoID     int    `json:"menuDeGrupoId"`
+	DateFrom          string `json:"dateFrom"`
+	DateTo            string `json:"dateTo"`
+	Weekdays          []int  `json:"weekdays"`
+	AmountCents       int    `json:"amountCents"`
+	PerPerson         bool   `json:"perPerson"`
+	RefundCutoffHours *int   `json:"refundCutoffHours,omitempty"`
+	Active            *bool  `json:"active,omitempty"`
+}
+
+// normalizeDepositRules validates a full rule list. It returns a message for
+// the first invalid rule.
+func normalizeDepositRules(in []depositRuleInput) ([]depositRule, string) {
+	out := make([]depositRule, 0, len(in))
+	for i, item := range in {
+		r := depositRule{
+			Name:              strings.TrimSpace(item.Name),
+			Kind:              strings.ToLower(strings.TrimSpace(item.Kind)),
+			MinPartySize:      item.MinPartySize,
+			GroupMenuOnly:     item.GroupMenuOnly,
+			MenuDeGrupoID:     item.MenuDeGrupoID,
+			DateFrom:          strings.TrimSpace(item.DateFrom),
+			DateTo:            strings.TrimSpace(item.DateTo),
+			AmountCents:       item.AmountCents,
+			PerPerson:         item.PerPerson,
+			RefundCutoffHours: 48,
+			SortOrder:         i,
+			Active:            true,
+		}
+		if item.RefundCutoffHours != nil {
+			r.RefundCutoffHours = *item.RefundCutoffHours
+		}
+		if item.Active != nil {
+			r.Active = *item.Active
+		}
+		if r.Name == "" || len(r.Name) > 120 {
+			return nil, "Nombre de regla invalido"
+		}
+		if r.Kind == "" {
+			r.Kind = depositKindDeposit
+		}
+		if r.Kind != depositKindDeposit && r.Kind != depositKindGuarantee {
+			return nil, "Tipo invalido en " + r.Name
+		}
+		if r.AmountCents <= 0 || r.AmountCents > 1_000_000 {
+			return nil, "Importe invalido en " + r.Name
+		}
+		if r.MinPartySize < 0 || r.MenuDeGrupoID < 0 || r.RefundCutoffHours < 0 || r.RefundCutoffHours > 24*60 {
+			return nil, "Condiciones invalidas en " + r.Name
+		}
+		if (r.DateFrom != "" && !isValidISODate(r.DateFrom)) || (r.DateTo != "" && !isValidISODate(r.DateTo)) ||
+			(r.DateFrom != "" && r.DateTo != "" && r.DateFrom > r.DateTo) {
+			return nil, "Fechas invalidas en " + r.Name
+		}
+		days := []int{}
+		for _, d := range item.Weekdays {
+			if d < 0 || d > 6 {
+				return nil, "Dias de la semana invalidos en " + r.Name
+			}
+			if !slices.Contains(days, d) {
+				days = append(days, d)
+			}
+		}
+		slices.Sort(days)
+		r.Weekdays = days
+		out = append(out, r)
+	}
+	return out, ""
+}
+
+func formatDepositWeekdays(days []int) string {
+	parts := make([]string, 0, len(days))
+	for _, d := range days {
+		parts = append(parts, strconv.Itoa(d))
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseDepositWeekdays(raw string) []int {
+	days := []int{}
+	for _, part := range strings.Split(raw, ",") {
+		if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && d >= 0 && d <= 6 {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+func (s *Server) loadDepositRules(ctx context.Context, q sqlQueryer, restaurantID int) ([]depositRule, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, name, kind, min_party_size, group_menu_only, menu_de_grupo_id,
+			DATE_FORMAT(date_from, '%Y-%m-%d'), DATE_FORMAT(date_to, '%Y-%m-%d'), weekdays,
+			amount_cents, per_person, refund_cutoff_hours, sort_order, is_active
+		FROM deposit_rules
+		WHERE restaurant_id = ?
+		ORDER BY sort_order ASC, id ASC
+	`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []depositRule{}
+	for rows.Next() {
+		var (
+			r                         depositRule
+			minSize, menuID           sql.NullInt64
+			dateFrom, dateTo, weekday sql.NullString
+		)
+		if err := rows.Scan(&r.ID, &r.Name, &r.Kind, &minSize, &r.GroupMenuOnly, &menuID, &dateFrom, &dateTo, &weekday,
+			&r.AmountCents, &r.PerPerson, &r.RefundCutoffHours, &r.SortOrder, &r.Active); err != nil {
+			return nil, err
+		}
+		r.MinPartySize = int(minSize.Int64)
+		r.MenuDeGrupoID = int(menuID.Int64)
+		r.DateFrom, r.DateTo = dateFrom.String, dateTo.String
+		r.Weekdays = parseDepositWeekdays(weekday.String)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// depositRefundable reports whether a cancellation at now is early enough
+// for the deposit to be returned: at least cutoffHours before the booking.
+func depositRefundable(reservationDate, reservationTime string, cutoffHours int, now time.Time) bool {
+	hhmm, err := normalizeHHMM(reservationTime)
+	if err != nil {
+		return false
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04", reservationDate+" "+hhmm, boMadridTZ)
+	if err != nil {
+		return false
+	}
+	return !now.After(start.Add(-time.Duration(cutoffHours) * time.Hour))
+}
+
+// bookingPaymentStatusFor is the bookings.payment_status shown while a
+// payment is in status.
+func bookingPaymentStatusFor(status string) string {
+	switch status {
+	case paymentPending:
+		return bookingPaymentPending
+	case paymentAuthorized:
+		return bookingPaymentGuaranteed
+	default:
+		return bookingPaymentPaid
+	}
+}
+
+// What to do with a provider event, given the payment's current status.
+const (
+	paymentOpNone = iota
+	paymentOpMarkPaid
+	// paid after the hold expired and the booking was cancelled: keep the
+	// record straight, then give the money back.
+	paymentOpMarkPaidAndReturn
+	paymentOpExpire
+	paymentOpMarkRefunded
+)
+
+// reconcilePaymentOp decides how an event applies. Providers retry and may
+// deliver out of order, so anything that doesn't move the payment forward
+// is a no-op.
+func reconcilePaymentOp(status string, ev paymentEvent) int {
+	switch ev.Type {
+	case paymentEventCompleted:
+		switch status {
+		case paymentPending:
+			return paymentOpMarkPaid
+		case paymentExpired:
+			return paymentOpMarkPaidAndReturn
+		}
+	case paymentEventExpired:
+		if status == paymentPending {
+			return paymentOpExpire
+		}
+	case paymentEventRefunded:
+		if status == paymentPaid || status == paymentCaptured {
+			return paymentOpMarkRefunded
+		}
+	}
+	return paymentOpNone
+}
+
+// paidStatusFor is the status a completed checkout leaves a payment in.
+func paidStatusFor(kind string) string {
+	if kind == depositKindGuarantee {
+		return paymentAuthorized
+	}
+	return paymentPaid
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchDepositRule(t *testing.T) {
+	rules := []depositRule{
+		{ID: 1, Name: "Menu navidad", Kind: depositKindDeposit, MenuDeGrupoID: 7, AmountCents: 1000, PerPerson: true, Active: true},
+		{ID: 2, Name: "Grupos sabado", Kind: depositKindGuarantee, MinPartySize: 8, Weekdays: []int{6}, AmountCents: 5000, Active: true},
+		{ID: 3, Name: "Inactiva", MinPartySize: 1, AmountCents: 100},
+	}
+
+	r, ok := matchDepositRule(rules, depositBookingFacts{Date: "2026-10-17", PartySize: 4, SpecialMenu: true, MenuDeGrupoID: 7})
+	if !ok || r.ID != 1 || r.amountFor(4) != 4000 {
+		t.Fatalf("group menu booking matched %+v (ok=%v)", r, ok)
+	}
+	// 2026-10-17 is a Saturday.
+	r, ok = matchDepositRule(rules, depositBookingFacts{Date: "2026-10-17", PartySize: 10})
+	if !ok || r.ID != 2 || r.amountFor(10) != 5000 {
+		t.Fatalf("large party matched %+v (ok=%v)", r, ok)
+	}
+	if r, ok := matchDepositRule(rules, depositBookingFacts{Date: "2026-10-16", PartySize: 10}); ok {
+		t.Fatalf("friday booking matched %+v", r)
+	}
+	if r, ok := matchDepositRule(rules, depositBookingFacts{Date: "2026-10-17", PartySize: 2}); ok {
+		t.Fatalf("small party matched %+v", r)
+	}
+}
+
+func TestNormalizeDepositRules(t *testing.T) {
+	off := false
+	rules, msg := normalizeDepositRules([]depositRuleInput{
+		{Name: " Grupos ", MinPartySize: 8, Weekdays: []int{6, 5, 6}, AmountCents: 2000},
+		{Name: "Garantia", Kind: "GUARANTEE", AmountCents: 3000, Active: &off},
+	})
+	if msg != "" {
+		t.Fatalf("normalizeDepositRules() message = %q", msg)
+	}
+	if rules[0].Name != "Grupos" || rules[0].Kind != depositKindDeposit || !rules[0].Active || rules[0].RefundCutoffHours != 48 {
+		t.Fatalf("rule 0 = %+v", rules[0])
+	}
+	if got := formatDepositWeekdays(rules[0].Weekdays); got != "5,6" {
+		t.Fatalf("weekdays = %q, want 5,6", got)
+	}
+	if rules[1].Kind != depositKindGuarantee || rules[1].Active || rules[1].SortOrder != 1 {
+		t.Fatalf("rule 1 = %+v", rules[1])
+	}
+
+	bad := []depositRuleInput{
+		{Name: "Sin importe"},
+		{Name: "Tipo", Kind: "prepaid", AmountCents: 100},
+		{Name: "Fechas", DateFrom: "2026-12-31", DateTo: "2026-12-01", AmountCents: 100},
+		{Name: "Dias", Weekdays: []int{7}, AmountCents: 100},
+	}
+	for _, in := range bad {
+		if _, msg := normalizeDepositRules([]depositRuleInput{in}); msg == "" {
+			t.Fatalf("rule %q accepted", in.Name)
+		}
+	}
+}
+
+func TestDepositRefundable(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, boMadridTZ)
+	if !depositRefundable("2026-10-18", "12:00:00", 48, now) {
+		t.Fatalf("cancellation exactly at the cutoff should be refundable")
+	}
+	if depositRefundable("2026-10-18", "11:59", 48, now) {
+		t.Fatalf("cancellation after the cutoff should not be refundable")
+	}
+	if !depositRefundable("2026-10-16", "13:00", 0, now) {
+		t.Fatalf("zero cutoff should refund until the booking starts")
+	}
+}
+
+func TestReconcilePaymentOp(t *testing.T) {
+	cases := []struct {
+		status string
+		event  string
+		want   int
+	}{
+		{paymentPending, paymentEventCompleted, paymentOpMarkPaid},
+		{paymentExpired, paymentEventCompleted, paymentOpMarkPaidAndReturn},
+		{paymentPaid, paymentEventCompleted, paymentOpNone},
+		{paymentPending, paymentEventExpired, paymentOpExpire},
+		{paymentPaid, paymentEventExpired, paymentOpNone},
+		{paymentPaid, paymentEventRefunded, paymentOpMarkRefunded},
+		{paymentAuthorized, paymentEventRefunded, paymentOpNone},
+		{paymentPending, "", paymentOpNone},
+	}
+	for _, tc := range cases {
+		if got := reconcilePaymentOp(tc.status, paymentEvent{Type: tc.event}); got != tc.want {
+			t.Fatalf("reconcilePaymentOp(%q, %q) = %d, want %d", tc.status, tc.event, got, tc.want)
+		}
+	}
+}
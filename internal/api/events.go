@@ -3,7 +3,10 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
@@ -12,6 +15,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func eventEnabled(enabled []string, event string) bool {
@@ -28,6 +33,9 @@ func eventEnabled(enabled []string, event string) bool {
 		if e == "*" || e == event {
 			return true
 		}
+		if prefix, ok := strings.CutSuffix(e, ".*"); ok && strings.HasPrefix(event, prefix+".") {
+			return true
+		}
 	}
 	return false
 }
@@ -45,76 +53,297 @@ func (s *Server) emitN8nWebhookAsync(restaurantID int, event string, payload any
 	}()
 }
 
-func (s *Server) emitN8nWebhook(ctx context.Context, restaurantID int, event string, payload any) error {
-	var webhook sql.NullString
-	var enabledRaw sql.NullString
+const (
+	// webhookMaxAttempts includes the first (inline) attempt.
+	webhookMaxAttempts   = 8
+	webhookRetryBase     = 30 * time.Second
+	webhookRetryMaxDelay = 6 * time.Hour
+	// webhookClaimLease keeps a claimed delivery out of the queue while it is
+	// being sent. A crashed sender just makes the row due again after the lease.
+	webhookClaimLease   = 2 * time.Minute
+	webhookRetryPoll    = 30 * time.Second
+	webhookRetryBatch   = 20
+	webhookHTTPTimeout  = 8 * time.Second
+	webhookSignaturePfx = "sha256="
+)
+
+// webhookRetryDelay returns the wait after the given number of failed attempts:
+// 30s, 1m, 2m, 4m... capped at 6h.
+func webhookRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := webhookRetryBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= webhookRetryMaxDelay {
+			return webhookRetryMaxDelay
+		}
+	}
+	return d
+}
+
+// signWebhookBody signs "<timestamp>.<body>" so receivers can reject replays
+// of an old body with a fresh timestamp.
+func signWebhookBody(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return webhookSignaturePfx + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookTarget struct {
+	URL     string
+	Secret  string
+	Enabled []string
+}
+
+func (s *Server) loadWebhookTarget(ctx context.Context, restaurantID int) (webhookTarget, error) {
+	var out webhookTarget
+	var webhook, secret, enabledRaw sql.NullString
 	err := s.db.QueryRowContext(ctx, `
-		SELECT n8n_webhook_url, enabled_events_json
+		SELECT n8n_webhook_url, n8n_webhook_secret, enabled_events_json
 		FROM restaurant_integrations
 		WHERE restaurant_id = ?
 		LIMIT 1
-	`, restaurantID).Scan(&webhook, &enabledRaw)
+	`, restaurantID).Scan(&webhook, &secret, &enabledRaw)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil
+			return out, nil
 		}
-		return err
+		return out, err
 	}
-
-	webhookURL := strings.TrimSpace(webhook.String)
-	if webhookURL == "" {
-		return nil
+	out.URL = strings.TrimSpace(webhook.String)
+	out.Secret = strings.TrimSpace(secret.String)
+	if enabledRaw.Valid && strings.TrimSpace(enabledRaw.String) != "" {
+		_ = json.Unmarshal([]byte(enabledRaw.String), &out.Enabled)
 	}
+	return out, nil
+}
 
-	var enabled []string
-	if enabledRaw.Valid && strings.TrimSpace(enabledRaw.String) != "" {
-		_ = json.Unmarshal([]byte(enabledRaw.String), &enabled)
+func (s *Server) emitN8nWebhook(ctx context.Context, restaurantID int, event string, payload any) error {
+	target, err := s.loadWebhookTarget(ctx, restaurantID)
+	if err != nil {
+		return err
 	}
-	if !eventEnabled(enabled, event) {
+	if target.URL == "" || !eventEnabled(target.Enabled, event) {
 		return nil
 	}
 
+	eventID := uuid.NewString()
 	envelope := map[string]any{
 		"event":        event,
+		"eventId":      eventID,
+		"version":      webhookEventVersion(event),
 		"restaurantId": restaurantID,
 		"payload":      payload,
 		"occurredAt":   time.Now().Format(time.RFC3339),
 	}
 	body, _ := json.Marshal(envelope)
 
-	// Persist delivery attempt for observability.
-	var deliveryID int64
-	{
-		res, err := s.db.ExecContext(ctx, `
-			INSERT INTO message_deliveries (restaurant_id, channel, event, recipient, payload_json, status)
-			VALUES (?, 'webhook', ?, ?, ?, 'pending')
-		`, restaurantID, event, webhookURL, string(body))
-		if err != nil {
-			return err
-		}
-		deliveryID, _ = res.LastInsertId()
+	// The row is queued with a lease before the inline attempt, so a crash
+	// between insert and send still gets picked up by the retry loop.
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO message_deliveries (restaurant_id, channel, event, event_id, recipient, payload_json, status, attempts, next_attempt_at)
+		VALUES (?, 'webhook', ?, ?, ?, ?, 'pending', 0, DATE_ADD(NOW(), INTERVAL ? SECOND))
+	`, restaurantID, event, eventID, target.URL, string(body), int(webhookClaimLease/time.Second))
+	if err != nil {
+		return err
 	}
+	deliveryID, _ := res.LastInsertId()
+
+	return s.attemptWebhookDelivery(ctx, webhookDelivery{
+		ID:           deliveryID,
+		RestaurantID: restaurantID,
+		Event:        event,
+		EventID:      eventID,
+		Body:         body,
+	}, target)
+}
+
+type webhookDelivery struct {
+	ID           int64
+	RestaurantID int
+	Event        string
+	EventID      string
+	Body         []byte
+	// Attempts already made before this one.
+	Attempts int
+}
+
+// attemptWebhookDelivery makes one POST and records the outcome: sent,
+// retrying (with the next backoff) or failed once attempts run out.
+func (s *Server) attemptWebhookDelivery(ctx context.Context, d webhookDelivery, target webhookTarget) error {
+	attempt := d.Attempts + 1
+	sendErr := postWebhook(ctx, target, d, attempt)
+
+	if sendErr == nil {
+		_, _ = s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET status = 'sent', attempts = ?, recipient = ?, error = NULL, sent_at = NOW(), last_attempt_at = NOW(), next_attempt_at = NULL
+			WHERE id = ? AND restaurant_id = ?
+		`, attempt, target.URL, d.ID, d.RestaurantID)
+		return nil
+	}
+
+	if attempt >= webhookMaxAttempts {
+		_, _ = s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET status = 'failed', attempts = ?, recipient = ?, error = ?, last_attempt_at = NOW(), next_attempt_at = NULL
+			WHERE id = ? AND restaurant_id = ?
+		`, attempt, target.URL, sendErr.Error(), d.ID, d.RestaurantID)
+		return sendErr
+	}
+
+	_, _ = s.db.ExecContext(ctx, `
+		UPDATE message_deliveries
+		SET status = 'retrying', attempts = ?, recipient = ?, error = ?, last_attempt_at = NOW(),
+			next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE id = ? AND restaurant_id = ?
+	`, attempt, target.URL, sendErr.Error(), int(webhookRetryDelay(attempt)/time.Second), d.ID, d.RestaurantID)
+	return sendErr
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+func postWebhook(ctx context.Context, target webhookTarget, d webhookDelivery, attempt int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(d.Body))
 	if err != nil {
-		_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'failed', error = ? WHERE id = ? AND restaurant_id = ?", err.Error(), deliveryID, restaurantID)
 		return err
 	}
+	ts := time.Now().Unix()
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", d.EventID)
+	req.Header.Set("Idempotency-Key", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	if target.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", signWebhookBody(target.Secret, ts, d.Body))
+	}
 
-	resp, err := (&http.Client{Timeout: 8 * time.Second}).Do(req)
+	resp, err := (&http.Client{Timeout: webhookHTTPTimeout}).Do(req)
 	if err != nil {
-		_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'failed', error = ? WHERE id = ? AND restaurant_id = ?", err.Error(), deliveryID, restaurantID)
 		return err
 	}
 	defer resp.Body.Close()
 	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 32<<10))
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		msg := "HTTP " + strconv.Itoa(resp.StatusCode) + ": " + strings.TrimSpace(string(raw))
-		_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'failed', error = ? WHERE id = ? AND restaurant_id = ?", msg, deliveryID, restaurantID)
-		return errors.New(msg)
+		return errors.New("HTTP " + strconv.Itoa(resp.StatusCode) + ": " + strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
+
+// runWebhookRetryLoop resends due pending/retrying webhook deliveries. Rows are
+// claimed by pushing next_attempt_at forward, so several instances can share
+// the queue without sending the same attempt twice.
+func (s *Server) runWebhookRetryLoop(ctx context.Context) {
+	ticker := time.NewTicker(webhookRetryPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.retryDueWebhooks(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook retry loop: %v", err)
+		}
+	}
+}
+
+func (s *Server) retryDueWebhooks(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id
+		FROM message_deliveries
+		WHERE channel = 'webhook'
+			AND status IN ('pending', 'retrying')
+			AND next_attempt_at IS NOT NULL
+			AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at ASC
+		LIMIT ?
+	`, webhookRetryBatch)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET status = 'sent', sent_at = NOW() WHERE id = ? AND restaurant_id = ?", deliveryID, restaurantID)
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+			WHERE id = ? AND status IN ('pending', 'retrying') AND next_attempt_at <= NOW()
+		`, int(webhookClaimLease/time.Second), id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			continue
+		}
+		if err := s.redeliverWebhook(ctx, id, false); err != nil {
+			log.Printf("webhook retry failed (delivery_id=%d): %v", id, err)
+		}
+	}
 	return nil
 }
+
+// redeliverWebhook resends a stored delivery with its original body and event
+// ID. The current URL and secret are used, so fixing the integration settings
+// is enough for a replay to go through. resetAttempts gives a manual replay a
+// fresh retry budget.
+func (s *Server) redeliverWebhook(ctx context.Context, deliveryID int64, resetAttempts bool) error {
+	var d webhookDelivery
+	var eventID sql.NullString
+	var body sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, restaurant_id, event, event_id, payload_json, attempts
+		FROM message_deliveries
+		WHERE id = ? AND channel = 'webhook'
+		LIMIT 1
+	`, deliveryID).Scan(&d.ID, &d.RestaurantID, &d.Event, &eventID, &body, &d.Attempts)
+	if err != nil {
+		return err
+	}
+	d.Body = []byte(body.String)
+	d.EventID = strings.TrimSpace(eventID.String)
+	if d.EventID == "" {
+		// Rows written before event IDs existed get one on first redelivery.
+		d.EventID = uuid.NewString()
+		_, _ = s.db.ExecContext(ctx, "UPDATE message_deliveries SET event_id = ? WHERE id = ?", d.EventID, d.ID)
+	}
+	if resetAttempts {
+		d.Attempts = 0
+	}
+
+	target, err := s.loadWebhookTarget(ctx, d.RestaurantID)
+	if err != nil {
+		return err
+	}
+	if target.URL == "" {
+		msg := "n8n webhook URL not configured"
+		_, _ = s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET status = 'failed', error = ?, next_attempt_at = NULL
+			WHERE id = ?
+		`, msg, d.ID)
+		return errors.New(msg)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, webhookHTTPTimeout+2*time.Second)
+	defer cancel()
+	return s.attemptWebhookDelivery(sendCtx, d, target)
+}
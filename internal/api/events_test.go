@@ -0,0 +1,76 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignWebhookBody(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	got := signWebhookBody("secret", 1700000000, []byte(`{"a":1}`))
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got != want {
+		t.Fatalf("signWebhookBody = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		7:  32 * time.Minute,
+		20: webhookRetryMaxDelay,
+	}
+	for attempts, want := range cases {
+		if got := webhookRetryDelay(attempts); got != want {
+			t.Errorf("webhookRetryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestEventEnabledWildcards(t *testing.T) {
+	cases := []struct {
+		enabled []string
+		event   string
+		want    bool
+	}{
+		{nil, webhookEventBookingUpdated, true},
+		{[]string{"*"}, webhookEventInvoiceSent, true},
+		{[]string{"booking.*"}, webhookEventBookingTableAssigned, true},
+		{[]string{"booking.*"}, webhookEventDayClosed, false},
+		{[]string{webhookEventDayClosed}, webhookEventDayOpened, false},
+	}
+	for _, tc := range cases {
+		if got := eventEnabled(tc.enabled, tc.event); got != tc.want {
+			t.Errorf("eventEnabled(%v, %q) = %v, want %v", tc.enabled, tc.event, got, tc.want)
+		}
+	}
+}
+
+func TestValidWebhookSubscription(t *testing.T) {
+	for _, sub := range []string{"*", "booking.*", "fichaje.*", webhookEventMenuPublished} {
+		if !validWebhookSubscription(sub) {
+			t.Errorf("validWebhookSubscription(%q) = false, want true", sub)
+		}
+	}
+	for _, sub := range []string{"", "booking", "orders.*", "booking.deleted"} {
+		if validWebhookSubscription(sub) {
+			t.Errorf("validWebhookSubscription(%q) = true, want false", sub)
+		}
+	}
+}
+
+func TestChangedBookingFields(t *testing.T) {
+	before := webhookBookingSnapshot{"reservationTime": "14:00:00", "partySize": 4, "tableNumber": ""}
+	after := webhookBookingSnapshot{"reservationTime": "14:00:00", "partySize": 6, "tableNumber": "12"}
+
+	changed, previous := changedBookingFields(before, after)
+	if len(changed) != 2 || changed[0] != "partySize" || changed[1] != "tableNumber" {
+		t.Fatalf("changed = %v, want [partySize tableNumber]", changed)
+	}
+	if previous["partySize"] != 4 || previous["tableNumber"] != "" {
+		t.Fatalf("previous = %v", previous)
+	}
+}
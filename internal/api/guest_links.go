@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Guest page actions covered by signed links.
+const (
+	guestLinkConfirm = "confirm"
+	guestLinkCancel  = "cancel"
+	guestLinkRice    = "rice"
+	guestLinkPayment = "payment"
+)
+
+var (
+	errGuestLinkMissing = errors.New("guest link token missing")
+	errGuestLinkInvalid = errors.New("guest link token invalid")
+	errGuestLinkExpired = errors.New("guest link token expired")
+)
+
+var guestLinkPaths = map[string]string{
+	guestLinkConfirm: "/confirm_reservation.php",
+	guestLinkCancel:  "/cancel_reservation.php",
+	guestLinkRice:    "/book_rice.php",
+	guestLinkPayment: "/payment_result.php",
+}
+
+// guestLinkExpiry keeps links valid until the end of the day after the
+// reservation, so a guest can still open the confirmation they got that day.
+func guestLinkExpiry(reservationDate string) time.Time {
+	d, err := time.ParseInLocation("2006-01-02", reservationDate, boMadridTZ)
+	if err != nil {
+		return time.Now().Add(30 * 24 * time.Hour)
+	}
+	return d.AddDate(0, 0, 2)
+}
+
+func guestLinkSignature(secret string, restaurantID, bookingID int, action string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("guest-link:v1|" + strconv.Itoa(restaurantID) + "|" + strconv.Itoa(bookingID) + "|" + action + "|" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newGuestLinkToken returns "<exp>.<signature>". The booking ID travels in the
+// id query parameter and the restaurant comes from the request host, so both
+// are bound by the signature without being repeated in the token.
+func newGuestLinkToken(secret string, restaurantID, bookingID int, action string, expiresAt time.Time) string {
+	exp := expiresAt.Unix()
+	return strconv.FormatInt(exp, 10) + "." + guestLinkSignature(secret, restaurantID, bookingID, action, exp)
+}
+
+func verifyGuestLinkToken(secret string, restaurantID, bookingID int, action string, token string, now time.Time) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errGuestLinkMissing
+	}
+	expRaw, sig, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return errGuestLinkInvalid
+	}
+	exp, err := strconv.ParseInt(expRaw, 10, 64)
+	if err != nil {
+		return errGuestLinkInvalid
+	}
+	want := guestLinkSignature(secret, restaurantID, bookingID, action, exp)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return errGuestLinkInvalid
+	}
+	if now.Unix() > exp {
+		return errGuestLinkExpired
+	}
+	return nil
+}
+
+// guestLinkURL builds the public link for action. Without GUEST_LINK_SECRET it
+// falls back to the legacy ID-only URL; the server only starts that way when
+// GUEST_LINK_ALLOW_LEGACY_ID is enabled, so pages accept what is sent.
+func (s *Server) guestLinkURL(baseURL string, restaurantID, bookingID int, action string, reservationDate string) string {
+	qs := url.Values{}
+	qs.Set("id", strconv.Itoa(bookingID))
+	if secret := s.cfg.GuestLinkSecret; secret != "" {
+		qs.Set("t", newGuestLinkToken(secret, restaurantID, bookingID, action, guestLinkExpiry(reservationDate)))
+	}
+	return strings.TrimRight(baseURL, "/") + guestLinkPaths[action] + "?" + qs.Encode()
+}
+
+func (s *Server) guestLinksForBooking(baseURL string, restaurantID, bookingID int, reservationDate string) map[string]string {
+	return map[string]string{
+		"confirm":  s.guestLinkURL(baseURL, restaurantID, bookingID, guestLinkConfirm, reservationDate),
+		"cancel":   s.guestLinkURL(baseURL, restaurantID, bookingID, guestLinkCancel, reservationDate),
+		"bookRice": s.guestLinkURL(baseURL, restaurantID, bookingID, guestLinkRice, reservationDate),
+	}
+}
+
+// authorizeGuestLink checks the id/t query parameters of a guest page. It
+// returns the booking ID and the raw token (to carry into form actions), or a
+// message to show instead of the booking.
+func (s *Server) authorizeGuestLink(r *http.Request, restaurantID int, action string) (int, string, string) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(strings.TrimSpace(q.Get("id")))
+	token := strings.TrimSpace(q.Get("t"))
+	if id <= 0 {
+		return 0, token, "ID de reserva inválido. Por favor, inténtelo de nuevo."
+	}
+
+	err := verifyGuestLinkToken(s.cfg.GuestLinkSecret, restaurantID, id, action, token, time.Now())
+	switch {
+	case err == nil:
+		return id, token, ""
+	case errors.Is(err, errGuestLinkMissing) && s.cfg.GuestLinkAllowLegacyID:
+		return id, "", ""
+	case errors.Is(err, errGuestLinkExpired):
+		return 0, token, "Este enlace ha caducado. Por favor, contacte con el restaurante."
+	default:
+		return 0, token, "Enlace no válido. Por favor, utilice el enlace que recibió o contacte con el restaurante."
+	}
+}
+
+func guestLinkAction(path string, id int, token string, extra url.Values) string {
+	qs := url.Values{}
+	for k, v := range extra {
+		qs[k] = v
+	}
+	qs.Set("id", strconv.Itoa(id))
+	if token != "" {
+		qs.Set("t", token)
+	}
+	return path + "?" + qs.Encode()
+}
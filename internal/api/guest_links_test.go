@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGuestLinkToken(t *testing.T) {
+	const secret = "test-secret"
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, boMadridTZ)
+	token := newGuestLinkToken(secret, 1, 42, guestLinkCancel, now.Add(time.Hour))
+
+	if err := verifyGuestLinkToken(secret, 1, 42, guestLinkCancel, token, now); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		restaurantID int
+		bookingID    int
+		action       string
+		token        string
+		now          time.Time
+		want         error
+	}{
+		{"other booking", 1, 43, guestLinkCancel, token, now, errGuestLinkInvalid},
+		{"other restaurant", 2, 42, guestLinkCancel, token, now, errGuestLinkInvalid},
+		{"other action", 1, 42, guestLinkConfirm, token, now, errGuestLinkInvalid},
+		{"expired", 1, 42, guestLinkCancel, token, now.Add(2 * time.Hour), errGuestLinkExpired},
+		{"missing", 1, 42, guestLinkCancel, "", now, errGuestLinkMissing},
+		{"garbage", 1, 42, guestLinkCancel, "abc", now, errGuestLinkInvalid},
+	}
+	for _, tc := range cases {
+		if err := verifyGuestLinkToken(secret, tc.restaurantID, tc.bookingID, tc.action, tc.token, tc.now); err != tc.want {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestGuestLinkExpiry(t *testing.T) {
+	got := guestLinkExpiry("2026-10-16")
+	want := time.Date(2026, 10, 18, 0, 0, 0, 0, boMadridTZ)
+	if !got.Equal(want) {
+		t.Fatalf("guestLinkExpiry = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,718 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	guestStatsPoll    = time.Hour
+	guestRefreshWait  = 30 * time.Second
+	guestBackfillPage = 500
+	guestMaxTags      = 20
+	guestMaxTagLen    = 40
+)
+
+type guestProfile struct {
+	ID               int      `json:"id"`
+	Name             string   `json:"name"`
+	PhoneE164        string   `json:"phoneE164"`
+	PhoneCountryCode string   `json:"phoneCountryCode"`
+	PhoneNational    string   `json:"phoneNational"`
+	Email            string   `json:"email"`
+	Birthday         *string  `json:"birthday"`
+	BookingCount     int      `json:"bookingCount"`
+	VisitCount       int      `json:"visitCount"`
+	NoShowCount      int      `json:"noShowCount"`
+	CancelCount      int      `json:"cancelCount"`
+	ReliabilityScore int      `json:"reliabilityScore"`
+	FirstVisitDate   *string  `json:"firstVisitDate"`
+	LastVisitDate    *string  `json:"lastVisitDate"`
+	Tags             []string `json:"tags"`
+	Allergies        string   `json:"allergies"`
+	Notes            string   `json:"notes"`
+	CreatedAt        *string  `json:"createdAt"`
+	// When the guest last agreed to marketing on each channel; nil when
+	// they haven't or withdrew.
+	MarketingEmailAt    *string `json:"marketingEmailAt"`
+	MarketingWhatsAppAt *string `json:"marketingWhatsappAt"`
+
+	mergedIntoID int
+}
+
+// guestIdentity is what a booking says about who made it.
+type guestIdentity struct {
+	Name        string
+	CountryCode string
+	National    string
+	E164        string
+	Email       string
+}
+
+// newGuestIdentity normalises a booking's contact details. fallbackEmail is
+// the restaurant address the booking forms store when the guest leaves the
+// field empty; it identifies nobody.
+func newGuestIdentity(name, countryCode, phone, email, fallbackEmail string) guestIdentity {
+	id := guestIdentity{Name: strings.TrimSpace(name)}
+	if strings.TrimSpace(phone) != "" {
+		if cc, national, e164, ok := normalizePhoneParts(countryCode, phone); ok {
+			id.CountryCode, id.National, id.E164 = cc, national, e164
+		}
+	}
+	id.Email = normalizeGuestEmail(email)
+	if id.Email != "" && strings.EqualFold(id.Email, strings.TrimSpace(fallbackEmail)) {
+		id.Email = ""
+	}
+	return id
+}
+
+func normalizeGuestEmail(raw string) string {
+	e := strings.ToLower(strings.TrimSpace(raw))
+	if e == "" || len(e) > 255 {
+		return ""
+	}
+	addr, err := mail.ParseAddress(e)
+	if err != nil || addr.Address != e {
+		return ""
+	}
+	return e
+}
+
+func (g guestIdentity) empty() bool {
+	return g.E164 == "" && g.Email == ""
+}
+
+// normalizeGuestTags trims tags and drops empty and repeated ones (case
+// insensitive), keeping the first spelling.
+func normalizeGuestTags(in []string) ([]string, string) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range in {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if len(t) > guestMaxTagLen {
+			return nil, "Etiqueta demasiado larga: " + t
+		}
+		key := strings.ToLower(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	if len(out) > guestMaxTags {
+		return nil, "Demasiadas etiquetas"
+	}
+	return out, ""
+}
+
+// mergeGuestProfiles folds sources into target: tags are combined, allergies
+// and notes appended, and contact details the target lacks are taken from
+// the first source that has them. Marketing consent only survives on a
+// channel when every profile has it, so an opt-out on any of them wins.
+// Counters are left to refreshGuestStats.
+func mergeGuestProfiles(target guestProfile, sources []guestProfile) guestProfile {
+	tags := append([]string{}, target.Tags...)
+	allergies := []string{}
+	notes := []string{}
+	if v := strings.TrimSpace(target.Allergies); v != "" {
+		allergies = append(allergies, v)
+	}
+	if v := strings.TrimSpace(target.Notes); v != "" {
+		notes = append(notes, v)
+	}
+	for _, src := range sources {
+		tags = append(tags, src.Tags...)
+		if v := strings.TrimSpace(src.Allergies); v != "" && !containsFold(allergies, v) {
+			allergies = append(allergies, v)
+		}
+		if v := strings.TrimSpace(src.Notes); v != "" && !containsFold(notes, v) {
+			notes = append(notes, v)
+		}
+		if target.Name == "" {
+			target.Name = src.Name
+		}
+		if target.Email == "" {
+			target.Email = src.Email
+		}
+		if target.Birthday == nil {
+			target.Birthday = src.Birthday
+		}
+		if src.MarketingEmailAt == nil {
+			target.MarketingEmailAt = nil
+		}
+		if src.MarketingWhatsAppAt == nil {
+			target.MarketingWhatsAppAt = nil
+		}
+	}
+	target.Tags, _ = normalizeGuestTags(tags)
+	if len(target.Tags) > guestMaxTags {
+		target.Tags = target.Tags[:guestMaxTags]
+	}
+	target.Allergies = strings.Join(allergies, "; ")
+	target.Notes = strings.Join(notes, "\n")
+	return target
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+const guestSelectColumns = `
+	id,
+	name,
+	COALESCE(phone_e164, ''),
+	COALESCE(phone_country_code, ''),
+	COALESCE(phone_national, ''),
+	COALESCE(email, ''),
+	DATE_FORMAT(birthday, '%Y-%m-%d'),
+	booking_count,
+	visit_count,
+	no_show_count,
+	cancel_count,
+	DATE_FORMAT(first_visit_date, '%Y-%m-%d'),
+	DATE_FORMAT(last_visit_date, '%Y-%m-%d'),
+	COALESCE(tags, ''),
+	COALESCE(allergies, ''),
+	COALESCE(notes, ''),
+	created_at,
+	COALESCE(merged_into_id, 0),
+	marketing_email_at,
+	marketing_whatsapp_at`
+
+func scanGuestProfile(scanner waitlistScanner) (guestProfile, error) {
+	var (
+		g                    guestProfile
+		firstVisit, lastSeen sql.NullString
+		birthday             sql.NullString
+		tags                 string
+		createdAt            sql.NullTime
+		emailAt, whatsAppAt  sql.NullTime
+	)
+	err := scanner.Scan(&g.ID, &g.Name, &g.PhoneE164, &g.PhoneCountryCode, &g.PhoneNational, &g.Email, &birthday,
+		&g.BookingCount, &g.VisitCount, &g.NoShowCount, &g.CancelCount, &firstVisit, &lastSeen,
+		&tags, &g.Allergies, &g.Notes, &createdAt, &g.mergedIntoID, &emailAt, &whatsAppAt)
+	if err != nil {
+		return guestProfile{}, err
+	}
+	if birthday.Valid {
+		g.Birthday = &birthday.String
+	}
+	if firstVisit.Valid {
+		g.FirstVisitDate = &firstVisit.String
+	}
+	if lastSeen.Valid {
+		g.LastVisitDate = &lastSeen.String
+	}
+	g.Tags = []string{}
+	if tags != "" {
+		_ = json.Unmarshal([]byte(tags), &g.Tags)
+	}
+	g.CreatedAt = formatNullTimeRFC3339(createdAt)
+	g.MarketingEmailAt = formatNullTimeRFC3339(emailAt)
+	g.MarketingWhatsAppAt = formatNullTimeRFC3339(whatsAppAt)
+	g.ReliabilityScore = guestReliabilityScore(g.VisitCount, g.NoShowCount)
+	return g, nil
+}
+
+func (s *Server) loadGuest(ctx context.Context, restaurantID, id int) (guestProfile, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+guestSelectColumns+" FROM guests WHERE restaurant_id = ? AND id = ? LIMIT 1", restaurantID, id)
+	return scanGuestProfile(row)
+}
+
+// guestDB is satisfied by both *sql.DB and *sql.Tx, so bookings can be
+// linked inside their insert transaction or from the backfill.
+type guestDB interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// findGuest returns the guest for id: by phone, else by email (only guests
+// without a phone when the booking has one, so people sharing an address
+// stay apart). merged reports that the match was merged and the id returned
+// is the guest it was merged into. It returns sql.ErrNoRows when nobody
+// matches.
+func findGuest(ctx context.Context, q guestDB, restaurantID int, id guestIdentity) (guestID int, merged bool, err error) {
+	if id.empty() {
+		return 0, false, sql.ErrNoRows
+	}
+	var mergedInto sql.NullInt64
+	switch {
+	case id.E164 != "":
+		err = q.QueryRowContext(ctx, `
+			SELECT id, merged_into_id FROM guests WHERE restaurant_id = ? AND phone_e164 = ? LIMIT 1
+		`, restaurantID, id.E164).Scan(&guestID, &mergedInto)
+		if errors.Is(err, sql.ErrNoRows) && id.Email != "" {
+			err = q.QueryRowContext(ctx, `
+				SELECT id, merged_into_id FROM guests
+				WHERE restaurant_id = ? AND email = ? AND phone_e164 IS NULL
+				ORDER BY id ASC LIMIT 1
+			`, restaurantID, id.Email).Scan(&guestID, &mergedInto)
+		}
+	default:
+		err = q.QueryRowContext(ctx, `
+			SELECT id, merged_into_id FROM guests
+			WHERE restaurant_id = ? AND email = ?
+			ORDER BY merged_into_id IS NOT NULL, id ASC LIMIT 1
+		`, restaurantID, id.Email).Scan(&guestID, &mergedInto)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if mergedInto.Valid {
+		return int(mergedInto.Int64), true, nil
+	}
+	return guestID, false, nil
+}
+
+// findOrCreateGuest returns the guest for id (see findGuest), creating it
+// when nobody matches. It returns 0 when the booking has neither phone nor
+// email.
+func findOrCreateGuest(ctx context.Context, q guestDB, restaurantID int, id guestIdentity) (int, error) {
+	if id.empty() {
+		return 0, nil
+	}
+	guestID, merged, err := findGuest(ctx, q, restaurantID, id)
+	switch {
+	case err == nil:
+		if merged {
+			return guestID, nil
+		}
+		// Keep the latest name and fill in contact details the profile lacks.
+		_, err = q.ExecContext(ctx, `
+			UPDATE guests
+			SET name = IF(? = '', name, ?),
+				phone_e164 = COALESCE(phone_e164, ?),
+				phone_country_code = COALESCE(phone_country_code, ?),
+				phone_national = COALESCE(phone_national, ?),
+				email = COALESCE(email, ?)
+			WHERE id = ?
+		`, id.Name, id.Name, nullableString(id.E164), nullableString(id.CountryCode), nullableString(id.National),
+			nullableString(id.Email), guestID)
+		return guestID, err
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+
+	res, err := q.ExecContext(ctx, `
+		INSERT INTO guests (restaurant_id, name, phone_e164, phone_country_code, phone_national, email)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)
+	`, restaurantID, id.Name, nullableString(id.E164), nullableString(id.CountryCode), nullableString(id.National),
+		nullableString(id.Email))
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), err
+}
+
+// linkBookingGuest sets bookings.guest_id and refreshes the guest's counters.
+func linkBookingGuest(ctx context.Context, q guestDB, restaurantID, bookingID int, id guestIdentity) (int, error) {
+	guestID, err := findOrCreateGuest(ctx, q, restaurantID, id)
+	if err != nil || guestID == 0 {
+		return 0, err
+	}
+	if _, err := q.ExecContext(ctx, "UPDATE bookings SET guest_id = ? WHERE restaurant_id = ? AND id = ?", guestID, restaurantID, bookingID); err != nil {
+		return 0, err
+	}
+	return guestID, refreshGuestStats(ctx, q, restaurantID, guestID)
+}
+
+// linkNewBookingGuest links a booking being inserted. Guest profiles are a
+// convenience, so failures are logged and never fail the booking.
+func (s *Server) linkNewBookingGuest(ctx context.Context, q guestDB, restaurantID int, bookingID int64, name, countryCode, phone, email string) {
+	id := newGuestIdentity(name, countryCode, phone, email, s.restaurantFallbackEmail(ctx, restaurantID))
+	if _, err := linkBookingGuest(ctx, q, restaurantID, int(bookingID), id); err != nil && !isSQLSchemaError(err) {
+		log.Printf("[guests] link booking %d: %v", bookingID, err)
+	}
+}
+
+// carryBookingGuestTx copies a booking's guest onto its cancelled_bookings
+// row. Call it after the INSERT into cancelled_bookings and before the
+// DELETE; it returns the guest whose counters then need a refresh.
+func carryBookingGuestTx(ctx context.Context, tx *sql.Tx, restaurantID, bookingID int) int {
+	var guestID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, "SELECT guest_id FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, bookingID).Scan(&guestID); err != nil || !guestID.Valid {
+		return 0
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE cancelled_bookings SET guest_id = ? WHERE restaurant_id = ? AND booking_id = ? AND guest_id IS NULL
+	`, guestID.Int64, restaurantID, bookingID); err != nil {
+		log.Printf("[guests] carry guest of booking %d: %v", bookingID, err)
+		return 0
+	}
+	return int(guestID.Int64)
+}
+
+// A booking counts as a visit once its date has passed, or earlier if staff
+// already marked the guest arrived, unless it was marked a no-show. The
+// three placeholders all take today.
+const guestVisitCondition = "((b.attendance IS NULL OR b.attendance <> 'no_show') AND " +
+	"(b.reservation_date < ? OR b.seat_status IS NOT NULL OR b.attendance = 'arrived'))"
+
+// refreshGuestStatsWhere recomputes the counters of the guests matching
+// where (an SQL condition on guests g).
+func refreshGuestStatsWhere(ctx context.Context, q boSQLExecutor, where string, args ...any) error {
+	today := time.Now().In(boMadridTZ).Format("2006-01-02")
+	_, err := q.ExecContext(ctx, `
+		UPDATE guests g SET
+			booking_count = (SELECT COUNT(*) FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id),
+			visit_count = (SELECT COUNT(*) FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id AND `+guestVisitCondition+`),
+			first_visit_date = (SELECT MIN(b.reservation_date) FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id AND `+guestVisitCondition+`),
+			last_visit_date = (SELECT MAX(b.reservation_date) FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id AND `+guestVisitCondition+`),
+			no_show_count = (SELECT COUNT(*) FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id AND b.attendance = 'no_show'),
+			cancel_count = (SELECT COUNT(*) FROM cancelled_bookings c WHERE c.restaurant_id = g.restaurant_id AND c.guest_id = g.id)
+		WHERE g.merged_into_id IS NULL AND `+where,
+		append([]any{today, today, today}, args...)...)
+	return err
+}
+
+func refreshGuestStats(ctx context.Context, q boSQLExecutor, restaurantID int, guestIDs ...int) error {
+	ids := make([]any, 0, len(guestIDs))
+	for _, id := range guestIDs {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	return refreshGuestStatsWhere(ctx, q, "g.restaurant_id = ? AND g.id IN ("+placeholders+")", append([]any{restaurantID}, ids...)...)
+}
+
+func (s *Server) refreshGuestStatsAsync(restaurantID int, guestIDs ...int) {
+	if restaurantID <= 0 || len(guestIDs) == 0 {
+		return
+	}
+	s.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, guestRefreshWait)
+		defer cancel()
+		if err := refreshGuestStats(ctx, s.db, restaurantID, guestIDs...); err != nil && !isSQLSchemaError(err) {
+			log.Printf("[guests] refresh restaurant_id=%d guests=%v: %v", restaurantID, guestIDs, err)
+		}
+	})
+}
+
+// refreshBookingGuestAsync refreshes the guest a booking is linked to, if
+// any.
+func (s *Server) refreshBookingGuestAsync(restaurantID, bookingID int) {
+	s.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, guestRefreshWait)
+		defer cancel()
+		var guestID sql.NullInt64
+		err := s.db.QueryRowContext(ctx, "SELECT guest_id FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, bookingID).Scan(&guestID)
+		if err == nil && guestID.Valid {
+			err = refreshGuestStats(ctx, s.db, restaurantID, int(guestID.Int64))
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) && !isSQLSchemaError(err) {
+			log.Printf("[guests] refresh guest of booking %d: %v", bookingID, err)
+		}
+	})
+}
+
+// runGuestStatsLoop turns yesterday's bookings into visits once a day.
+func (s *Server) runGuestStatsLoop(ctx context.Context) {
+	t := time.NewTicker(guestStatsPoll)
+	defer t.Stop()
+	lastDay := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			now := time.Now().In(boMadridTZ)
+			today := now.Format("2006-01-02")
+			if today == lastDay {
+				continue
+			}
+			yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+			err := refreshGuestStatsWhere(ctx, s.db, "g.id IN (SELECT guest_id FROM bookings WHERE reservation_date = ? AND guest_id IS NOT NULL)", yesterday)
+			if err != nil {
+				if !isSQLSchemaError(err) {
+					log.Printf("[guests] refresh visits of %s: %v", yesterday, err)
+				}
+				continue
+			}
+			lastDay = today
+		}
+	}
+}
+
+// mergeGuests folds sourceIDs into targetID: their bookings move to the
+// target and they keep resolving to it through merged_into_id.
+func (s *Server) mergeGuests(ctx context.Context, restaurantID, targetID int, sourceIDs []int) error {
+	return withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var targetMerged sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT merged_into_id FROM guests WHERE restaurant_id = ? AND id = ? FOR UPDATE
+		`, restaurantID, targetID).Scan(&targetMerged); err != nil {
+			return err
+		}
+		if targetMerged.Valid {
+			return &guestMergeError{Message: "El cliente destino ya fue fusionado"}
+		}
+
+		target, err := scanGuestProfile(tx.QueryRowContext(ctx, "SELECT "+guestSelectColumns+" FROM guests WHERE id = ?", targetID))
+		if err != nil {
+			return err
+		}
+		var sources []guestProfile
+		for _, id := range sourceIDs {
+			if id == targetID {
+				continue
+			}
+			src, err := scanGuestProfile(tx.QueryRowContext(ctx, "SELECT "+guestSelectColumns+" FROM guests WHERE restaurant_id = ? AND id = ? FOR UPDATE", restaurantID, id))
+			if errors.Is(err, sql.ErrNoRows) {
+				return &guestMergeError{Message: "Cliente no encontrado"}
+			}
+			if err != nil {
+				return err
+			}
+			if src.mergedIntoID > 0 {
+				return &guestMergeError{Message: "El cliente " + src.Name + " ya fue fusionado"}
+			}
+			sources = append(sources, src)
+		}
+		if len(sources) == 0 {
+			return &guestMergeError{Message: "No hay clientes que fusionar"}
+		}
+
+		for _, src := range sources {
+			for _, stmt := range []string{
+				"UPDATE bookings SET guest_id = ? WHERE restaurant_id = ? AND guest_id = ?",
+				"UPDATE cancelled_bookings SET guest_id = ? WHERE restaurant_id = ? AND guest_id = ?",
+				"UPDATE marketing_consents SET guest_id = ? WHERE restaurant_id = ? AND guest_id = ?",
+				"UPDATE guests SET merged_into_id = ? WHERE restaurant_id = ? AND merged_into_id = ?",
+			} {
+				if _, err := tx.ExecContext(ctx, stmt, targetID, restaurantID, src.ID); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE guests SET merged_into_id = ? WHERE id = ?", targetID, src.ID); err != nil {
+				return err
+			}
+		}
+
+		merged := mergeGuestProfiles(target, sources)
+		tags, _ := json.Marshal(merged.Tags)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE guests
+			SET name = ?, email = ?, birthday = ?, tags = ?, allergies = ?, notes = ?,
+				marketing_email_at = IF(?, marketing_email_at, NULL),
+				marketing_whatsapp_at = IF(?, marketing_whatsapp_at, NULL)
+			WHERE id = ?
+		`, merged.Name, nullableString(merged.Email), merged.Birthday, string(tags), nullableString(merged.Allergies),
+			nullableString(merged.Notes), merged.MarketingEmailAt != nil, merged.MarketingWhatsAppAt != nil, targetID); err != nil {
+			return err
+		}
+		return refreshGuestStats(ctx, tx, restaurantID, targetID)
+	})
+}
+
+type guestMergeError struct{ Message string }
+
+func (e *guestMergeError) Error() string { return e.Message }
+
+// GuestBackfillResult summarises a BackfillGuests run.
+type GuestBackfillResult struct {
+	Bookings          int
+	CancelledBookings int
+	Skipped           int
+	Guests            int
+}
+
+// BackfillGuests links existing bookings and cancelled bookings without a
+// guest, oldest first so the latest name wins. restaurantID 0 does every
+// restaurant. It is safe to run again.
+func (s *Server) BackfillGuests(ctx context.Context, restaurantID int) (GuestBackfillResult, error) {
+	var out GuestBackfillResult
+	restaurants := []int{restaurantID}
+	if restaurantID <= 0 {
+		var err error
+		restaurants, err = s.guestBackfillRestaurants(ctx)
+		if err != nil {
+			return out, err
+		}
+	}
+	for _, rid := range restaurants {
+		if err := s.backfillRestaurantGuests(ctx, rid, &out); err != nil {
+			return out, err
+		}
+		if err := refreshGuestStatsWhere(ctx, s.db, "g.restaurant_id = ?", rid); err != nil {
+			return out, err
+		}
+		var n int
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM guests WHERE restaurant_id = ? AND merged_into_id IS NULL", rid).Scan(&n); err != nil {
+			return out, err
+		}
+		out.Guests += n
+	}
+	return out, nil
+}
+
+func (s *Server) guestBackfillRestaurants(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT restaurant_id FROM bookings WHERE guest_id IS NULL
+		UNION
+		SELECT restaurant_id FROM cancelled_bookings WHERE guest_id IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+type guestBackfillRow struct {
+	id    int
+	name  string
+	cc    string
+	phone string
+	email string
+}
+
+func (s *Server) backfillRestaurantGuests(ctx context.Context, restaurantID int, out *GuestBackfillResult) error {
+	fallback := s.restaurantFallbackEmail(ctx, restaurantID)
+
+	for lastID := 0; ; {
+		batch, err := s.loadGuestBackfillRows(ctx, `
+			SELECT id, customer_name, COALESCE(contact_phone_country_code, ''), COALESCE(contact_phone, ''), COALESCE(contact_email, '')
+			FROM bookings
+			WHERE restaurant_id = ? AND guest_id IS NULL AND id > ?
+			ORDER BY id ASC LIMIT ?
+		`, restaurantID, lastID, guestBackfillPage)
+		if err != nil {
+			return err
+		}
+		for _, b := range batch {
+			lastID = b.id
+			guestID, err := findOrCreateGuest(ctx, s.db, restaurantID, newGuestIdentity(b.name, b.cc, b.phone, b.email, fallback))
+			if err != nil {
+				return err
+			}
+			if guestID == 0 {
+				out.Skipped++
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, "UPDATE bookings SET guest_id = ? WHERE id = ?", guestID, b.id); err != nil {
+				return err
+			}
+			out.Bookings++
+		}
+		if len(batch) < guestBackfillPage {
+			break
+		}
+	}
+
+	// cancelled_bookings has no country code: try the national number of a
+	// known guest before assuming the default prefix.
+	for lastID := 0; ; {
+		batch, err := s.loadGuestBackfillRows(ctx, `
+			SELECT id, customer_name, '', COALESCE(contact_phone, ''), COALESCE(contact_email, '')
+			FROM cancelled_bookings
+			WHERE restaurant_id = ? AND guest_id IS NULL AND id > ?
+			ORDER BY id ASC LIMIT ?
+		`, restaurantID, lastID, guestBackfillPage)
+		if err != nil {
+			return err
+		}
+		for _, b := range batch {
+			lastID = b.id
+			guestID := 0
+			if digits := onlyDigits(b.phone); digits != "" {
+				err := s.db.QueryRowContext(ctx, `
+					SELECT COALESCE(merged_into_id, id) FROM guests
+					WHERE restaurant_id = ? AND phone_national = ?
+					ORDER BY id ASC LIMIT 1
+				`, restaurantID, digits).Scan(&guestID)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return err
+				}
+			}
+			if guestID == 0 {
+				guestID, err = findOrCreateGuest(ctx, s.db, restaurantID, newGuestIdentity(b.name, "", b.phone, b.email, fallback))
+				if err != nil {
+					return err
+				}
+			}
+			if guestID == 0 {
+				out.Skipped++
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, "UPDATE cancelled_bookings SET guest_id = ? WHERE id = ?", guestID, b.id); err != nil {
+				return err
+			}
+			out.CancelledBookings++
+		}
+		if len(batch) < guestBackfillPage {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Server) loadGuestBackfillRows(ctx context.Context, query string, args ...any) ([]guestBackfillRow, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []guestBackfillRow
+	for rows.Next() {
+		var b guestBackfillRow
+		if err := rows.Scan(&b.id, &b.name, &b.cc, &b.phone, &b.email); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// relinkBookingGuest links an edited booking again, since a new phone or
+// email may belong to someone else, and refreshes the guest it left.
+func (s *Server) relinkBookingGuest(ctx context.Context, restaurantID, bookingID int, name, countryCode, phone, email string) {
+	var previous sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, "SELECT guest_id FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, bookingID).Scan(&previous); err != nil {
+		if !isSQLSchemaError(err) {
+			log.Printf("[guests] relink booking %d: %v", bookingID, err)
+		}
+		return
+	}
+	id := newGuestIdentity(name, countryCode, phone, email, s.restaurantFallbackEmail(ctx, restaurantID))
+	guestID, err := linkBookingGuest(ctx, s.db, restaurantID, bookingID, id)
+	if err != nil {
+		log.Printf("[guests] relink booking %d: %v", bookingID, err)
+		return
+	}
+	if guestID == 0 && previous.Valid {
+		if _, err := s.db.ExecContext(ctx, "UPDATE bookings SET guest_id = NULL WHERE restaurant_id = ? AND id = ?", restaurantID, bookingID); err != nil {
+			log.Printf("[guests] unlink booking %d: %v", bookingID, err)
+		}
+	}
+	if previous.Valid && int(previous.Int64) != guestID {
+		s.refreshGuestStatsAsync(restaurantID, int(previous.Int64))
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewGuestIdentity(t *testing.T) {
+	id := newGuestIdentity(" Ana ", "34", "600 111 222", " Ana@Example.com ", "reservas@villacarmen.es")
+	if id.Name != "Ana" || id.National != "600111222" || id.E164 != "34600111222" || id.Email != "ana@example.com" {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	// The restaurant's own address stands in for a missing email.
+	id = newGuestIdentity("Ana", "34", "", "Reservas@VillaCarmen.es", "reservas@villacarmen.es")
+	if id.Email != "" || !id.empty() {
+		t.Fatalf("fallback email kept: %+v", id)
+	}
+
+	id = newGuestIdentity("Ana", "34", "600111222", "not an email", "")
+	if id.Email != "" || id.E164 == "" {
+		t.Fatalf("identity = %+v", id)
+	}
+}
+
+func TestNormalizeGuestTags(t *testing.T) {
+	got, msg := normalizeGuestTags([]string{" VIP ", "vip", "", "Celiaco"})
+	if msg != "" {
+		t.Fatalf("normalizeGuestTags() message = %q", msg)
+	}
+	if want := []string{"VIP", "Celiaco"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tags = %v, want %v", got, want)
+	}
+
+	long := make([]string, guestMaxTags+1)
+	for i := range long {
+		long[i] = string(rune('a' + i))
+	}
+	if _, msg := normalizeGuestTags(long); msg == "" {
+		t.Fatalf("too many tags accepted")
+	}
+}
+
+func TestMergeGuestProfiles(t *testing.T) {
+	target := guestProfile{Name: "Ana", Tags: []string{"VIP"}, Allergies: "Gluten"}
+	sources := []guestProfile{
+		{Name: "Ana G.", Email: "ana@example.com", Tags: []string{"vip", "Terraza"}, Allergies: "gluten", Notes: "Mesa junto a la ventana"},
+		{Allergies: "Marisco", Notes: "Cumple en mayo"},
+	}
+	got := mergeGuestProfiles(target, sources)
+	if got.Name != "Ana" || got.Email != "ana@example.com" {
+		t.Fatalf("contact = %q %q", got.Name, got.Email)
+	}
+	if want := []string{"VIP", "Terraza"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Fatalf("tags = %v, want %v", got.Tags, want)
+	}
+	if got.Allergies != "Gluten; Marisco" {
+		t.Fatalf("allergies = %q", got.Allergies)
+	}
+	if got.Notes != "Mesa junto a la ventana\nCumple en mayo" {
+		t.Fatalf("notes = %q", got.Notes)
+	}
+}
+
+func TestMergeGuestProfilesConsentOptOutWins(t *testing.T) {
+	at := "2026-03-01T10:00:00Z"
+	target := guestProfile{MarketingEmailAt: &at, MarketingWhatsAppAt: &at}
+	got := mergeGuestProfiles(target, []guestProfile{
+		{MarketingEmailAt: &at, MarketingWhatsAppAt: &at},
+		{MarketingEmailAt: &at},
+	})
+	if got.MarketingEmailAt == nil || *got.MarketingEmailAt != at {
+		t.Fatalf("email consent = %v, want kept", got.MarketingEmailAt)
+	}
+	if got.MarketingWhatsAppAt != nil {
+		t.Fatalf("whatsapp consent = %v, want dropped", *got.MarketingWhatsAppAt)
+	}
+
+	got = mergeGuestProfiles(guestProfile{}, []guestProfile{{MarketingEmailAt: &at}})
+	if got.MarketingEmailAt != nil {
+		t.Fatalf("source consent carried to a target that never consented")
+	}
+}
@@ -58,6 +58,24 @@ func (s *Server) handleGetHourData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	services, err := s.loadServiceDay(r.Context(), s.db, restaurantID, date, 0)
+	if err != nil {
+		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]any{
+			"success": false,
+			"message": "Error al obtener la configuración de horas",
+			"debug":   err.Error(),
+		})
+		return
+	}
+	if len(services) > 0 {
+		dailyLimit = 0
+		for _, svc := range services {
+			if !svc.Closed {
+				dailyLimit += svc.Limit
+			}
+		}
+	}
+
 	var hourDataRaw sql.NullString
 	err = s.db.QueryRowContext(r.Context(), "SELECT hourData FROM hour_configuration WHERE restaurant_id = ? AND date = ? LIMIT 1", restaurantID, date).Scan(&hourDataRaw)
 	if err != nil && err != sql.ErrNoRows {
@@ -108,6 +126,10 @@ func (s *Server) handleGetHourData(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if len(services) > 0 {
+			applyServiceCapacity(hourData, services)
+		}
+
 		sort.Strings(activeHours)
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{
 			"success":       true,
@@ -116,6 +138,7 @@ func (s *Server) handleGetHourData(w http.ResponseWriter, r *http.Request) {
 			"isDefaultData": true,
 			"dailyLimit":    dailyLimit,
 			"totalPeople":   totalPeople,
+			"services":      services,
 			"date":          date,
 		})
 		return
@@ -157,6 +180,9 @@ func (s *Server) handleGetHourData(w http.ResponseWriter, r *http.Request) {
 
 		hourData[hour] = data
 	}
+	if len(services) > 0 {
+		applyServiceCapacity(hourData, services)
+	}
 
 	activeHours := make([]string, 0, len(hourData))
 	for h := range hourData {
@@ -171,6 +197,7 @@ func (s *Server) handleGetHourData(w http.ResponseWriter, r *http.Request) {
 		"isDefaultData": false,
 		"dailyLimit":    dailyLimit,
 		"totalPeople":   totalPeople,
+		"services":      services,
 		"date":          date,
 	})
 }
@@ -0,0 +1,590 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+const (
+	invoiceTypeOrdinary   = "ordinaria"
+	invoiceTypeRectifying = "rectificativa"
+
+	invoiceSeriesOrdinary   = "F"
+	invoiceSeriesRectifying = "R"
+
+	// Restaurant services are taxed at the reduced VAT rate.
+	defaultInvoiceTaxRate = 10.0
+)
+
+var (
+	errInvoiceNotFound    = errors.New("invoice not found")
+	errInvoiceIssued      = errors.New("Issued invoices can't be modified or deleted; create a rectifying invoice instead")
+	errInvoiceNotIssued   = errors.New("Only issued invoices can be rectified")
+	errInvoiceNoLines     = errors.New("Invoice has no lines")
+	errInvoiceDateOrder   = errors.New("Invoice date is earlier than the last issued invoice of the series")
+	errInvoiceLineInvalid = errors.New("Invalid invoice line")
+	errInvoiceRectified   = errors.New("Invoice has already been rectified; rectify what is left with explicit lines")
+	errInvoiceRectifyOver = errors.New("Rectifications can't exceed the amount of the original invoice")
+)
+
+type InvoiceLine struct {
+	ID          int     `json:"id,omitempty"`
+	Position    int     `json:"position"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	TaxRate     float64 `json:"tax_rate"`
+	TaxBase     float64 `json:"tax_base"`
+	TaxAmount   float64 `json:"tax_amount"`
+	LineTotal   float64 `json:"line_total"`
+}
+
+// InvoiceLineInput prices are tax-exclusive; tax_rate defaults to 10%.
+type InvoiceLineInput struct {
+	Description string   `json:"description"`
+	Quantity    float64  `json:"quantity"`
+	UnitPrice   float64  `json:"unit_price"`
+	TaxRate     *float64 `json:"tax_rate"`
+}
+
+type InvoiceTaxBreakdown struct {
+	TaxRate   float64 `json:"tax_rate"`
+	TaxBase   float64 `json:"tax_base"`
+	TaxAmount float64 `json:"tax_amount"`
+}
+
+type invoiceTotals struct {
+	TaxBase   float64
+	TaxAmount float64
+	Total     float64
+	Breakdown []InvoiceTaxBreakdown
+}
+
+func newInvoiceLine(position int, description string, quantity, unitPrice, taxRate float64) InvoiceLine {
+	base := round2(quantity * unitPrice)
+	tax := round2(base * taxRate / 100)
+	return InvoiceLine{
+		Position:    position,
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+		TaxRate:     taxRate,
+		TaxBase:     base,
+		TaxAmount:   tax,
+		LineTotal:   round2(base + tax),
+	}
+}
+
+// buildInvoiceLines validates input lines and computes their amounts. Prices
+// and quantities may be negative (discounts, rectifications).
+func buildInvoiceLines(inputs []InvoiceLineInput) ([]InvoiceLine, error) {
+	lines := make([]InvoiceLine, 0, len(inputs))
+	for i, in := range inputs {
+		desc := strings.TrimSpace(in.Description)
+		if desc == "" || len([]rune(desc)) > 255 {
+			return nil, fmt.Errorf("%w %d: description is required (max 255 chars)", errInvoiceLineInvalid, i+1)
+		}
+		qty := in.Quantity
+		if qty == 0 {
+			qty = 1
+		}
+		if math.IsNaN(qty) || math.IsInf(qty, 0) || math.IsNaN(in.UnitPrice) || math.IsInf(in.UnitPrice, 0) {
+			return nil, fmt.Errorf("%w %d: invalid number", errInvoiceLineInvalid, i+1)
+		}
+		rate := defaultInvoiceTaxRate
+		if in.TaxRate != nil {
+			rate = *in.TaxRate
+		}
+		if rate < 0 || rate > 100 {
+			return nil, fmt.Errorf("%w %d: tax_rate must be between 0 and 100", errInvoiceLineInvalid, i+1)
+		}
+		lines = append(lines, newInvoiceLine(i, desc, math.Round(qty*1000)/1000, round2(in.UnitPrice), rate))
+	}
+	return lines, nil
+}
+
+// legacyInvoiceLine turns a tax-included amount (clients that only send
+// "amount") into a single line at the default rate, keeping the total exact.
+func legacyInvoiceLine(description string, amount float64) InvoiceLine {
+	total := round2(amount)
+	base := round2(total / (1 + defaultInvoiceTaxRate/100))
+	return InvoiceLine{
+		Description: description,
+		Quantity:    1,
+		UnitPrice:   base,
+		TaxRate:     defaultInvoiceTaxRate,
+		TaxBase:     base,
+		TaxAmount:   round2(total - base),
+		LineTotal:   total,
+	}
+}
+
+func computeInvoiceTotals(lines []InvoiceLine) invoiceTotals {
+	var out invoiceTotals
+	byRate := map[float64]*InvoiceTaxBreakdown{}
+	for _, l := range lines {
+		out.TaxBase += l.TaxBase
+		out.TaxAmount += l.TaxAmount
+		b, ok := byRate[l.TaxRate]
+		if !ok {
+			b = &InvoiceTaxBreakdown{TaxRate: l.TaxRate}
+			byRate[l.TaxRate] = b
+		}
+		b.TaxBase += l.TaxBase
+		b.TaxAmount += l.TaxAmount
+	}
+	out.TaxBase = round2(out.TaxBase)
+	out.TaxAmount = round2(out.TaxAmount)
+	out.Total = round2(out.TaxBase + out.TaxAmount)
+	out.Breakdown = make([]InvoiceTaxBreakdown, 0, len(byRate))
+	for _, b := range byRate {
+		out.Breakdown = append(out.Breakdown, InvoiceTaxBreakdown{TaxRate: b.TaxRate, TaxBase: round2(b.TaxBase), TaxAmount: round2(b.TaxAmount)})
+	}
+	sort.Slice(out.Breakdown, func(i, j int) bool { return out.Breakdown[i].TaxRate < out.Breakdown[j].TaxRate })
+	return out
+}
+
+// invoiceLinesFromInput resolves the lines of a create/update request.
+func invoiceLinesFromInput(input InvoiceInput) ([]InvoiceLine, error) {
+	if len(input.Lines) > 0 {
+		return buildInvoiceLines(input.Lines)
+	}
+	if input.Amount != 0 {
+		desc := "Servicios de restauración"
+		if input.IsReservation {
+			desc = "Reserva"
+		}
+		return []InvoiceLine{legacyInvoiceLine(desc, input.Amount)}, nil
+	}
+	return nil, errInvoiceNoLines
+}
+
+func formatInvoiceNumber(series string, year, sequence int) string {
+	return fmt.Sprintf("%s%d-%05d", series, year, sequence)
+}
+
+func invoiceSeriesForType(invoiceType string) string {
+	if invoiceType == invoiceTypeRectifying {
+		return invoiceSeriesRectifying
+	}
+	return invoiceSeriesOrdinary
+}
+
+func replaceInvoiceLinesTx(ctx context.Context, tx *sql.Tx, restaurantID, invoiceID int, lines []InvoiceLine) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM invoice_lines WHERE invoice_id = ?", invoiceID); err != nil {
+		return err
+	}
+	for i, l := range lines {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO invoice_lines (invoice_id, restaurant_id, position, description, quantity, unit_price, tax_rate, tax_base, tax_amount, line_total)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, invoiceID, restaurantID, i, l.Description, l.Quantity, l.UnitPrice, l.TaxRate, l.TaxBase, l.TaxAmount, l.LineTotal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const invoiceLinesQuery = `
+	SELECT id, position, description, quantity, unit_price, tax_rate, tax_base, tax_amount, line_total
+	FROM invoice_lines
+	WHERE invoice_id = ?
+	ORDER BY position ASC, id ASC
+`
+
+// invoiceLineRows is the part of *sql.Rows scanInvoiceLines reads.
+type invoiceLineRows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
+// scanInvoiceLines reads rows of invoiceLinesQuery, stored amounts
+// included: rectifications negate them rather than repricing the lines.
+func scanInvoiceLines(rows invoiceLineRows) ([]InvoiceLine, error) {
+	lines := []InvoiceLine{}
+	for rows.Next() {
+		var l InvoiceLine
+		if err := rows.Scan(&l.ID, &l.Position, &l.Description, &l.Quantity, &l.UnitPrice, &l.TaxRate, &l.TaxBase, &l.TaxAmount, &l.LineTotal); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+func (s *Server) loadInvoiceLines(ctx context.Context, invoiceID int) ([]InvoiceLine, error) {
+	rows, err := s.db.QueryContext(ctx, invoiceLinesQuery, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanInvoiceLines(rows)
+}
+
+// lockDraftInvoiceTx locks the invoice row and fails with errInvoiceIssued
+// once it has a number.
+func lockDraftInvoiceTx(ctx context.Context, tx *sql.Tx, restaurantID, invoiceID int) error {
+	var issuedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+		SELECT issued_at FROM invoices WHERE id = ? AND restaurant_id = ? FOR UPDATE
+	`, invoiceID, restaurantID).Scan(&issuedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errInvoiceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if issuedAt.Valid {
+		return errInvoiceIssued
+	}
+	return nil
+}
+
+// issueInvoiceTx gives the invoice the next number of its series for the
+// invoice year. The counter row is locked for the rest of the transaction, so
+// numbers are gapless and follow invoice_date order within a series. Issuing
+// an already issued invoice is a no-op.
+func issueInvoiceTx(ctx context.Context, tx *sql.Tx, restaurantID, invoiceID int) (string, error) {
+	var (
+		invoiceType string
+		invoiceDate string
+		number      sql.NullString
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT invoice_type, DATE_FORMAT(invoice_date, '%Y-%m-%d'), invoice_number
+		FROM invoices
+		WHERE id = ? AND restaurant_id = ?
+		FOR UPDATE
+	`, invoiceID, restaurantID).Scan(&invoiceType, &invoiceDate, &number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errInvoiceNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if number.Valid && number.String != "" {
+		return number.String, nil
+	}
+
+	var lineCount int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM invoice_lines WHERE invoice_id = ?", invoiceID).Scan(&lineCount); err != nil {
+		return "", err
+	}
+	if lineCount == 0 {
+		return "", errInvoiceNoLines
+	}
+
+	date, err := time.Parse("2006-01-02", invoiceDate)
+	if err != nil {
+		return "", err
+	}
+	series := invoiceSeriesForType(invoiceType)
+	year := date.Year()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT IGNORE INTO invoice_series_counters (restaurant_id, series, year, last_sequence)
+		VALUES (?, ?, ?, 0)
+	`, restaurantID, series, year); err != nil {
+		return "", err
+	}
+	var last int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT last_sequence FROM invoice_series_counters
+		WHERE restaurant_id = ? AND series = ? AND year = ?
+		FOR UPDATE
+	`, restaurantID, series, year).Scan(&last); err != nil {
+		return "", err
+	}
+
+	var lastDate sql.NullString
+	if err := tx.QueryRowContext(ctx, `
+		SELECT DATE_FORMAT(MAX(invoice_date), '%Y-%m-%d') FROM invoices
+		WHERE restaurant_id = ? AND invoice_series = ? AND invoice_year = ? AND issued_at IS NOT NULL
+	`, restaurantID, series, year).Scan(&lastDate); err != nil {
+		return "", err
+	}
+	if lastDate.Valid && lastDate.String > invoiceDate {
+		return "", errInvoiceDateOrder
+	}
+
+	seq := last + 1
+	num := formatInvoiceNumber(series, year, seq)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE invoice_series_counters SET last_sequence = ?
+		WHERE restaurant_id = ? AND series = ? AND year = ?
+	`, seq, restaurantID, series, year); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE invoices
+		SET invoice_series = ?, invoice_year = ?, invoice_sequence = ?, invoice_number = ?, issued_at = NOW()
+		WHERE id = ? AND restaurant_id = ?
+	`, series, year, seq, num, invoiceID, restaurantID); err != nil {
+		return "", err
+	}
+	if err := appendFiscalRecordTx(ctx, tx, restaurantID, invoiceID, time.Now()); err != nil {
+		return "", err
+	}
+	return num, nil
+}
+
+// negateInvoiceLines copies lines with every amount negated, for a full
+// cancellation. The stored amounts are negated rather than recomputed, so
+// the rectification matches the original to the cent.
+func negateInvoiceLines(lines []InvoiceLine) []InvoiceLine {
+	out := make([]InvoiceLine, len(lines))
+	for i, l := range lines {
+		out[i] = InvoiceLine{
+			Position:    i,
+			Description: l.Description,
+			Quantity:    -l.Quantity,
+			UnitPrice:   l.UnitPrice,
+			TaxRate:     l.TaxRate,
+			TaxBase:     -l.TaxBase,
+			TaxAmount:   -l.TaxAmount,
+			LineTotal:   -l.LineTotal,
+		}
+	}
+	return out
+}
+
+// checkInvoiceRectification validates a new rectification of total against
+// an original invoice of originalTotal already rectified count times by
+// rectifiedTotal in all. A full cancellation must be the only one, and
+// negative rectifications together can't take more than the original.
+func checkInvoiceRectification(originalTotal float64, count int, rectifiedTotal float64, full bool, total float64) error {
+	if full && count > 0 {
+		return errInvoiceRectified
+	}
+	if total < 0 && originalTotal > 0 && round2(originalTotal+rectifiedTotal+total) < 0 {
+		return errInvoiceRectifyOver
+	}
+	return nil
+}
+
+func writeInvoiceFiscalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvoiceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "Invoice not found")
+	case errors.Is(err, errInvoiceIssued), errors.Is(err, errInvoiceDateOrder),
+		errors.Is(err, errInvoiceRectified), errors.Is(err, errInvoiceRectifyOver):
+		httpx.WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, errInvoiceNotIssued), errors.Is(err, errInvoiceNoLines), errors.Is(err, errInvoiceLineInvalid):
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errInvoiceIssuerMissing):
+		httpx.WriteError(w, http.StatusConflict, "Completa los datos fiscales del emisor (NIF y razon social) antes de emitir facturas")
+	default:
+		httpx.WriteError(w, http.StatusInternalServerError, "Error updating invoice: "+err.Error())
+	}
+}
+
+// Handle issue invoice (assign its definitive number)
+func (s *Server) handleBOInvoiceIssue(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invoiceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	before := s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, invoiceID)
+	var number string
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		number, err = issueInvoiceTx(ctx, tx, a.ActiveRestaurantID, invoiceID)
+		return err
+	})
+	if err != nil {
+		writeInvoiceFiscalError(w, err)
+		return
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: "issue", Entity: "invoice", EntityID: invoiceID, Before: before,
+		After: s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, invoiceID)})
+	s.submitFiscalRecordAsync(a.ActiveRestaurantID, invoiceID)
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":        true,
+		"invoice_number": number,
+	})
+}
+
+type invoiceRectifyInput struct {
+	Reason string             `json:"reason"`
+	Lines  []InvoiceLineInput `json:"lines"`
+}
+
+// Handle rectify invoice. Issued invoices can't be edited or deleted; the
+// correction is a new invoice in the rectifying series that references the
+// original. Without lines it cancels the original in full.
+func (s *Server) handleBOInvoiceRectify(w http.ResponseWriter, r *http.Request) {
+	a, ok := boAuthFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	originalID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	var input invoiceRectifyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" || len([]rune(input.Reason)) > 255 {
+		httpx.WriteError(w, http.StatusBadRequest, "reason is required (max 255 chars)")
+		return
+	}
+
+	var lines []InvoiceLine
+	if len(input.Lines) > 0 {
+		lines, err = buildInvoiceLines(input.Lines)
+		if err != nil {
+			writeInvoiceFiscalError(w, err)
+			return
+		}
+	}
+
+	today := time.Now().In(boMadridTZ).Format("2006-01-02")
+	var (
+		newID  int64
+		number string
+	)
+	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
+		// The original's row lock also serialises its rectifications.
+		var (
+			issuedAt sql.NullTime
+			original invoiceTotals
+		)
+		err := tx.QueryRowContext(ctx, `
+			SELECT issued_at, amount, tax_base, tax_amount FROM invoices WHERE id = ? AND restaurant_id = ? FOR UPDATE
+		`, originalID, a.ActiveRestaurantID).Scan(&issuedAt, &original.Total, &original.TaxBase, &original.TaxAmount)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvoiceNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !issuedAt.Valid {
+			return errInvoiceNotIssued
+		}
+
+		full := lines == nil
+		var totals invoiceTotals
+		if full {
+			stored, err := loadInvoiceLinesTx(ctx, tx, originalID)
+			if err != nil {
+				return err
+			}
+			lines = negateInvoiceLines(stored)
+			totals = computeInvoiceTotals(lines)
+			if original.TaxBase != 0 || original.TaxAmount != 0 {
+				totals.TaxBase, totals.TaxAmount, totals.Total = -original.TaxBase, -original.TaxAmount, -original.Total
+			}
+		} else {
+			totals = computeInvoiceTotals(lines)
+		}
+
+		var (
+			count     int
+			rectified float64
+		)
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM invoices
+			WHERE restaurant_id = ? AND rectifies_invoice_id = ? AND issued_at IS NOT NULL
+		`, a.ActiveRestaurantID, originalID).Scan(&count, &rectified); err != nil {
+			return err
+		}
+		if err := checkInvoiceRectification(original.Total, count, rectified, full, totals.Total); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO invoices (
+				restaurant_id, customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
+				customer_address_street, customer_address_number, customer_address_postal_code,
+				customer_address_city, customer_address_province, customer_address_country,
+				amount, tax_base, tax_amount, payment_method, invoice_date,
+				status, invoice_type, rectifies_invoice_id, rectification_reason,
+				is_reservation, reservation_id, reservation_date, reservation_customer_name, reservation_party_size
+			)
+			SELECT
+				restaurant_id, customer_name, customer_surname, customer_email, customer_dni_cif, customer_phone,
+				customer_address_street, customer_address_number, customer_address_postal_code,
+				customer_address_city, customer_address_province, customer_address_country,
+				?, ?, ?, payment_method, ?,
+				'pendiente', ?, id, ?,
+				is_reservation, reservation_id, reservation_date, reservation_customer_name, reservation_party_size
+			FROM invoices
+			WHERE id = ? AND restaurant_id = ?
+		`, totals.Total, totals.TaxBase, totals.TaxAmount, today,
+			invoiceTypeRectifying, input.Reason,
+			originalID, a.ActiveRestaurantID)
+		if err != nil {
+			return err
+		}
+		newID, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := replaceInvoiceLinesTx(ctx, tx, a.ActiveRestaurantID, int(newID), lines); err != nil {
+			return err
+		}
+		number, err = issueInvoiceTx(ctx, tx, a.ActiveRestaurantID, int(newID))
+		return err
+	})
+	if err != nil {
+		writeInvoiceFiscalError(w, err)
+		return
+	}
+	s.submitFiscalRecordAsync(a.ActiveRestaurantID, int(newID))
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditCreate, Entity: "invoice", EntityID: newID,
+		After: s.invoiceAuditSnapshot(r.Context(), a.ActiveRestaurantID, int(newID))})
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":        true,
+		"id":             newID,
+		"invoice_number": number,
+		"message":        "Rectifying invoice created successfully",
+	})
+}
+
+func loadInvoiceLinesTx(ctx context.Context, tx *sql.Tx, invoiceID int) ([]InvoiceLine, error) {
+	rows, err := tx.QueryContext(ctx, invoiceLinesQuery, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines, err := scanInvoiceLines(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errInvoiceNoLines
+	}
+	return lines, nil
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildInvoiceLinesAndTotals(t *testing.T) {
+	rate21 := 21.0
+	lines, err := buildInvoiceLines([]InvoiceLineInput{
+		{Description: "Menú degustación", Quantity: 3, UnitPrice: 45.45},
+		{Description: "Vino", Quantity: 2, UnitPrice: 18.2, TaxRate: &rate21},
+		{Description: "Descuento", UnitPrice: -10},
+	})
+	if err != nil {
+		t.Fatalf("buildInvoiceLines: %v", err)
+	}
+	if got := lines[0]; got.TaxBase != 136.35 || got.TaxAmount != 13.64 || got.LineTotal != 149.99 {
+		t.Fatalf("line 1 = %+v", got)
+	}
+	if got := lines[2]; got.Quantity != 1 || got.TaxBase != -10 || got.TaxAmount != -1 {
+		t.Fatalf("discount line = %+v", got)
+	}
+
+	totals := computeInvoiceTotals(lines)
+	if totals.TaxBase != 162.75 || totals.TaxAmount != 20.28 || totals.Total != 183.03 {
+		t.Fatalf("totals = %+v", totals)
+	}
+	if len(totals.Breakdown) != 2 || totals.Breakdown[0].TaxRate != 10 || totals.Breakdown[0].TaxBase != 126.35 || totals.Breakdown[1].TaxAmount != 7.64 {
+		t.Fatalf("breakdown = %+v", totals.Breakdown)
+	}
+
+	bad := 120.0
+	for _, in := range [][]InvoiceLineInput{
+		{{Description: " ", UnitPrice: 1}},
+		{{Description: "x", UnitPrice: 1, TaxRate: &bad}},
+	} {
+		if _, err := buildInvoiceLines(in); !errors.Is(err, errInvoiceLineInvalid) {
+			t.Errorf("buildInvoiceLines(%+v) err = %v", in, err)
+		}
+	}
+}
+
+func TestLegacyInvoiceLineKeepsTotal(t *testing.T) {
+	for _, amount := range []float64{0.01, 10, 99.99, 245.5, 1234.57} {
+		l := legacyInvoiceLine("Reserva", amount)
+		if round2(l.TaxBase+l.TaxAmount) != amount || l.LineTotal != amount {
+			t.Errorf("legacyInvoiceLine(%v) = %+v", amount, l)
+		}
+	}
+	if _, err := invoiceLinesFromInput(InvoiceInput{}); !errors.Is(err, errInvoiceNoLines) {
+		t.Fatalf("expected errInvoiceNoLines, got %v", err)
+	}
+}
+
+func TestFormatInvoiceNumber(t *testing.T) {
+	if got := formatInvoiceNumber(invoiceSeriesOrdinary, 2026, 42); got != "F2026-00042" {
+		t.Fatalf("formatInvoiceNumber = %q", got)
+	}
+	if got := invoiceSeriesForType(invoiceTypeRectifying); got != invoiceSeriesRectifying {
+		t.Fatalf("rectifying series = %q", got)
+	}
+}
+
+// fakeInvoiceLineRows hands out rows in invoiceLinesQuery column order.
+type fakeInvoiceLineRows struct {
+	rows [][]any
+	next int
+}
+
+func (f *fakeInvoiceLineRows) Next() bool {
+	f.next++
+	return f.next <= len(f.rows)
+}
+
+func (f *fakeInvoiceLineRows) Scan(dest ...any) error {
+	row := f.rows[f.next-1]
+	if len(dest) != len(row) {
+		return fmt.Errorf("scan into %d columns, row has %d", len(dest), len(row))
+	}
+	for i, v := range row {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func (f *fakeInvoiceLineRows) Err() error { return nil }
+
+func TestRectificationNegatesLoadedLineAmounts(t *testing.T) {
+	if got := strings.Count(strings.SplitN(invoiceLinesQuery, "FROM", 2)[0], ","); got != 8 {
+		t.Fatalf("invoiceLinesQuery selects %d columns, want 9", got+1)
+	}
+	// A legacy line: the stored split doesn't follow from unit_price.
+	rows := &fakeInvoiceLineRows{rows: [][]any{
+		{7, 0, "Reserva", 1.0, 90.9, 10.0, 90.9, 9.09, 99.99},
+		{8, 1, "Vino", 2.0, 10.0, 21.0, 20.0, 4.2, 24.2},
+	}}
+	stored, err := scanInvoiceLines(rows)
+	if err != nil {
+		t.Fatalf("scanInvoiceLines: %v", err)
+	}
+	lines := negateInvoiceLines(stored)
+	if got := lines[0]; got.Quantity != -1 || got.TaxBase != -90.9 || got.TaxAmount != -9.09 || got.LineTotal != -99.99 {
+		t.Fatalf("negated line = %+v", got)
+	}
+	totals := computeInvoiceTotals(lines)
+	if totals.TaxBase != -110.9 || totals.TaxAmount != -13.29 || totals.Total != -124.19 {
+		t.Fatalf("negated totals = %+v", totals)
+	}
+}
+
+func TestCheckInvoiceRectification(t *testing.T) {
+	if err := checkInvoiceRectification(100, 0, 0, true, -100); err != nil {
+		t.Fatalf("first full rectification rejected: %v", err)
+	}
+	if err := checkInvoiceRectification(100, 1, -100, true, -100); !errors.Is(err, errInvoiceRectified) {
+		t.Fatalf("second full rectification err = %v", err)
+	}
+	if err := checkInvoiceRectification(100, 1, -30, true, -100); !errors.Is(err, errInvoiceRectified) {
+		t.Fatalf("full rectification after a partial one err = %v", err)
+	}
+	if err := checkInvoiceRectification(100, 1, -30, false, -70); err != nil {
+		t.Fatalf("rectifying what is left rejected: %v", err)
+	}
+	if err := checkInvoiceRectification(100, 1, -30, false, -70.01); !errors.Is(err, errInvoiceRectifyOver) {
+		t.Fatalf("over-rectification err = %v", err)
+	}
+	if err := checkInvoiceRectification(100, 2, -100, false, 15); err != nil {
+		t.Fatalf("positive correction rejected: %v", err)
+	}
+}
+
+func TestWriteInvoiceFiscalErrorIssuerMissing(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeInvoiceFiscalError(w, fmt.Errorf("issue: %w", errInvoiceIssuerMissing))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "datos fiscales del emisor") {
+		t.Fatalf("body = %s", body)
+	}
+}
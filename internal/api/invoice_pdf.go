@@ -0,0 +1,601 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"preactvillacarmen/internal/lib/qrcode"
+)
+
+// Minimal PDF 1.4 writer for invoices. It only uses the standard Helvetica
+// fonts with WinAnsiEncoding, so no font files are embedded and Spanish text
+// (accents, ñ, €) renders without extra dependencies.
+
+const (
+	pdfPageWidth  = 595.0 // A4 in points
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+	pdfQRSize     = 84.0
+	// Issuer lines are printed at 8pt beside the title block.
+	pdfIssuerLineRunes = 70
+)
+
+type invoicePDFLine struct {
+	Description string
+	Quantity    float64
+	UnitPrice   float64
+	TaxRate     float64
+	Total       float64
+}
+
+type invoicePDFTotal struct {
+	Label  string
+	Amount float64
+	Bold   bool
+}
+
+type invoicePDFDoc struct {
+	BrandName    string
+	PrimaryColor string
+	// Issuer is the legal identity printed under the brand on every page.
+	Issuer       []string
+	Title        string
+	Number       string
+	InvoiceDate  string
+	PaymentDate  string
+	PaymentLabel string
+	Customer     []string
+	Lines        []invoicePDFLine
+	Totals       []invoicePDFTotal
+	Notes        []string
+	// QRPayload is the tax agency validation URL; QRCaption is printed
+	// under the code (e.g. "VERI*FACTU").
+	QRPayload string
+	QRCaption string
+}
+
+// invoicePDFIssuer lists the issuer details every invoice has to carry.
+func invoicePDFIssuer(p fiscalProfileInput) []string {
+	var out []string
+	if v := strings.TrimSpace(p.IssuerName); v != "" {
+		out = append(out, v)
+	}
+	if v := strings.TrimSpace(p.IssuerNIF); v != "" {
+		out = append(out, "NIF: "+v)
+	}
+	// The header has room for two address lines under name and NIF.
+	address := wrapPDFText(strings.TrimSpace(p.IssuerAddress), pdfIssuerLineRunes)
+	if len(address) > 2 {
+		address = append(address[:1], truncatePDFText(strings.Join(address[1:], " "), pdfIssuerLineRunes))
+	}
+	return append(out, address...)
+}
+
+// invoicePDFDocFromInvoice maps the stored invoice into the printable layout.
+// Invoices without stored lines (created before line items existed) print
+// their total as a single line.
+func invoicePDFDocFromInvoice(inv Invoice, branding restaurantBrandingCfg, restaurantName string) invoicePDFDoc {
+	brand := strings.TrimSpace(branding.BrandName)
+	if brand == "" {
+		brand = strings.TrimSpace(restaurantName)
+	}
+
+	doc := invoicePDFDoc{
+		BrandName:    brand,
+		PrimaryColor: branding.PrimaryColor,
+		Title:        "FACTURA",
+		Number:       invoiceDisplayNumber(inv),
+		InvoiceDate:  formatInvoicePDFDate(inv.InvoiceDate),
+	}
+	if inv.InvoiceType == invoiceTypeRectifying {
+		doc.Title = "FACTURA RECTIFICATIVA"
+		ref := "Rectifica la factura"
+		if inv.RectifiesInvoiceNumber != nil {
+			ref += " Nº " + *inv.RectifiesInvoiceNumber
+		}
+		if reason := derefTrim(inv.RectificationReason); reason != "" {
+			ref += ". Motivo: " + reason
+		}
+		doc.Notes = append(doc.Notes, ref)
+	}
+	if inv.PaymentDate != nil {
+		doc.PaymentDate = formatInvoicePDFDate(*inv.PaymentDate)
+	}
+	if inv.PaymentMethod != nil {
+		doc.PaymentLabel = invoicePaymentMethodLabel(*inv.PaymentMethod)
+	}
+
+	name := strings.TrimSpace(inv.CustomerName)
+	if inv.CustomerSurname != nil && strings.TrimSpace(*inv.CustomerSurname) != "" {
+		name += " " + strings.TrimSpace(*inv.CustomerSurname)
+	}
+	doc.Customer = append(doc.Customer, name)
+	if v := derefTrim(inv.CustomerDniCif); v != "" {
+		doc.Customer = append(doc.Customer, "NIF/CIF: "+v)
+	}
+	street := strings.TrimSpace(derefTrim(inv.CustomerAddressStreet) + " " + derefTrim(inv.CustomerAddressNumber))
+	if street != "" {
+		doc.Customer = append(doc.Customer, street)
+	}
+	city := strings.TrimSpace(derefTrim(inv.CustomerAddressPostalCode) + " " + derefTrim(inv.CustomerAddressCity))
+	if p := derefTrim(inv.CustomerAddressProvince); p != "" {
+		if city != "" {
+			city += " (" + p + ")"
+		} else {
+			city = p
+		}
+	}
+	if city != "" {
+		doc.Customer = append(doc.Customer, city)
+	}
+	if v := derefTrim(inv.CustomerAddressCountry); v != "" {
+		doc.Customer = append(doc.Customer, v)
+	}
+	if v := strings.TrimSpace(inv.CustomerEmail); v != "" {
+		doc.Customer = append(doc.Customer, v)
+	}
+	if v := derefTrim(inv.CustomerPhone); v != "" {
+		doc.Customer = append(doc.Customer, "Tel. "+v)
+	}
+
+	lines := inv.Lines
+	if len(lines) == 0 {
+		desc := "Servicios de restauración"
+		if inv.IsReservation {
+			desc = "Reserva"
+			if inv.ReservationDate != nil && strings.TrimSpace(*inv.ReservationDate) != "" {
+				desc += " del " + formatInvoicePDFDate(*inv.ReservationDate)
+			}
+			if inv.ReservationPartySize != nil && *inv.ReservationPartySize > 0 {
+				desc += fmt.Sprintf(" - %d personas", *inv.ReservationPartySize)
+			}
+		}
+		lines = []InvoiceLine{legacyInvoiceLine(desc, inv.Amount)}
+	}
+	for _, l := range lines {
+		doc.Lines = append(doc.Lines, invoicePDFLine{
+			Description: l.Description,
+			Quantity:    l.Quantity,
+			UnitPrice:   l.UnitPrice,
+			TaxRate:     l.TaxRate,
+			Total:       l.TaxBase,
+		})
+	}
+
+	totals := computeInvoiceTotals(lines)
+	doc.Totals = append(doc.Totals, invoicePDFTotal{Label: "Base imponible", Amount: totals.TaxBase})
+	for _, b := range totals.Breakdown {
+		doc.Totals = append(doc.Totals, invoicePDFTotal{
+			Label:  fmt.Sprintf("IVA %s%% s/ %s", formatPDFQuantity(b.TaxRate), formatEuros(b.TaxBase)),
+			Amount: b.TaxAmount,
+		})
+	}
+	doc.Totals = append(doc.Totals, invoicePDFTotal{Label: "Total", Amount: totals.Total, Bold: true})
+	return doc
+}
+
+// invoiceDisplayNumber is the fiscal number once issued, or the internal ID
+// for drafts.
+func invoiceDisplayNumber(inv Invoice) string {
+	if inv.InvoiceNumber != nil && *inv.InvoiceNumber != "" {
+		return *inv.InvoiceNumber
+	}
+	return strconv.Itoa(inv.ID)
+}
+
+func derefTrim(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(*v)
+}
+
+func formatInvoicePDFDate(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 10 && raw[4] == '-' && raw[7] == '-' {
+		return raw[8:10] + "/" + raw[5:7] + "/" + raw[0:4]
+	}
+	return raw
+}
+
+func invoicePaymentMethodLabel(method string) string {
+	switch method {
+	case "efectivo":
+		return "Efectivo"
+	case "tarjeta":
+		return "Tarjeta"
+	case "transferencia":
+		return "Transferencia bancaria"
+	case "bizum":
+		return "Bizum"
+	case "cheque":
+		return "Cheque"
+	default:
+		return method
+	}
+}
+
+// formatEuros renders 1234.5 as "1.234,50 €".
+func formatEuros(v float64) string {
+	cents := int64(math.Round(v * 100))
+	neg := cents < 0
+	if neg {
+		cents = -cents
+	}
+	intPart := strconv.FormatInt(cents/100, 10)
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	out := fmt.Sprintf("%s,%02d €", b.String(), cents%100)
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+func formatPDFQuantity(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strings.Replace(strconv.FormatFloat(v, 'f', 2, 64), ".", ",", 1)
+}
+
+// renderInvoicePDF lays the invoice out on as many A4 pages as its lines
+// need. Every page repeats the header band with the invoice number, pages
+// that continue the lines table repeat its column titles, and blocks that
+// would cross the bottom margin move to a new page.
+func renderInvoicePDF(doc invoicePDFDoc) ([]byte, error) {
+	if len(doc.Lines) == 0 {
+		return nil, fmt.Errorf("invoice has no lines")
+	}
+
+	var (
+		pages []*pdfContent
+		c     *pdfContent
+		y     float64
+	)
+	pr, pg, pb := pdfHexColor(doc.PrimaryColor, 0.16, 0.20, 0.27)
+	right := pdfPageWidth - pdfMargin
+	colQty := right - 250.0
+	colUnit := right - 170.0
+	colTax := right - 100.0
+
+	// Header band
+	newPage := func() {
+		c = &pdfContent{}
+		pages = append(pages, c)
+		y = pdfPageHeight - pdfMargin
+		c.fillRect(0, pdfPageHeight-6, pdfPageWidth, 6, pr, pg, pb)
+		c.color(pr, pg, pb)
+		c.text(pdfMargin, y-14, "F2", 20, doc.BrandName)
+		c.color(0.25, 0.25, 0.25)
+		for i, line := range doc.Issuer {
+			c.text(pdfMargin, y-30-float64(i)*11, "F1", 8, truncatePDFText(line, pdfIssuerLineRunes))
+		}
+		c.color(pr, pg, pb)
+		c.textRight(right, y-10, "F2", 16, doc.Title)
+		c.color(0.25, 0.25, 0.25)
+		c.textRight(right, y-28, "F1", 10, "Nº "+doc.Number)
+		c.textRight(right, y-42, "F1", 10, "Fecha: "+doc.InvoiceDate)
+		y -= 80
+	}
+	tableHeader := func() {
+		c.fillRect(pdfMargin, y-6, right-pdfMargin, 20, pr, pg, pb)
+		c.color(1, 1, 1)
+		c.text(pdfMargin+6, y, "F2", 10, "Concepto")
+		c.textRight(colQty, y, "F2", 10, "Cant.")
+		c.textRight(colUnit, y, "F2", 10, "Precio")
+		c.textRight(colTax, y, "F2", 10, "IVA")
+		c.textRight(right-6, y, "F2", 10, "Base")
+		y -= 24
+		c.color(0.1, 0.1, 0.1)
+	}
+	// fit moves to a new page unless a block of height h still fits above
+	// the bottom margin.
+	fit := func(h float64, inTable bool) {
+		if y-h >= pdfMargin {
+			return
+		}
+		newPage()
+		if inTable {
+			tableHeader()
+		}
+	}
+
+	newPage()
+	qrBottom := y
+	if doc.QRPayload != "" {
+		code, err := qrcode.Encode([]byte(doc.QRPayload))
+		if err != nil {
+			return nil, fmt.Errorf("invoice QR: %w", err)
+		}
+		c.color(0.25, 0.25, 0.25)
+		c.textRight(right, y+2, "F1", 7, "QR tributario:")
+		qrBottom = y - 4 - pdfQRSize
+		c.qr(code, right-pdfQRSize, qrBottom, pdfQRSize)
+		if doc.QRCaption != "" {
+			qrBottom -= 10
+			c.color(0.25, 0.25, 0.25)
+			c.textRight(right, qrBottom, "F2", 7, doc.QRCaption)
+		}
+	}
+
+	// Customer block
+	c.color(pr, pg, pb)
+	c.text(pdfMargin, y, "F2", 10, "FACTURAR A")
+	y -= 16
+	c.color(0.1, 0.1, 0.1)
+	for i, line := range doc.Customer {
+		font := "F1"
+		if i == 0 {
+			font = "F2"
+		}
+		c.text(pdfMargin, y, font, 10, line)
+		y -= 14
+	}
+	y = math.Min(y, qrBottom)
+	y -= 20
+
+	// Lines table
+	fit(24+22, false)
+	tableHeader()
+	for _, l := range doc.Lines {
+		fit(22, true)
+		c.text(pdfMargin+6, y, "F1", 10, truncatePDFText(l.Description, 48))
+		c.textRight(colQty, y, "F1", 10, formatPDFQuantity(l.Quantity))
+		c.textRight(colUnit, y, "F1", 10, formatEuros(l.UnitPrice))
+		c.textRight(colTax, y, "F1", 10, formatPDFQuantity(l.TaxRate)+"%")
+		c.textRight(right-6, y, "F1", 10, formatEuros(l.Total))
+		y -= 8
+		c.line(pdfMargin, y, right, y, 0.85)
+		y -= 14
+	}
+	y -= 10
+
+	// Totals, kept together
+	fit(float64(16*len(doc.Totals)), false)
+	c.color(0.1, 0.1, 0.1)
+	for _, t := range doc.Totals {
+		font := "F1"
+		if t.Bold {
+			font = "F2"
+		}
+		c.textRight(colTax, y, font, 11, t.Label)
+		c.textRight(right-6, y, font, 11, formatEuros(t.Amount))
+		y -= 16
+	}
+	y -= 20
+
+	if doc.PaymentLabel != "" || doc.PaymentDate != "" {
+		fit(16+28, false)
+		c.color(pr, pg, pb)
+		c.text(pdfMargin, y, "F2", 10, "PAGO")
+		y -= 16
+		c.color(0.1, 0.1, 0.1)
+		if doc.PaymentLabel != "" {
+			c.text(pdfMargin, y, "F1", 10, "Forma de pago: "+doc.PaymentLabel)
+			y -= 14
+		}
+		if doc.PaymentDate != "" {
+			c.text(pdfMargin, y, "F1", 10, "Fecha de pago: "+doc.PaymentDate)
+			y -= 14
+		}
+	}
+	for _, n := range doc.Notes {
+		fit(18, false)
+		y -= 6
+		c.color(0.35, 0.35, 0.35)
+		c.text(pdfMargin, y, "F1", 9, n)
+		y -= 12
+	}
+
+	contents := make([][]byte, len(pages))
+	for i, p := range pages {
+		if len(pages) > 1 {
+			p.color(0.35, 0.35, 0.35)
+			p.textRight(right, pdfMargin-24, "F1", 8, fmt.Sprintf("Página %d de %d", i+1, len(pages)))
+		}
+		contents[i] = p.buf.Bytes()
+	}
+	return buildPDF(contents), nil
+}
+
+// wrapPDFText breaks s at spaces into lines of at most max runes; longer
+// words are left whole.
+func wrapPDFText(s string, max int) []string {
+	var (
+		out  []string
+		line string
+	)
+	for _, word := range strings.Fields(s) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > max {
+			out = append(out, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		out = append(out, line)
+	}
+	return out
+}
+
+func truncatePDFText(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
+
+type pdfContent struct {
+	buf bytes.Buffer
+}
+
+func (c *pdfContent) color(r, g, b float64) {
+	fmt.Fprintf(&c.buf, "%.3f %.3f %.3f rg\n", r, g, b)
+}
+
+func (c *pdfContent) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(&c.buf, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscapeText(s))
+}
+
+func (c *pdfContent) textRight(x, y float64, font string, size float64, s string) {
+	c.text(x-pdfTextWidth(s, font == "F2", size), y, font, size, s)
+}
+
+func (c *pdfContent) fillRect(x, y, w, h, r, g, b float64) {
+	fmt.Fprintf(&c.buf, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", r, g, b, x, y, w, h)
+}
+
+func (c *pdfContent) line(x1, y1, x2, y2, gray float64) {
+	fmt.Fprintf(&c.buf, "%.3f G 0.5 w %.2f %.2f m %.2f %.2f l S\n", gray, x1, y1, x2, y2)
+}
+
+// qr draws code as black squares in a size×size box whose lower-left corner
+// is (x, y). Dark modules in a row are merged into one rectangle to keep the
+// content stream small.
+func (c *pdfContent) qr(code *qrcode.Code, x, y, size float64) {
+	m := size / float64(code.Size)
+	c.buf.WriteString("0 0 0 rg\n")
+	for row := 0; row < code.Size; row++ {
+		top := y + size - float64(row+1)*m
+		for col := 0; col < code.Size; {
+			if !code.Dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < code.Size && code.Dark(col, row) {
+				col++
+			}
+			fmt.Fprintf(&c.buf, "%.2f %.2f %.2f %.2f re\n", x+float64(start)*m, top, float64(col-start)*m, m)
+		}
+	}
+	c.buf.WriteString("f\n")
+}
+
+// pdfTextWidth approximates Helvetica advance widths (1/1000 em). It only needs
+// to be exact for the characters used in right-aligned columns: digits,
+// separators and the euro sign.
+func pdfTextWidth(s string, bold bool, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9', r == '€':
+			total += 556
+		case r == '.' || r == ',' || r == ' ':
+			total += 278
+		case r == '-':
+			total += 333
+		case r == '(' || r == ')':
+			total += 333
+		case r == 'I' || r == 'i' || r == 'l' || r == 'j':
+			total += 278
+		case r == 'm' || r == 'M' || r == 'W' || r == 'w':
+			total += 833
+		case r >= 'A' && r <= 'Z':
+			total += 667
+		default:
+			total += 556
+		}
+	}
+	if bold {
+		total = total * 105 / 100
+	}
+	return float64(total) * size / 1000
+}
+
+var pdfWinAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// pdfEscapeText converts UTF-8 to WinAnsi bytes and escapes string delimiters.
+func pdfEscapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7F:
+			b.WriteByte(byte(r))
+		case r >= 0xA0 && r <= 0xFF:
+			b.WriteByte(byte(r))
+		default:
+			if c, ok := pdfWinAnsiExtra[r]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+func pdfHexColor(hex string, dr, dg, db float64) (float64, float64, float64) {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return dr, dg, db
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return dr, dg, db
+	}
+	return float64(v>>16&0xFF) / 255, float64(v>>8&0xFF) / 255, float64(v&0xFF) / 255
+}
+
+// buildPDF assembles a document with one A4 page per content stream.
+// Objects 1-4 are the catalog, the page tree and the two fonts; each page
+// then takes two objects, the page and its content stream.
+func buildPDF(pages [][]byte) []byte {
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	for i, content := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFormatEuros(t *testing.T) {
+	cases := map[float64]string{
+		0:          "0,00 €",
+		12.5:       "12,50 €",
+		1234.56:    "1.234,56 €",
+		1000000:    "1.000.000,00 €",
+		-45.1:      "-45,10 €",
+		0.004999:   "0,00 €",
+		999.995001: "1.000,00 €",
+	}
+	for in, want := range cases {
+		if got := formatEuros(in); got != want {
+			t.Errorf("formatEuros(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPDFEscapeText(t *testing.T) {
+	got := pdfEscapeText("Peña (10€) \\ ok")
+	want := "Pe\xf1a \\(10\x80\\) \\\\ ok"
+	if got != want {
+		t.Fatalf("pdfEscapeText = %q, want %q", got, want)
+	}
+}
+
+func TestRenderInvoicePDF(t *testing.T) {
+	surname := "García"
+	cif := "B12345678"
+	party := 6
+	resDate := "2026-10-16"
+	inv := Invoice{
+		ID:                   17,
+		CustomerName:         "Ana",
+		CustomerSurname:      &surname,
+		CustomerEmail:        "ana@example.com",
+		CustomerDniCif:       &cif,
+		Amount:               245.5,
+		InvoiceDate:          "2026-10-16T00:00:00Z",
+		IsReservation:        true,
+		ReservationDate:      &resDate,
+		ReservationPartySize: &party,
+	}
+	doc := invoicePDFDocFromInvoice(inv, restaurantBrandingCfg{PrimaryColor: "#8a1c2b"}, "Villa Carmen")
+	if doc.BrandName != "Villa Carmen" {
+		t.Fatalf("brand fallback = %q", doc.BrandName)
+	}
+	if doc.InvoiceDate != "16/10/2026" {
+		t.Fatalf("invoice date = %q", doc.InvoiceDate)
+	}
+
+	doc.Issuer = invoicePDFIssuer(fiscalProfileInput{IssuerNIF: "B87654321", IssuerName: "Villa Carmen SL", IssuerAddress: "Camino de la Albufera 12, 46012 Valencia"})
+
+	out, err := renderInvoicePDF(doc)
+	if err != nil {
+		t.Fatalf("renderInvoicePDF: %v", err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF document")
+	}
+	for _, want := range []string{"(Villa Carmen SL)", "(NIF: B87654321)", "(Camino de la Albufera 12, 46012 Valencia)", "Ana Garc\xeda", "NIF/CIF: B12345678", "Reserva del 16/10/2026 - 6 personas", "245,50 \x80"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+
+	// The xref offsets must point at the objects they describe.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("startxref missing")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if !bytes.HasPrefix(out[off:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d points at wrong offset", i+1)
+		}
+	}
+
+	doc.QRPayload = "https://example.test/ValidarQR?nif=B12345678&numserie=F2026-00001"
+	doc.QRCaption = "VERI*FACTU"
+	withQR, err := renderInvoicePDF(doc)
+	if err != nil {
+		t.Fatalf("renderInvoicePDF with QR: %v", err)
+	}
+	if !bytes.Contains(withQR, []byte("VERI*FACTU")) || bytes.Count(withQR, []byte(" re\n")) <= bytes.Count(out, []byte(" re\n")) {
+		t.Errorf("PDF missing QR code")
+	}
+
+	if _, err := renderInvoicePDF(invoicePDFDoc{}); err == nil {
+		t.Fatalf("expected error for invoice without lines")
+	}
+}
+
+func TestRenderInvoicePDFPaginatesLongInvoices(t *testing.T) {
+	doc := invoicePDFDoc{
+		BrandName:    "Villa Carmen",
+		Title:        "FACTURA",
+		Issuer:       []string{"Villa Carmen SL", "NIF: B87654321"},
+		Number:       "F2026-00042",
+		InvoiceDate:  "16/10/2026",
+		PaymentLabel: "Tarjeta",
+		Customer:     []string{"Ana García", "NIF/CIF: B12345678"},
+		Totals:       []invoicePDFTotal{{Label: "Base imponible", Amount: 800}, {Label: "Total", Amount: 880, Bold: true}},
+		Notes:        []string{"Gracias por su visita"},
+	}
+	for i := 1; i <= 80; i++ {
+		doc.Lines = append(doc.Lines, invoicePDFLine{Description: fmt.Sprintf("Linea %02d", i), Quantity: 1, UnitPrice: 10, TaxRate: 10, Total: 10})
+	}
+
+	out, err := renderInvoicePDF(doc)
+	if err != nil {
+		t.Fatalf("renderInvoicePDF: %v", err)
+	}
+	m := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("page tree missing")
+	}
+	pages, _ := strconv.Atoi(string(m[1]))
+	if pages < 3 {
+		t.Fatalf("80 lines fit on %d pages", pages)
+	}
+	if got := bytes.Count(out, []byte("/Type /Page /Parent")); got != pages {
+		t.Fatalf("%d page objects for /Count %d", got, pages)
+	}
+	for _, want := range []string{"Linea 01", "Linea 80", "880,00 \x80", "Gracias por su visita", fmt.Sprintf("P\xe1gina %d de %d", pages, pages)} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+	if got := bytes.Count(out, []byte("(N\xba F2026-00042)")); got != pages {
+		t.Errorf("header on %d of %d pages", got, pages)
+	}
+	if got := bytes.Count(out, []byte("(NIF: B87654321)")); got != pages {
+		t.Errorf("issuer on %d of %d pages", got, pages)
+	}
+	if got := bytes.Count(out, []byte("(Concepto)")); got != pages-1 && got != pages {
+		t.Errorf("table header on %d of %d pages", got, pages)
+	}
+
+	// Nothing may be drawn below the bottom margin's footer line.
+	for _, td := range regexp.MustCompile(`Tf [\d.]+ (-?[\d.]+) Td`).FindAllSubmatch(out, -1) {
+		if y, _ := strconv.ParseFloat(string(td[1]), 64); y < pdfMargin-24 {
+			t.Fatalf("text drawn at y=%v, off the page", y)
+		}
+	}
+}
+
+func TestInvoicePDFIssuerWrapsAddress(t *testing.T) {
+	long := strings.Repeat("Calle muy larga ", 20)
+	got := invoicePDFIssuer(fiscalProfileInput{IssuerNIF: "B87654321", IssuerName: "Villa Carmen SL", IssuerAddress: long})
+	if len(got) != 4 || got[1] != "NIF: B87654321" {
+		t.Fatalf("issuer lines = %q", got)
+	}
+	for _, l := range got {
+		if n := len([]rune(l)); n > pdfIssuerLineRunes {
+			t.Errorf("line of %d runes: %q", n, l)
+		}
+	}
+}
@@ -1,22 +1,19 @@
 package api
 
 import (
-	"database/sql"
 	"net/http"
-	"net/mail"
-	"net/url"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"preactvillacarmen/internal/httpx"
 )
 
 // Legacy admin tool endpoint: /emailAdvertising/sendEmailAndWhastappAd.php?action=send&type=all|email|whatsapp
-// The original PHP implementation used PHPMailer + Twilio. In Go we support:
-// - extracting unique contacts from `bookings`
-// - WhatsApp sending via UAZAPI if configured (UAZAPI_URL + UAZAPI_TOKEN)
-// Email sending is currently a no-op unless you wire SMTP; we count them as failed with a clear log entry.
+// The original PHP implementation used PHPMailer + Twilio and sent everything inline. In Go the
+// advert becomes one marketing campaign per channel, queued to start right away: the campaign
+// senders deliver it in the background (SMTP and UAZAPI) to the guests who consented on that
+// channel, at the configured rate limits. Progress is in /api/admin/marketing/campaigns/{id}.
 func (s *Server) handleSendEmailAndWhatsappAd(w http.ResponseWriter, r *http.Request) {
 	restaurantID, ok := restaurantIDFromContext(r.Context())
 	if !ok {
@@ -51,97 +48,12 @@ func (s *Server) handleSendEmailAndWhatsappAd(w http.ResponseWriter, r *http.Req
 		"emails_failed":   0,
 		"whatsapp_sent":   0,
 		"whatsapp_failed": 0,
+		"campaign_ids":    []int{},
 		"details":         []any{},
 		"logs":            []string{},
 	}
 	logs := results["logs"].([]string)
-	details := results["details"].([]any)
-
-	logs = append(logs, "Iniciando extracción de contactos únicos...")
-
-	rows, err := s.db.QueryContext(r.Context(), `
-		SELECT DISTINCT contact_email, contact_phone_country_code, contact_phone
-		FROM bookings
-		WHERE restaurant_id = ?
-		  AND (contact_email IS NOT NULL OR contact_phone IS NOT NULL)
-	`, restaurantID)
-	if err != nil {
-		results["logs"] = append(logs, "✗ Error extrayendo contactos: "+err.Error())
-		results["error"] = err.Error()
-		httpx.WriteJSON(w, http.StatusOK, results)
-		return
-	}
-	defer rows.Close()
-
-	emails := map[string]bool{}
-	phones := map[string]bool{}
-
-	for rows.Next() {
-		var email sql.NullString
-		var cc sql.NullString
-		var phone sql.NullString
-		if err := rows.Scan(&email, &cc, &phone); err != nil {
-			continue
-		}
-		if email.Valid {
-			e := strings.TrimSpace(email.String)
-			if e != "" {
-				if _, err := mail.ParseAddress(e); err == nil {
-					emails[e] = true
-				}
-			}
-		}
-		if phone.Valid {
-			ccDigits := ""
-			if cc.Valid {
-				ccDigits = onlyDigits(cc.String)
-			}
-			if ccDigits == "" {
-				ccDigits = "34"
-			}
-
-			p := onlyDigits(phone.String)
-			if p == "" {
-				continue
-			}
-
-			// If the DB already contains an E.164 number, keep it.
-			if len(p) >= 8 && len(p) <= 15 && strings.HasPrefix(p, ccDigits) && len(p) > 9 {
-				phones[p] = true
-				continue
-			}
-
-			// National number: keep permissive min length but respect E.164 max length.
-			if len(p) < 6 || len(p) > 15 {
-				continue
-			}
-			if len(ccDigits) < 1 || len(ccDigits) > 4 {
-				continue
-			}
-			if len(ccDigits)+len(p) > 15 {
-				continue
-			}
-
-			phones[ccDigits+p] = true
-		}
-	}
-
-	results["total_emails"] = len(emails)
-	results["total_phones"] = len(phones)
-	logs = append(logs, "Encontrados "+strconv.Itoa(len(emails))+" emails únicos y "+strconv.Itoa(len(phones))+" teléfonos únicos")
-
-	// Deterministic order for logs/results.
-	emailList := make([]string, 0, len(emails))
-	for e := range emails {
-		emailList = append(emailList, e)
-	}
-	sort.Strings(emailList)
-
-	phoneList := make([]string, 0, len(phones))
-	for p := range phones {
-		phoneList = append(phoneList, p)
-	}
-	sort.Strings(phoneList)
+	campaignIDs := results["campaign_ids"].([]int)
 
 	branding, _ := s.loadRestaurantBranding(r.Context(), restaurantID)
 	brandName := strings.TrimSpace(branding.BrandName)
@@ -150,91 +62,81 @@ func (s *Server) handleSendEmailAndWhatsappAd(w http.ResponseWriter, r *http.Req
 	}
 	baseURL := strings.TrimRight(publicBaseURL(r), "/")
 
-	advertisingMessage := "🌟 ¡La magia vuelve a " + brandName + "!\n\n" +
+	advertisingMessage := "🌟 ¡La magia vuelve a {{restaurant}}!\n\n" +
 		"⛱️ Tras las vacaciones, abrimos nuestras puertas para que disfrutes de momentos inolvidables en familia en nuestro entorno mágico.\n" +
 		"🧑🏻‍🍳 Saborea la esencia de la cocina mediterránea casera, con productos de la tierra de primera calidad.\n" +
 		"🥘 Reconocidos en el Top 50 Paella de Las Provincias.\n\n" +
-		"Reserva ya: " + baseURL
+		"Reserva ya: {{bookingUrl}}"
 
-	if campaignType == "all" || campaignType == "email" {
-		// Email sending not implemented in Go backend (no SMTP configured).
-		logs = append(logs, "Comenzando envío de emails...")
-		for _, e := range emailList {
-			results["emails_failed"] = results["emails_failed"].(int) + 1
-			details = append(details, map[string]any{
-				"type":    "email",
-				"contact": e,
-				"name":    "Estimado cliente",
-				"success": false,
-				"error":   "Email sending not configured (SMTP not set up in Go backend)",
-			})
-			logs = append(logs, "✗ Email NO enviado a: "+e+" (SMTP no configurado)")
-		}
-	} else {
+	channels := []string{marketingChannelEmail, marketingChannelWhatsApp}
+	switch campaignType {
+	case "email":
+		channels = channels[:1]
+		logs = append(logs, "Omitiendo envío de WhatsApp (no incluido en este tipo de campaña)")
+	case "whatsapp":
+		channels = channels[1:]
 		logs = append(logs, "Omitiendo envío de emails (no incluido en este tipo de campaña)")
 	}
 
-	if campaignType == "all" || campaignType == "whatsapp" {
-		logs = append(logs, "Comenzando envío de WhatsApp...")
+	logs = append(logs, "Calculando clientes con consentimiento...")
+	failed := false
+	for _, channel := range channels {
+		label, totalKey := "email", "total_emails"
+		if channel == marketingChannelWhatsApp {
+			label, totalKey = "WhatsApp", "total_phones"
+		}
 
-		uazURL, uazToken := s.uazapiBaseAndToken(r.Context(), restaurantID)
-		sendURL := ""
-		if uazURL != "" {
-			sendURL = uazURL + "/send/text"
-			if uazToken != "" {
-				sendURL += "?token=" + url.QueryEscape(uazToken)
-			}
+		if s.marketingChannelUnavailable(channel) {
+			logs = append(logs, "✗ "+marketingEmailUnsignedMsg)
+			results["error"] = marketingEmailUnsignedMsg
+			failed = true
+			continue
 		}
 
-		if sendURL == "" {
-			for _, p := range phoneList {
-				results["whatsapp_failed"] = results["whatsapp_failed"].(int) + 1
-				details = append(details, map[string]any{
-					"type":    "whatsapp",
-					"contact": p,
-					"name":    "Estimado cliente",
-					"success": false,
-					"error":   "UAZAPI_URL/UAZAPI_TOKEN not configured",
-				})
-			}
-			logs = append(logs, "✗ WhatsApp NO enviados: UAZAPI_URL/UAZAPI_TOKEN no configurados")
-		} else {
-			for _, p := range phoneList {
-				body, code, err := sendUazAPI(r.Context(), sendURL, map[string]any{
-					"number": p,
-					"text":   advertisingMessage,
-				})
-				sent := err == nil && (code == 200 || code == 201)
-				if sent {
-					results["whatsapp_sent"] = results["whatsapp_sent"].(int) + 1
-					logs = append(logs, "✓ WhatsApp enviado a: +"+p)
-				} else {
-					results["whatsapp_failed"] = results["whatsapp_failed"].(int) + 1
-					logs = append(logs, "✗ Error enviando WhatsApp a: +"+p)
-				}
-				detail := map[string]any{
-					"type":    "whatsapp",
-					"contact": p,
-					"name":    "Estimado cliente",
-					"success": sent,
-				}
-				if !sent {
-					if err != nil {
-						detail["error"] = err.Error()
-					} else {
-						detail["error"] = "HTTP " + strconv.Itoa(code) + ": " + body
-					}
-				}
-				details = append(details, detail)
-			}
+		total, err := s.countMarketingAudience(r.Context(), restaurantID, channel, marketingAudience{})
+		if err != nil {
+			logs = append(logs, "✗ Error extrayendo contactos de "+label+": "+err.Error())
+			results["error"] = err.Error()
+			failed = true
+			continue
 		}
-	} else {
-		logs = append(logs, "Omitiendo envío de WhatsApp (no incluido en este tipo de campaña)")
+		results[totalKey] = total
+		if total == 0 {
+			logs = append(logs, "Sin clientes con consentimiento para "+label)
+			continue
+		}
+
+		in := marketingCampaignInput{
+			Name:     "Anuncio " + time.Now().In(boMadridTZ).Format("02/01/2006 15:04"),
+			Channel:  channel,
+			Body:     advertisingMessage,
+			Audience: marketingAudience{GroupMenuIDs: []int{}},
+			BaseURL:  baseURL,
+		}
+		if channel == marketingChannelEmail {
+			in.Subject = "Novedades de " + brandName
+		}
+		id, err := s.insertMarketingCampaign(r.Context(), restaurantID, in)
+		if err == nil {
+			_, err = s.scheduleMarketingCampaign(r.Context(), restaurantID, id, 0)
+		}
+		if err != nil {
+			logs = append(logs, "✗ Error programando campaña de "+label+": "+err.Error())
+			results["error"] = err.Error()
+			failed = true
+			continue
+		}
+		campaignIDs = append(campaignIDs, id)
+		logs = append(logs, "✓ Campaña de "+label+" #"+strconv.Itoa(id)+" en cola para "+strconv.Itoa(total)+" clientes")
 	}
 
 	results["logs"] = logs
-	results["details"] = details
-	results["success"] = results["emails_sent"].(int) > 0 || results["whatsapp_sent"].(int) > 0
+	results["campaign_ids"] = campaignIDs
+	results["success"] = !failed && len(campaignIDs) > 0
 
-	httpx.WriteJSON(w, http.StatusOK, results)
+	status := http.StatusOK
+	if failed && len(campaignIDs) == 0 && results["error"] == marketingEmailUnsignedMsg {
+		status = http.StatusConflict
+	}
+	httpx.WriteJSON(w, status, results)
 }
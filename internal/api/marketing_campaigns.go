@@ -0,0 +1,957 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marketing campaigns send a template to an audience of guests on one
+// channel. When a scheduled campaign is due, the scheduler resolves its
+// audience once into message_deliveries rows (event marketing.campaign,
+// one per guest); a sender per channel then works through them at that
+// channel's rate limit. Consent is checked again right before each send,
+// so a guest who unsubscribes mid-campaign gets nothing more.
+const (
+	campaignDraft     = "draft"
+	campaignScheduled = "scheduled"
+	campaignSending   = "sending"
+	campaignSent      = "sent"
+	campaignCancelled = "cancelled"
+)
+
+const (
+	marketingDeliveryEvent   = "marketing.campaign"
+	marketingClickPath       = "/marketing_click.php"
+	marketingSchedulerPoll   = 30 * time.Second
+	marketingSenderPoll      = 10 * time.Second
+	marketingSendBatch       = 50
+	marketingSendLease       = 2 * time.Minute
+	marketingMaxAttempts     = 3
+	marketingBirthdayMaxDays = 60
+	marketingTemplateMaxBody = 4000
+	marketingStopFooter      = "Responde STOP para no recibir más mensajes."
+	// Every campaign email carries a signed unsubscribe link, so without
+	// GUEST_LINK_SECRET email campaigns are refused and never sent.
+	marketingEmailUnsignedMsg = "Falta GUEST_LINK_SECRET en la configuracion del servidor: sin el no se pueden firmar los enlaces de baja y no se envian campanas por email"
+)
+
+// marketingChannelUnavailable reports whether campaigns can't go out on
+// channel in this setup.
+func (s *Server) marketingChannelUnavailable(channel string) bool {
+	return channel == marketingChannelEmail && s.cfg.GuestLinkSecret == ""
+}
+
+// marketingAudience filters guests by their booking history. Zero values
+// don't filter. Whatever the filters, only guests who consented on the
+// campaign's channel and have a contact for it are included.
+type marketingAudience struct {
+	// Last visit at least / at most this many days ago.
+	LastVisitMinDays int `json:"lastVisitMinDays"`
+	LastVisitMaxDays int `json:"lastVisitMaxDays"`
+	MinVisits        int `json:"minVisits"`
+	// Has a booking for this many people.
+	PartySizeMin int `json:"partySizeMin"`
+	PartySizeMax int `json:"partySizeMax"`
+	// Has a booking with any group menu, or with one of GroupMenuIDs.
+	GroupMenu    bool  `json:"groupMenu"`
+	GroupMenuIDs []int `json:"groupMenuIds"`
+	// Birthday in the next N days, today included.
+	BirthdayWithinDays int    `json:"birthdayWithinDays"`
+	Tag                string `json:"tag"`
+}
+
+// normalize validates the filters in place and returns a message for the
+// first invalid one.
+func (a *marketingAudience) normalize() string {
+	if a.LastVisitMinDays < 0 || a.LastVisitMinDays > 3650 || a.LastVisitMaxDays < 0 || a.LastVisitMaxDays > 3650 {
+		return "Dias desde la ultima visita invalidos"
+	}
+	if a.LastVisitMaxDays > 0 && a.LastVisitMinDays > a.LastVisitMaxDays {
+		return "Rango de ultima visita invalido"
+	}
+	if a.MinVisits < 0 || a.MinVisits > 1000 {
+		return "Numero de visitas invalido"
+	}
+	if a.PartySizeMin < 0 || a.PartySizeMin > 100 || a.PartySizeMax < 0 || a.PartySizeMax > 100 {
+		return "Numero de comensales invalido"
+	}
+	if a.PartySizeMax > 0 && a.PartySizeMin > a.PartySizeMax {
+		return "Rango de comensales invalido"
+	}
+	if a.BirthdayWithinDays < 0 || a.BirthdayWithinDays > marketingBirthdayMaxDays {
+		return "Dias hasta el cumpleanos invalidos (maximo " + strconv.Itoa(marketingBirthdayMaxDays) + ")"
+	}
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, id := range a.GroupMenuIDs {
+		if id <= 0 {
+			return "Menu de grupo invalido"
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 50 {
+		return "Demasiados menus de grupo"
+	}
+	sort.Ints(ids)
+	a.GroupMenuIDs = ids
+	a.Tag = strings.TrimSpace(a.Tag)
+	return ""
+}
+
+// marketingBirthdays lists the "MM-DD" days from today through days-1
+// ahead. Feb 29 birthdays count on Feb 28 in non-leap years.
+func marketingBirthdays(today time.Time, days int) []string {
+	out := []string{}
+	for i := 0; i < days; i++ {
+		d := today.AddDate(0, 0, i)
+		out = append(out, d.Format("01-02"))
+		if d.Month() == time.February && d.Day() == 28 && d.AddDate(0, 0, 1).Day() == 1 {
+			out = append(out, "02-29")
+		}
+	}
+	return out
+}
+
+// marketingAudienceWhere builds the guests (alias g) WHERE clause for an
+// audience on a channel. today is the restaurant's local date.
+func marketingAudienceWhere(restaurantID int, channel string, a marketingAudience, today time.Time) (string, []any) {
+	where := []string{"g.restaurant_id = ?", "g.merged_into_id IS NULL", "g.anonymized_at IS NULL"}
+	args := []any{restaurantID}
+	if channel == marketingChannelWhatsApp {
+		where = append(where, "g.marketing_whatsapp_at IS NOT NULL", "g.phone_e164 IS NOT NULL", "g.phone_e164 <> ''")
+	} else {
+		where = append(where, "g.marketing_email_at IS NOT NULL", "g.email IS NOT NULL", "g.email <> ''")
+	}
+
+	if a.LastVisitMinDays > 0 {
+		where = append(where, "g.last_visit_date <= ?")
+		args = append(args, today.AddDate(0, 0, -a.LastVisitMinDays).Format("2006-01-02"))
+	}
+	if a.LastVisitMaxDays > 0 {
+		where = append(where, "g.last_visit_date >= ?")
+		args = append(args, today.AddDate(0, 0, -a.LastVisitMaxDays).Format("2006-01-02"))
+	}
+	if a.MinVisits > 0 {
+		where = append(where, "g.visit_count >= ?")
+		args = append(args, a.MinVisits)
+	}
+
+	const guestBookings = "EXISTS (SELECT 1 FROM bookings b WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = g.id AND "
+	if a.PartySizeMin > 0 || a.PartySizeMax > 0 {
+		cond := []string{}
+		if a.PartySizeMin > 0 {
+			cond = append(cond, "b.party_size >= ?")
+			args = append(args, a.PartySizeMin)
+		}
+		if a.PartySizeMax > 0 {
+			cond = append(cond, "b.party_size <= ?")
+			args = append(args, a.PartySizeMax)
+		}
+		where = append(where, guestBookings+strings.Join(cond, " AND ")+")")
+	}
+	if len(a.GroupMenuIDs) > 0 {
+		where = append(where, guestBookings+"b.menu_de_grupo_id IN ("+sqlPlaceholders(len(a.GroupMenuIDs))+"))")
+		for _, id := range a.GroupMenuIDs {
+			args = append(args, id)
+		}
+	} else if a.GroupMenu {
+		where = append(where, guestBookings+"b.menu_de_grupo_id > 0)")
+	}
+
+	if a.BirthdayWithinDays > 0 {
+		days := marketingBirthdays(today, a.BirthdayWithinDays)
+		where = append(where, "DATE_FORMAT(g.birthday, '%m-%d') IN ("+sqlPlaceholders(len(days))+")")
+		for _, d := range days {
+			args = append(args, d)
+		}
+	}
+	if a.Tag != "" {
+		quoted, _ := json.Marshal(a.Tag)
+		where = append(where, "g.tags LIKE ?")
+		args = append(args, "%"+string(quoted)+"%")
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (s *Server) countMarketingAudience(ctx context.Context, restaurantID int, channel string, a marketingAudience) (int, error) {
+	where, args := marketingAudienceWhere(restaurantID, channel, a, time.Now().In(boMadridTZ))
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM guests g WHERE "+where, args...).Scan(&n)
+	return n, err
+}
+
+// Template placeholders, written {{name}}.
+var (
+	marketingPlaceholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z]+)\s*\}\}`)
+	marketingPlaceholders  = []string{"name", "firstName", "restaurant", "lastVisit", "bookingUrl", "unsubscribeUrl"}
+)
+
+// unknownMarketingPlaceholders returns the placeholders in text that
+// renderMarketingTemplate wouldn't fill.
+func unknownMarketingPlaceholders(text string) []string {
+	out := []string{}
+	for _, m := range marketingPlaceholderRe.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(marketingPlaceholders, m[1]) {
+			out = append(out, m[0])
+		}
+	}
+	return out
+}
+
+type marketingMessageVars struct {
+	Name           string
+	Restaurant     string
+	LastVisit      string // YYYY-MM-DD
+	BookingURL     string
+	UnsubscribeURL string
+}
+
+func renderMarketingTemplate(text string, v marketingMessageVars) string {
+	name := strings.TrimSpace(v.Name)
+	if name == "" || name == privacyAnonymizedName {
+		name = "cliente"
+	}
+	lastVisit := v.LastVisit
+	if t, err := time.Parse("2006-01-02", lastVisit); err == nil {
+		lastVisit = t.Format("02/01/2006")
+	}
+	values := map[string]string{
+		"name":           name,
+		"firstName":      strings.Fields(name)[0],
+		"restaurant":     v.Restaurant,
+		"lastVisit":      lastVisit,
+		"bookingUrl":     v.BookingURL,
+		"unsubscribeUrl": v.UnsubscribeURL,
+	}
+	return marketingPlaceholderRe.ReplaceAllStringFunc(text, func(m string) string {
+		key := marketingPlaceholderRe.FindStringSubmatch(m)[1]
+		if val, ok := values[key]; ok {
+			return val
+		}
+		return m
+	})
+}
+
+// withMarketingOptOut makes sure a message tells the guest how to opt out:
+// the STOP keyword on WhatsApp, the unsubscribe link by email.
+func withMarketingOptOut(channel, body, unsubscribeURL string) string {
+	body = strings.TrimRight(body, " \n")
+	if channel == marketingChannelWhatsApp {
+		if strings.Contains(strings.ToUpper(body), "STOP") {
+			return body
+		}
+		return body + "\n\n" + marketingStopFooter
+	}
+	if unsubscribeURL == "" || strings.Contains(body, unsubscribeURL) {
+		return body
+	}
+	return body + "\n\n--\nPara no recibir más emails: " + unsubscribeURL
+}
+
+var marketingLinkRe = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+func marketingClickSignature(secret string, restaurantID int, deliveryID int64, target string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("click:v1|" + strconv.Itoa(restaurantID) + "|" + strconv.FormatInt(deliveryID, 10) + "|" + target))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// trackMarketingLinks points every link in body except skip (the
+// unsubscribe link) at the click redirect. Without a secret links are left
+// alone: the redirect must not be usable as an open redirect.
+func trackMarketingLinks(body, baseURL, secret string, restaurantID int, deliveryID int64, skip string) string {
+	if secret == "" || baseURL == "" {
+		return body
+	}
+	return marketingLinkRe.ReplaceAllStringFunc(body, func(link string) string {
+		target := strings.TrimRight(link, ".,;:!?)")
+		trail := link[len(target):]
+		if target == skip {
+			return link
+		}
+		qs := url.Values{}
+		qs.Set("d", strconv.FormatInt(deliveryID, 10))
+		qs.Set("u", target)
+		qs.Set("t", marketingClickSignature(secret, restaurantID, deliveryID, target))
+		return strings.TrimRight(baseURL, "/") + marketingClickPath + "?" + qs.Encode() + trail
+	})
+}
+
+// handleMarketingClick counts a click on a campaign link and redirects to
+// the original URL.
+func (s *Server) handleMarketingClick(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := restaurantIDFromContext(r.Context())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	deliveryID, _ := strconv.ParseInt(q.Get("d"), 10, 64)
+	target := q.Get("u")
+	secret := s.cfg.GuestLinkSecret
+	if deliveryID <= 0 || secret == "" || !hmac.Equal([]byte(q.Get("t")), []byte(marketingClickSignature(secret, restaurantID, deliveryID, target))) {
+		http.NotFound(w, r)
+		return
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, err := s.db.ExecContext(r.Context(), `
+		UPDATE message_deliveries
+		SET click_count = click_count + 1, clicked_at = COALESCE(clicked_at, NOW())
+		WHERE id = ? AND restaurant_id = ? AND campaign_id IS NOT NULL
+	`, deliveryID, restaurantID); err != nil {
+		log.Printf("[marketing] click delivery=%d: %v", deliveryID, err)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// marketingRateLimiter spaces sends evenly at perMinute, without bursts.
+// Each channel's sender owns one, so limits apply per instance.
+type marketingRateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newMarketingRateLimiter(perMinute int) *marketingRateLimiter {
+	if perMinute < 1 {
+		perMinute = 1
+	}
+	return &marketingRateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// reserve takes the next send slot and returns how long to wait for it.
+func (l *marketingRateLimiter) reserve(now time.Time) time.Duration {
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+func (l *marketingRateLimiter) wait(ctx context.Context) error {
+	d := l.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// runMarketingSchedulerLoop starts due campaigns and closes the ones whose
+// deliveries are all done.
+func (s *Server) runMarketingSchedulerLoop(ctx context.Context) {
+	ticker := time.NewTicker(marketingSchedulerPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.startDueCampaigns(ctx); err != nil && ctx.Err() == nil && !isSQLSchemaError(err) {
+			log.Printf("[marketing] scheduler: %v", err)
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE marketing_campaigns c
+			SET c.status = ?, c.finished_at = NOW()
+			WHERE c.status = ?
+				AND NOT EXISTS (
+					SELECT 1 FROM message_deliveries d
+					WHERE d.campaign_id = c.id AND d.status IN ('pending', 'retrying')
+				)
+		`, campaignSent, campaignSending); err != nil && ctx.Err() == nil && !isSQLSchemaError(err) {
+			log.Printf("[marketing] scheduler: %v", err)
+		}
+	}
+}
+
+func (s *Server) startDueCampaigns(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM marketing_campaigns
+		WHERE status = ? AND scheduled_at <= NOW()
+		ORDER BY scheduled_at ASC
+		LIMIT 10
+	`, campaignScheduled)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := s.startCampaign(ctx, id); err != nil {
+			log.Printf("[marketing] start campaign %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// startCampaign claims a due campaign and queues one delivery per guest of
+// its audience, in one transaction so a crash can't leave it half queued.
+func (s *Server) startCampaign(ctx context.Context, campaignID int) error {
+	return withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE marketing_campaigns SET status = ?, started_at = NOW()
+			WHERE id = ? AND status = ? AND scheduled_at <= NOW()
+		`, campaignSending, campaignID, campaignScheduled)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return nil
+		}
+
+		var (
+			restaurantID int
+			channel      string
+			audienceRaw  sql.NullString
+		)
+		if err := tx.QueryRowContext(ctx, "SELECT restaurant_id, channel, audience_json FROM marketing_campaigns WHERE id = ?", campaignID).
+			Scan(&restaurantID, &channel, &audienceRaw); err != nil {
+			return err
+		}
+		var audience marketingAudience
+		if audienceRaw.Valid && audienceRaw.String != "" {
+			if err := json.Unmarshal([]byte(audienceRaw.String), &audience); err != nil {
+				return err
+			}
+		}
+		recipient := "g.email"
+		if channel == marketingChannelWhatsApp {
+			recipient = "g.phone_e164"
+		}
+		where, args := marketingAudienceWhere(restaurantID, channel, audience, time.Now().In(boMadridTZ))
+		res, err = tx.ExecContext(ctx, `
+			INSERT INTO message_deliveries (restaurant_id, campaign_id, guest_id, channel, event, recipient, status, attempts, next_attempt_at)
+			SELECT g.restaurant_id, ?, g.id, ?, ?, `+recipient+`, 'pending', 0, NOW()
+			FROM guests g
+			WHERE `+where+`
+			ORDER BY g.id
+		`, append([]any{campaignID, channel, marketingDeliveryEvent}, args...)...)
+		if err != nil {
+			return err
+		}
+		queued, _ := res.RowsAffected()
+		_, err = tx.ExecContext(ctx, "UPDATE marketing_campaigns SET recipients = ? WHERE id = ?", queued, campaignID)
+		return err
+	})
+}
+
+// runMarketingSender returns the send loop of a channel, paced by its own
+// rate limiter.
+func (s *Server) runMarketingSender(channel string, perMinute int) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		limiter := newMarketingRateLimiter(perMinute)
+		ticker := time.NewTicker(marketingSenderPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for ctx.Err() == nil {
+				n, err := s.sendDueMarketingDeliveries(ctx, channel, limiter)
+				if err != nil && ctx.Err() == nil && !isSQLSchemaError(err) {
+					log.Printf("[marketing] %s sender: %v", channel, err)
+				}
+				if err != nil || n < marketingSendBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// sendDueMarketingDeliveries sends a batch of due campaign deliveries of a
+// channel. Rows are claimed by pushing next_attempt_at forward, as with
+// webhook retries, so instances can share the queue.
+func (s *Server) sendDueMarketingDeliveries(ctx context.Context, channel string, limiter *marketingRateLimiter) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id
+		FROM message_deliveries
+		WHERE channel = ?
+			AND campaign_id IS NOT NULL
+			AND status IN ('pending', 'retrying')
+			AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at ASC, id ASC
+		LIMIT ?
+	`, channel, marketingSendBatch)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := limiter.wait(ctx); err != nil {
+			return 0, nil
+		}
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+			WHERE id = ? AND status IN ('pending', 'retrying') AND next_attempt_at <= NOW()
+		`, int(marketingSendLease/time.Second), id)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			continue
+		}
+		if err := s.sendMarketingDelivery(ctx, id); err != nil {
+			log.Printf("[marketing] delivery %d: %v", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// sendMarketingDelivery renders and sends one claimed delivery, recording
+// the outcome on its row.
+func (s *Server) sendMarketingDelivery(ctx context.Context, deliveryID int64) error {
+	var (
+		restaurantID, attempts, guestID int
+		channel, recipient, status      string
+		subject, body, baseURL          sql.NullString
+		name, lastVisit                 sql.NullString
+		consented                       bool
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT d.restaurant_id, d.channel, d.recipient, d.attempts, COALESCE(d.guest_id, 0),
+			c.status, c.subject, c.body, c.base_url,
+			g.name, DATE_FORMAT(g.last_visit_date, '%Y-%m-%d'),
+			COALESCE(g.merged_into_id IS NULL AND g.anonymized_at IS NULL AND CASE d.channel
+				WHEN 'whatsapp' THEN g.marketing_whatsapp_at IS NOT NULL AND g.phone_e164 = d.recipient
+				ELSE g.marketing_email_at IS NOT NULL AND g.email = d.recipient
+			END, 0)
+		FROM message_deliveries d
+		JOIN marketing_campaigns c ON c.id = d.campaign_id
+		LEFT JOIN guests g ON g.id = d.guest_id
+		WHERE d.id = ?
+	`, deliveryID).Scan(&restaurantID, &channel, &recipient, &attempts, &guestID,
+		&status, &subject, &body, &baseURL, &name, &lastVisit, &consented)
+	if err != nil {
+		return err
+	}
+
+	finish := func(status, errText string) error {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE message_deliveries SET status = ?, error = ?, next_attempt_at = NULL WHERE id = ?
+		`, status, nullableString(errText), deliveryID)
+		return err
+	}
+	if status != campaignSending {
+		return finish("cancelled", "")
+	}
+	if !consented {
+		return finish("skipped", "sin consentimiento")
+	}
+	unsubscribeURL := ""
+	if channel == marketingChannelEmail {
+		unsubscribeURL = s.marketingUnsubscribeURL(baseURL.String, restaurantID, guestID, channel)
+		if unsubscribeURL == "" {
+			return finish("failed", "sin enlace de baja: falta GUEST_LINK_SECRET")
+		}
+	}
+
+	branding, _ := s.loadRestaurantBranding(ctx, restaurantID)
+	brand := strings.TrimSpace(branding.BrandName)
+	if brand == "" {
+		brand = s.restaurantNameFallback(ctx, restaurantID)
+	}
+	vars := marketingMessageVars{
+		Name:           name.String,
+		Restaurant:     brand,
+		LastVisit:      lastVisit.String,
+		BookingURL:     strings.TrimRight(baseURL.String, "/"),
+		UnsubscribeURL: unsubscribeURL,
+	}
+	text := withMarketingOptOut(channel, renderMarketingTemplate(body.String, vars), unsubscribeURL)
+	text = trackMarketingLinks(text, baseURL.String, s.cfg.GuestLinkSecret, restaurantID, deliveryID, unsubscribeURL)
+
+	var sendErr error
+	if channel == marketingChannelWhatsApp {
+		sendErr = s.sendWhatsAppMessage(ctx, restaurantID, recipient, text)
+	} else {
+		fromName := strings.TrimSpace(branding.EmailFromName)
+		if fromName == "" {
+			fromName = brand
+		}
+		sendErr = sendMarketingEmail(recipient, fromName, renderMarketingTemplate(subject.String, vars), text, unsubscribeURL)
+	}
+
+	attempt := attempts + 1
+	if sendErr == nil {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET status = 'sent', attempts = ?, error = NULL, sent_at = NOW(), last_attempt_at = NOW(), next_attempt_at = NULL
+			WHERE id = ?
+		`, attempt, deliveryID)
+		return err
+	}
+	if attempt >= marketingMaxAttempts {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE message_deliveries
+			SET status = 'failed', attempts = ?, error = ?, last_attempt_at = NOW(), next_attempt_at = NULL
+			WHERE id = ?
+		`, attempt, sendErr.Error(), deliveryID)
+		if err != nil {
+			return err
+		}
+		return sendErr
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE message_deliveries
+		SET status = 'retrying', attempts = ?, error = ?, last_attempt_at = NOW(),
+			next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE id = ?
+	`, attempt, sendErr.Error(), int(webhookRetryDelay(attempt)/time.Second), deliveryID)
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// sendMarketingEmail sends a plain-text campaign email with List-Unsubscribe
+// headers, so mail clients can offer one-click unsubscribe.
+func sendMarketingEmail(to, fromName, subject, body, unsubscribeURL string) error {
+	to, err := validateMailRecipient(to)
+	if err != nil {
+		return err
+	}
+	cfg, err := smtpSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	from := cfg.From
+	if name := strings.TrimSpace(fromName); name != "" {
+		from = (&mail.Address{Name: name, Address: cfg.From}).String()
+	}
+	msg := strings.Builder{}
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", mimeSafeSubject(subject)) + "\r\n")
+	if unsubscribeURL != "" {
+		msg.WriteString("List-Unsubscribe: <" + unsubscribeURL + ">\r\n")
+		msg.WriteString("List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+
+	return smtp.SendMail(cfg.Addr, cfg.Auth, cfg.From, []string{to}, []byte(msg.String()))
+}
+
+type marketingTemplate struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Channel   string  `json:"channel"`
+	Subject   string  `json:"subject"`
+	Body      string  `json:"body"`
+	CreatedAt *string `json:"createdAt"`
+	UpdatedAt *string `json:"updatedAt"`
+}
+
+type marketingTemplateInput struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// normalize validates a template in place and returns a message for the
+// first problem.
+func (t *marketingTemplateInput) normalize() string {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" || len(t.Name) > 120 {
+		return "Nombre invalido"
+	}
+	channel, ok := normalizeMarketingChannel(t.Channel)
+	if !ok {
+		return "Canal invalido"
+	}
+	t.Channel = channel
+	t.Subject = strings.TrimSpace(t.Subject)
+	if channel == marketingChannelWhatsApp {
+		t.Subject = ""
+	} else if t.Subject == "" || len(t.Subject) > 255 {
+		return "Asunto invalido"
+	}
+	t.Body = strings.TrimSpace(t.Body)
+	if t.Body == "" || len(t.Body) > marketingTemplateMaxBody {
+		return "Mensaje invalido"
+	}
+	if unknown := unknownMarketingPlaceholders(t.Subject + " " + t.Body); len(unknown) > 0 {
+		return "Variable desconocida: " + unknown[0]
+	}
+	return ""
+}
+
+func scanMarketingTemplate(scanner waitlistScanner) (marketingTemplate, error) {
+	var (
+		t                    marketingTemplate
+		createdAt, updatedAt sql.NullTime
+	)
+	if err := scanner.Scan(&t.ID, &t.Name, &t.Channel, &t.Subject, &t.Body, &createdAt, &updatedAt); err != nil {
+		return marketingTemplate{}, err
+	}
+	t.CreatedAt = formatNullTimeRFC3339(createdAt)
+	t.UpdatedAt = formatNullTimeRFC3339(updatedAt)
+	return t, nil
+}
+
+const marketingTemplateColumns = "id, name, channel, COALESCE(subject, ''), body, created_at, updated_at"
+
+func (s *Server) loadMarketingTemplate(ctx context.Context, restaurantID, id int) (marketingTemplate, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+marketingTemplateColumns+" FROM marketing_templates WHERE restaurant_id = ? AND id = ?", restaurantID, id)
+	return scanMarketingTemplate(row)
+}
+
+func (s *Server) loadMarketingTemplates(ctx context.Context, restaurantID int) ([]marketingTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+marketingTemplateColumns+" FROM marketing_templates WHERE restaurant_id = ? ORDER BY name, id", restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []marketingTemplate{}
+	for rows.Next() {
+		t, err := scanMarketingTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// marketingCampaignStats counts a campaign's deliveries by outcome.
+// Pending includes deliveries waiting for a retry.
+type marketingCampaignStats struct {
+	Pending   int `json:"pending"`
+	Sent      int `json:"sent"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	Cancelled int `json:"cancelled"`
+	Clicked   int `json:"clicked"`
+	Clicks    int `json:"clicks"`
+}
+
+type marketingCampaign struct {
+	ID          int                     `json:"id"`
+	Name        string                  `json:"name"`
+	Channel     string                  `json:"channel"`
+	TemplateID  *int                    `json:"templateId"`
+	Subject     string                  `json:"subject"`
+	Body        string                  `json:"body"`
+	Audience    marketingAudience       `json:"audience"`
+	Status      string                  `json:"status"`
+	ScheduledAt *string                 `json:"scheduledAt"`
+	StartedAt   *string                 `json:"startedAt"`
+	FinishedAt  *string                 `json:"finishedAt"`
+	Recipients  int                     `json:"recipients"`
+	CreatedAt   *string                 `json:"createdAt"`
+	Stats       *marketingCampaignStats `json:"stats,omitempty"`
+}
+
+const marketingCampaignColumns = `
+	id, name, channel, template_id, COALESCE(subject, ''), body, audience_json, status,
+	scheduled_at, started_at, finished_at, recipients, created_at`
+
+func scanMarketingCampaign(scanner waitlistScanner) (marketingCampaign, error) {
+	var (
+		c                                  marketingCampaign
+		templateID                         sql.NullInt64
+		audience                           sql.NullString
+		scheduled, started, finished, made sql.NullTime
+	)
+	err := scanner.Scan(&c.ID, &c.Name, &c.Channel, &templateID, &c.Subject, &c.Body, &audience, &c.Status,
+		&scheduled, &started, &finished, &c.Recipients, &made)
+	if err != nil {
+		return marketingCampaign{}, err
+	}
+	if templateID.Valid {
+		id := int(templateID.Int64)
+		c.TemplateID = &id
+	}
+	if audience.Valid && audience.String != "" {
+		_ = json.Unmarshal([]byte(audience.String), &c.Audience)
+	}
+	if c.Audience.GroupMenuIDs == nil {
+		c.Audience.GroupMenuIDs = []int{}
+	}
+	c.ScheduledAt = formatNullTimeRFC3339(scheduled)
+	c.StartedAt = formatNullTimeRFC3339(started)
+	c.FinishedAt = formatNullTimeRFC3339(finished)
+	c.CreatedAt = formatNullTimeRFC3339(made)
+	return c, nil
+}
+
+func (s *Server) loadMarketingCampaign(ctx context.Context, restaurantID, id int) (marketingCampaign, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+marketingCampaignColumns+" FROM marketing_campaigns WHERE restaurant_id = ? AND id = ?", restaurantID, id)
+	return scanMarketingCampaign(row)
+}
+
+func (s *Server) loadMarketingCampaignStats(ctx context.Context, campaignID int) (marketingCampaignStats, error) {
+	var st marketingCampaignStats
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT status, COUNT(*), COALESCE(SUM(click_count > 0), 0), COALESCE(SUM(click_count), 0)
+		FROM message_deliveries
+		WHERE campaign_id = ?
+		GROUP BY status
+	`, campaignID)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status                 string
+			count, clicked, clicks int
+		)
+		if err := rows.Scan(&status, &count, &clicked, &clicks); err != nil {
+			return st, err
+		}
+		switch status {
+		case "pending", "retrying":
+			st.Pending += count
+		case "sent":
+			st.Sent += count
+		case "failed":
+			st.Failed += count
+		case "skipped":
+			st.Skipped += count
+		case "cancelled":
+			st.Cancelled += count
+		}
+		st.Clicked += clicked
+		st.Clicks += clicks
+	}
+	return st, rows.Err()
+}
+
+// marketingCampaignInput is a campaign about to be saved. Channel, Subject
+// and Body come from the template.
+type marketingCampaignInput struct {
+	Name       string
+	TemplateID int
+	Channel    string
+	Subject    string
+	Body       string
+	Audience   marketingAudience
+	BaseURL    string
+	UserID     int
+}
+
+func (s *Server) insertMarketingCampaign(ctx context.Context, restaurantID int, in marketingCampaignInput) (int, error) {
+	audience, _ := json.Marshal(in.Audience)
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO marketing_campaigns (restaurant_id, name, channel, template_id, subject, body, audience_json, status, base_url, created_by_user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, restaurantID, in.Name, in.Channel, nullablePositiveInt(in.TemplateID), nullableString(in.Subject), in.Body,
+		string(audience), campaignDraft, nullableString(in.BaseURL), nullablePositiveInt(in.UserID))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// scheduleMarketingCampaign queues a draft or rescheduled campaign to start
+// after delay. Delays are relative to the database clock, like every other
+// queue here.
+func (s *Server) scheduleMarketingCampaign(ctx context.Context, restaurantID, id int, delay time.Duration) (bool, error) {
+	if delay < 0 {
+		delay = 0
+	}
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE marketing_campaigns
+		SET status = ?, scheduled_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE restaurant_id = ? AND id = ? AND status IN (?, ?)
+	`, campaignScheduled, int(delay/time.Second), restaurantID, id, campaignDraft, campaignScheduled)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// cancelMarketingCampaign stops a campaign that hasn't finished. Deliveries
+// already sent stay as they are.
+func (s *Server) cancelMarketingCampaign(ctx context.Context, restaurantID, id int) (bool, error) {
+	var cancelled bool
+	err := withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE marketing_campaigns SET status = ?, finished_at = NOW()
+			WHERE restaurant_id = ? AND id = ? AND status IN (?, ?, ?)
+		`, campaignCancelled, restaurantID, id, campaignDraft, campaignScheduled, campaignSending)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return nil
+		}
+		cancelled = true
+		_, err = tx.ExecContext(ctx, `
+			UPDATE message_deliveries SET status = 'cancelled', next_attempt_at = NULL
+			WHERE campaign_id = ? AND status IN ('pending', 'retrying')
+		`, id)
+		return err
+	})
+	return cancelled, err
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarketingAudienceNormalize(t *testing.T) {
+	a := marketingAudience{LastVisitMinDays: 90, LastVisitMaxDays: 365, GroupMenuIDs: []int{7, 3, 7}, Tag: " vip "}
+	if msg := a.normalize(); msg != "" {
+		t.Fatalf("normalize() message = %q", msg)
+	}
+	if !reflect.DeepEqual(a.GroupMenuIDs, []int{3, 7}) || a.Tag != "vip" {
+		t.Fatalf("audience = %+v", a)
+	}
+
+	for _, bad := range []marketingAudience{
+		{LastVisitMinDays: 400, LastVisitMaxDays: 30},
+		{PartySizeMin: 10, PartySizeMax: 4},
+		{BirthdayWithinDays: marketingBirthdayMaxDays + 1},
+		{GroupMenuIDs: []int{0}},
+		{MinVisits: -1},
+	} {
+		if msg := bad.normalize(); msg == "" {
+			t.Errorf("normalize(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestMarketingBirthdays(t *testing.T) {
+	got := marketingBirthdays(time.Date(2026, 12, 30, 0, 0, 0, 0, time.UTC), 3)
+	if !reflect.DeepEqual(got, []string{"12-30", "12-31", "01-01"}) {
+		t.Fatalf("year wrap = %v", got)
+	}
+	got = marketingBirthdays(time.Date(2027, 2, 28, 0, 0, 0, 0, time.UTC), 2)
+	if !reflect.DeepEqual(got, []string{"02-28", "02-29", "03-01"}) {
+		t.Fatalf("non-leap February = %v", got)
+	}
+	got = marketingBirthdays(time.Date(2028, 2, 28, 0, 0, 0, 0, time.UTC), 2)
+	if !reflect.DeepEqual(got, []string{"02-28", "02-29"}) {
+		t.Fatalf("leap February = %v", got)
+	}
+}
+
+func TestMarketingAudienceWhere(t *testing.T) {
+	today := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	full := marketingAudience{
+		LastVisitMinDays: 30, LastVisitMaxDays: 365, MinVisits: 2, PartySizeMin: 6, PartySizeMax: 12,
+		GroupMenuIDs: []int{4, 5}, BirthdayWithinDays: 7, Tag: "vip",
+	}
+	for _, a := range []marketingAudience{{}, full, {GroupMenu: true, PartySizeMin: 8}} {
+		for _, channel := range marketingChannels {
+			where, args := marketingAudienceWhere(9, channel, a, today)
+			if got := strings.Count(where, "?"); got != len(args) {
+				t.Errorf("%s %+v: %d placeholders, %d args (%s)", channel, a, got, len(args), where)
+			}
+			if !strings.HasPrefix(where, "g.restaurant_id = ? AND ") || args[0] != 9 {
+				t.Errorf("%s: not scoped to the restaurant: %s", channel, where)
+			}
+			if !strings.Contains(where, marketingConsentColumn(channel)+" IS NOT NULL") {
+				t.Errorf("%s: no consent check: %s", channel, where)
+			}
+		}
+	}
+
+	_, args := marketingAudienceWhere(9, marketingChannelEmail, marketingAudience{LastVisitMinDays: 30}, today)
+	if args[1] != "2026-05-16" {
+		t.Fatalf("last visit cutoff = %v", args[1])
+	}
+}
+
+func TestRenderMarketingTemplate(t *testing.T) {
+	vars := marketingMessageVars{Name: "Ana María López", Restaurant: "Villa Carmen", LastVisit: "2026-03-07", BookingURL: "https://example.com"}
+	got := renderMarketingTemplate("Hola {{firstName}}, desde el {{ lastVisit }} te echamos de menos en {{restaurant}}. {{bookingUrl}} {{other}}", vars)
+	want := "Hola Ana, desde el 07/03/2026 te echamos de menos en Villa Carmen. https://example.com {{other}}"
+	if got != want {
+		t.Fatalf("render = %q", got)
+	}
+	if got := renderMarketingTemplate("Hola {{name}}", marketingMessageVars{Name: privacyAnonymizedName}); got != "Hola cliente" {
+		t.Fatalf("render anonymised = %q", got)
+	}
+	if got := unknownMarketingPlaceholders("{{name}} {{nombre}} {{ bookingUrl }}"); !reflect.DeepEqual(got, []string{"{{nombre}}"}) {
+		t.Fatalf("unknown placeholders = %v", got)
+	}
+}
+
+func TestMarketingTemplateInputNormalize(t *testing.T) {
+	in := marketingTemplateInput{Name: " Vuelta ", Channel: "WhatsApp", Subject: "ignored", Body: " Hola {{firstName}} "}
+	if msg := in.normalize(); msg != "" {
+		t.Fatalf("normalize() message = %q", msg)
+	}
+	if in.Channel != marketingChannelWhatsApp || in.Subject != "" || in.Body != "Hola {{firstName}}" {
+		t.Fatalf("template = %+v", in)
+	}
+	for _, bad := range []marketingTemplateInput{
+		{Name: "a", Channel: "email", Body: "sin asunto"},
+		{Name: "a", Channel: "sms", Body: "x"},
+		{Name: "a", Channel: "whatsapp", Body: "Hola {{nombre}}"},
+		{Name: "", Channel: "whatsapp", Body: "x"},
+	} {
+		if msg := bad.normalize(); msg == "" {
+			t.Errorf("normalize(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestWithMarketingOptOut(t *testing.T) {
+	if got := withMarketingOptOut(marketingChannelWhatsApp, "Hola\n", ""); got != "Hola\n\n"+marketingStopFooter {
+		t.Fatalf("whatsapp = %q", got)
+	}
+	if got := withMarketingOptOut(marketingChannelWhatsApp, "Escribe STOP para salir", ""); got != "Escribe STOP para salir" {
+		t.Fatalf("whatsapp with STOP = %q", got)
+	}
+	unsub := "https://example.com/unsubscribe.php?g=1"
+	if got := withMarketingOptOut(marketingChannelEmail, "Hola", unsub); !strings.HasSuffix(got, unsub) {
+		t.Fatalf("email = %q", got)
+	}
+	if got := withMarketingOptOut(marketingChannelEmail, "Baja: "+unsub, unsub); got != "Baja: "+unsub {
+		t.Fatalf("email with link = %q", got)
+	}
+}
+
+func TestTrackMarketingLinks(t *testing.T) {
+	const secret = "s3cret"
+	unsub := "https://example.com/unsubscribe.php?g=1&c=email&t=x"
+	body := "Reserva en https://example.com/reservas. Baja: " + unsub
+	got := trackMarketingLinks(body, "https://example.com", secret, 3, 42, unsub)
+	if !strings.HasSuffix(got, "Baja: "+unsub) {
+		t.Fatalf("unsubscribe link rewritten: %q", got)
+	}
+	link := marketingLinkRe.FindString(got)
+	link = strings.TrimRight(link, ".")
+	if !strings.HasPrefix(link, "https://example.com"+marketingClickPath+"?") || !strings.Contains(got, link+". Baja") {
+		t.Fatalf("link not tracked: %q", got)
+	}
+	u, _ := url.Parse(link)
+	q := u.Query()
+	if q.Get("u") != "https://example.com/reservas" || q.Get("d") != "42" {
+		t.Fatalf("click params = %v", q)
+	}
+	if q.Get("t") != marketingClickSignature(secret, 3, 42, "https://example.com/reservas") {
+		t.Fatalf("click signature mismatch")
+	}
+	if q.Get("t") == marketingClickSignature(secret, 3, 42, "https://evil.example/") {
+		t.Fatalf("signature does not cover the target")
+	}
+
+	if got := trackMarketingLinks(body, "https://example.com", "", 3, 42, unsub); got != body {
+		t.Fatalf("links tracked without a secret: %q", got)
+	}
+}
+
+func TestMarketingRateLimiter(t *testing.T) {
+	l := newMarketingRateLimiter(20)
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	if d := l.reserve(now); d != 0 {
+		t.Fatalf("first send waits %v", d)
+	}
+	if d := l.reserve(now); d != 3*time.Second {
+		t.Fatalf("second send waits %v, want 3s", d)
+	}
+	if d := l.reserve(now.Add(time.Second)); d != 5*time.Second {
+		t.Fatalf("third send waits %v, want 5s", d)
+	}
+	if d := l.reserve(now.Add(time.Minute)); d != 0 {
+		t.Fatalf("send after idle waits %v", d)
+	}
+}
+
+func TestParseMarketingSchedule(t *testing.T) {
+	now := time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC)
+	if d, msg := parseMarketingSchedule("", now); d != 0 || msg != "" {
+		t.Fatalf("empty = %v %q", d, msg)
+	}
+	if d, msg := parseMarketingSchedule("2026-06-01T12:30:00Z", now); d != 150*time.Minute || msg != "" {
+		t.Fatalf("RFC3339 = %v %q", d, msg)
+	}
+	// 14:00 in Madrid (CEST) is 12:00 UTC.
+	if d, msg := parseMarketingSchedule("2026-06-01T14:00", now); d != 2*time.Hour || msg != "" {
+		t.Fatalf("local = %v %q", d, msg)
+	}
+	for _, bad := range []string{"manana", "2026-05-31T10:00:00Z", "2028-01-01T00:00:00Z"} {
+		if _, msg := parseMarketingSchedule(bad, now); msg == "" {
+			t.Errorf("parseMarketingSchedule(%q) accepted", bad)
+		}
+	}
+}
+
+func TestMarketingChannelUnavailable(t *testing.T) {
+	s := &Server{}
+	if !s.marketingChannelUnavailable(marketingChannelEmail) {
+		t.Fatal("email campaigns allowed without a signing secret")
+	}
+	if s.marketingChannelUnavailable(marketingChannelWhatsApp) {
+		t.Fatal("WhatsApp campaigns refused without a signing secret")
+	}
+	s.cfg.GuestLinkSecret = "s3cret"
+	if s.marketingChannelUnavailable(marketingChannelEmail) {
+		t.Fatal("email campaigns refused with a signing secret")
+	}
+	if got := s.marketingUnsubscribeURL("https://example.com/", 3, 42, marketingChannelEmail); !strings.HasPrefix(got, "https://example.com/unsubscribe.php?") {
+		t.Fatalf("unsubscribe link = %q", got)
+	}
+}
@@ -0,0 +1,388 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// Marketing channels a guest can consent to.
+const (
+	marketingChannelEmail    = "email"
+	marketingChannelWhatsApp = "whatsapp"
+)
+
+// Where a consent change came from (marketing_consents.source).
+const (
+	marketingSourceBookingForm  = "booking_form"
+	marketingSourceBackoffice   = "backoffice"
+	marketingSourceUnsubscribe  = "unsubscribe_link"
+	marketingSourceWhatsAppStop = "whatsapp_stop"
+)
+
+var errMarketingUnsubscribeInvalid = errors.New("unsubscribe token invalid")
+
+var marketingChannels = []string{marketingChannelEmail, marketingChannelWhatsApp}
+
+func normalizeMarketingChannel(raw string) (string, bool) {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	switch v {
+	case marketingChannelEmail, marketingChannelWhatsApp:
+		return v, true
+	}
+	return "", false
+}
+
+// marketingConsentColumn is the guests column holding a channel's current
+// consent.
+func marketingConsentColumn(channel string) string {
+	if channel == marketingChannelWhatsApp {
+		return "marketing_whatsapp_at"
+	}
+	return "marketing_email_at"
+}
+
+// bookingFormMarketingChannels reads the opt-in boxes of the booking form:
+// marketing_email and marketing_whatsapp, or marketing_consent for both.
+// An unticked box withdraws nothing.
+func bookingFormMarketingChannels(form url.Values) []string {
+	all := parseBoolParam(form.Get("marketing_consent"), false)
+	out := []string{}
+	if all || parseBoolParam(form.Get("marketing_email"), false) {
+		out = append(out, marketingChannelEmail)
+	}
+	if all || parseBoolParam(form.Get("marketing_whatsapp"), false) {
+		out = append(out, marketingChannelWhatsApp)
+	}
+	return out
+}
+
+// isMarketingStopKeyword reports whether a WhatsApp message is an opt-out.
+// Only the whole message counts, so "no puedo parar" stays a conversation.
+func isMarketingStopKeyword(text string) bool {
+	v := strings.ToUpper(strings.TrimSpace(text))
+	v = strings.TrimRight(v, ".!¡ ")
+	v = strings.Join(strings.Fields(v), " ")
+	switch v {
+	case "STOP", "BAJA", "PARAR", "UNSUBSCRIBE", "DARSE DE BAJA", "DAR DE BAJA", "DAME DE BAJA":
+		return true
+	}
+	return false
+}
+
+func marketingUnsubscribeSignature(secret string, restaurantID, guestID int, channel string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:v1|" + strconv.Itoa(restaurantID) + "|" + strconv.Itoa(guestID) + "|" + channel))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyMarketingUnsubscribeToken checks a link's signature. Unsubscribe
+// links don't expire: a guest may use one from an old message.
+func verifyMarketingUnsubscribeToken(secret string, restaurantID, guestID int, channel, token string) error {
+	token = strings.TrimSpace(token)
+	if secret == "" || token == "" || guestID <= 0 {
+		return errMarketingUnsubscribeInvalid
+	}
+	want := marketingUnsubscribeSignature(secret, restaurantID, guestID, channel)
+	if !hmac.Equal([]byte(token), []byte(want)) {
+		return errMarketingUnsubscribeInvalid
+	}
+	return nil
+}
+
+// marketingUnsubscribeURL returns a guest's signed unsubscribe link for a
+// channel, or "" when GUEST_LINK_SECRET isn't set and links can't be
+// signed.
+func (s *Server) marketingUnsubscribeURL(baseURL string, restaurantID, guestID int, channel string) string {
+	secret := s.cfg.GuestLinkSecret
+	if secret == "" {
+		return ""
+	}
+	qs := url.Values{}
+	qs.Set("g", strconv.Itoa(guestID))
+	qs.Set("c", channel)
+	qs.Set("t", marketingUnsubscribeSignature(secret, restaurantID, guestID, channel))
+	return strings.TrimRight(baseURL, "/") + "/unsubscribe.php?" + qs.Encode()
+}
+
+// marketingConsentChange is one ledger entry.
+type marketingConsentChange struct {
+	Channel     string
+	Granted     bool
+	Source      string
+	BookingID   int
+	ActorUserID int
+	IP          string
+}
+
+// recordMarketingConsent appends a change to the ledger and updates the
+// guest's current consent. A grant refreshes the timestamp; a withdrawal
+// clears it.
+func recordMarketingConsent(ctx context.Context, q guestDB, restaurantID, guestID int, c marketingConsentChange) error {
+	ip := c.IP
+	if len(ip) > 64 {
+		ip = ip[:64]
+	}
+	if _, err := q.ExecContext(ctx, `
+		INSERT INTO marketing_consents (restaurant_id, guest_id, channel, granted, source, booking_id, actor_user_id, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, restaurantID, guestID, c.Channel, c.Granted, c.Source, nullablePositiveInt(c.BookingID),
+		nullablePositiveInt(c.ActorUserID), nullableString(ip)); err != nil {
+		return err
+	}
+	value := "NULL"
+	if c.Granted {
+		value = "NOW()"
+	}
+	_, err := q.ExecContext(ctx, "UPDATE guests SET "+marketingConsentColumn(c.Channel)+" = "+value+" WHERE restaurant_id = ? AND id = ?",
+		restaurantID, guestID)
+	return err
+}
+
+// recordBookingMarketingConsent stores the opt-ins ticked on a booking form
+// against the booking's guest. Channels the guest left no contact for are
+// skipped. Failures are logged: they must not fail the booking.
+func (s *Server) recordBookingMarketingConsent(r *http.Request, restaurantID int, bookingID int64, channels []string) {
+	if len(channels) == 0 {
+		return
+	}
+	ctx := r.Context()
+	var (
+		guestID     int
+		email, e164 string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT g.id, COALESCE(g.email, ''), COALESCE(g.phone_e164, '')
+		FROM bookings b
+		JOIN guests g ON g.id = b.guest_id
+		WHERE b.restaurant_id = ? AND b.id = ?
+	`, restaurantID, bookingID).Scan(&guestID, &email, &e164)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && !isSQLSchemaError(err) {
+			log.Printf("[marketing] consent for booking %d: %v", bookingID, err)
+		}
+		return
+	}
+	for _, channel := range channels {
+		if (channel == marketingChannelEmail && email == "") || (channel == marketingChannelWhatsApp && e164 == "") {
+			continue
+		}
+		if err := recordMarketingConsent(ctx, s.db, restaurantID, guestID, marketingConsentChange{
+			Channel:   channel,
+			Granted:   true,
+			Source:    marketingSourceBookingForm,
+			BookingID: int(bookingID),
+			IP:        clientIP(r),
+		}); err != nil {
+			log.Printf("[marketing] consent for booking %d: %v", bookingID, err)
+		}
+	}
+}
+
+// optOutWhatsAppSender withdraws WhatsApp consent for the guest writing from
+// sender (E.164 digits, '+' optional). It reports whether a consenting
+// guest was found.
+func (s *Server) optOutWhatsAppSender(ctx context.Context, restaurantID int, sender string) (bool, error) {
+	digits := onlyDigits(sender)
+	if digits == "" {
+		return false, nil
+	}
+	guestID, _, err := findGuest(ctx, s.db, restaurantID, guestIdentity{E164: digits})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var consentAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, "SELECT marketing_whatsapp_at FROM guests WHERE id = ?", guestID).Scan(&consentAt); err != nil {
+		return false, err
+	}
+	if !consentAt.Valid {
+		return false, nil
+	}
+	return true, recordMarketingConsent(ctx, s.db, restaurantID, guestID, marketingConsentChange{
+		Channel: marketingChannelWhatsApp,
+		Granted: false,
+		Source:  marketingSourceWhatsAppStop,
+	})
+}
+
+type marketingConsentEntry struct {
+	ID          int64   `json:"id"`
+	Channel     string  `json:"channel"`
+	Granted     bool    `json:"granted"`
+	Source      string  `json:"source"`
+	BookingID   *int    `json:"bookingId"`
+	ActorUserID *int    `json:"actorUserId"`
+	IP          string  `json:"ip"`
+	CreatedAt   *string `json:"createdAt"`
+}
+
+func (s *Server) loadMarketingConsents(ctx context.Context, restaurantID, guestID int) ([]marketingConsentEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, channel, granted, source, booking_id, actor_user_id, COALESCE(ip, ''), created_at
+		FROM marketing_consents
+		WHERE restaurant_id = ? AND guest_id = ?
+		ORDER BY id DESC
+	`, restaurantID, guestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []marketingConsentEntry{}
+	for rows.Next() {
+		var (
+			e                  marketingConsentEntry
+			bookingID, actorID sql.NullInt64
+			createdAt          sql.NullTime
+		)
+		if err := rows.Scan(&e.ID, &e.Channel, &e.Granted, &e.Source, &bookingID, &actorID, &e.IP, &createdAt); err != nil {
+			return nil, err
+		}
+		if bookingID.Valid {
+			v := int(bookingID.Int64)
+			e.BookingID = &v
+		}
+		if actorID.Valid {
+			v := int(actorID.Int64)
+			e.ActorUserID = &v
+		}
+		e.CreatedAt = formatNullTimeRFC3339(createdAt)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+var marketingUnsubscribeTmpl = template.Must(template.New("marketing_unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+  <title>Cancelar suscripción - {{.BrandName}}</title>
+  <style>
+    :root { --primary:#4a6741; --danger:#dc3545; --success:#28a745; --bg1:#e8f5e9; --bg2:#c8e6c9; --bg3:#a5d6a7; --text:#2d3748; --muted:#718096; }
+    * { box-sizing:border-box; }
+    body { margin:0; font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,Oxygen,Ubuntu,sans-serif; min-height:100vh; display:flex; align-items:center; justify-content:center; padding:16px; background:linear-gradient(135deg,var(--bg1),var(--bg2),var(--bg3)); background-attachment:fixed; color:var(--text); }
+    .card { width:100%; max-width:560px; background:rgba(255,255,255,0.75); border:1px solid rgba(255,255,255,0.35); border-radius:18px; padding:24px; box-shadow:0 8px 32px rgba(0,0,0,0.08); backdrop-filter: blur(18px); }
+    .logo { display:block; margin:0 auto 10px; width:120px; height:auto; }
+    h1 { margin:0 0 6px; font-size:22px; text-align:center; }
+    .sub { margin:0 0 16px; color:var(--muted); font-size:14px; text-align:center; }
+    .msg { padding:12px 14px; border-radius:12px; margin:14px 0; border:1px solid rgba(0,0,0,0.08); background:rgba(255,255,255,0.55); }
+    .msg.success { border-color: rgba(40,167,69,0.35); background: rgba(40,167,69,0.12); }
+    .msg.error { border-color: rgba(220,53,69,0.35); background: rgba(220,53,69,0.10); }
+    .btn { display:inline-block; width:100%; text-align:center; border:none; border-radius:12px; padding:12px 14px; cursor:pointer; font-size:16px; background:var(--danger); color:white; text-decoration:none; }
+    .btn.secondary { background:rgba(74,103,65,0.12); color:var(--primary); border:1px solid rgba(74,103,65,0.35); }
+  </style>
+</head>
+<body>
+  <main class="card">
+    <img class="logo" src="{{.LogoURL}}" alt="{{.BrandName}}" />
+    <h1>Cancelar suscripción</h1>
+    <p class="sub">Dejará de recibir comunicaciones comerciales de {{.BrandName}} por {{.ChannelLabel}}.</p>
+
+    {{if .Message}}
+      <div class="msg {{if .Success}}success{{else}}error{{end}}">{{.Message}}</div>
+    {{end}}
+
+    {{if .ShowConfirmation}}
+      <form method="post" action="{{.Action}}">
+        <button class="btn" type="submit" name="unsubscribe" value="1">Darme de baja</button>
+      </form>
+      <div style="height:10px"></div>
+    {{end}}
+    <a class="btn secondary" href="index.php">Volver a la página principal</a>
+  </main>
+</body>
+</html>`))
+
+// handleMarketingUnsubscribePage withdraws a guest's consent for one channel
+// from a signed link. GET shows a single button, so link scanners opening
+// the URL don't unsubscribe anyone; POST (the button, or a mail client's
+// RFC 8058 one-click request) records the withdrawal.
+func (s *Server) handleMarketingUnsubscribePage(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := restaurantIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusNotFound, "Unknown restaurant")
+		return
+	}
+
+	branding, _ := s.loadRestaurantBranding(r.Context(), restaurantID)
+	brandName := strings.TrimSpace(branding.BrandName)
+	if brandName == "" {
+		brandName = "Restaurante"
+	}
+	logoURL := strings.TrimSpace(branding.LogoURL)
+	if logoURL == "" {
+		logoURL = "/media/logos/logo-negro.png"
+	}
+
+	q := r.URL.Query()
+	guestID, _ := strconv.Atoi(strings.TrimSpace(q.Get("g")))
+	channel, channelOK := normalizeMarketingChannel(q.Get("c"))
+	channelLabel := "email"
+	if channel == marketingChannelWhatsApp {
+		channelLabel = "WhatsApp"
+	}
+	data := map[string]any{
+		"BrandName":        brandName,
+		"LogoURL":          logoURL,
+		"ChannelLabel":     channelLabel,
+		"Message":          "",
+		"Success":          false,
+		"ShowConfirmation": false,
+		"Action":           r.URL.RequestURI(),
+	}
+
+	if !channelOK || verifyMarketingUnsubscribeToken(s.cfg.GuestLinkSecret, restaurantID, guestID, channel, q.Get("t")) != nil {
+		data["Message"] = "Enlace no válido. Por favor, utilice el enlace que recibió o contacte con el restaurante."
+		writeHTMLTemplate(w, marketingUnsubscribeTmpl, data)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		data["ShowConfirmation"] = true
+		writeHTMLTemplate(w, marketingUnsubscribeTmpl, data)
+		return
+	}
+
+	var consentAt sql.NullTime
+	err := s.db.QueryRowContext(r.Context(), "SELECT "+marketingConsentColumn(channel)+" FROM guests WHERE restaurant_id = ? AND id = ?",
+		restaurantID, guestID).Scan(&consentAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Anonymised or never existed: nothing to withdraw.
+	case err != nil:
+		data["Message"] = "No se pudo procesar la baja. Por favor, inténtelo de nuevo."
+		data["ShowConfirmation"] = true
+		writeHTMLTemplate(w, marketingUnsubscribeTmpl, data)
+		return
+	case consentAt.Valid:
+		if err := recordMarketingConsent(r.Context(), s.db, restaurantID, guestID, marketingConsentChange{
+			Channel: channel,
+			Granted: false,
+			Source:  marketingSourceUnsubscribe,
+			IP:      clientIP(r),
+		}); err != nil {
+			data["Message"] = "No se pudo procesar la baja. Por favor, inténtelo de nuevo."
+			data["ShowConfirmation"] = true
+			writeHTMLTemplate(w, marketingUnsubscribeTmpl, data)
+			return
+		}
+	}
+	data["Success"] = true
+	data["Message"] = "Se ha dado de baja correctamente. No recibirá más comunicaciones comerciales por " + channelLabel + "."
+	writeHTMLTemplate(w, marketingUnsubscribeTmpl, data)
+}
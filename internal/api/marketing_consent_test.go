@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestIsMarketingStopKeyword(t *testing.T) {
+	for _, in := range []string{"STOP", " stop ", "Baja", "baja.", "Darse de  baja!", "unsubscribe"} {
+		if !isMarketingStopKeyword(in) {
+			t.Errorf("isMarketingStopKeyword(%q) = false", in)
+		}
+	}
+	for _, in := range []string{"", "no puedo parar de pensar en vuestra paella", "stop, mejor manana", "bajamos a las 9"} {
+		if isMarketingStopKeyword(in) {
+			t.Errorf("isMarketingStopKeyword(%q) = true", in)
+		}
+	}
+}
+
+func TestBookingFormMarketingChannels(t *testing.T) {
+	cases := []struct {
+		form url.Values
+		want []string
+	}{
+		{url.Values{}, []string{}},
+		{url.Values{"marketing_consent": {"1"}}, []string{marketingChannelEmail, marketingChannelWhatsApp}},
+		{url.Values{"marketing_whatsapp": {"on"}}, []string{marketingChannelWhatsApp}},
+		{url.Values{"marketing_email": {"true"}, "marketing_whatsapp": {"0"}}, []string{marketingChannelEmail}},
+	}
+	for _, c := range cases {
+		if got := bookingFormMarketingChannels(c.form); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("bookingFormMarketingChannels(%v) = %v, want %v", c.form, got, c.want)
+		}
+	}
+}
+
+func TestMarketingUnsubscribeToken(t *testing.T) {
+	const secret = "s3cret"
+	token := marketingUnsubscribeSignature(secret, 3, 41, marketingChannelEmail)
+	if err := verifyMarketingUnsubscribeToken(secret, 3, 41, marketingChannelEmail, token); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	for name, err := range map[string]error{
+		"other guest":      verifyMarketingUnsubscribeToken(secret, 3, 42, marketingChannelEmail, token),
+		"other channel":    verifyMarketingUnsubscribeToken(secret, 3, 41, marketingChannelWhatsApp, token),
+		"other restaurant": verifyMarketingUnsubscribeToken(secret, 4, 41, marketingChannelEmail, token),
+		"no secret":        verifyMarketingUnsubscribeToken("", 3, 41, marketingChannelEmail, token),
+	} {
+		if err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestMarketingConsentColumn(t *testing.T) {
+	if got := marketingConsentColumn(marketingChannelWhatsApp); got != "marketing_whatsapp_at" {
+		t.Fatalf("whatsapp column = %q", got)
+	}
+	if got := marketingConsentColumn(marketingChannelEmail); got != "marketing_email_at" {
+		t.Fatalf("email column = %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -130,6 +131,11 @@ func (s *Server) computeAvailableHoursForPartySize(r *http.Request, date string,
 		return nil, err
 	}
 
+	services, err := s.loadServiceDay(r.Context(), s.db, restaurantID, date, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	var hourDataRaw sql.NullString
 	err = s.db.QueryRowContext(r.Context(), "SELECT hourData FROM hour_configuration WHERE restaurant_id = ? AND date = ? LIMIT 1", restaurantID, date).Scan(&hourDataRaw)
 	if err != nil && err != sql.ErrNoRows {
@@ -203,6 +209,10 @@ func (s *Server) computeAvailableHoursForPartySize(r *http.Request, date string,
 		}
 	}
 
+	if len(services) > 0 {
+		applyServiceCapacity(hourData, services)
+	}
+
 	sort.Strings(activeHours)
 
 	out := []availableHour{}
@@ -211,6 +221,9 @@ func (s *Server) computeAvailableHoursForPartySize(r *http.Request, date string,
 		if slot.IsClosed || strings.EqualFold(slot.Status, "closed") {
 			continue
 		}
+		if len(services) > 0 && !services[serviceForHour(services, h)].acceptsPartySize(partySize) {
+			continue
+		}
 		if slot.Capacity >= partySize {
 			out = append(out, availableHour{
 				Time:          h,
@@ -853,8 +866,26 @@ func (s *Server) handleUpdateReservation(w http.ResponseWriter, r *http.Request)
 		value = string(input.Value)
 	}
 
-	query := "UPDATE bookings SET " + column + " = ? WHERE restaurant_id = ? AND id = ?"
-	_, err := s.db.ExecContext(r.Context(), query, value, restaurantID, input.BookingID)
+	before, _ := s.loadWebhookBookingSnapshot(r.Context(), restaurantID, input.BookingID)
+	var err error
+	if field == "rice_type" {
+		query := "UPDATE bookings SET " + column + " = ? WHERE restaurant_id = ? AND id = ?"
+		_, err = s.db.ExecContext(r.Context(), query, value, restaurantID, input.BookingID)
+	} else {
+		err = s.updateBookingSlotWithCapacity(r.Context(), restaurantID, input.BookingID, field, value)
+	}
+	var capErr *bookingCapacityError
+	if errors.As(err, &capErr) {
+		writeBookingCapacityError(w, http.StatusOK, capErr)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success": false,
+			"message": "Booking not found",
+		})
+		return
+	}
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusOK, map[string]any{
 			"success": false,
@@ -863,6 +894,8 @@ func (s *Server) handleUpdateReservation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	s.emitBookingUpdatedWebhooks(r.Context(), restaurantID, input.BookingID, "n8n_update_reservation", before)
+
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{
 		"success":  true,
 		"message":  "Reservation updated successfully",
@@ -872,6 +905,60 @@ func (s *Server) handleUpdateReservation(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// updateBookingSlotWithCapacity changes the date, time or party size of a
+// booking, re-checking capacity for the resulting slot in the same transaction.
+func (s *Server) updateBookingSlotWithCapacity(ctx context.Context, restaurantID int, bookingID int, field string, value any) error {
+	req := bookingCapacityRequest{ExcludeBookingID: bookingID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT DATE_FORMAT(reservation_date, '%Y-%m-%d'), TIME_FORMAT(reservation_time, '%H:%i:%s'), party_size
+		FROM bookings
+		WHERE restaurant_id = ? AND id = ?
+		LIMIT 1
+	`, restaurantID, bookingID).Scan(&req.ReservationDate, &req.ReservationTime, &req.PartySize)
+	if err != nil {
+		return err
+	}
+
+	switch field {
+	case "reservation_date":
+		date := strings.TrimSpace(anyToString(value))
+		if !isValidISODate(date) {
+			return badRequest("Invalid date format. Use YYYY-MM-DD")
+		}
+		req.ReservationDate = date
+		value = date
+	case "reservation_time":
+		t, err := ensureHHMMSS(anyToString(value))
+		if err != nil {
+			return badRequest("Invalid time format. Use HH:MM")
+		}
+		req.ReservationTime = t
+		value = t
+	case "party_size":
+		n, _ := value.(int)
+		if n <= 0 {
+			return badRequest("Invalid value for party_size")
+		}
+		req.PartySize = n
+	default:
+		return badRequest("Invalid field name")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := s.enforceBookingCapacityTx(ctx, tx, restaurantID, req); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE bookings SET "+field+" = ? WHERE restaurant_id = ? AND id = ?", value, restaurantID, bookingID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (s *Server) handleNotifyRestaurantModification(w http.ResponseWriter, r *http.Request) {
 	restaurantID, ok := restaurantIDFromContext(r.Context())
 	if !ok {
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bookings.attendance values. NULL means nobody marked it yet.
+const (
+	bookingAttendanceArrived = "arrived"
+	bookingAttendanceNoShow  = "no_show"
+)
+
+// What a no-show policy does to an online booking.
+const (
+	noShowActionConfirm = "confirm"
+	noShowActionDeposit = "deposit"
+	noShowActionBlock   = "block"
+)
+
+var (
+	errAttendanceTooEarly = errors.New("attendance marked before the booking date")
+	errAttendanceSeated   = errors.New("no-show marked on a seated booking")
+)
+
+func normalizeBookingAttendance(raw string) (string, bool) {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	switch v {
+	case "", bookingAttendanceArrived, bookingAttendanceNoShow:
+		return v, true
+	}
+	return "", false
+}
+
+// guestReliabilityScore is 0-100: the share of a guest's attended bookings
+// among those that were attended or missed, counting one attended booking
+// up front so a single early no-show doesn't sink a new guest to zero.
+func guestReliabilityScore(visits, noShows int) int {
+	if visits < 0 {
+		visits = 0
+	}
+	if noShows <= 0 {
+		return 100
+	}
+	return (visits + 1) * 100 / (visits + noShows + 1)
+}
+
+type noShowPolicy struct {
+	ID                int    `json:"id"`
+	MinNoShows        int    `json:"minNoShows"`
+	Action            string `json:"action"`
+	AmountCents       int    `json:"amountCents"`
+	PerPerson         bool   `json:"perPerson"`
+	RefundCutoffHours int    `json:"refundCutoffHours"`
+	Active            bool   `json:"active"`
+}
+
+// noShowPolicyInput is a policy as sent by the backoffice; active defaults
+// to true when omitted.
+type noShowPolicyInput struct {
+	MinNoShows        int    `json:"minNoShows"`
+	Action            string `json:"action"`
+	AmountCents       int    `json:"amountCents"`
+	PerPerson         bool   `json:"perPerson"`
+	RefundCutoffHours *int   `json:"refundCutoffHours,omitempty"`
+	Active            *bool  `json:"active,omitempty"`
+}
+
+// normalizeNoShowPolicies validates a full policy list, sorted by threshold.
+// It returns a message for the first invalid policy.
+func normalizeNoShowPolicies(in []noShowPolicyInput) ([]noShowPolicy, string) {
+	out := make([]noShowPolicy, 0, len(in))
+	for _, item := range in {
+		p := noShowPolicy{
+			MinNoShows:        item.MinNoShows,
+			Action:            strings.ToLower(strings.TrimSpace(item.Action)),
+			AmountCents:       item.AmountCents,
+			PerPerson:         item.PerPerson,
+			RefundCutoffHours: 48,
+			Active:            true,
+		}
+		if item.RefundCutoffHours != nil {
+			p.RefundCutoffHours = *item.RefundCutoffHours
+		}
+		if item.Active != nil {
+			p.Active = *item.Active
+		}
+		if p.MinNoShows < 1 || p.MinNoShows > 100 {
+			return nil, "Numero de no presentados invalido"
+		}
+		for _, prev := range out {
+			if prev.MinNoShows == p.MinNoShows {
+				return nil, "Umbral repetido"
+			}
+		}
+		switch p.Action {
+		case noShowActionConfirm, noShowActionBlock:
+			p.AmountCents, p.PerPerson = 0, false
+		case noShowActionDeposit:
+			if p.AmountCents <= 0 || p.AmountCents > 1_000_000 {
+				return nil, "Importe invalido"
+			}
+			if p.RefundCutoffHours < 0 || p.RefundCutoffHours > 24*60 {
+				return nil, "Plazo de devolucion invalido"
+			}
+		default:
+			return nil, "Accion invalida"
+		}
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b noShowPolicy) int { return a.MinNoShows - b.MinNoShows })
+	return out, ""
+}
+
+// pickNoShowPolicy returns the active policy with the highest threshold the
+// guest reached.
+func pickNoShowPolicy(policies []noShowPolicy, noShows int) (noShowPolicy, bool) {
+	var (
+		best  noShowPolicy
+		found bool
+	)
+	for _, p := range policies {
+		if p.Active && noShows >= p.MinNoShows && (!found || p.MinNoShows > best.MinNoShows) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// depositRule is the deposit a 'deposit' policy imposes. It has no id: the
+// payment is not tied to a deposit_rules row.
+func (p noShowPolicy) depositRule() depositRule {
+	return depositRule{
+		Name:              "No presentados",
+		Kind:              depositKindDeposit,
+		AmountCents:       p.AmountCents,
+		PerPerson:         p.PerPerson,
+		RefundCutoffHours: p.RefundCutoffHours,
+		Active:            true,
+	}
+}
+
+func (s *Server) loadNoShowPolicies(ctx context.Context, q sqlQueryer, restaurantID int) ([]noShowPolicy, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, min_no_shows, action, COALESCE(amount_cents, 0), per_person, refund_cutoff_hours, is_active
+		FROM no_show_policies
+		WHERE restaurant_id = ?
+		ORDER BY min_no_shows ASC
+	`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []noShowPolicy{}
+	for rows.Next() {
+		var p noShowPolicy
+		if err := rows.Scan(&p.ID, &p.MinNoShows, &p.Action, &p.AmountCents, &p.PerPerson, &p.RefundCutoffHours, &p.Active); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// noShowPolicyFor returns the policy an online booking by id falls under.
+// A 'deposit' policy turns into 'confirm' when no payment provider is set
+// up, so the guest is still checked. Lookup failures are logged and let
+// the booking through: a broken policy must not stop every booking.
+func (s *Server) noShowPolicyFor(ctx context.Context, restaurantID int, id guestIdentity) (noShowPolicy, bool) {
+	guestID, _, err := findGuest(ctx, s.db, restaurantID, id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && !isSQLSchemaError(err) {
+			log.Printf("[no-shows] find guest: %v", err)
+		}
+		return noShowPolicy{}, false
+	}
+	var noShows int
+	if err := s.db.QueryRowContext(ctx, "SELECT no_show_count FROM guests WHERE id = ?", guestID).Scan(&noShows); err != nil {
+		log.Printf("[no-shows] load guest %d: %v", guestID, err)
+		return noShowPolicy{}, false
+	}
+	if noShows == 0 {
+		return noShowPolicy{}, false
+	}
+	policies, err := s.loadNoShowPolicies(ctx, s.db, restaurantID)
+	if err != nil {
+		if !isSQLSchemaError(err) {
+			log.Printf("[no-shows] load policies restaurant_id=%d: %v", restaurantID, err)
+		}
+		return noShowPolicy{}, false
+	}
+	p, ok := pickNoShowPolicy(policies, noShows)
+	if ok && p.Action == noShowActionDeposit && s.payments == nil {
+		p.Action = noShowActionConfirm
+	}
+	return p, ok
+}
+
+// setBookingAttendance marks whether the guest came ("" clears it), refreshes
+// the guest's counters and broadcasts the booking to the tables map. Only
+// bookings of today or earlier can be marked. It returns sql.ErrNoRows for
+// an unknown booking.
+func (s *Server) setBookingAttendance(r *http.Request, restaurantID, bookingID int, attendance string) (bookingSeatInfo, error) {
+	ctx := r.Context()
+	before, err := s.loadBookingSeatInfo(ctx, restaurantID, bookingID)
+	if err != nil {
+		return bookingSeatInfo{}, err
+	}
+	if attendance != "" && before.Date > time.Now().In(boMadridTZ).Format("2006-01-02") {
+		return bookingSeatInfo{}, errAttendanceTooEarly
+	}
+	if attendance == bookingAttendanceNoShow && before.State != nil {
+		return bookingSeatInfo{}, errAttendanceSeated
+	}
+	// attendance_at is assigned first: MySQL applies assignments in order.
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE bookings
+		SET attendance_at = IF(? IS NULL, NULL, IF(attendance <=> ?, attendance_at, NOW())), attendance = ?
+		WHERE restaurant_id = ? AND id = ?
+	`, nullableString(attendance), attendance, nullableString(attendance), restaurantID, bookingID); err != nil {
+		return bookingSeatInfo{}, err
+	}
+	after, err := s.loadBookingSeatInfo(ctx, restaurantID, bookingID)
+	if err != nil {
+		return bookingSeatInfo{}, err
+	}
+	s.recordBOAudit(r, boAuditEntry{Action: boAuditUpdate, Entity: "booking", EntityID: bookingID, Before: before, After: after})
+	s.refreshBookingGuestAsync(restaurantID, bookingID)
+	s.broadcastBOTablesEvent(restaurantID, "booking_state_changed", after)
+	return after, nil
+}
+
+// bookingAttendanceErrorMessage maps a setBookingAttendance error to a code
+// and message for staff. It returns empty strings for nil.
+func bookingAttendanceErrorMessage(err error) (string, string) {
+	switch {
+	case err == nil:
+		return "", ""
+	case errors.Is(err, sql.ErrNoRows):
+		return "NOT_FOUND", "Reserva no encontrada"
+	case errors.Is(err, errAttendanceTooEarly):
+		return "TOO_EARLY", "La reserva aun no ha llegado a su fecha"
+	case errors.Is(err, errAttendanceSeated):
+		return "ALREADY_SEATED", "La reserva ya esta en sala"
+	default:
+		return "ATTENDANCE_FAILED", "No se pudo guardar la asistencia"
+	}
+}
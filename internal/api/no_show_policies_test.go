@@ -0,0 +1,79 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuestReliabilityScore(t *testing.T) {
+	cases := []struct {
+		visits, noShows, want int
+	}{
+		{0, 0, 100},
+		{12, 0, 100},
+		{0, 1, 50},
+		{9, 1, 90},
+		{1, 3, 40},
+	}
+	for _, c := range cases {
+		if got := guestReliabilityScore(c.visits, c.noShows); got != c.want {
+			t.Errorf("guestReliabilityScore(%d, %d) = %d, want %d", c.visits, c.noShows, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeNoShowPolicies(t *testing.T) {
+	inactive := false
+	got, msg := normalizeNoShowPolicies([]noShowPolicyInput{
+		{MinNoShows: 3, Action: "Block"},
+		{MinNoShows: 1, Action: "deposit", AmountCents: 1000, PerPerson: true},
+		{MinNoShows: 2, Action: "confirm", AmountCents: 500, Active: &inactive},
+	})
+	if msg != "" {
+		t.Fatalf("normalizeNoShowPolicies() message = %q", msg)
+	}
+	if len(got) != 3 || got[0].MinNoShows != 1 || got[2].Action != noShowActionBlock {
+		t.Fatalf("policies = %+v", got)
+	}
+	if got[0].RefundCutoffHours != 48 || got[1].AmountCents != 0 || got[1].Active {
+		t.Fatalf("policies = %+v", got)
+	}
+
+	for _, bad := range [][]noShowPolicyInput{
+		{{MinNoShows: 0, Action: "block"}},
+		{{MinNoShows: 1, Action: "deposit"}},
+		{{MinNoShows: 1, Action: "ban"}},
+		{{MinNoShows: 2, Action: "block"}, {MinNoShows: 2, Action: "confirm"}},
+	} {
+		if _, msg := normalizeNoShowPolicies(bad); msg == "" {
+			t.Errorf("normalizeNoShowPolicies(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestPickNoShowPolicy(t *testing.T) {
+	policies := []noShowPolicy{
+		{MinNoShows: 1, Action: noShowActionConfirm, Active: true},
+		{MinNoShows: 2, Action: noShowActionDeposit, Active: false},
+		{MinNoShows: 3, Action: noShowActionBlock, Active: true},
+	}
+	if _, ok := pickNoShowPolicy(policies, 0); ok {
+		t.Fatal("policy picked for a guest without no-shows")
+	}
+	if p, _ := pickNoShowPolicy(policies, 2); p.Action != noShowActionConfirm {
+		t.Fatalf("2 no-shows: action = %q, want confirm (deposit is inactive)", p.Action)
+	}
+	if p, _ := pickNoShowPolicy(policies, 7); p.Action != noShowActionBlock {
+		t.Fatalf("7 no-shows: action = %q, want block", p.Action)
+	}
+}
+
+func TestBookingSeatStateSQLMarksArrived(t *testing.T) {
+	q := bookingSeatStateSQL(bookingSeatSeated)
+	if !strings.Contains(q, "attendance = 'arrived'") {
+		t.Fatalf("bookingSeatStateSQL(seated) = %q, does not mark the guest arrived", q)
+	}
+	if strings.Index(q, "attendance_at") > strings.Index(q, "attendance = ") {
+		t.Fatalf("bookingSeatStateSQL(seated) = %q, attendance_at must be set before attendance", q)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"preactvillacarmen/internal/config"
+)
+
+// paymentProvider takes deposits through a hosted checkout. Refs are the
+// provider's ids: the checkout session (ref) and, once paid, the payment it
+// produced (paymentRef), which refunds and captures act on.
+type paymentProvider interface {
+	Name() string
+	CreateCheckout(ctx context.Context, req paymentCheckoutRequest) (paymentCheckout, error)
+	// ExpireCheckout closes an unpaid checkout so it can't be paid late.
+	ExpireCheckout(ctx context.Context, ref string) error
+	// Refund sends idempotencyKey along so a retried request can't refund
+	// twice.
+	Refund(ctx context.Context, paymentRef string, amountCents int, idempotencyKey string) (refundRef string, err error)
+	// Release cancels an authorisation (card guarantee) without charging.
+	Release(ctx context.Context, paymentRef string) error
+	Capture(ctx context.Context, paymentRef string, amountCents int) error
+	// ParseWebhook verifies and decodes a provider callback. Events the
+	// reconciliation doesn't use come back with an empty Type.
+	ParseWebhook(payload []byte, header http.Header) (paymentEvent, error)
+}
+
+type paymentCheckoutRequest struct {
+	RestaurantID  int
+	BookingID     int
+	Kind          string
+	AmountCents   int
+	Currency      string
+	Description   string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	ExpiresAt     time.Time
+}
+
+type paymentCheckout struct {
+	Ref string
+	URL string
+}
+
+// Reconciliation event types.
+const (
+	paymentEventCompleted = "completed"
+	paymentEventExpired   = "expired"
+	paymentEventRefunded  = "refunded"
+)
+
+type paymentEvent struct {
+	ID          string
+	Type        string
+	Ref         string // checkout session
+	PaymentRef  string
+	AmountCents int
+}
+
+var errPaymentWebhookSignature = errors.New("invalid payment webhook signature")
+
+// paymentRejectedError is a provider answer that certainly moved no money
+// (e.g. a 4xx from Stripe). Any other error may have reached the provider.
+type paymentRejectedError struct{ err error }
+
+func (e *paymentRejectedError) Error() string { return e.err.Error() }
+func (e *paymentRejectedError) Unwrap() error { return e.err }
+
+func paymentRejected(err error) bool {
+	var rejected *paymentRejectedError
+	return errors.As(err, &rejected)
+}
+
+func newPaymentProvider(cfg config.Config) paymentProvider {
+	switch cfg.PaymentProvider {
+	case "stripe":
+		if cfg.StripeSecretKey == "" || cfg.StripeWebhookSecret == "" {
+			log.Printf("PAYMENT_PROVIDER=stripe needs STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET; deposits are disabled")
+			return nil
+		}
+		return newStripePaymentProvider(cfg.StripeSecretKey, cfg.StripeWebhookSecret)
+	case "fake":
+		return newFakePaymentProvider()
+	case "":
+		return nil
+	default:
+		log.Printf("unknown PAYMENT_PROVIDER %q; deposits are disabled", cfg.PaymentProvider)
+		return nil
+	}
+}
+
+// fakePaymentProvider keeps checkouts in memory and sends the guest straight
+// to the success URL. Webhooks are unsigned JSON
+// {"id","type","ref","paymentRef","amountCents"}, so it is only meant for
+// local development and tests.
+type fakePaymentProvider struct {
+	mu       sync.Mutex
+	next     int
+	Created  []paymentCheckoutRequest
+	Expired  []string
+	Refunds  map[string]int
+	Released []string
+	Captured map[string]int
+}
+
+func newFakePaymentProvider() *fakePaymentProvider {
+	return &fakePaymentProvider{Refunds: map[string]int{}, Captured: map[string]int{}}
+}
+
+func (p *fakePaymentProvider) Name() string { return "fake" }
+
+func (p *fakePaymentProvider) CreateCheckout(_ context.Context, req paymentCheckoutRequest) (paymentCheckout, error) {
+	if req.AmountCents <= 0 {
+		return paymentCheckout{}, errors.New("amount must be positive")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	p.Created = append(p.Created, req)
+	return paymentCheckout{Ref: "fake_cs_" + strconv.Itoa(p.next), URL: req.SuccessURL}, nil
+}
+
+func (p *fakePaymentProvider) ExpireCheckout(_ context.Context, ref string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Expired = append(p.Expired, ref)
+	return nil
+}
+
+func (p *fakePaymentProvider) Refund(_ context.Context, paymentRef string, amountCents int, _ string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Refunds[paymentRef] += amountCents
+	return "fake_re_" + paymentRef, nil
+}
+
+func (p *fakePaymentProvider) Release(_ context.Context, paymentRef string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Released = append(p.Released, paymentRef)
+	return nil
+}
+
+func (p *fakePaymentProvider) Capture(_ context.Context, paymentRef string, amountCents int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Captured[paymentRef] += amountCents
+	return nil
+}
+
+func (p *fakePaymentProvider) ParseWebhook(payload []byte, _ http.Header) (paymentEvent, error) {
+	var ev struct {
+		ID          string `json:"id"`
+		Type        string `json:"type"`
+		Ref         string `json:"ref"`
+		PaymentRef  string `json:"paymentRef"`
+		AmountCents int    `json:"amountCents"`
+	}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return paymentEvent{}, err
+	}
+	switch ev.Type {
+	case paymentEventCompleted, paymentEventExpired, paymentEventRefunded:
+	default:
+		ev.Type = ""
+	}
+	return paymentEvent{ID: ev.ID, Type: ev.Type, Ref: ev.Ref, PaymentRef: ev.PaymentRef, AmountCents: ev.AmountCents}, nil
+}
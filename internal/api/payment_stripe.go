@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIBaseURL         = "https://api.stripe.com"
+	stripeSignatureTolerance = 5 * time.Minute
+	// Stripe rejects checkout sessions that expire sooner than this.
+	stripeMinCheckoutTTL = 30 * time.Minute
+)
+
+// stripePaymentProvider uses Stripe Checkout. Guarantees are checkouts whose
+// payment intent is only authorised (capture_method=manual).
+type stripePaymentProvider struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+	now           func() time.Time
+}
+
+func newStripePaymentProvider(secretKey, webhookSecret string) *stripePaymentProvider {
+	return &stripePaymentProvider{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		baseURL:       stripeAPIBaseURL,
+		client:        &http.Client{Timeout: 20 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (p *stripePaymentProvider) Name() string { return "stripe" }
+
+// post sends a form-encoded request and decodes the JSON answer into out.
+func (p *stripePaymentProvider) post(ctx context.Context, path string, form url.Values, out any) error {
+	return p.postIdempotent(ctx, path, form, "", out)
+}
+
+// postIdempotent is post with an Idempotency-Key, so Stripe answers a
+// repeated request with the first result instead of acting again. 4xx
+// answers come back as paymentRejectedError, except 409 (the same key is
+// still being processed).
+func (p *stripePaymentProvider) postIdempotent(ctx context.Context, path string, form url.Values, idempotencyKey string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &apiErr)
+		err := fmt.Errorf("stripe %s: http %d: %s", path, resp.StatusCode, apiErr.Error.Message)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusConflict {
+			return &paymentRejectedError{err: err}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (p *stripePaymentProvider) CreateCheckout(ctx context.Context, req paymentCheckoutRequest) (paymentCheckout, error) {
+	expires := req.ExpiresAt
+	if min := p.now().Add(stripeMinCheckoutTTL); expires.Before(min) {
+		expires = min
+	}
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", strconv.Itoa(req.BookingID))
+	form.Set("expires_at", strconv.FormatInt(expires.Unix(), 10))
+	form.Set("metadata[restaurant_id]", strconv.Itoa(req.RestaurantID))
+	form.Set("metadata[booking_id]", strconv.Itoa(req.BookingID))
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", req.Currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.Itoa(req.AmountCents))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	if req.Kind == depositKindGuarantee {
+		form.Set("payment_intent_data[capture_method]", "manual")
+	}
+
+	var out struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := p.post(ctx, "/v1/checkout/sessions", form, &out); err != nil {
+		return paymentCheckout{}, err
+	}
+	return paymentCheckout{Ref: out.ID, URL: out.URL}, nil
+}
+
+func (p *stripePaymentProvider) ExpireCheckout(ctx context.Context, ref string) error {
+	return p.post(ctx, "/v1/checkout/sessions/"+url.PathEscape(ref)+"/expire", url.Values{}, nil)
+}
+
+func (p *stripePaymentProvider) Refund(ctx context.Context, paymentRef string, amountCents int, idempotencyKey string) (string, error) {
+	form := url.Values{}
+	form.Set("payment_intent", paymentRef)
+	form.Set("amount", strconv.Itoa(amountCents))
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := p.postIdempotent(ctx, "/v1/refunds", form, idempotencyKey, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+func (p *stripePaymentProvider) Release(ctx context.Context, paymentRef string) error {
+	return p.post(ctx, "/v1/payment_intents/"+url.PathEscape(paymentRef)+"/cancel", url.Values{}, nil)
+}
+
+func (p *stripePaymentProvider) Capture(ctx context.Context, paymentRef string, amountCents int) error {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.Itoa(amountCents))
+	return p.post(ctx, "/v1/payment_intents/"+url.PathEscape(paymentRef)+"/capture", form, nil)
+}
+
+// verifyStripeSignature checks a Stripe-Signature header ("t=<unix>,v1=<hex>,...")
+// against the payload.
+func verifyStripeSignature(secret string, payload []byte, header string, now time.Time) error {
+	var (
+		ts   int64
+		sigs []string
+	)
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if ts == 0 || len(sigs) == 0 || secret == "" {
+		return errPaymentWebhookSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > stripeSignatureTolerance || d < -stripeSignatureTolerance {
+		return errPaymentWebhookSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(payload)
+	want := hex.EncodeToString(mac.Sum(nil))
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return errPaymentWebhookSignature
+}
+
+func (p *stripePaymentProvider) ParseWebhook(payload []byte, header http.Header) (paymentEvent, error) {
+	if err := verifyStripeSignature(p.webhookSecret, payload, header.Get("Stripe-Signature"), p.now()); err != nil {
+		return paymentEvent{}, err
+	}
+	return parseStripeEvent(payload)
+}
+
+func parseStripeEvent(payload []byte) (paymentEvent, error) {
+	var ev struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID             string `json:"id"`
+				PaymentIntent  string `json:"payment_intent"`
+				AmountTotal    int    `json:"amount_total"`
+				AmountRefunded int    `json:"amount_refunded"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return paymentEvent{}, err
+	}
+	obj := ev.Data.Object
+	out := paymentEvent{ID: ev.ID}
+	switch ev.Type {
+	case "checkout.session.completed":
+		out.Type, out.Ref, out.PaymentRef, out.AmountCents = paymentEventCompleted, obj.ID, obj.PaymentIntent, obj.AmountTotal
+	case "checkout.session.expired":
+		out.Type, out.Ref = paymentEventExpired, obj.ID
+	case "charge.refunded":
+		out.Type, out.PaymentRef, out.AmountCents = paymentEventRefunded, obj.PaymentIntent, obj.AmountRefunded
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func stripeTestSignature(secret string, payload []byte, ts int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(payload)
+	return "t=" + strconv.FormatInt(ts, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1_800_000_000, 0)
+	header := stripeTestSignature("whsec_test", payload, now.Unix())
+
+	if err := verifyStripeSignature("whsec_test", payload, header, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := verifyStripeSignature("whsec_other", payload, header, now); !errors.Is(err, errPaymentWebhookSignature) {
+		t.Fatalf("wrong secret: err = %v", err)
+	}
+	if err := verifyStripeSignature("whsec_test", []byte(`{"id":"evt_2"}`), header, now); !errors.Is(err, errPaymentWebhookSignature) {
+		t.Fatalf("tampered payload: err = %v", err)
+	}
+	if err := verifyStripeSignature("whsec_test", payload, header, now.Add(10*time.Minute)); !errors.Is(err, errPaymentWebhookSignature) {
+		t.Fatalf("stale timestamp: err = %v", err)
+	}
+}
+
+func TestParseStripeEvent(t *testing.T) {
+	ev, err := parseStripeEvent([]byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_intent":"pi_1","amount_total":4000}}}`))
+	if err != nil {
+		t.Fatalf("parseStripeEvent() error = %v", err)
+	}
+	if ev.Type != paymentEventCompleted || ev.Ref != "cs_1" || ev.PaymentRef != "pi_1" || ev.AmountCents != 4000 {
+		t.Fatalf("completed event = %+v", ev)
+	}
+
+	ev, _ = parseStripeEvent([]byte(`{"id":"evt_2","type":"charge.refunded","data":{"object":{"id":"ch_1","payment_intent":"pi_1","amount_refunded":1500}}}`))
+	if ev.Type != paymentEventRefunded || ev.Ref != "" || ev.PaymentRef != "pi_1" || ev.AmountCents != 1500 {
+		t.Fatalf("refunded event = %+v", ev)
+	}
+
+	ev, _ = parseStripeEvent([]byte(`{"id":"evt_3","type":"customer.created","data":{"object":{"id":"cus_1"}}}`))
+	if ev.Type != "" {
+		t.Fatalf("unused event type = %q, want empty", ev.Type)
+	}
+}
+
+func TestFakePaymentProviderWebhook(t *testing.T) {
+	p := newFakePaymentProvider()
+	ev, err := p.ParseWebhook([]byte(`{"id":"1","type":"completed","ref":"fake_cs_1","paymentRef":"fake_pi_1"}`), nil)
+	if err != nil || ev.Type != paymentEventCompleted || ev.Ref != "fake_cs_1" || ev.PaymentRef != "fake_pi_1" {
+		t.Fatalf("ParseWebhook() = %+v, %v", ev, err)
+	}
+	ev, _ = p.ParseWebhook([]byte(`{"id":"2","type":"disputed"}`), nil)
+	if ev.Type != "" {
+		t.Fatalf("unknown type = %q, want empty", ev.Type)
+	}
+}
+
+func TestStripeRefundIdempotency(t *testing.T) {
+	var (
+		gotKey string
+		status int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Idempotency-Key")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"id":"re_1","error":{"message":"nope"}}`))
+	}))
+	defer srv.Close()
+	p := newStripePaymentProvider("sk_test", "whsec")
+	p.baseURL = srv.URL
+
+	key := paymentRefundIdempotencyKey(bookingPayment{ID: 12, RefundedCents: 500}, 1500)
+	status = http.StatusOK
+	if ref, err := p.Refund(context.Background(), "pi_1", 1500, key); err != nil || ref != "re_1" {
+		t.Fatalf("refund = %q, %v", ref, err)
+	}
+	if gotKey != "booking_payment_12_refund_500_1500" {
+		t.Fatalf("Idempotency-Key = %q", gotKey)
+	}
+
+	for code, rejected := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusConflict:            false,
+		http.StatusInternalServerError: false,
+	} {
+		status = code
+		_, err := p.Refund(context.Background(), "pi_1", 1500, key)
+		if err == nil || paymentRejected(err) != rejected {
+			t.Errorf("http %d: err = %v, rejected = %v", code, err, paymentRejected(err))
+		}
+	}
+}
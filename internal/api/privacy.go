@@ -0,0 +1,874 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	privacyRetentionPoll = time.Hour
+	// The retention job runs once a day, from this hour (Madrid) on.
+	privacyRetentionHour = 4
+	// Name left on scrubbed bookings, guests and invoices.
+	privacyAnonymizedName = "Anonimizado"
+	// Issued invoices are kept whole for this long whatever the settings say.
+	fiscalRetentionYears = 6
+)
+
+// privacySubject is the person a data request is about, identified by phone
+// and/or email.
+type privacySubject struct {
+	CountryCode string `json:"phoneCountryCode,omitempty"`
+	National    string `json:"phoneNational,omitempty"`
+	E164        string `json:"phoneE164,omitempty"`
+	Email       string `json:"email,omitempty"`
+}
+
+// newPrivacySubject normalises the phone and email staff typed in. It
+// returns a message when one of them is invalid or both are empty.
+func newPrivacySubject(countryCode, phone, email string) (privacySubject, string) {
+	id := newGuestIdentity("", countryCode, phone, email, "")
+	if strings.TrimSpace(phone) != "" && id.E164 == "" {
+		return privacySubject{}, "Telefono invalido"
+	}
+	if strings.TrimSpace(email) != "" && id.Email == "" {
+		return privacySubject{}, "Email invalido"
+	}
+	if id.empty() {
+		return privacySubject{}, "Indica un telefono o un email"
+	}
+	return privacySubject{CountryCode: id.CountryCode, National: id.National, E164: id.E164, Email: id.Email}, ""
+}
+
+// ref is a stable pseudonym for the subject, so the audit log can tell
+// requests about the same person apart without keeping their details.
+func (p privacySubject) ref() string {
+	sum := sha256.Sum256([]byte(p.E164 + "|" + p.Email))
+	return hex.EncodeToString(sum[:8])
+}
+
+// senderNumbers are the forms the WhatsApp bot stores a phone in.
+func (p privacySubject) senderNumbers() []any {
+	if p.E164 == "" {
+		return nil
+	}
+	return []any{p.E164, "+" + p.E164}
+}
+
+// privacyFilter is a WHERE condition and its arguments.
+type privacyFilter struct {
+	where string
+	args  []any
+}
+
+// match returns a condition on a table's phone and email columns. Phones
+// match as E.164 digits (with or without '+') or, when ccCol is set, as the
+// national number with that country code; without ccCol the national
+// number matches alone. Empty column names are skipped.
+func (p privacySubject) match(phoneCol, ccCol, emailCol string) privacyFilter {
+	var (
+		parts []string
+		args  []any
+	)
+	if phoneCol != "" && p.E164 != "" {
+		parts = append(parts, phoneCol+" IN (?, ?)")
+		args = append(args, p.E164, "+"+p.E164)
+		if ccCol != "" {
+			parts = append(parts, "("+ccCol+" = ? AND "+phoneCol+" = ?)")
+			args = append(args, p.CountryCode, p.National)
+		} else {
+			parts = append(parts, phoneCol+" = ?")
+			args = append(args, p.National)
+		}
+	}
+	if emailCol != "" && p.Email != "" {
+		parts = append(parts, "LOWER(TRIM("+emailCol+")) = ?")
+		args = append(args, p.Email)
+	}
+	if len(parts) == 0 {
+		return privacyFilter{where: "1 = 0"}
+	}
+	return privacyFilter{where: "(" + strings.Join(parts, " OR ") + ")", args: args}
+}
+
+// privacyScope holds, per table, the condition selecting a subject's rows
+// in one restaurant.
+type privacyScope struct {
+	guests        privacyFilter
+	bookings      privacyFilter
+	cancelled     privacyFilter
+	waitlist      privacyFilter
+	invoices      privacyFilter
+	conversations privacyFilter
+	deliveries    privacyFilter
+	members       privacyFilter
+}
+
+func scoped(restaurantID int, f privacyFilter) privacyFilter {
+	return privacyFilter{where: "restaurant_id = ? AND " + f.where, args: append([]any{restaurantID}, f.args...)}
+}
+
+func orGuestIDs(f privacyFilter, guestIDs []int) privacyFilter {
+	if len(guestIDs) == 0 {
+		return f
+	}
+	args := append([]any{}, f.args...)
+	for _, id := range guestIDs {
+		args = append(args, id)
+	}
+	return privacyFilter{
+		where: "(" + f.where + " OR guest_id IN (" + sqlPlaceholders(len(guestIDs)) + "))",
+		args:  args,
+	}
+}
+
+func sqlPlaceholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// privacyScopeFor builds the per-table conditions for a subject. guestIDs
+// are the guest profiles found for them; bookings linked to those match
+// even when their own contact details differ.
+func privacyScopeFor(restaurantID int, p privacySubject, guestIDs []int) privacyScope {
+	guests := privacyFilter{where: "1 = 0"}
+	if len(guestIDs) > 0 {
+		guests = privacyFilter{where: "id IN (" + sqlPlaceholders(len(guestIDs)) + ")"}
+		for _, id := range guestIDs {
+			guests.args = append(guests.args, id)
+		}
+	}
+
+	conversations := privacyFilter{where: "1 = 0"}
+	if senders := p.senderNumbers(); len(senders) > 0 {
+		conversations = privacyFilter{where: "sender_number IN (?, ?)", args: senders}
+	}
+
+	var (
+		deliveryParts []string
+		deliveryArgs  []any
+	)
+	for _, v := range []string{p.E164, p.National, p.Email} {
+		if v == "" {
+			continue
+		}
+		deliveryParts = append(deliveryParts, "JSON_SEARCH(payload_json, 'one', ?) IS NOT NULL")
+		deliveryArgs = append(deliveryArgs, v)
+	}
+	recipient := p.match("recipient", "", "recipient")
+	deliveries := privacyFilter{
+		where: "(" + strings.Join(append([]string{recipient.where}, deliveryParts...), " OR ") + ")",
+		args:  append(recipient.args, deliveryArgs...),
+	}
+
+	return privacyScope{
+		guests:        scoped(restaurantID, guests),
+		bookings:      scoped(restaurantID, orGuestIDs(p.match("contact_phone", "contact_phone_country_code", "contact_email"), guestIDs)),
+		cancelled:     scoped(restaurantID, orGuestIDs(p.match("contact_phone", "", "contact_email"), guestIDs)),
+		waitlist:      scoped(restaurantID, p.match("contact_phone", "contact_phone_country_code", "contact_email")),
+		invoices:      scoped(restaurantID, p.match("customer_phone", "", "customer_email")),
+		conversations: scoped(restaurantID, conversations),
+		deliveries:    scoped(restaurantID, deliveries),
+		members:       scoped(restaurantID, p.match("phone", "", "email")),
+	}
+}
+
+// privacyGuestIDs returns the guest profiles of a subject, including guests
+// merged into or from them.
+func (s *Server) privacyGuestIDs(ctx context.Context, restaurantID int, p privacySubject) ([]int, error) {
+	var (
+		parts []string
+		args  = []any{restaurantID}
+	)
+	if p.E164 != "" {
+		parts = append(parts, "phone_e164 = ?")
+		args = append(args, p.E164)
+	}
+	if p.Email != "" {
+		parts = append(parts, "email = ?")
+		args = append(args, p.Email)
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT id, COALESCE(merged_into_id, 0) FROM guests WHERE restaurant_id = ? AND ("+strings.Join(parts, " OR ")+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[int]bool{}
+	ids := []int{}
+	add := func(id int) {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for rows.Next() {
+		var id, mergedInto int
+		if err := rows.Scan(&id, &mergedInto); err != nil {
+			return nil, err
+		}
+		add(id)
+		add(mergedInto)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	args = []any{restaurantID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	merged, err := s.db.QueryContext(ctx, "SELECT id FROM guests WHERE restaurant_id = ? AND merged_into_id IN ("+sqlPlaceholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer merged.Close()
+	for merged.Next() {
+		var id int
+		if err := merged.Scan(&id); err != nil {
+			return nil, err
+		}
+		add(id)
+	}
+	return ids, merged.Err()
+}
+
+func (s *Server) loadPrivacyScope(ctx context.Context, restaurantID int, p privacySubject) (privacyScope, error) {
+	guestIDs, err := s.privacyGuestIDs(ctx, restaurantID, p)
+	if err != nil && !isSQLSchemaError(err) {
+		return privacyScope{}, err
+	}
+	return privacyScopeFor(restaurantID, p, guestIDs), nil
+}
+
+// exportPrivacySubject gathers every row held about a subject, table by
+// table. Tables missing from older schemas come back empty.
+func (s *Server) exportPrivacySubject(ctx context.Context, restaurantID int, p privacySubject) (map[string][]map[string]any, error) {
+	scope, err := s.loadPrivacyScope(ctx, restaurantID, p)
+	if err != nil {
+		return nil, err
+	}
+	sections := []struct {
+		key   string
+		query string
+		f     privacyFilter
+	}{
+		{"guests", "SELECT * FROM guests WHERE ", scope.guests},
+		{"marketingConsents", "SELECT * FROM marketing_consents WHERE ", privacyFilter{where: "guest_id IN (SELECT id FROM guests WHERE " + scope.guests.where + ")", args: scope.guests.args}},
+		{"bookings", "SELECT * FROM bookings WHERE ", scope.bookings},
+		{"bookingPayments", "SELECT * FROM booking_payments WHERE ", privacyFilter{where: "booking_id IN (SELECT id FROM bookings WHERE " + scope.bookings.where + ")", args: scope.bookings.args}},
+		{"cancelledBookings", "SELECT * FROM cancelled_bookings WHERE ", scope.cancelled},
+		{"waitlist", "SELECT * FROM waitlist_entries WHERE ", scope.waitlist},
+		{"invoices", "SELECT * FROM invoices WHERE ", scope.invoices},
+		{"conversationMessages", "SELECT * FROM conversation_messages WHERE ", scope.conversations},
+		{"conversationSessions", "SELECT * FROM conversation_sessions WHERE ", scope.conversations},
+		{"conversationStates", "SELECT * FROM conversation_states WHERE ", scope.conversations},
+		{"messageDeliveries", "SELECT * FROM message_deliveries WHERE ", scope.deliveries},
+		{"members", "SELECT * FROM restaurant_members WHERE ", scope.members},
+	}
+
+	out := make(map[string][]map[string]any, len(sections))
+	for _, sec := range sections {
+		rows, err := s.queryAllAsMaps(ctx, sec.query+sec.f.where, sec.f.args...)
+		if err != nil {
+			if !isSQLSchemaError(err) {
+				return nil, err
+			}
+			rows = []map[string]any{}
+		}
+		out[sec.key] = rows
+	}
+	return out, nil
+}
+
+// privacyAuditTarget lists the IDs of one audit_log entity whose
+// before/after snapshots copy a subject's personal data.
+type privacyAuditTarget struct {
+	entity string
+	query  string
+	args   []any
+}
+
+// privacyAuditIDs runs the targets and groups the IDs found by entity.
+// Missing legacy tables are skipped.
+func privacyAuditIDs(ctx context.Context, tx *sql.Tx, targets []privacyAuditTarget) (map[string][]int, error) {
+	ids := map[string][]int{}
+	for _, t := range targets {
+		rows, err := tx.QueryContext(ctx, t.query, t.args...)
+		if err != nil {
+			if isSQLSchemaError(err) {
+				continue
+			}
+			return nil, err
+		}
+		for rows.Next() {
+			var id sql.NullInt64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if id.Valid && id.Int64 > 0 {
+				ids[t.entity] = append(ids[t.entity], int(id.Int64))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// privacyAuditFilter selects a restaurant's audit_log rows about the given
+// entity IDs.
+func privacyAuditFilter(restaurantID int, ids map[string][]int) privacyFilter {
+	entities := make([]string, 0, len(ids))
+	for entity, list := range ids {
+		if len(list) > 0 {
+			entities = append(entities, entity)
+		}
+	}
+	if len(entities) == 0 {
+		return scoped(restaurantID, privacyFilter{where: "1 = 0"})
+	}
+	sort.Strings(entities)
+
+	var (
+		parts []string
+		args  []any
+	)
+	for _, entity := range entities {
+		parts = append(parts, "(entity = ? AND entity_id IN ("+sqlPlaceholders(len(ids[entity]))+"))")
+		args = append(args, entity)
+		for _, id := range ids[entity] {
+			args = append(args, strconv.Itoa(id))
+		}
+	}
+	return scoped(restaurantID, privacyFilter{where: "(" + strings.Join(parts, " OR ") + ")", args: args})
+}
+
+// privacyAnonymiseResult counts the rows scrubbed or deleted for a subject.
+type privacyAnonymiseResult struct {
+	Guests               int64 `json:"guests"`
+	Bookings             int64 `json:"bookings"`
+	CancelledBookings    int64 `json:"cancelledBookings"`
+	Waitlist             int64 `json:"waitlist"`
+	ConversationMessages int64 `json:"conversationMessages"`
+	ConversationSessions int64 `json:"conversationSessions"`
+	ConversationStates   int64 `json:"conversationStates"`
+	MessageDeliveries    int64 `json:"messageDeliveries"`
+	Invoices             int64 `json:"invoices"`
+	// Issued invoices still inside the fiscal retention period; kept whole.
+	InvoicesRetained int64 `json:"invoicesRetained"`
+	Members          int64 `json:"members"`
+	// Active members are left alone: deactivate them first.
+	MembersActive int64 `json:"membersActive"`
+	// Audit entries whose snapshots held the subject's data.
+	AuditLog int64 `json:"auditLog"`
+}
+
+// Column updates shared by subject requests and the retention job.
+const (
+	privacyGuestScrubSQL = `
+		UPDATE guests g
+		SET name = ?, phone_e164 = NULL, phone_country_code = NULL, phone_national = NULL, email = NULL,
+			birthday = NULL, tags = NULL, allergies = NULL, notes = NULL, marketing_email_at = NULL, marketing_whatsapp_at = NULL,
+			anonymized_at = NOW()
+		WHERE `
+	privacyBookingScrubSQL = `
+		UPDATE bookings
+		SET customer_name = ?, contact_phone = NULL, contact_email = '', commentary = NULL, anonymized_at = NOW()
+		WHERE `
+	privacyCancelledScrubSQL = `
+		UPDATE cancelled_bookings
+		SET customer_name = ?, contact_phone = '', contact_email = '', commentary = '', anonymized_at = NOW()
+		WHERE `
+	privacyInvoiceScrubSQL = `
+		UPDATE invoices
+		SET customer_name = ?, customer_surname = NULL, customer_email = '', customer_dni_cif = NULL, customer_phone = NULL,
+			customer_address_street = NULL, customer_address_number = NULL, customer_address_postal_code = NULL,
+			customer_address_city = NULL, customer_address_province = NULL, customer_address_country = NULL,
+			reservation_customer_name = NULL, account_image_url = NULL, pdf_url = NULL, anonymized_at = NOW()
+		WHERE `
+	// Names stay: time entries must remain attributable to the member.
+	privacyMemberScrubSQL = `
+		UPDATE restaurant_members
+		SET email = NULL, dni = NULL, bank_account = NULL, phone = NULL, photo_url = NULL, anonymized_at = NOW()
+		WHERE `
+)
+
+// privacyStep is one scrub or delete and the counter it reports into.
+type privacyStep struct {
+	n     *int64
+	query string
+	args  []any
+}
+
+// execPrivacy runs one scrub or delete and returns the rows it touched.
+// Missing legacy tables count as nothing to do.
+func execPrivacy(ctx context.Context, q boSQLExecutor, query string, args ...any) (int64, error) {
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		if isSQLSchemaError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// invoiceFileURLs returns the stored PDFs and receipt images of the
+// invoices matching where, so they can be removed once scrubbed.
+func invoiceFileURLs(ctx context.Context, tx *sql.Tx, where string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT COALESCE(pdf_url, ''), COALESCE(account_image_url, '') FROM invoices WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	urls := []string{}
+	for rows.Next() {
+		var pdf, img string
+		if err := rows.Scan(&pdf, &img); err != nil {
+			return nil, err
+		}
+		for _, u := range []string{pdf, img} {
+			if strings.TrimSpace(u) != "" {
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls, rows.Err()
+}
+
+// anonymisePrivacySubject scrubs a subject's details from guests, bookings,
+// cancellations and invoices and deletes their waitlist entries,
+// conversations, message deliveries and the audit entries about any of
+// those rows, in one transaction. Issued invoices younger than the fiscal
+// retention period and active members are counted but left as they are.
+func (s *Server) anonymisePrivacySubject(ctx context.Context, restaurantID int, p privacySubject) (privacyAnonymiseResult, error) {
+	var out privacyAnonymiseResult
+	scope, err := s.loadPrivacyScope(ctx, restaurantID, p)
+	if err != nil {
+		return out, err
+	}
+	retention, err := s.loadPrivacyRetention(ctx, restaurantID)
+	if err != nil {
+		return out, err
+	}
+	invoiceCutoff := time.Now().In(boMadridTZ).AddDate(-max(retention.InvoiceYears, fiscalRetentionYears), 0, 0).Format("2006-01-02")
+	invoiceScrubbable := scope.invoices.where + " AND (issued_at IS NULL OR invoice_date < ?)"
+	invoiceArgs := append(append([]any{}, scope.invoices.args...), invoiceCutoff)
+
+	var files []string
+	err = withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		// Collected first: the waitlist entries are about to be deleted.
+		auditIDs, err := privacyAuditIDs(ctx, tx, []privacyAuditTarget{
+			{"booking", "SELECT id FROM bookings WHERE " + scope.bookings.where, scope.bookings.args},
+			{"booking", "SELECT booking_id FROM cancelled_bookings WHERE " + scope.cancelled.where, scope.cancelled.args},
+			{"booking_payment", "SELECT id FROM booking_payments WHERE booking_id IN (SELECT id FROM bookings WHERE " + scope.bookings.where + ")", scope.bookings.args},
+			{"guest", "SELECT id FROM guests WHERE " + scope.guests.where, scope.guests.args},
+			{"waitlist", "SELECT id FROM waitlist_entries WHERE " + scope.waitlist.where, scope.waitlist.args},
+			{"invoice", "SELECT id FROM invoices WHERE " + invoiceScrubbable, invoiceArgs},
+			{"member", "SELECT id FROM restaurant_members WHERE " + scope.members.where + " AND is_active = 0", scope.members.args},
+		})
+		if err != nil {
+			return err
+		}
+		audit := privacyAuditFilter(restaurantID, auditIDs)
+
+		steps := []privacyStep{
+			{&out.Guests, privacyGuestScrubSQL + scope.guests.where, append([]any{privacyAnonymizedName}, scope.guests.args...)},
+			{&out.Bookings, privacyBookingScrubSQL + scope.bookings.where, append([]any{privacyAnonymizedName}, scope.bookings.args...)},
+			{&out.CancelledBookings, privacyCancelledScrubSQL + scope.cancelled.where, append([]any{privacyAnonymizedName}, scope.cancelled.args...)},
+			{&out.Waitlist, "DELETE FROM waitlist_entries WHERE " + scope.waitlist.where, scope.waitlist.args},
+			{&out.ConversationMessages, "DELETE FROM conversation_messages WHERE " + scope.conversations.where, scope.conversations.args},
+			{&out.ConversationSessions, "DELETE FROM conversation_sessions WHERE " + scope.conversations.where, scope.conversations.args},
+			{&out.ConversationStates, "DELETE FROM conversation_states WHERE " + scope.conversations.where, scope.conversations.args},
+			{&out.MessageDeliveries, "DELETE FROM message_deliveries WHERE " + scope.deliveries.where, scope.deliveries.args},
+			{&out.Members, privacyMemberScrubSQL + scope.members.where + " AND is_active = 0", scope.members.args},
+			{&out.AuditLog, "DELETE FROM audit_log WHERE " + audit.where, audit.args},
+		}
+		for _, st := range steps {
+			n, err := execPrivacy(ctx, tx, st.query, st.args...)
+			if err != nil {
+				return err
+			}
+			*st.n = n
+		}
+
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM restaurant_members WHERE "+scope.members.where+" AND is_active = 1",
+			scope.members.args...).Scan(&out.MembersActive); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM invoices WHERE "+scope.invoices.where+" AND issued_at IS NOT NULL AND invoice_date >= ?",
+			invoiceArgs...).Scan(&out.InvoicesRetained); err != nil {
+			return err
+		}
+		files, err = invoiceFileURLs(ctx, tx, invoiceScrubbable, invoiceArgs...)
+		if err != nil {
+			return err
+		}
+		out.Invoices, err = execPrivacy(ctx, tx, privacyInvoiceScrubSQL+invoiceScrubbable, append([]any{privacyAnonymizedName}, invoiceArgs...)...)
+		return err
+	})
+	if err != nil {
+		return privacyAnonymiseResult{}, err
+	}
+	s.deleteInvoiceFiles(ctx, files)
+	return out, nil
+}
+
+// deleteInvoiceFiles removes scrubbed invoices' files from storage. The rows
+// no longer point at them, so failures are only logged.
+func (s *Server) deleteInvoiceFiles(ctx context.Context, urls []string) {
+	for _, u := range urls {
+		if err := s.bunnyDeleteURL(ctx, u); err != nil {
+			log.Printf("[privacy] delete %s: %v", u, err)
+		}
+	}
+}
+
+// privacyRetention holds a restaurant's retention periods. 0 turns a purge
+// off.
+type privacyRetention struct {
+	BookingMonths      int `json:"bookingMonths"`
+	ConversationDays   int `json:"conversationDays"`
+	DeliveryDays       int `json:"deliveryDays"`
+	FormerMemberMonths int `json:"formerMemberMonths"`
+	InvoiceYears       int `json:"invoiceYears"`
+}
+
+func defaultPrivacyRetention() privacyRetention {
+	return privacyRetention{
+		BookingMonths:      36,
+		ConversationDays:   90,
+		DeliveryDays:       365,
+		FormerMemberMonths: 48,
+		InvoiceYears:       fiscalRetentionYears,
+	}
+}
+
+// validate returns a message for the first period out of range.
+func (r privacyRetention) validate() string {
+	checks := []struct {
+		v, min, max int
+		msg         string
+	}{
+		{r.BookingMonths, 6, 240, "Plazo de reservas invalido"},
+		{r.ConversationDays, 7, 3650, "Plazo de conversaciones invalido"},
+		{r.DeliveryDays, 30, 3650, "Plazo de envios invalido"},
+		{r.FormerMemberMonths, 12, 240, "Plazo de antiguos miembros invalido"},
+		{r.InvoiceYears, fiscalRetentionYears, 30, "Plazo de facturas invalido (minimo 6 anos)"},
+	}
+	for _, c := range checks {
+		if c.v != 0 && (c.v < c.min || c.v > c.max) {
+			return c.msg
+		}
+	}
+	return ""
+}
+
+// privacyCutoffs are the dates before which each kind of data is purged.
+// Zero means that purge is off.
+type privacyCutoffs struct {
+	Bookings      time.Time
+	Conversations time.Time
+	Deliveries    time.Time
+	Members       time.Time
+	Invoices      time.Time
+}
+
+func (r privacyRetention) cutoffs(now time.Time) privacyCutoffs {
+	var c privacyCutoffs
+	if r.BookingMonths > 0 {
+		c.Bookings = now.AddDate(0, -r.BookingMonths, 0)
+	}
+	if r.ConversationDays > 0 {
+		c.Conversations = now.AddDate(0, 0, -r.ConversationDays)
+	}
+	if r.DeliveryDays > 0 {
+		c.Deliveries = now.AddDate(0, 0, -r.DeliveryDays)
+	}
+	if r.FormerMemberMonths > 0 {
+		c.Members = now.AddDate(0, -r.FormerMemberMonths, 0)
+	}
+	if r.InvoiceYears > 0 {
+		c.Invoices = now.AddDate(-max(r.InvoiceYears, fiscalRetentionYears), 0, 0)
+	}
+	return c
+}
+
+// privacyRetentionSettings is a restaurant's saved periods, or the defaults
+// when it hasn't configured any (the job then skips it).
+type privacyRetentionSettings struct {
+	privacyRetention
+	Configured bool            `json:"configured"`
+	LastRunAt  *string         `json:"lastRunAt"`
+	LastRun    json.RawMessage `json:"lastRun"`
+}
+
+func (s *Server) loadPrivacyRetention(ctx context.Context, restaurantID int) (privacyRetentionSettings, error) {
+	out := privacyRetentionSettings{privacyRetention: defaultPrivacyRetention()}
+	var (
+		lastRunAt sql.NullTime
+		lastRun   sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT booking_months, conversation_days, delivery_days, former_member_months, invoice_years, last_run_at, last_run_json
+		FROM privacy_retention_settings
+		WHERE restaurant_id = ?
+	`, restaurantID).Scan(&out.BookingMonths, &out.ConversationDays, &out.DeliveryDays, &out.FormerMemberMonths,
+		&out.InvoiceYears, &lastRunAt, &lastRun)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) || isSQLSchemaError(err):
+		return out, nil
+	case err != nil:
+		return out, err
+	}
+	out.Configured = true
+	out.LastRunAt = formatNullTimeRFC3339(lastRunAt)
+	if lastRun.Valid && lastRun.String != "" {
+		out.LastRun = json.RawMessage(lastRun.String)
+	}
+	return out, nil
+}
+
+func (s *Server) savePrivacyRetention(ctx context.Context, restaurantID int, r privacyRetention) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO privacy_retention_settings
+			(restaurant_id, booking_months, conversation_days, delivery_days, former_member_months, invoice_years)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			booking_months = VALUES(booking_months),
+			conversation_days = VALUES(conversation_days),
+			delivery_days = VALUES(delivery_days),
+			former_member_months = VALUES(former_member_months),
+			invoice_years = VALUES(invoice_years)
+	`, restaurantID, r.BookingMonths, r.ConversationDays, r.DeliveryDays, r.FormerMemberMonths, r.InvoiceYears)
+	return err
+}
+
+// privacyPurgeResult counts the rows one retention run scrubbed or deleted.
+type privacyPurgeResult struct {
+	Bookings             int64 `json:"bookings"`
+	CancelledBookings    int64 `json:"cancelledBookings"`
+	Waitlist             int64 `json:"waitlist"`
+	Guests               int64 `json:"guests"`
+	ConversationMessages int64 `json:"conversationMessages"`
+	ConversationSessions int64 `json:"conversationSessions"`
+	ConversationStates   int64 `json:"conversationStates"`
+	MessageDeliveries    int64 `json:"messageDeliveries"`
+	Members              int64 `json:"members"`
+	Invoices             int64 `json:"invoices"`
+	AuditLog             int64 `json:"auditLog"`
+}
+
+// Audit entities whose snapshots copy guest data, purged with the bookings.
+var privacyAuditBookingEntities = []any{"booking", "booking_payment", "guest", "waitlist"}
+
+// purgePersonalData applies a restaurant's retention periods and records
+// the run. Each purge is its own statement: a failure stops the run but
+// keeps what was already done, and the next run picks up the rest.
+func (s *Server) purgePersonalData(ctx context.Context, restaurantID int, r privacyRetention) (privacyPurgeResult, error) {
+	var out privacyPurgeResult
+	c := r.cutoffs(time.Now().In(boMadridTZ))
+
+	var runErr error
+	for _, st := range privacyPurgeSteps(restaurantID, c, &out) {
+		n, err := execPrivacy(ctx, s.db, st.query, st.args...)
+		if err != nil {
+			runErr = err
+			break
+		}
+		*st.n += n
+	}
+	if runErr == nil && !c.Invoices.IsZero() {
+		out.Invoices, runErr = s.purgeInvoices(ctx, restaurantID, c.Invoices.Format("2006-01-02"))
+	}
+
+	summary, _ := json.Marshal(out)
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE privacy_retention_settings SET last_run_at = NOW(), last_run_json = ? WHERE restaurant_id = ?
+	`, string(summary), restaurantID); err != nil && runErr == nil {
+		runErr = err
+	}
+	return out, runErr
+}
+
+// privacyPurgeSteps lists the statements of a retention run, counting into
+// out. Invoices are purged apart, see purgeInvoices. Audit entries go with
+// the data their snapshots copy: booking, guest and waitlist entries after
+// the booking period, former members' after theirs, invoices' after the
+// invoice period.
+func privacyPurgeSteps(restaurantID int, c privacyCutoffs, out *privacyPurgeResult) []privacyStep {
+	day := func(t time.Time) string { return t.Format("2006-01-02") }
+	stamp := func(t time.Time) string { return t.Format("2006-01-02 15:04:05") }
+
+	var steps []privacyStep
+	if !c.Bookings.IsZero() {
+		cutoff := day(c.Bookings)
+		steps = append(steps,
+			privacyStep{&out.Bookings, privacyBookingScrubSQL + "restaurant_id = ? AND anonymized_at IS NULL AND reservation_date < ?",
+				[]any{privacyAnonymizedName, restaurantID, cutoff}},
+			privacyStep{&out.CancelledBookings, privacyCancelledScrubSQL + "restaurant_id = ? AND anonymized_at IS NULL AND reservation_date < ?",
+				[]any{privacyAnonymizedName, restaurantID, cutoff}},
+			privacyStep{&out.Waitlist, "DELETE FROM waitlist_entries WHERE restaurant_id = ? AND reservation_date < ?",
+				[]any{restaurantID, cutoff}},
+			// Guests (merged ones through the guest they were merged into)
+			// with no booking or cancellation since the cutoff.
+			privacyStep{&out.Guests, privacyGuestScrubSQL + `
+				g.restaurant_id = ? AND g.anonymized_at IS NULL AND g.created_at < ?
+				AND NOT EXISTS (
+					SELECT 1 FROM bookings b
+					WHERE b.restaurant_id = g.restaurant_id AND b.guest_id = COALESCE(g.merged_into_id, g.id) AND b.reservation_date >= ?
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM cancelled_bookings cb
+					WHERE cb.restaurant_id = g.restaurant_id AND cb.guest_id = COALESCE(g.merged_into_id, g.id) AND cb.reservation_date >= ?
+				)`,
+				[]any{privacyAnonymizedName, restaurantID, cutoff, cutoff, cutoff}},
+			privacyStep{&out.AuditLog, "DELETE FROM audit_log WHERE restaurant_id = ? AND created_at < ? AND entity IN (" +
+				sqlPlaceholders(len(privacyAuditBookingEntities)) + ")",
+				append([]any{restaurantID, cutoff}, privacyAuditBookingEntities...)},
+		)
+	}
+	if !c.Conversations.IsZero() {
+		cutoff := stamp(c.Conversations)
+		steps = append(steps,
+			privacyStep{&out.ConversationMessages, "DELETE FROM conversation_messages WHERE restaurant_id = ? AND created_at < ?",
+				[]any{restaurantID, cutoff}},
+			privacyStep{&out.ConversationSessions, "DELETE FROM conversation_sessions WHERE restaurant_id = ? AND last_activity_at < ?",
+				[]any{restaurantID, cutoff}},
+			privacyStep{&out.ConversationStates, "DELETE FROM conversation_states WHERE restaurant_id = ? AND updated_at < ? AND (expires_at IS NULL OR expires_at < NOW())",
+				[]any{restaurantID, cutoff}},
+		)
+	}
+	if !c.Deliveries.IsZero() {
+		steps = append(steps, privacyStep{&out.MessageDeliveries,
+			"DELETE FROM message_deliveries WHERE restaurant_id = ? AND status IN ('sent', 'failed') AND created_at < ?",
+			[]any{restaurantID, stamp(c.Deliveries)}})
+	}
+	if !c.Members.IsZero() {
+		cutoff := stamp(c.Members)
+		steps = append(steps,
+			privacyStep{&out.Members,
+				privacyMemberScrubSQL + "restaurant_id = ? AND is_active = 0 AND anonymized_at IS NULL AND updated_at < ?",
+				[]any{restaurantID, cutoff}},
+			privacyStep{&out.AuditLog, `
+				DELETE FROM audit_log
+				WHERE restaurant_id = ? AND entity = 'member' AND created_at < ?
+					AND entity_id IN (SELECT CAST(id AS CHAR) FROM restaurant_members WHERE restaurant_id = ? AND is_active = 0)`,
+				[]any{restaurantID, cutoff, restaurantID}},
+		)
+	}
+	if !c.Invoices.IsZero() {
+		steps = append(steps, privacyStep{&out.AuditLog,
+			"DELETE FROM audit_log WHERE restaurant_id = ? AND entity = 'invoice' AND created_at < ?",
+			[]any{restaurantID, day(c.Invoices)}})
+	}
+	return steps
+}
+
+// purgeInvoices scrubs customer details from invoices dated before cutoff
+// and removes their files.
+func (s *Server) purgeInvoices(ctx context.Context, restaurantID int, cutoff string) (int64, error) {
+	where := "restaurant_id = ? AND anonymized_at IS NULL AND invoice_date < ?"
+	var (
+		n     int64
+		files []string
+	)
+	err := withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		files, err = invoiceFileURLs(ctx, tx, where, restaurantID, cutoff)
+		if err != nil {
+			return err
+		}
+		n, err = execPrivacy(ctx, tx, privacyInvoiceScrubSQL+where, privacyAnonymizedName, restaurantID, cutoff)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.deleteInvoiceFiles(ctx, files)
+	return n, nil
+}
+
+// runPrivacyRetentionLoop applies every configured restaurant's retention
+// periods once a day, early in the morning.
+func (s *Server) runPrivacyRetentionLoop(ctx context.Context) {
+	t := time.NewTicker(privacyRetentionPoll)
+	defer t.Stop()
+	lastDay := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			now := time.Now().In(boMadridTZ)
+			today := now.Format("2006-01-02")
+			if today == lastDay || now.Hour() < privacyRetentionHour {
+				continue
+			}
+			if err := s.runPrivacyRetention(ctx); err != nil {
+				if !isSQLSchemaError(err) {
+					log.Printf("[privacy] retention run: %v", err)
+				}
+				continue
+			}
+			lastDay = today
+		}
+	}
+}
+
+func (s *Server) runPrivacyRetention(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT restaurant_id, booking_months, conversation_days, delivery_days, former_member_months, invoice_years
+		FROM privacy_retention_settings
+	`)
+	if err != nil {
+		return err
+	}
+	type restaurantRetention struct {
+		id int
+		r  privacyRetention
+	}
+	var list []restaurantRetention
+	for rows.Next() {
+		var rr restaurantRetention
+		if err := rows.Scan(&rr.id, &rr.r.BookingMonths, &rr.r.ConversationDays, &rr.r.DeliveryDays,
+			&rr.r.FormerMemberMonths, &rr.r.InvoiceYears); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, rr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rr := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := s.purgePersonalData(ctx, rr.id, rr.r); err != nil {
+			log.Printf("[privacy] retention restaurant_id=%d: %v", rr.id, err)
+		}
+	}
+	return nil
+}
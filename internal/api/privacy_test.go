@@ -0,0 +1,183 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPrivacySubject(t *testing.T) {
+	p, msg := newPrivacySubject("34", "600 11 22 33", " Ana@Example.com ")
+	if msg != "" {
+		t.Fatalf("newPrivacySubject() message = %q", msg)
+	}
+	if p.E164 != "34600112233" || p.National != "600112233" || p.Email != "ana@example.com" {
+		t.Fatalf("subject = %+v", p)
+	}
+
+	for _, bad := range [][3]string{
+		{"", "", ""},
+		{"34", "12", ""},
+		{"", "", "not-an-email"},
+	} {
+		if _, msg := newPrivacySubject(bad[0], bad[1], bad[2]); msg == "" {
+			t.Errorf("newPrivacySubject(%q) accepted", bad)
+		}
+	}
+}
+
+func TestPrivacySubjectRef(t *testing.T) {
+	a, _ := newPrivacySubject("34", "600112233", "")
+	b, _ := newPrivacySubject("", "+34 600 112 233", "")
+	if a.ref() != b.ref() {
+		t.Fatalf("ref differs for the same phone: %q vs %q", a.ref(), b.ref())
+	}
+	if strings.Contains(a.ref(), "600112233") {
+		t.Fatalf("ref %q leaks the phone", a.ref())
+	}
+}
+
+func TestPrivacyScopeForPlaceholders(t *testing.T) {
+	subjects := []privacySubject{
+		{CountryCode: "34", National: "600112233", E164: "34600112233", Email: "ana@example.com"},
+		{CountryCode: "34", National: "600112233", E164: "34600112233"},
+		{Email: "ana@example.com"},
+	}
+	for _, p := range subjects {
+		for _, guestIDs := range [][]int{nil, {4, 9}} {
+			scope := privacyScopeFor(7, p, guestIDs)
+			for name, f := range map[string]privacyFilter{
+				"guests": scope.guests, "bookings": scope.bookings, "cancelled": scope.cancelled,
+				"waitlist": scope.waitlist, "invoices": scope.invoices, "conversations": scope.conversations,
+				"deliveries": scope.deliveries, "members": scope.members,
+			} {
+				if got := strings.Count(f.where, "?"); got != len(f.args) {
+					t.Errorf("%+v %v %s: %d placeholders, %d args (%s)", p, guestIDs, name, got, len(f.args), f.where)
+				}
+				if !strings.HasPrefix(f.where, "restaurant_id = ? AND ") || f.args[0] != 7 {
+					t.Errorf("%s is not scoped to the restaurant: %s", name, f.where)
+				}
+			}
+		}
+	}
+}
+
+func TestPrivacySubjectMatch(t *testing.T) {
+	p := privacySubject{CountryCode: "34", National: "600112233", E164: "34600112233"}
+	f := p.match("contact_phone", "contact_phone_country_code", "contact_email")
+	if !strings.Contains(f.where, "contact_phone_country_code = ? AND contact_phone = ?") {
+		t.Fatalf("national number matched without its country code: %s", f.where)
+	}
+	if strings.Contains(f.where, "contact_email") {
+		t.Fatalf("email column used for a subject without email: %s", f.where)
+	}
+	if f := (privacySubject{}).match("phone", "", "email"); f.where != "1 = 0" {
+		t.Fatalf("empty subject matched %q", f.where)
+	}
+}
+
+func TestPrivacyRetentionValidate(t *testing.T) {
+	if msg := defaultPrivacyRetention().validate(); msg != "" {
+		t.Fatalf("defaults rejected: %q", msg)
+	}
+	if msg := (privacyRetention{}).validate(); msg != "" {
+		t.Fatalf("all purges off rejected: %q", msg)
+	}
+	r := defaultPrivacyRetention()
+	r.InvoiceYears = 4
+	if r.validate() == "" {
+		t.Fatal("invoice retention below the fiscal minimum accepted")
+	}
+	r = defaultPrivacyRetention()
+	r.ConversationDays = 1
+	if r.validate() == "" {
+		t.Fatal("1-day conversation retention accepted")
+	}
+}
+
+func TestPrivacyRetentionCutoffs(t *testing.T) {
+	now := time.Date(2026, 5, 10, 4, 0, 0, 0, time.UTC)
+	c := privacyRetention{BookingMonths: 36, ConversationDays: 90, InvoiceYears: 6}.cutoffs(now)
+	if got := c.Bookings.Format("2006-01-02"); got != "2023-05-10" {
+		t.Errorf("bookings cutoff = %s", got)
+	}
+	if got := c.Conversations.Format("2006-01-02"); got != "2026-02-09" {
+		t.Errorf("conversations cutoff = %s", got)
+	}
+	if got := c.Invoices.Format("2006-01-02"); got != "2020-05-10" {
+		t.Errorf("invoices cutoff = %s", got)
+	}
+	if !c.Deliveries.IsZero() || !c.Members.IsZero() {
+		t.Errorf("disabled purges got cutoffs: %+v", c)
+	}
+}
+
+func TestPrivacyAuditFilter(t *testing.T) {
+	f := privacyAuditFilter(7, map[string][]int{"guest": {4}, "booking": {12, 15}, "waitlist": nil})
+	if got := strings.Count(f.where, "?"); got != len(f.args) {
+		t.Fatalf("%d placeholders, %d args (%s)", got, len(f.args), f.where)
+	}
+	want := []any{7, "booking", "12", "15", "guest", "4"}
+	if !reflect.DeepEqual(f.args, want) {
+		t.Fatalf("args = %v, want %v", f.args, want)
+	}
+	if strings.Contains(f.where, "waitlist") || strings.Count(f.where, "entity = ?") != 2 {
+		t.Fatalf("where = %s", f.where)
+	}
+	if f := privacyAuditFilter(7, map[string][]int{}); !strings.HasSuffix(f.where, "1 = 0") || f.args[0] != 7 {
+		t.Fatalf("nothing to delete matched %q", f.where)
+	}
+}
+
+func TestPrivacyPurgeStepsAuditLog(t *testing.T) {
+	var out privacyPurgeResult
+	c := defaultPrivacyRetention().cutoffs(time.Date(2026, 5, 10, 4, 0, 0, 0, time.UTC))
+	entities := map[string]bool{}
+	for _, st := range privacyPurgeSteps(7, c, &out) {
+		if got := strings.Count(st.query, "?"); got != len(st.args) {
+			t.Errorf("%d placeholders, %d args (%s)", got, len(st.args), st.query)
+		}
+		if len(st.args) == 0 || (st.args[0] != 7 && st.args[1] != 7) {
+			t.Errorf("not scoped to the restaurant: %s", st.query)
+		}
+		if !strings.Contains(st.query, "DELETE FROM audit_log") {
+			continue
+		}
+		if st.n != &out.AuditLog {
+			t.Errorf("audit purge counted elsewhere: %s", st.query)
+		}
+		for _, a := range st.args {
+			if e, ok := a.(string); ok && !strings.Contains(e, "-") {
+				entities[e] = true
+			}
+		}
+		if strings.Contains(st.query, "'member'") {
+			entities["member"] = true
+		}
+		if strings.Contains(st.query, "'invoice'") {
+			entities["invoice"] = true
+		}
+	}
+	for _, e := range []string{"booking", "booking_payment", "guest", "waitlist", "member", "invoice"} {
+		if !entities[e] {
+			t.Errorf("retention run keeps %s audit entries", e)
+		}
+	}
+
+	if steps := privacyPurgeSteps(7, privacyRetention{}.cutoffs(time.Now()), &out); len(steps) != 0 {
+		t.Fatalf("all purges off still runs %d steps", len(steps))
+	}
+}
+
+func TestBunnyObjectPath(t *testing.T) {
+	base := "https://cdn.example.com/"
+	if p, ok := bunnyObjectPath(base, "https://cdn.example.com/3/facturas/pdf/pdf_12.pdf"); !ok || p != "3/facturas/pdf/pdf_12.pdf" {
+		t.Fatalf("bunnyObjectPath() = %q, %v", p, ok)
+	}
+	for _, u := range []string{"https://other.example.com/3/a.pdf", "https://cdn.example.com.evil/3/a.pdf", "https://cdn.example.com/"} {
+		if p, ok := bunnyObjectPath(base, u); ok {
+			t.Errorf("bunnyObjectPath(%q) = %q, want no match", u, p)
+		}
+	}
+}
@@ -32,6 +32,8 @@ type publicBooking struct {
 	SpecialMenu     sql.NullInt64
 	MenuDeGrupoID   sql.NullInt64
 	PrincipalesJSON sql.NullString
+	// ConfirmationRequired: staff confirm it by phone (no-show policy).
+	ConfirmationRequired bool
 }
 
 func (s *Server) fetchPublicBooking(ctx context.Context, id int) (publicBooking, error) {
@@ -58,7 +60,8 @@ func (s *Server) fetchPublicBooking(ctx context.Context, id int) (publicBooking,
 			status,
 			special_menu,
 			menu_de_grupo_id,
-			principales_json
+			principales_json,
+			confirmation_required
 		FROM bookings
 		WHERE restaurant_id = ?
 		  AND id = ?
@@ -80,6 +83,7 @@ func (s *Server) fetchPublicBooking(ctx context.Context, id int) (publicBooking,
 		&b.SpecialMenu,
 		&b.MenuDeGrupoID,
 		&b.PrincipalesJSON,
+		&b.ConfirmationRequired,
 	)
 	return b, err
 }
@@ -254,8 +258,7 @@ func (s *Server) handleConfirmReservationPage(w http.ResponseWriter, r *http.Req
 		logoURL = "/media/logos/logo-negro.png"
 	}
 
-	idRaw := strings.TrimSpace(r.URL.Query().Get("id"))
-	id, _ := strconv.Atoi(idRaw)
+	id, token, linkErr := s.authorizeGuestLink(r, restaurantID, guestLinkConfirm)
 	data := map[string]any{
 		"BrandName":        brandName,
 		"LogoURL":          logoURL,
@@ -263,11 +266,11 @@ func (s *Server) handleConfirmReservationPage(w http.ResponseWriter, r *http.Req
 		"Success":          false,
 		"HasBooking":       false,
 		"ShowConfirmation": false,
-		"Action":           r.URL.Path + "?id=" + url.QueryEscape(idRaw),
+		"Action":           guestLinkAction(r.URL.Path, id, token, nil),
 	}
 
-	if id <= 0 {
-		data["Message"] = "ID de reserva inválido. Por favor, inténtelo de nuevo."
+	if linkErr != "" {
+		data["Message"] = linkErr
 		writeHTMLTemplate(w, confirmReservationTmpl, data)
 		return
 	}
@@ -317,12 +320,18 @@ func (s *Server) handleConfirmReservationPage(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if b.ConfirmationRequired {
+		data["Message"] = "El restaurante le llamará para confirmar esta reserva."
+		writeHTMLTemplate(w, confirmReservationTmpl, data)
+		return
+	}
+
 	if process {
 		_, err := s.db.ExecContext(r.Context(), "UPDATE bookings SET status = 'confirmed' WHERE restaurant_id = ? AND id = ?", restaurantID, b.ID)
 		if err == nil {
 			data["Success"] = true
 			data["Message"] = "¡Su reserva ha sido confirmada correctamente!"
-			s.emitN8nWebhookAsync(restaurantID, "booking.confirmed", map[string]any{
+			s.emitN8nWebhookAsync(restaurantID, webhookEventBookingConfirmed, map[string]any{
 				"source":          "public_confirm_page",
 				"bookingId":       b.ID,
 				"reservationDate": b.ReservationDate,
@@ -425,7 +434,6 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 	}
 
 	q := r.URL.Query()
-	idRaw := strings.TrimSpace(q.Get("id"))
 	cancelledBy := strings.TrimSpace(q.Get("cancelled_by"))
 	if cancelledBy == "" {
 		cancelledBy = "customer"
@@ -433,12 +441,8 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 	if cancelledBy != "customer" && cancelledBy != "staff" {
 		cancelledBy = "customer"
 	}
-	id, _ := strconv.Atoi(idRaw)
-
-	actionQS := url.Values{}
-	actionQS.Set("id", idRaw)
-	actionQS.Set("cancelled_by", cancelledBy)
-	action := r.URL.Path + "?" + actionQS.Encode()
+	id, token, linkErr := s.authorizeGuestLink(r, restaurantID, guestLinkCancel)
+	action := guestLinkAction(r.URL.Path, id, token, url.Values{"cancelled_by": {cancelledBy}})
 
 	data := map[string]any{
 		"BrandName":        brandName,
@@ -451,8 +455,8 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 		"Action":           action,
 	}
 
-	if id <= 0 {
-		data["Message"] = "ID de reserva inválido. Por favor, inténtelo de nuevo."
+	if linkErr != "" {
+		data["Message"] = linkErr
 		writeHTMLTemplate(w, cancelReservationTmpl, data)
 		return
 	}
@@ -499,6 +503,7 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Transaction: move booking to cancelled_bookings and delete it.
+	guestID := 0
 	err = withTx(r.Context(), s.db, func(ctx context.Context, tx *sql.Tx) error {
 		resTimeNorm, _ := ensureHHMMSS(b.ReservationTime)
 		if resTimeNorm != "" {
@@ -533,6 +538,7 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 		if err != nil {
 			return err
 		}
+		guestID = carryBookingGuestTx(ctx, tx, restaurantID, b.ID)
 
 		_, err = tx.ExecContext(ctx, "DELETE FROM bookings WHERE restaurant_id = ? AND id = ?", restaurantID, b.ID)
 		return err
@@ -548,7 +554,7 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 	data["ShowConfirmation"] = false
 	writeHTMLTemplate(w, cancelReservationTmpl, data)
 
-	s.emitN8nWebhookAsync(restaurantID, "booking.cancelled", map[string]any{
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCancelled, map[string]any{
 		"source":          "public_cancel_page",
 		"cancelledBy":     cancelledBy,
 		"bookingId":       b.ID,
@@ -559,6 +565,9 @@ func (s *Server) handleCancelReservationPage(w http.ResponseWriter, r *http.Requ
 		"contactPhone":    defaultString(b.ContactPhone, ""),
 		"contactEmail":    defaultString(b.ContactEmail, ""),
 	})
+	s.offerWaitlistAsync(restaurantID, b.ReservationDate)
+	s.settleBookingDepositAsync(restaurantID, b.ID, b.ReservationDate, b.ReservationTime)
+	s.refreshGuestStatsAsync(restaurantID, guestID)
 
 	// Best-effort: notify restaurant via WhatsApp.
 	cancelledByText := "👤 Cliente"
@@ -700,8 +709,7 @@ func (s *Server) handleBookRicePage(w http.ResponseWriter, r *http.Request) {
 		logoURL = "/media/logos/logo-negro.png"
 	}
 
-	idRaw := strings.TrimSpace(r.URL.Query().Get("id"))
-	id, _ := strconv.Atoi(idRaw)
+	id, token, linkErr := s.authorizeGuestLink(r, restaurantID, guestLinkRice)
 	data := map[string]any{
 		"BrandName":    brandName,
 		"LogoURL":      logoURL,
@@ -712,11 +720,11 @@ func (s *Server) handleBookRicePage(w http.ResponseWriter, r *http.Request) {
 		"Countdown":   false,
 		"IsSameDay":   false,
 		"RiceOptions": []string{},
-		"Action":      r.URL.Path + "?id=" + url.QueryEscape(idRaw),
+		"Action":      guestLinkAction(r.URL.Path, id, token, nil),
 	}
 
-	if id <= 0 {
-		data["Message"] = "ID de reserva inválido. Por favor, inténtelo de nuevo."
+	if linkErr != "" {
+		data["Message"] = linkErr
 		writeHTMLTemplate(w, bookRiceTmpl, data)
 		return
 	}
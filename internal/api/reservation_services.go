@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+)
+
+// reservationService is a bookable shift (comida, cena...) with its own covers
+// limit. When a restaurant has active services they replace the single daily
+// limit: each booking counts against the service whose window holds its hour,
+// so a full lunch doesn't block dinner.
+type reservationService struct {
+	ID           int    `json:"id"`
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	StartTime    string `json:"startTime"`
+	EndTime      string `json:"endTime"`
+	CoversLimit  int    `json:"coversLimit"`
+	PacingLimit  int    `json:"pacingLimit"`  // max covers per slot, 0 = none
+	MinPartySize int    `json:"minPartySize"` // 0 = no minimum
+	MaxPartySize int    `json:"maxPartySize"` // 0 = no maximum
+	SortOrder    int    `json:"sortOrder"`
+	Active       bool   `json:"active"`
+}
+
+// containsHour reports whether hhmm falls in the service window. Both ends
+// are inclusive and compared in service-day order, so a dinner running to
+// 00:30 works.
+func (svc reservationService) containsHour(hhmm string) bool {
+	if _, ok := hhmmToMinutes(hhmm); !ok {
+		return false
+	}
+	k := serviceHourSortKey(hhmm)
+	return k >= serviceHourSortKey(svc.StartTime) && k <= serviceHourSortKey(svc.EndTime)
+}
+
+func (svc reservationService) acceptsPartySize(n int) bool {
+	if svc.MinPartySize > 0 && n < svc.MinPartySize {
+		return false
+	}
+	return svc.MaxPartySize <= 0 || n <= svc.MaxPartySize
+}
+
+// serviceDayCapacity is a service on a given date: its limit after
+// overrides and the covers already booked in its window.
+type serviceDayCapacity struct {
+	reservationService
+	Limit  int  `json:"limit"`
+	Booked int  `json:"booked"`
+	Closed bool `json:"closed"`
+}
+
+func (c serviceDayCapacity) free() int {
+	if c.Closed {
+		return 0
+	}
+	return max(c.Limit-c.Booked, 0)
+}
+
+type serviceDayOverride struct {
+	CoversLimit sql.NullInt64
+	Closed      bool
+}
+
+// buildServiceDay spreads the bookings of a day over the services. Bookings
+// at an hour no service covers don't count against any of them.
+func buildServiceDay(services []reservationService, overrides map[int]serviceDayOverride, bookingsByHour map[string]int) []serviceDayCapacity {
+	out := make([]serviceDayCapacity, 0, len(services))
+	for _, svc := range services {
+		c := serviceDayCapacity{reservationService: svc, Limit: svc.CoversLimit}
+		if o, ok := overrides[svc.ID]; ok {
+			if o.CoversLimit.Valid {
+				c.Limit = int(o.CoversLimit.Int64)
+			}
+			c.Closed = o.Closed
+		}
+		for hour, people := range bookingsByHour {
+			if svc.containsHour(hour) {
+				c.Booked += people
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// serviceForHour returns the index of the service holding hhmm, or -1.
+func serviceForHour(services []serviceDayCapacity, hhmm string) int {
+	for i, svc := range services {
+		if svc.containsHour(hhmm) {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyServiceCapacity recomputes hour slots against their service. A slot
+// gets the pacing limit when the service has one, otherwise its share of the
+// service covers, weighted by the hour_configuration percentages of the
+// service's hours. Bookable capacity never exceeds what is left in the
+// service. Hours outside every service are closed. Bookings must already be
+// set on each slot.
+func applyServiceCapacity(hourData map[string]HourSlot, services []serviceDayCapacity) {
+	weights := make([]float64, len(services))
+	counts := make([]int, len(services))
+	for hour, slot := range hourData {
+		if i := serviceForHour(services, hour); i >= 0 {
+			weights[i] += slot.Percentage
+			counts[i]++
+		}
+	}
+
+	for hour, slot := range hourData {
+		i := serviceForHour(services, hour)
+		if i < 0 || services[i].Closed {
+			slot.TotalCapacity = 0
+			slot.Capacity = 0
+			slot.Completion = 0
+			slot.IsClosed = true
+			slot.Status = "closed"
+			hourData[hour] = slot
+			continue
+		}
+		svc := services[i]
+
+		total := svc.PacingLimit
+		if total <= 0 {
+			share := 1.0 / float64(counts[i])
+			if weights[i] > 0 {
+				share = slot.Percentage / weights[i]
+			}
+			total = int(math.Ceil(share * float64(svc.Limit)))
+		}
+		slot.TotalCapacity = total
+		slot.Capacity = min(total-slot.Bookings, svc.free())
+		slot.Completion = 0
+		if total > 0 {
+			slot.Completion = (float64(slot.Bookings) / float64(total)) * 100.0
+		}
+		if !slot.IsClosed && slot.Status != "closed" {
+			switch {
+			case slot.Capacity <= 0 || slot.Completion > 90:
+				slot.Status = "full"
+			case slot.Completion > 70:
+				slot.Status = "limited"
+			default:
+				slot.Status = "available"
+			}
+		}
+		hourData[hour] = slot
+	}
+}
+
+// sqlQueryer is satisfied by *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (s *Server) loadReservationServices(ctx context.Context, q sqlQueryer, restaurantID int, activeOnly bool) ([]reservationService, error) {
+	query := `
+		SELECT id, service_key, name, start_time, end_time, covers_limit, pacing_limit, min_party_size, max_party_size, sort_order, is_active
+		FROM restaurant_services
+		WHERE restaurant_id = ?`
+	if activeOnly {
+		query += " AND is_active = 1"
+	}
+	query += " ORDER BY sort_order ASC, id ASC"
+
+	rows, err := q.QueryContext(ctx, query, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []reservationService{}
+	for rows.Next() {
+		var (
+			svc                      reservationService
+			pacing, minSize, maxSize sql.NullInt64
+		)
+		if err := rows.Scan(&svc.ID, &svc.Key, &svc.Name, &svc.StartTime, &svc.EndTime, &svc.CoversLimit, &pacing, &minSize, &maxSize, &svc.SortOrder, &svc.Active); err != nil {
+			return nil, err
+		}
+		svc.PacingLimit = int(pacing.Int64)
+		svc.MinPartySize = int(minSize.Int64)
+		svc.MaxPartySize = int(maxSize.Int64)
+		out = append(out, svc)
+	}
+	return out, rows.Err()
+}
+
+// loadServiceOverrides returns the per-date overrides between from and to,
+// keyed by date and service id.
+func (s *Server) loadServiceOverrides(ctx context.Context, q sqlQueryer, restaurantID int, from, to string) (map[string]map[int]serviceDayOverride, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT DATE_FORMAT(date, '%Y-%m-%d'), service_id, covers_limit, is_closed
+		FROM restaurant_service_days
+		WHERE restaurant_id = ? AND date BETWEEN ? AND ?
+	`, restaurantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]map[int]serviceDayOverride{}
+	for rows.Next() {
+		var (
+			date      string
+			serviceID int
+			o         serviceDayOverride
+		)
+		if err := rows.Scan(&date, &serviceID, &o.CoversLimit, &o.Closed); err != nil {
+			return nil, err
+		}
+		if out[date] == nil {
+			out[date] = map[int]serviceDayOverride{}
+		}
+		out[date][serviceID] = o
+	}
+	return out, rows.Err()
+}
+
+// loadBookedCoversByHour sums party sizes by date and HH:MM between from and
+// to, skipping excludeBookingID.
+func (s *Server) loadBookedCoversByHour(ctx context.Context, q sqlQueryer, restaurantID int, from, to string, excludeBookingID int) (map[string]map[string]int, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT DATE_FORMAT(reservation_date, '%Y-%m-%d'), TIME_FORMAT(reservation_time, '%H:%i'), COALESCE(SUM(party_size), 0)
+		FROM bookings
+		WHERE restaurant_id = ? AND reservation_date BETWEEN ? AND ? AND id <> ?
+		GROUP BY reservation_date, TIME_FORMAT(reservation_time, '%H:%i')
+	`, restaurantID, from, to, excludeBookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]map[string]int{}
+	for rows.Next() {
+		var (
+			date, hour string
+			people     int
+		)
+		if err := rows.Scan(&date, &hour, &people); err != nil {
+			return nil, err
+		}
+		if out[date] == nil {
+			out[date] = map[string]int{}
+		}
+		out[date][hour] = people
+	}
+	return out, rows.Err()
+}
+
+// loadServiceDay returns the active services of date with their usage, or
+// nil when the restaurant has none configured.
+func (s *Server) loadServiceDay(ctx context.Context, q sqlQueryer, restaurantID int, date string, excludeBookingID int) ([]serviceDayCapacity, error) {
+	days, err := s.loadServiceRange(ctx, q, restaurantID, date, date, excludeBookingID)
+	if err != nil || days == nil {
+		return nil, err
+	}
+	return days[date], nil
+}
+
+// loadServiceRange is loadServiceDay for every date between from and to
+// (YYYY-MM-DD, inclusive).
+func (s *Server) loadServiceRange(ctx context.Context, q sqlQueryer, restaurantID int, from, to string, excludeBookingID int) (map[string][]serviceDayCapacity, error) {
+	first, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := s.loadReservationServices(ctx, q, restaurantID, true)
+	if err != nil || len(services) == 0 {
+		return nil, err
+	}
+	overrides, err := s.loadServiceOverrides(ctx, q, restaurantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := s.loadBookedCoversByHour(ctx, q, restaurantID, from, to, excludeBookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]serviceDayCapacity{}
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		out[date] = buildServiceDay(services, overrides[date], booked[date])
+	}
+	return out, nil
+}
+
+func normalizeServiceKey(raw string) string {
+	return roleSlugFromLabel(strings.TrimSpace(raw))
+}
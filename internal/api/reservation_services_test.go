@@ -0,0 +1,100 @@
+package api
+
+import "testing"
+
+func TestReservationServiceContainsHour(t *testing.T) {
+	cena := reservationService{StartTime: "20:00", EndTime: "00:30"}
+	for hour, want := range map[string]bool{
+		"19:30": false,
+		"20:00": true,
+		"23:30": true,
+		"00:30": true,
+		"01:00": false,
+		"bogus": false,
+	} {
+		if got := cena.containsHour(hour); got != want {
+			t.Errorf("containsHour(%q) = %v, want %v", hour, got, want)
+		}
+	}
+}
+
+func TestBuildServiceDay(t *testing.T) {
+	services := []reservationService{
+		{ID: 1, StartTime: "13:00", EndTime: "15:30", CoversLimit: 40},
+		{ID: 2, StartTime: "20:00", EndTime: "23:00", CoversLimit: 30},
+	}
+	overrides := map[int]serviceDayOverride{2: {Closed: true}}
+	day := buildServiceDay(services, overrides, map[string]int{"13:30": 10, "15:00": 6, "21:00": 4, "17:00": 9})
+
+	if day[0].Booked != 16 || day[0].free() != 24 {
+		t.Errorf("comida = %+v, free %d", day[0], day[0].free())
+	}
+	if day[1].Booked != 4 || !day[1].Closed || day[1].free() != 0 {
+		t.Errorf("cena = %+v", day[1])
+	}
+}
+
+func TestApplyServiceCapacity(t *testing.T) {
+	services := []serviceDayCapacity{
+		{reservationService: reservationService{StartTime: "13:00", EndTime: "15:00"}, Limit: 40, Booked: 36},
+		{reservationService: reservationService{StartTime: "20:00", EndTime: "22:00", PacingLimit: 12}, Limit: 30},
+	}
+	hourData := map[string]HourSlot{
+		"13:00": {Percentage: 30, Bookings: 20},
+		"14:00": {Percentage: 10, Bookings: 16},
+		"17:00": {Percentage: 20},
+		"21:00": {Percentage: 40},
+	}
+	applyServiceCapacity(hourData, services)
+
+	// 13:00 holds 3/4 of the lunch covers but only 4 are left in the service.
+	if got := hourData["13:00"]; got.TotalCapacity != 30 || got.Capacity != 4 {
+		t.Errorf("13:00 = %+v", got)
+	}
+	if got := hourData["14:00"]; got.TotalCapacity != 10 || got.Status != "full" {
+		t.Errorf("14:00 = %+v", got)
+	}
+	if got := hourData["17:00"]; !got.IsClosed || got.Status != "closed" {
+		t.Errorf("17:00 outside any service = %+v", got)
+	}
+	if got := hourData["21:00"]; got.TotalCapacity != 12 || got.Capacity != 12 || got.Status != "available" {
+		t.Errorf("21:00 = %+v", got)
+	}
+}
+
+func TestNormalizeBOServices(t *testing.T) {
+	services, msg := normalizeBOServices([]boServiceInput{
+		{Name: "Comida", StartTime: "13:00", EndTime: "15:30", CoversLimit: 40},
+		{Name: "Cena", StartTime: "20:00", EndTime: "00:30", CoversLimit: 30, PacingLimit: 10},
+	})
+	if msg != "" || len(services) != 2 || services[0].Key != "comida" || services[1].SortOrder != 1 {
+		t.Fatalf("normalizeBOServices = %+v, %q", services, msg)
+	}
+
+	inactive := false
+	cases := map[string][]boServiceInput{
+		"overlap": {
+			{Name: "Comida", StartTime: "13:00", EndTime: "16:00"},
+			{Name: "Merienda", StartTime: "16:00", EndTime: "18:00"},
+		},
+		"reversed window": {{Name: "Cena", StartTime: "23:00", EndTime: "20:00"}},
+		"duplicate key": {
+			{Name: "Cena", StartTime: "20:00", EndTime: "21:00"},
+			{Name: "cena", StartTime: "22:00", EndTime: "23:00"},
+		},
+		"party sizes": {{Name: "Cena", StartTime: "20:00", EndTime: "23:00", MinPartySize: 6, MaxPartySize: 4}},
+	}
+	for name, in := range cases {
+		if _, msg := normalizeBOServices(in); msg == "" {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Inactive services may overlap active ones.
+	if _, msg := normalizeBOServices([]boServiceInput{
+		{Name: "Comida", StartTime: "13:00", EndTime: "16:00"},
+		{Name: "Brunch", StartTime: "12:00", EndTime: "14:00", Active: &inactive},
+	}); msg != "" {
+		t.Errorf("inactive overlap rejected: %s", msg)
+	}
+}
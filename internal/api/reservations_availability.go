@@ -532,6 +532,16 @@ func (s *Server) handleSetDayOpenFlag(w http.ResponseWriter, r *http.Request, is
 		return
 	}
 
+	event := webhookEventDayOpened
+	if !isOpen {
+		event = webhookEventDayClosed
+	}
+	s.emitN8nWebhookAsync(restaurantID, event, map[string]any{
+		"source": "legacy_admin",
+		"date":   date,
+		"isOpen": isOpen,
+	})
+
 	msg := "Day opened successfully"
 	if !isOpen {
 		msg = "Day closed successfully"
@@ -672,7 +682,7 @@ func parseMonthYear(monthRaw string, yearRaw string) (int, int, error) {
 	return month, year, nil
 }
 
-func (s *Server) buildMonthAvailability(ctx context.Context, restaurantID int, year int, month int) (map[string]map[string]int, error) {
+func (s *Server) buildMonthAvailability(ctx context.Context, restaurantID int, year int, month int) (map[string]map[string]any, error) {
 	firstDay := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
 	lastDay := firstDay.AddDate(0, 1, -1)
 
@@ -725,17 +735,39 @@ func (s *Server) buildMonthAvailability(ctx context.Context, restaurantID int, y
 		return nil, err
 	}
 
-	availability := map[string]map[string]int{}
+	serviceDays, err := s.loadServiceRange(ctx, s.db, restaurantID, firstDayStr, lastDayStr, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	availability := map[string]map[string]any{}
 	defaultLimit := 45
 	daysInMonth := lastDay.Day()
 	for day := 1; day <= daysInMonth; day++ {
 		dateISO := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+		total := bookings[dateISO]
+		if services, ok := serviceDays[dateISO]; ok {
+			// With services the day is bookable while any service has room.
+			lim, free := 0, 0
+			for _, svc := range services {
+				if !svc.Closed {
+					lim += svc.Limit
+				}
+				free += svc.free()
+			}
+			availability[dateISO] = map[string]any{
+				"dailyLimit":       lim,
+				"totalPeople":      total,
+				"freeBookingSeats": free,
+				"services":         services,
+			}
+			continue
+		}
 		lim := defaultLimit
 		if v, ok := dailyLimits[dateISO]; ok {
 			lim = v
 		}
-		total := bookings[dateISO]
-		availability[dateISO] = map[string]int{
+		availability[dateISO] = map[string]any{
 			"dailyLimit":       lim,
 			"totalPeople":      total,
 			"freeBookingSeats": lim - total,
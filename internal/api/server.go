@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/md5"
 	"database/sql"
 	"encoding/hex"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 
@@ -22,10 +24,18 @@ type Server struct {
 	db                  *sql.DB
 	cfg                 config.Config
 	tenantCache         tenantDomainCache
+	authCache           boAuthCache
 	fichajeHub          *boFichajeHub
 	tablesHub           *boTablesHub
 	groupMenusV2AIHub   *boGroupMenuV2AIHub
 	groupMenusV2AIQueue chan struct{}
+	fiscalSubmitter     fiscalSubmitter
+	payments            paymentProvider
+
+	// Background jobs started by Start run until Shutdown cancels bgCtx.
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+	bgWG     sync.WaitGroup
 }
 
 func NewServer(db *sql.DB, cfg config.Config) *Server {
@@ -33,6 +43,7 @@ func NewServer(db *sql.DB, cfg config.Config) *Server {
 	if aiConcurrency <= 0 {
 		aiConcurrency = 1
 	}
+	bgCtx, bgCancel := context.WithCancel(context.Background())
 	s := &Server{
 		db:                  db,
 		cfg:                 cfg,
@@ -40,11 +51,61 @@ func NewServer(db *sql.DB, cfg config.Config) *Server {
 		tablesHub:           newBOTablesHub(),
 		groupMenusV2AIHub:   newBOGroupMenuV2AIHub(),
 		groupMenusV2AIQueue: make(chan struct{}, aiConcurrency),
+		fiscalSubmitter:     newFiscalSubmitter(cfg.VerifactuSubmitter),
+		payments:            newPaymentProvider(cfg),
+		bgCtx:               bgCtx,
+		bgCancel:            bgCancel,
 	}
-	go s.runBOFichajeAutoCutLoop()
 	return s
 }
 
+// Start launches the periodic background loops. Only the HTTP server calls it;
+// one-off commands build a Server for its helpers without running the loops.
+func (s *Server) Start() {
+	s.goBackground(s.runBOFichajeAutoCutLoop)
+	s.goBackground(s.runWebhookRetryLoop)
+	s.goBackground(s.runBOLoginThrottleCleanupLoop)
+	s.goBackground(s.runBOAuthCachePurgeLoop)
+	s.goBackground(s.runWaitlistOfferExpiryLoop)
+	s.goBackground(s.runDepositHoldExpiryLoop)
+	s.goBackground(s.runGuestStatsLoop)
+	s.goBackground(s.runPrivacyRetentionLoop)
+	s.goBackground(s.runMarketingSchedulerLoop)
+	s.goBackground(s.runMarketingSender(marketingChannelEmail, s.cfg.MarketingEmailRate))
+	s.goBackground(s.runMarketingSender(marketingChannelWhatsApp, s.cfg.MarketingWhatsAppRate))
+}
+
+func (s *Server) goBackground(job func(ctx context.Context)) {
+	s.bgWG.Add(1)
+	go func() {
+		defer s.bgWG.Done()
+		job(s.bgCtx)
+	}()
+}
+
+// Shutdown stops background loops and disconnects websocket clients.
+// Hijacked websocket connections are not tracked by http.Server.Shutdown, so
+// this must be called once the HTTP listener has stopped accepting requests.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.bgCancel()
+
+	s.fichajeHub.closeAll()
+	s.tablesHub.closeAll()
+	s.groupMenusV2AIHub.closeAll()
+
+	done := make(chan struct{})
+	go func() {
+		s.bgWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (s *Server) Routes() http.Handler {
 	r := chi.NewRouter()
 	websiteBuilder := newWebsiteBuilder(s)
@@ -84,16 +145,17 @@ func (s *Server) Routes() http.Handler {
 	})
 
 	r.Route("/admin", func(r chi.Router) {
-		reservasGate := s.requireBOSection(boSectionReservas)
-		menusGate := s.requireBOSection(boSectionMenus)
-		ajustesGate := s.requireBOSection(boSectionAjustes)
-		miembrosGate := s.requireBOSection(boSectionMiembros)
-		fichajeGate := s.requireBOSection(boSectionFichaje)
-		horariosGate := s.requireBOSection(boSectionHorarios)
-		facturasGate := s.requireBOSection(boSectionFacturas)
+		reservasGate := s.boPermissionGate(boSectionReservas)
+		menusGate := s.boPermissionGate(boSectionMenus)
+		ajustesGate := s.boPermissionGate(boSectionAjustes)
+		miembrosGate := s.boPermissionGate(boSectionMiembros)
+		fichajeGate := s.boPermissionGate(boSectionFichaje)
+		horariosGate := s.boPermissionGate(boSectionHorarios)
+		facturasGate := s.boPermissionGate(boSectionFacturas)
 		rolesAdminGate := s.requireBORoleImportanceAtLeast(90)
 
 		r.Post("/login", s.handleBOLogin)
+		r.Post("/login/2fa", s.handleBOLoginTwoFactor)
 		r.Post("/logout", s.handleBOLogout)
 		r.Post("/invitations/validate", s.handleBOInvitationValidate)
 		r.Post("/invitations/onboarding/start", s.handleBOInvitationOnboardingStart)
@@ -106,223 +168,301 @@ func (s *Server) Routes() http.Handler {
 
 		r.With(s.requireBOSession).Get("/me", s.handleBOMe)
 		r.With(s.requireBOSession).Post("/me/password", s.handleBOSetPassword)
+		r.With(s.requireBOSession).Get("/me/2fa", s.handleBOTwoFactorStatus)
+		r.With(s.requireBOSession).Post("/me/2fa/setup", s.handleBOTwoFactorSetup)
+		r.With(s.requireBOSession).Post("/me/2fa/enable", s.handleBOTwoFactorEnable)
+		r.With(s.requireBOSession).Post("/me/2fa/disable", s.handleBOTwoFactorDisable)
+		r.With(s.requireBOSession).Post("/me/2fa/recovery-codes", s.handleBOTwoFactorRecoveryCodes)
+		r.With(s.requireBOSession).Post("/me/2fa/verify", s.handleBOTwoFactorVerify)
+		r.With(s.requireBOSession).Get("/me/sessions", s.handleBOMySessionsList)
+		r.With(s.requireBOSession).Delete("/me/sessions/{id}", s.handleBOMySessionRevoke)
+		r.With(s.requireBOSession).Post("/me/sessions/revoke-others", s.handleBOMySessionsRevokeOthers)
 		r.With(s.requireBOSession).Post("/active-restaurant", s.handleBOSetActiveRestaurant)
 
-		r.With(s.requireBOSession, reservasGate).Get("/dashboard/metrics", s.handleBODashboardMetrics)
-
-		r.With(s.requireBOSession, reservasGate).Get("/calendar", s.handleBOCalendarMonth)
-
-		r.With(s.requireBOSession, reservasGate).Get("/bookings", s.handleBOBookingsList)
-		r.With(s.requireBOSession, reservasGate).Get("/bookings/export", s.handleBOBookingsExport)
-		r.With(s.requireBOSession, reservasGate).Get("/bookings/{id}", s.handleBOBookingGet)
-		r.With(s.requireBOSession, reservasGate).Post("/bookings", s.handleBOBookingCreate)
-		r.With(s.requireBOSession, reservasGate).Patch("/bookings/{id}", s.handleBOBookingPatch)
-		r.With(s.requireBOSession, reservasGate).Post("/bookings/{id}/cancel", s.handleBOBookingCancel)
-
-		r.With(s.requireBOSession, reservasGate).Get("/arroz-types", s.handleBOArrozTypes)
+		r.With(s.requireBOSession, reservasGate.View).Get("/dashboard/metrics", s.handleBODashboardMetrics)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/calendar", s.handleBOCalendarMonth)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/bookings", s.handleBOBookingsList)
+		r.With(s.requireBOSession, reservasGate.Export).Get("/bookings/export", s.handleBOBookingsExport)
+		r.With(s.requireBOSession, reservasGate.View).Get("/bookings/{id}", s.handleBOBookingGet)
+		r.With(s.requireBOSession, reservasGate.Create).Post("/bookings", s.handleBOBookingCreate)
+		r.With(s.requireBOSession, reservasGate.Edit).Patch("/bookings/{id}", s.handleBOBookingPatch)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/bookings/{id}/cancel", s.handleBOBookingCancel)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/bookings/{id}/attendance", s.handleBOBookingAttendance)
+		r.With(s.requireBOSession, reservasGate.View).Get("/bookings/{id}/payments", s.handleBOBookingPayments)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/payments/{id}/refund", s.handleBOPaymentRefund)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/payments/{id}/capture", s.handleBOPaymentCapture)
+		r.With(s.requireBOSession, reservasGate.View).Get("/guests", s.handleBOGuestsList)
+		r.With(s.requireBOSession, reservasGate.View).Get("/guests/{id}", s.handleBOGuestGet)
+		r.With(s.requireBOSession, reservasGate.Edit).Patch("/guests/{id}", s.handleBOGuestPatch)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/guests/{id}/merge", s.handleBOGuestMerge)
+		r.With(s.requireBOSession, reservasGate.View).Get("/guests/{id}/consents", s.handleBOGuestConsentsGet)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/guests/{id}/consents", s.handleBOGuestConsentSet)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/marketing/templates", s.handleBOMarketingTemplatesList)
+		r.With(s.requireBOSession, reservasGate.Create).Post("/marketing/templates", s.handleBOMarketingTemplateCreate)
+		r.With(s.requireBOSession, reservasGate.Edit).Patch("/marketing/templates/{id}", s.handleBOMarketingTemplateUpdate)
+		r.With(s.requireBOSession, reservasGate.Delete).Delete("/marketing/templates/{id}", s.handleBOMarketingTemplateDelete)
+		r.With(s.requireBOSession, reservasGate.View).Post("/marketing/audience/preview", s.handleBOMarketingAudiencePreview)
+		r.With(s.requireBOSession, reservasGate.View).Get("/marketing/campaigns", s.handleBOMarketingCampaignsList)
+		r.With(s.requireBOSession, reservasGate.Create).Post("/marketing/campaigns", s.handleBOMarketingCampaignCreate)
+		r.With(s.requireBOSession, reservasGate.View).Get("/marketing/campaigns/{id}", s.handleBOMarketingCampaignGet)
+		r.With(s.requireBOSession, reservasGate.Edit).Patch("/marketing/campaigns/{id}", s.handleBOMarketingCampaignUpdate)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/marketing/campaigns/{id}/schedule", s.handleBOMarketingCampaignSchedule)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/marketing/campaigns/{id}/cancel", s.handleBOMarketingCampaignCancel)
+		r.With(s.requireBOSession, reservasGate.View).Get("/marketing/campaigns/{id}/deliveries", s.handleBOMarketingCampaignDeliveries)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/arroz-types", s.handleBOArrozTypes)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/waitlist", s.handleBOWaitlistList)
+		r.With(s.requireBOSession, reservasGate.Create).Post("/waitlist", s.handleBOWaitlistCreate)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/waitlist/{id}/offer", s.handleBOWaitlistOffer)
+		r.With(s.requireBOSession, reservasGate.Edit).Delete("/waitlist/{id}", s.handleBOWaitlistCancel)
 
 		// Backoffice menu management.
-		r.With(s.requireBOSession, menusGate).Get("/menu-visibility", s.handleBOMenuVisibilityGet)
-		r.With(s.requireBOSession, menusGate).Post("/menu-visibility", s.handleBOMenuVisibilitySet)
-
-		r.With(s.requireBOSession, menusGate).Get("/menus/dia", s.handleBOMenuDiaGet)
-		r.With(s.requireBOSession, menusGate).Post("/menus/dia/dishes", s.handleBOMenuDiaDishCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/menus/dia/dishes/{id}", s.handleBOMenuDiaDishPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/menus/dia/dishes/{id}", s.handleBOMenuDiaDishDelete)
-		r.With(s.requireBOSession, menusGate).Post("/menus/dia/price", s.handleBOMenuDiaSetPrice)
-
-		r.With(s.requireBOSession, menusGate).Get("/menus/finde", s.handleBOMenuFindeGet)
-		r.With(s.requireBOSession, menusGate).Post("/menus/finde/dishes", s.handleBOMenuFindeDishCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/menus/finde/dishes/{id}", s.handleBOMenuFindeDishPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/menus/finde/dishes/{id}", s.handleBOMenuFindeDishDelete)
-		r.With(s.requireBOSession, menusGate).Post("/menus/finde/price", s.handleBOMenuFindeSetPrice)
-
-		r.With(s.requireBOSession, menusGate).Get("/postres", s.handleBOPostresList)
-		r.With(s.requireBOSession, menusGate).Post("/postres", s.handleBOPostreCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/postres/{id}", s.handleBOPostrePatch)
-		r.With(s.requireBOSession, menusGate).Delete("/postres/{id}", s.handleBOPostreDelete)
-
-		r.With(s.requireBOSession, menusGate).Get("/vinos", s.handleBOVinosList)
-		r.With(s.requireBOSession, menusGate).Post("/vinos", s.handleBOVinoCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/vinos/{id}", s.handleBOVinoPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/vinos/{id}", s.handleBOVinoDelete)
+		r.With(s.requireBOSession, menusGate.View).Get("/menu-visibility", s.handleBOMenuVisibilityGet)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/menu-visibility", s.handleBOMenuVisibilitySet)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/menus/dia", s.handleBOMenuDiaGet)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/menus/dia/dishes", s.handleBOMenuDiaDishCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/menus/dia/dishes/{id}", s.handleBOMenuDiaDishPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/menus/dia/dishes/{id}", s.handleBOMenuDiaDishDelete)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/menus/dia/price", s.handleBOMenuDiaSetPrice)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/menus/finde", s.handleBOMenuFindeGet)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/menus/finde/dishes", s.handleBOMenuFindeDishCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/menus/finde/dishes/{id}", s.handleBOMenuFindeDishPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/menus/finde/dishes/{id}", s.handleBOMenuFindeDishDelete)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/menus/finde/price", s.handleBOMenuFindeSetPrice)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/postres", s.handleBOPostresList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/postres", s.handleBOPostreCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/postres/{id}", s.handleBOPostrePatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/postres/{id}", s.handleBOPostreDelete)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/vinos", s.handleBOVinosList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/vinos", s.handleBOVinoCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/vinos/{id}", s.handleBOVinoPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/vinos/{id}", s.handleBOVinoDelete)
 
 		// New comida module endpoints (typed routes).
-		r.With(s.requireBOSession, menusGate).Get("/comida/platos/categorias", s.handleBOComidaPlatoCategoriesList)
-		r.With(s.requireBOSession, menusGate).Post("/comida/platos/categorias", s.handleBOComidaPlatoCategoriesCreate)
-		r.With(s.requireBOSession, menusGate).Get("/comida/{tipo}", s.handleBOComidaList)
-		r.With(s.requireBOSession, menusGate).Get("/comida/{tipo}/{id}", s.handleBOComidaGet)
-		r.With(s.requireBOSession, menusGate).Post("/comida/{tipo}", s.handleBOComidaCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/comida/{tipo}/{id}", s.handleBOComidaPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/comida/{tipo}/{id}", s.handleBOComidaDelete)
+		r.With(s.requireBOSession, menusGate.View).Get("/comida/platos/categorias", s.handleBOComidaPlatoCategoriesList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/comida/platos/categorias", s.handleBOComidaPlatoCategoriesCreate)
+		r.With(s.requireBOSession, menusGate.View).Get("/comida/{tipo}", s.handleBOComidaList)
+		r.With(s.requireBOSession, menusGate.View).Get("/comida/{tipo}/{id}", s.handleBOComidaGet)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/comida/{tipo}", s.handleBOComidaCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/comida/{tipo}/{id}", s.handleBOComidaPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/comida/{tipo}/{id}", s.handleBOComidaDelete)
 
 		// Legacy aliases consumed by current backoffice comida screen.
-		r.With(s.requireBOSession, menusGate).Get("/platos", s.handleBOPlatosList)
-		r.With(s.requireBOSession, menusGate).Post("/platos", s.handleBOPlatosCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/platos/{id}", s.handleBOPlatosPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/platos/{id}", s.handleBOPlatosDelete)
-		r.With(s.requireBOSession, menusGate).Post("/platos/{id}/toggle", s.handleBOPlatosToggle)
-
-		r.With(s.requireBOSession, menusGate).Get("/bebidas", s.handleBOBebidasList)
-		r.With(s.requireBOSession, menusGate).Post("/bebidas", s.handleBOBebidasCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/bebidas/{id}", s.handleBOBebidasPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/bebidas/{id}", s.handleBOBebidasDelete)
-		r.With(s.requireBOSession, menusGate).Post("/bebidas/{id}/toggle", s.handleBOBebidasToggle)
-
-		r.With(s.requireBOSession, menusGate).Get("/cafes", s.handleBOCafesList)
-		r.With(s.requireBOSession, menusGate).Post("/cafes", s.handleBOCafesCreate)
-		r.With(s.requireBOSession, menusGate).Patch("/cafes/{id}", s.handleBOCafesPatch)
-		r.With(s.requireBOSession, menusGate).Delete("/cafes/{id}", s.handleBOCafesDelete)
-		r.With(s.requireBOSession, menusGate).Post("/cafes/{id}/toggle", s.handleBOCafesToggle)
-
-		r.With(s.requireBOSession, menusGate).Get("/group-menus", s.handleBOGroupMenusList)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus/{id}", s.handleBOGroupMenuGet)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus", s.handleBOGroupMenuCreate)
-		r.With(s.requireBOSession, menusGate).Put("/group-menus/{id}", s.handleBOGroupMenuUpdate)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus/{id}/toggle", s.handleBOGroupMenuToggleActive)
-		r.With(s.requireBOSession, menusGate).Delete("/group-menus/{id}", s.handleBOGroupMenuDelete)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus-v2", s.handleBOGroupMenusV2List)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/drafts", s.handleBOGroupMenusV2CreateDraft)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus-v2/ws", s.handleBOGroupMenusV2AIWS)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus-v2/{id}", s.handleBOGroupMenusV2Get)
-		r.With(s.requireBOSession, menusGate).Patch("/group-menus-v2/{id}/basics", s.handleBOGroupMenusV2PatchBasics)
-		r.With(s.requireBOSession, menusGate).Patch("/group-menus-v2/{id}/menu-type", s.handleBOGroupMenusV2PatchMenuType)
-		r.With(s.requireBOSession, menusGate).Put("/group-menus-v2/{id}/sections", s.handleBOGroupMenusV2PutSections)
-		r.With(s.requireBOSession, menusGate).Patch("/group-menus-v2/{id}/sections/{sectionId}/annotations", s.handleBOGroupMenusV2PatchSectionAnnotations)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus-v2/{id}/sections/{sectionId}/dishes", s.handleBOGroupMenusV2GetSectionDishes)
-		r.With(s.requireBOSession, menusGate).Put("/group-menus-v2/{id}/sections/{sectionId}/dishes", s.handleBOGroupMenusV2PutSectionDishes)
-		r.With(s.requireBOSession, menusGate).Patch("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}", s.handleBOGroupMenusV2PatchSectionDish)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}/image", s.handleBOGroupMenusV2UploadSectionDishImage)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}/image/ai", s.handleBOGroupMenusV2GenerateSectionDishAIImage)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/preview-image", s.handleBOGroupMenusV2UploadMenuPreviewImage)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/preview-image/ai", s.handleBOGroupMenusV2GenerateMenuPreviewAIImage)
-		r.With(s.requireBOSession, menusGate).Get("/group-menus-v2/{id}/slider", s.handleBOGroupMenusV2GetSlider)
-		r.With(s.requireBOSession, menusGate).Patch("/group-menus-v2/{id}/slider", s.handleBOGroupMenusV2PatchSlider)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/slider/images", s.handleBOGroupMenusV2UploadSliderImage)
-		r.With(s.requireBOSession, menusGate).Delete("/group-menus-v2/{id}/slider/images/{imageId}", s.handleBOGroupMenusV2DeleteSliderImage)
-		r.With(s.requireBOSession, menusGate).Put("/group-menus-v2/{id}/slider/images", s.handleBOGroupMenusV2ReorderSliderImages)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/slider/images/ai", s.handleBOGroupMenusV2GenerateSliderAIImage)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/publish", s.handleBOGroupMenusV2Publish)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/toggle-active", s.handleBOGroupMenusV2ToggleActive)
-		r.With(s.requireBOSession, menusGate).Post("/group-menus-v2/{id}/special-image", s.handleBOSpecialMenuImageUpload)
-		r.With(s.requireBOSession, menusGate).Delete("/group-menus-v2/{id}", s.handleBOGroupMenusV2Delete)
-		r.With(s.requireBOSession, menusGate).Get("/dishes-catalog/search", s.handleBODishesCatalogSearch)
-		r.With(s.requireBOSession, menusGate).Post("/dishes-catalog/upsert", s.handleBODishesCatalogUpsert)
+		r.With(s.requireBOSession, menusGate.View).Get("/platos", s.handleBOPlatosList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/platos", s.handleBOPlatosCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/platos/{id}", s.handleBOPlatosPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/platos/{id}", s.handleBOPlatosDelete)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/platos/{id}/toggle", s.handleBOPlatosToggle)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/bebidas", s.handleBOBebidasList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/bebidas", s.handleBOBebidasCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/bebidas/{id}", s.handleBOBebidasPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/bebidas/{id}", s.handleBOBebidasDelete)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/bebidas/{id}/toggle", s.handleBOBebidasToggle)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/cafes", s.handleBOCafesList)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/cafes", s.handleBOCafesCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/cafes/{id}", s.handleBOCafesPatch)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/cafes/{id}", s.handleBOCafesDelete)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/cafes/{id}/toggle", s.handleBOCafesToggle)
+
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus", s.handleBOGroupMenusList)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus/{id}", s.handleBOGroupMenuGet)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/group-menus", s.handleBOGroupMenuCreate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/group-menus/{id}", s.handleBOGroupMenuUpdate)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus/{id}/toggle", s.handleBOGroupMenuToggleActive)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/group-menus/{id}", s.handleBOGroupMenuDelete)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus-v2", s.handleBOGroupMenusV2List)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/group-menus-v2/drafts", s.handleBOGroupMenusV2CreateDraft)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus-v2/ws", s.handleBOGroupMenusV2AIWS)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus-v2/{id}", s.handleBOGroupMenusV2Get)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/group-menus-v2/{id}/basics", s.handleBOGroupMenusV2PatchBasics)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/group-menus-v2/{id}/menu-type", s.handleBOGroupMenusV2PatchMenuType)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/group-menus-v2/{id}/sections", s.handleBOGroupMenusV2PutSections)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/group-menus-v2/{id}/sections/{sectionId}/annotations", s.handleBOGroupMenusV2PatchSectionAnnotations)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus-v2/{id}/sections/{sectionId}/dishes", s.handleBOGroupMenusV2GetSectionDishes)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/group-menus-v2/{id}/sections/{sectionId}/dishes", s.handleBOGroupMenusV2PutSectionDishes)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}", s.handleBOGroupMenusV2PatchSectionDish)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}/image", s.handleBOGroupMenusV2UploadSectionDishImage)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/sections/{sectionId}/dishes/{dishId}/image/ai", s.handleBOGroupMenusV2GenerateSectionDishAIImage)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/preview-image", s.handleBOGroupMenusV2UploadMenuPreviewImage)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/preview-image/ai", s.handleBOGroupMenusV2GenerateMenuPreviewAIImage)
+		r.With(s.requireBOSession, menusGate.View).Get("/group-menus-v2/{id}/slider", s.handleBOGroupMenusV2GetSlider)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Patch("/group-menus-v2/{id}/slider", s.handleBOGroupMenusV2PatchSlider)
+		r.With(s.requireBOSession, menusGate.Create, s.auditBOWrite(boAuditCreate)).Post("/group-menus-v2/{id}/slider/images", s.handleBOGroupMenusV2UploadSliderImage)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/group-menus-v2/{id}/slider/images/{imageId}", s.handleBOGroupMenusV2DeleteSliderImage)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/group-menus-v2/{id}/slider/images", s.handleBOGroupMenusV2ReorderSliderImages)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/slider/images/ai", s.handleBOGroupMenusV2GenerateSliderAIImage)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/publish", s.handleBOGroupMenusV2Publish)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/toggle-active", s.handleBOGroupMenusV2ToggleActive)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/group-menus-v2/{id}/special-image", s.handleBOSpecialMenuImageUpload)
+		r.With(s.requireBOSession, menusGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/group-menus-v2/{id}", s.handleBOGroupMenusV2Delete)
+		r.With(s.requireBOSession, menusGate.View).Get("/dishes-catalog/search", s.handleBODishesCatalogSearch)
+		r.With(s.requireBOSession, menusGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/dishes-catalog/upsert", s.handleBODishesCatalogUpsert)
 
 		// Backoffice configuration for reservations.
-		r.With(s.requireBOSession, reservasGate).Get("/config/defaults", s.handleBOConfigDefaultsGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/defaults", s.handleBOConfigDefaultsSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/defaults", s.handleBOConfigDefaultsGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.defaults", s.handleBOConfigDefaultsGet)).Post("/config/defaults", s.handleBOConfigDefaultsSet)
+
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/day", s.handleBOConfigDayGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.day", s.handleBOConfigDayGet)).Post("/config/day", s.handleBOConfigDaySet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/day", s.handleBOConfigDayGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/day", s.handleBOConfigDaySet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/opening-hours", s.handleBOConfigOpeningHoursGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.opening-hours", s.handleBOConfigOpeningHoursGet)).Post("/config/opening-hours", s.handleBOConfigOpeningHoursSet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/opening-hours", s.handleBOConfigOpeningHoursGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/opening-hours", s.handleBOConfigOpeningHoursSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/mesas-de-dos", s.handleBOConfigMesasDeDosGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.mesas-de-dos", s.handleBOConfigMesasDeDosGet)).Post("/config/mesas-de-dos", s.handleBOConfigMesasDeDosSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/mesas-de-tres", s.handleBOConfigMesasDeTresGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.mesas-de-tres", s.handleBOConfigMesasDeTresGet)).Post("/config/mesas-de-tres", s.handleBOConfigMesasDeTresSet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/mesas-de-dos", s.handleBOConfigMesasDeDosGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/mesas-de-dos", s.handleBOConfigMesasDeDosSet)
-		r.With(s.requireBOSession, reservasGate).Get("/config/mesas-de-tres", s.handleBOConfigMesasDeTresGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/mesas-de-tres", s.handleBOConfigMesasDeTresSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/floors/defaults", s.handleBOConfigFloorsDefaultsGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.floors.defaults", s.handleBOConfigFloorsDefaultsGet)).Post("/config/floors/defaults", s.handleBOConfigFloorsDefaultsSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/floors", s.handleBOConfigFloorsGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.floors", s.handleBOConfigFloorsGet)).Post("/config/floors", s.handleBOConfigFloorsSet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/floors/defaults", s.handleBOConfigFloorsDefaultsGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/floors/defaults", s.handleBOConfigFloorsDefaultsSet)
-		r.With(s.requireBOSession, reservasGate).Get("/config/floors", s.handleBOConfigFloorsGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/floors", s.handleBOConfigFloorsSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/salon-condesa", s.handleBOConfigSalonCondesaGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.salon-condesa", s.handleBOConfigSalonCondesaGet)).Post("/config/salon-condesa", s.handleBOConfigSalonCondesaSet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/salon-condesa", s.handleBOConfigSalonCondesaGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/salon-condesa", s.handleBOConfigSalonCondesaSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/daily-limit", s.handleBOConfigDailyLimitGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.daily-limit", s.handleBOConfigDailyLimitGet)).Post("/config/daily-limit", s.handleBOConfigDailyLimitSet)
 
-		r.With(s.requireBOSession, reservasGate).Get("/config/daily-limit", s.handleBOConfigDailyLimitGet)
-		r.With(s.requireBOSession, reservasGate).Post("/config/daily-limit", s.handleBOConfigDailyLimitSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/services", s.handleBOConfigServicesGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.services", s.handleBOConfigServicesGet)).Post("/config/services", s.handleBOConfigServicesSet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.services.day", s.handleBOConfigServicesGet)).Post("/config/services/day", s.handleBOConfigServiceDaySet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/deposit-rules", s.handleBOConfigDepositRulesGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.deposit-rules", s.handleBOConfigDepositRulesGet)).Post("/config/deposit-rules", s.handleBOConfigDepositRulesSet)
+		r.With(s.requireBOSession, reservasGate.View).Get("/config/no-show-policies", s.handleBOConfigNoShowPoliciesGet)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOConfig("config.no-show-policies", s.handleBOConfigNoShowPoliciesGet)).Post("/config/no-show-policies", s.handleBOConfigNoShowPoliciesSet)
 
 		// Restaurant-level settings (integrations/branding).
-		r.With(s.requireBOSession, ajustesGate).Get("/integrations", s.handleBOIntegrationsGet)
-		r.With(s.requireBOSession, ajustesGate).Post("/integrations", s.handleBOIntegrationsSet)
-		r.With(s.requireBOSession, ajustesGate, rolesAdminGate).Get("/integrations/uazapi/servers", s.handleBOUAZAPIServersList)
-		r.With(s.requireBOSession, ajustesGate, rolesAdminGate).Post("/integrations/uazapi/servers", s.handleBOUAZAPIServersCreate)
-		r.With(s.requireBOSession, ajustesGate, rolesAdminGate).Patch("/integrations/uazapi/servers/{id}", s.handleBOUAZAPIServersPatch)
-		r.With(s.requireBOSession, ajustesGate).Get("/branding", s.handleBOBrandingGet)
-		r.With(s.requireBOSession, ajustesGate).Post("/branding", s.handleBOBrandingSet)
-		r.With(s.requireBOSession, ajustesGate).Get("/website", s.handleBOPremiumWebsiteGet)
-		r.With(s.requireBOSession, ajustesGate).Put("/website", s.handleBOPremiumWebsiteUpsert)
-		r.With(s.requireBOSession, ajustesGate).Post("/website", s.handleBOPremiumWebsiteUpsert)
-		r.With(s.requireBOSession, ajustesGate).Get("/website/templates", s.handleBOPremiumWebsiteTemplates)
-		r.With(s.requireBOSession, ajustesGate).Get("/website/menu-templates", s.handleBOPremiumWebsiteMenuTemplatesGet)
-		r.With(s.requireBOSession, ajustesGate).Put("/website/menu-templates", s.handleBOPremiumWebsiteMenuTemplatesUpsert)
-		r.With(s.requireBOSession, ajustesGate).Post("/website/ai-generate", s.handleBOPremiumWebsiteAIGenerate)
-		r.With(s.requireBOSession, ajustesGate).Group(func(r chi.Router) {
+		r.With(s.requireBOSession, ajustesGate.View).Get("/integrations", s.handleBOIntegrationsGet)
+		r.With(s.requireBOSession, ajustesGate.Edit, s.auditBOConfig("integrations", s.handleBOIntegrationsGet)).Post("/integrations", s.handleBOIntegrationsSet)
+		r.With(s.requireBOSession, ajustesGate.Edit, rolesAdminGate).Post("/integrations/webhooks/secret", s.handleBOWebhookSecretRotate)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/integrations/webhooks/events", s.handleBOWebhookEventsList)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/integrations/webhooks/deliveries", s.handleBOWebhookDeliveriesList)
+		r.With(s.requireBOSession, ajustesGate.Edit).Post("/integrations/webhooks/deliveries/{id}/replay", s.handleBOWebhookDeliveryReplay)
+		r.With(s.requireBOSession, ajustesGate.View, rolesAdminGate).Get("/integrations/uazapi/servers", s.handleBOUAZAPIServersList)
+		r.With(s.requireBOSession, ajustesGate.Create, rolesAdminGate).Post("/integrations/uazapi/servers", s.handleBOUAZAPIServersCreate)
+		r.With(s.requireBOSession, ajustesGate.Edit, rolesAdminGate).Patch("/integrations/uazapi/servers/{id}", s.handleBOUAZAPIServersPatch)
+		r.With(s.requireBOSession, ajustesGate.View, rolesAdminGate).Get("/api-keys", s.handleBOAPIKeysList)
+		r.With(s.requireBOSession, ajustesGate.Create, rolesAdminGate).Post("/api-keys", s.handleBOAPIKeyCreate)
+		r.With(s.requireBOSession, ajustesGate.Delete, rolesAdminGate).Delete("/api-keys/{id}", s.handleBOAPIKeyRevoke)
+		r.With(s.requireBOSession, ajustesGate.Export, rolesAdminGate).Post("/privacy/subject/export", s.handleBOPrivacySubjectExport)
+		r.With(s.requireBOSession, ajustesGate.Delete, rolesAdminGate).Post("/privacy/subject/anonymise", s.handleBOPrivacySubjectAnonymise)
+		r.With(s.requireBOSession, ajustesGate.View, rolesAdminGate).Get("/privacy/retention", s.handleBOPrivacyRetentionGet)
+		r.With(s.requireBOSession, ajustesGate.Edit, rolesAdminGate, s.auditBOConfig("config.privacy-retention", s.handleBOPrivacyRetentionGet)).Post("/privacy/retention", s.handleBOPrivacyRetentionSet)
+		r.With(s.requireBOSession, ajustesGate.Edit, rolesAdminGate).Post("/privacy/retention/run", s.handleBOPrivacyRetentionRun)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/branding", s.handleBOBrandingGet)
+		r.With(s.requireBOSession, ajustesGate.Edit, s.auditBOConfig("branding", s.handleBOBrandingGet)).Post("/branding", s.handleBOBrandingSet)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/website", s.handleBOPremiumWebsiteGet)
+		r.With(s.requireBOSession, ajustesGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/website", s.handleBOPremiumWebsiteUpsert)
+		r.With(s.requireBOSession, ajustesGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/website", s.handleBOPremiumWebsiteUpsert)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/website/templates", s.handleBOPremiumWebsiteTemplates)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/website/menu-templates", s.handleBOPremiumWebsiteMenuTemplatesGet)
+		r.With(s.requireBOSession, ajustesGate.Edit, s.auditBOConfig("website.menu-templates", s.handleBOPremiumWebsiteMenuTemplatesGet)).Put("/website/menu-templates", s.handleBOPremiumWebsiteMenuTemplatesUpsert)
+		r.With(s.requireBOSession, ajustesGate.Edit).Post("/website/ai-generate", s.handleBOPremiumWebsiteAIGenerate)
+		r.With(s.requireBOSession, ajustesGate.ByMethod).Group(func(r chi.Router) {
 			websiteBuilder.RegisterRoutes(r)
 		})
 		// Site builder routes (new visual editor)
-		r.With(s.requireBOSession, ajustesGate).Group(func(r chi.Router) {
+		r.With(s.requireBOSession, ajustesGate.ByMethod).Group(func(r chi.Router) {
 			RegisterSiteBuilderRoutes(r, s.db)
 		})
-		r.With(s.requireBOSession, ajustesGate).Get("/domains/search", s.handleBOPremiumDomainsSearch)
-		r.With(s.requireBOSession, ajustesGate).Post("/domains/quote", s.handleBOPremiumDomainsQuote)
-		r.With(s.requireBOSession, ajustesGate).Post("/domains/register", s.handleBOPremiumDomainsRegister)
-		r.With(s.requireBOSession, ajustesGate).Post("/domains/verify", s.handleBOPremiumDomainsVerify)
+		r.With(s.requireBOSession, ajustesGate.View).Get("/domains/search", s.handleBOPremiumDomainsSearch)
+		r.With(s.requireBOSession, ajustesGate.View).Post("/domains/quote", s.handleBOPremiumDomainsQuote)
+		r.With(s.requireBOSession, ajustesGate.Create).Post("/domains/register", s.handleBOPremiumDomainsRegister)
+		r.With(s.requireBOSession, ajustesGate.Edit).Post("/domains/verify", s.handleBOPremiumDomainsVerify)
 
 		// Tables premium endpoints.
-		r.With(s.requireBOSession, reservasGate).Get("/tables", s.handleBOPremiumTablesList)
-		r.With(s.requireBOSession, reservasGate).Post("/tables", s.handleBOPremiumTablesCreate)
-		r.With(s.requireBOSession, reservasGate).Put("/tables", s.handleBOPremiumTablesUpdate)
-		r.With(s.requireBOSession, reservasGate).Post("/tables/{id}/texture-image", s.handleBOPremiumTablesTextureImageUpload)
-		r.With(s.requireBOSession, reservasGate).Get("/tables/ws", s.handleBOPremiumTablesWS)
+		r.With(s.requireBOSession, reservasGate.View).Get("/tables", s.handleBOPremiumTablesList)
+		r.With(s.requireBOSession, reservasGate.Create, s.auditBOWrite(boAuditCreate)).Post("/tables", s.handleBOPremiumTablesCreate)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/tables", s.handleBOPremiumTablesUpdate)
+		r.With(s.requireBOSession, reservasGate.Edit, s.auditBOWrite(boAuditUpdate)).Post("/tables/{id}/texture-image", s.handleBOPremiumTablesTextureImageUpload)
+		r.With(s.requireBOSession, reservasGate.View).Get("/tables/ws", s.handleBOPremiumTablesWS)
+		r.With(s.requireBOSession, reservasGate.View).Post("/tables/auto-assign/preview", s.handleBOTablesAutoAssignPreview)
+		r.With(s.requireBOSession, reservasGate.Edit).Post("/tables/auto-assign/apply", s.handleBOTablesAutoAssignApply)
+		r.With(s.requireBOSession, reservasGate.View).Get("/tables/turn-times", s.handleBOTablesTurnTimes)
+		r.With(s.requireBOSession, reservasGate.View).Get("/tables/free", s.handleBOTablesFree)
 
 		// Members and role administration.
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members", s.handleBOMembersList)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members", s.handleBOMemberCreate)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}", s.handleBOMemberGet)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Patch("/members/{id}", s.handleBOMemberPatch)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/{id}/avatar", s.handleBOMemberAvatarUpload)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}/stats", s.handleBOMemberStats)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}/stats-year", s.handleBOMemberStatsYear)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}/stats-range", s.handleBOMemberStatsRange)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}/table-data", s.handleBOMemberTableData)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/{id}/time-balance", s.handleBOMemberQuarterBalance)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/{id}/ensure-user", s.handleBOMemberEnsureUser)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/{id}/invitation/resend", s.handleBOMemberInvitationResend)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/{id}/password-reset/send", s.handleBOMemberPasswordResetSend)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/roles", s.handleBORolesGet)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/roles", s.handleBORoleCreate)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Patch("/users/{id}/role", s.handleBOUserRolePatch)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/whatsapp/send", s.handleBOMembersWhatsAppSend)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/whatsapp/subscribe", s.handleBOMembersWhatsAppSubscribe)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/whatsapp/connect", s.handleBOMembersWhatsAppConnect)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Get("/members/whatsapp/connection", s.handleBOMembersWhatsAppConnectionStatus)
-		r.With(s.requireBOSession, miembrosGate, rolesAdminGate).Post("/members/whatsapp/disconnect", s.handleBOMembersWhatsAppDisconnect)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members", s.handleBOMembersList)
+		r.With(s.requireBOSession, miembrosGate.Create, rolesAdminGate).Post("/members", s.handleBOMemberCreate)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}", s.handleBOMemberGet)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Patch("/members/{id}", s.handleBOMemberPatch)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/{id}/avatar", s.handleBOMemberAvatarUpload)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}/stats", s.handleBOMemberStats)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}/stats-year", s.handleBOMemberStatsYear)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}/stats-range", s.handleBOMemberStatsRange)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}/table-data", s.handleBOMemberTableData)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/{id}/time-balance", s.handleBOMemberQuarterBalance)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/{id}/ensure-user", s.handleBOMemberEnsureUser)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/{id}/invitation/resend", s.handleBOMemberInvitationResend)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/{id}/password-reset/send", s.handleBOMemberPasswordResetSend)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/roles", s.handleBORolesGet)
+		r.With(s.requireBOSession, miembrosGate.Create, rolesAdminGate).Post("/roles", s.handleBORoleCreate)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Patch("/users/{id}/role", s.handleBOUserRolePatch)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/users/{id}/unlock", s.handleBOUserUnlock)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/users/{id}/2fa/reset", s.handleBOUserTwoFactorReset)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/users/{id}/sessions", s.handleBOUserSessionsList)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/users/{id}/sessions/revoke", s.handleBOUserSessionsRevoke)
+		r.With(s.requireBOSession, rolesAdminGate).Get("/audit", s.handleBOAuditList)
+		r.With(s.requireBOSession, rolesAdminGate).Get("/audit/entities", s.handleBOAuditEntities)
+		r.With(s.requireBOSession, miembrosGate.Create, rolesAdminGate).Post("/members/whatsapp/send", s.handleBOMembersWhatsAppSend)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/whatsapp/subscribe", s.handleBOMembersWhatsAppSubscribe)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/whatsapp/connect", s.handleBOMembersWhatsAppConnect)
+		r.With(s.requireBOSession, miembrosGate.View, rolesAdminGate).Get("/members/whatsapp/connection", s.handleBOMembersWhatsAppConnectionStatus)
+		r.With(s.requireBOSession, miembrosGate.Edit, rolesAdminGate).Post("/members/whatsapp/disconnect", s.handleBOMembersWhatsAppDisconnect)
 
 		// Fichaje and schedules.
-		r.With(s.requireBOSession, fichajeGate).Get("/fichaje/ping", s.handleBOFichajePing)
-		r.With(s.requireBOSession, fichajeGate).Get("/fichaje/state", s.handleBOFichajeState)
-		r.With(s.requireBOSession, fichajeGate).Post("/fichaje/start", s.handleBOFichajeStart)
-		r.With(s.requireBOSession, fichajeGate).Post("/fichaje/stop", s.handleBOFichajeStop)
-		r.With(s.requireBOSession, fichajeGate).Get("/fichaje/ws", s.handleBOFichajeWS)
-		r.With(s.requireBOSession, fichajeGate, rolesAdminGate).Post("/fichaje/admin/start", s.handleBOFichajeAdminStart)
-		r.With(s.requireBOSession, fichajeGate, rolesAdminGate).Post("/fichaje/admin/stop", s.handleBOFichajeAdminStop)
-		r.With(s.requireBOSession, fichajeGate, rolesAdminGate).Get("/fichaje/entries", s.handleBOFichajeEntriesList)
-		r.With(s.requireBOSession, fichajeGate, rolesAdminGate).Patch("/fichaje/entries/{id}", s.handleBOFichajeEntryPatch)
-
-		r.With(s.requireBOSession, horariosGate).Get("/horarios", s.handleBOHorariosList)
-		r.With(s.requireBOSession, horariosGate).Post("/horarios", s.handleBOHorariosAssign)
-		r.With(s.requireBOSession, horariosGate).Put("/horarios/{id}", s.handleBOHorariosUpdate)
-		r.With(s.requireBOSession, horariosGate).Delete("/horarios/{id}", s.handleBOHorariosDelete)
-		r.With(s.requireBOSession, horariosGate).Get("/horarios/month", s.handleBOHorariosMonth)
-		r.With(s.requireBOSession, fichajeGate).Get("/horarios/my-schedule", s.handleBOHorariosMySchedule)
+		r.With(s.requireBOSession, fichajeGate.View).Get("/fichaje/ping", s.handleBOFichajePing)
+		r.With(s.requireBOSession, fichajeGate.View).Get("/fichaje/state", s.handleBOFichajeState)
+		r.With(s.requireBOSession, fichajeGate.Create).Post("/fichaje/start", s.handleBOFichajeStart)
+		r.With(s.requireBOSession, fichajeGate.Create).Post("/fichaje/stop", s.handleBOFichajeStop)
+		r.With(s.requireBOSession, fichajeGate.View).Get("/fichaje/ws", s.handleBOFichajeWS)
+		r.With(s.requireBOSession, fichajeGate.Create, rolesAdminGate).Post("/fichaje/admin/start", s.handleBOFichajeAdminStart)
+		r.With(s.requireBOSession, fichajeGate.Create, rolesAdminGate).Post("/fichaje/admin/stop", s.handleBOFichajeAdminStop)
+		r.With(s.requireBOSession, fichajeGate.View, rolesAdminGate).Get("/fichaje/entries", s.handleBOFichajeEntriesList)
+		r.With(s.requireBOSession, fichajeGate.Edit, rolesAdminGate).Patch("/fichaje/entries/{id}", s.handleBOFichajeEntryPatch)
+
+		r.With(s.requireBOSession, horariosGate.View).Get("/horarios", s.handleBOHorariosList)
+		r.With(s.requireBOSession, horariosGate.Create, s.auditBOWrite(boAuditCreate)).Post("/horarios", s.handleBOHorariosAssign)
+		r.With(s.requireBOSession, horariosGate.Edit, s.auditBOWrite(boAuditUpdate)).Put("/horarios/{id}", s.handleBOHorariosUpdate)
+		r.With(s.requireBOSession, horariosGate.Delete, s.auditBOWrite(boAuditDelete)).Delete("/horarios/{id}", s.handleBOHorariosDelete)
+		r.With(s.requireBOSession, horariosGate.View).Get("/horarios/month", s.handleBOHorariosMonth)
+		r.With(s.requireBOSession, fichajeGate.View).Get("/horarios/my-schedule", s.handleBOHorariosMySchedule)
 
 		// Invoices management
-		r.With(s.requireBOSession, facturasGate).Get("/invoices", s.handleBOInvoicesList)
-		r.With(s.requireBOSession, facturasGate).Get("/invoices/{id}", s.handleBOInvoiceGet)
-		r.With(s.requireBOSession, facturasGate).Post("/invoices", s.handleBOInvoiceCreate)
-		r.With(s.requireBOSession, facturasGate).Put("/invoices/{id}", s.handleBOInvoiceUpdate)
-		r.With(s.requireBOSession, facturasGate).Delete("/invoices/{id}", s.handleBOInvoiceDelete)
-		r.With(s.requireBOSession, facturasGate).Post("/invoices/{id}/send", s.handleBOInvoiceSend)
-		r.With(s.requireBOSession, facturasGate).Post("/invoices/{id}/upload-image", s.handleBOInvoiceUploadImage)
-		r.With(s.requireBOSession, facturasGate).Get("/invoices/search-reservation", s.handleBOInvoicesSearchReservation)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices", s.handleBOInvoicesList)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices/{id}", s.handleBOInvoiceGet)
+		r.With(s.requireBOSession, facturasGate.Create).Post("/invoices", s.handleBOInvoiceCreate)
+		r.With(s.requireBOSession, facturasGate.Edit).Put("/invoices/{id}", s.handleBOInvoiceUpdate)
+		r.With(s.requireBOSession, facturasGate.Delete).Delete("/invoices/{id}", s.handleBOInvoiceDelete)
+		r.With(s.requireBOSession, facturasGate.Edit).Post("/invoices/{id}/send", s.handleBOInvoiceSend)
+		r.With(s.requireBOSession, facturasGate.Edit).Post("/invoices/{id}/issue", s.handleBOInvoiceIssue)
+		r.With(s.requireBOSession, facturasGate.Create).Post("/invoices/{id}/rectify", s.handleBOInvoiceRectify)
+		r.With(s.requireBOSession, facturasGate.Edit).Post("/invoices/{id}/upload-image", s.handleBOInvoiceUploadImage)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices/search-reservation", s.handleBOInvoicesSearchReservation)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices/fiscal-profile", s.handleBOInvoiceFiscalProfileGet)
+		r.With(s.requireBOSession, facturasGate.Edit, rolesAdminGate, s.auditBOConfig("fiscal_profile", s.handleBOInvoiceFiscalProfileGet)).Put("/invoices/fiscal-profile", s.handleBOInvoiceFiscalProfileUpdate)
+		r.With(s.requireBOSession, facturasGate.Export).Get("/invoices/fiscal-records/export", s.handleBOInvoiceFiscalRecordsExport)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices/fiscal-records/verify", s.handleBOInvoiceFiscalRecordsVerify)
+		r.With(s.requireBOSession, facturasGate.View).Get("/invoices/{id}/fiscal-record", s.handleBOInvoiceFiscalRecordGet)
+		r.With(s.requireBOSession, facturasGate.Edit).Post("/invoices/{id}/fiscal-record/submit", s.handleBOInvoiceFiscalRecordSubmit)
 	})
 
 	r.Get("/api/public/website-builder/render/{kind}", s.handleWebsiteBuilderRenderFragment)
 
+	// Payment provider callbacks find the restaurant through the payment.
+	r.Post("/payments/webhook", s.handlePaymentWebhook)
+
 	// Everything below is restaurant-scoped.
 	r.Group(func(r chi.Router) {
 		r.Use(s.withRestaurant)
@@ -335,6 +475,7 @@ func (s *Server) Routes() http.Handler {
 		r.Get("/reservations/two-top-availability", s.handleFetchMesasDeDos)
 		r.Get("/reservations/hour-data", s.handleGetHourData)
 		r.Get("/reservations/day-context", s.handleGetReservationDayContext)
+		r.Post("/reservations/waitlist", s.handleWaitlistJoin)
 		r.With(s.requireAdmin).Post("/menu-visibility", s.handleMenuVisibilityToggle)
 		r.Get("/menus/public", s.handlePublicMenus)
 		r.Get("/menus/dia", s.handleMenuDia)
@@ -449,30 +590,36 @@ func (s *Server) Routes() http.Handler {
 		r.Post("/cancel_reservation.php", s.handleCancelReservationPage)
 		r.Get("/book_rice.php", s.handleBookRicePage)
 		r.Post("/book_rice.php", s.handleBookRicePage)
+		r.Get("/waitlist_claim.php", s.handleWaitlistClaimPage)
+		r.Post("/waitlist_claim.php", s.handleWaitlistClaimPage)
+		r.Get("/payment_result.php", s.handlePaymentResultPage)
+		r.Get("/unsubscribe.php", s.handleMarketingUnsubscribePage)
+		r.Post("/unsubscribe.php", s.handleMarketingUnsubscribePage)
+		r.Get("/marketing_click.php", s.handleMarketingClick)
 
 		// Public booking creation (canonical route + legacy alias).
 		r.Post("/bookings/front", s.handleInsertBookingFront)
 		r.Post("/insert_booking_front.php", s.handleInsertBookingFront)
 
 		// Admin booking management (confreservas.php).
-		r.With(s.requireAdmin).Post("/insert_booking.php", s.handleInsertBookingAdmin)
-		r.With(s.requireAdmin).Post("/fetch_bookings.php", s.handleFetchBookings)
-		r.With(s.requireAdmin).Post("/get_booking.php", s.handleGetBooking)
-		r.With(s.requireAdmin).Post("/edit_booking.php", s.handleEditBooking)
-		r.With(s.requireAdmin).Post("/delete_booking.php", s.handleDeleteBooking)
-		r.With(s.requireAdmin).Post("/update_table_number.php", s.handleUpdateTableNumber)
-		r.With(s.requireAdmin).Post("/get_reservations.php", s.handleGetReservations)
-		r.With(s.requireAdmin).Post("/fetch_cancelled_bookings.php", s.handleFetchCancelledBookings)
-		r.With(s.requireAdmin).Post("/reactivate_booking.php", s.handleReactivateBooking)
+		r.With(s.requireAPIScope(apiScopeBookingsWrite)).Post("/insert_booking.php", s.handleInsertBookingAdmin)
+		r.With(s.requireAPIScope(apiScopeBookingsRead)).Post("/fetch_bookings.php", s.handleFetchBookings)
+		r.With(s.requireAPIScope(apiScopeBookingsRead)).Post("/get_booking.php", s.handleGetBooking)
+		r.With(s.requireAPIScope(apiScopeBookingsWrite)).Post("/edit_booking.php", s.handleEditBooking)
+		r.With(s.requireAPIScope(apiScopeBookingsWrite)).Post("/delete_booking.php", s.handleDeleteBooking)
+		r.With(s.requireAPIScope(apiScopeBookingsWrite)).Post("/update_table_number.php", s.handleUpdateTableNumber)
+		r.With(s.requireAPIScope(apiScopeBookingsRead)).Post("/get_reservations.php", s.handleGetReservations)
+		r.With(s.requireAPIScope(apiScopeBookingsRead)).Post("/fetch_cancelled_bookings.php", s.handleFetchCancelledBookings)
+		r.With(s.requireAPIScope(apiScopeBookingsWrite)).Post("/reactivate_booking.php", s.handleReactivateBooking)
 
 		// Admin tools / settings.
-		r.With(s.requireAdmin).Post("/update_daily_limit.php", s.handleUpdateDailyLimit)
-		r.With(s.requireAdmin).Post("/limitemesasdedos.php", s.handleSetMesasDeDosLimit)
-		r.With(s.requireAdmin).Post("/get_mesasdedos_limit.php", s.handleGetMesasDeDosLimit)
-		r.With(s.requireAdmin).Post("/check_day_status.php", s.handleCheckDayStatus)
-		r.With(s.requireAdmin).Post("/open_day.php", s.handleOpenDay)
-		r.With(s.requireAdmin).Post("/close_day.php", s.handleCloseDay)
-		r.With(s.requireAdmin).Post("/fetch_occupancy.php", s.handleFetchOccupancy)
+		r.With(s.requireAPIScope(apiScopeAvailabilityWrite)).Post("/update_daily_limit.php", s.handleUpdateDailyLimit)
+		r.With(s.requireAPIScope(apiScopeAvailabilityWrite)).Post("/limitemesasdedos.php", s.handleSetMesasDeDosLimit)
+		r.With(s.requireAPIScope(apiScopeAvailabilityRead)).Post("/get_mesasdedos_limit.php", s.handleGetMesasDeDosLimit)
+		r.With(s.requireAPIScope(apiScopeAvailabilityRead)).Post("/check_day_status.php", s.handleCheckDayStatus)
+		r.With(s.requireAPIScope(apiScopeAvailabilityWrite)).Post("/open_day.php", s.handleOpenDay)
+		r.With(s.requireAPIScope(apiScopeAvailabilityWrite)).Post("/close_day.php", s.handleCloseDay)
+		r.With(s.requireAPIScope(apiScopeAvailabilityRead)).Post("/fetch_occupancy.php", s.handleFetchOccupancy)
 	})
 
 	return r
@@ -504,27 +651,15 @@ func (s *Server) resolveAllowedOrigin(origin string) string {
 	return ""
 }
 
+// requireAdmin gates legacy admin endpoints that no API key scope covers.
+// Only the global ADMIN_TOKEN passes; ADMIN_OPEN=true lifts the gate for
+// local development.
 func (s *Server) requireAdmin(next http.Handler) http.Handler {
-	// If ADMIN_TOKEN is not set, don't gate admin endpoints (dev convenience).
-	if strings.TrimSpace(s.cfg.AdminToken) == "" {
-		return next
-	}
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := strings.TrimSpace(r.Header.Get("X-Admin-Token"))
-		if token == "" {
-			// Bearer token support.
-			authz := strings.TrimSpace(r.Header.Get("Authorization"))
-			if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
-				token = strings.TrimSpace(authz[len("bearer "):])
-			}
-		}
-
-		if token == "" || token != s.cfg.AdminToken {
+		if !s.cfg.AdminOpen && !s.validAdminToken(r) {
 			httpx.WriteError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
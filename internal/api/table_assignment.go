@@ -0,0 +1,393 @@
+package api
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table auto-assignment seats the bookings of a date onto restaurant_tables.
+// The attributes it needs live in the table metadata, like the rest of the
+// floor-plan extras:
+//
+//	floor_number   floor the table is on (default 0)
+//	combine_group  tables of the same group and floor can be pushed together
+//	accessible     room for high chairs and strollers
+//
+// The result is written to the legacy bookings.table_number as the table
+// names joined with "+", so existing screens and webhooks keep working.
+
+const (
+	defaultTableTurnMinutes = 120
+	maxCombinedTables       = 3
+)
+
+// Reasons a booking is left without a table.
+const (
+	tableAssignTooLarge    = "too_large"
+	tableAssignNoFreeTable = "no_free_table"
+	// Already arrived or at a table: staff seat them by hand.
+	tableAssignInService = "in_service"
+)
+
+// Warnings attached to an assignment that missed a preference.
+const (
+	tableAssignFloorMismatch = "floor_mismatch"
+	tableAssignNotAccessible = "not_accessible"
+)
+
+type assignableTable struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Capacity   int    `json:"capacity"`
+	Floor      int    `json:"floorNumber"`
+	Group      string `json:"combineGroup,omitempty"`
+	Accessible bool   `json:"accessible"`
+	Order      int    `json:"-"`
+}
+
+type assignableBooking struct {
+	ID             int
+	CustomerName   string
+	Time           string // HH:MM
+	PartySize      int
+	PreferredFloor *int
+	Extras         int // high chairs + strollers
+	TableNumber    string
+	TableIDs       []int64 // tables TableNumber resolves to
+	SeatState      string
+	SeatedAt       string // HH:MM, empty until seated
+	LeftAt         string // HH:MM, empty until the table is released
+}
+
+type tableAssignment struct {
+	BookingID    int      `json:"bookingId"`
+	CustomerName string   `json:"customerName"`
+	Time         string   `json:"time"`
+	PartySize    int      `json:"partySize"`
+	TableIDs     []int64  `json:"tableIds"`
+	TableNumber  string   `json:"tableNumber"`
+	Capacity     int      `json:"capacity"`
+	FloorNumber  int      `json:"floorNumber"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+type tableAssignmentMiss struct {
+	BookingID    int    `json:"bookingId"`
+	CustomerName string `json:"customerName"`
+	Time         string `json:"time"`
+	PartySize    int    `json:"partySize"`
+	Reason       string `json:"reason"`
+}
+
+type tableAssignmentPlan struct {
+	Turns       turnTimes             `json:"turns"`
+	Assignments []tableAssignment     `json:"assignments"`
+	Kept        []tableAssignment     `json:"kept"`
+	Unassigned  []tableAssignmentMiss `json:"unassigned"`
+}
+
+// tableCandidate is a single table or a combination that can seat a party.
+type tableCandidate struct {
+	tables     []int // indexes into the table list
+	capacity   int
+	floor      int
+	accessible bool
+}
+
+type tableSpan struct{ start, end int }
+
+// tableNumberFromNames is the table_number stored for a set of tables.
+func tableNumberFromNames(names []string) string {
+	return strings.Join(names, "+")
+}
+
+// resolveTableNumber maps a stored table_number back to table ids. Names are
+// matched case-insensitively and may be separated by "+" or ",". It returns
+// nil when any part is unknown.
+func resolveTableNumber(raw string, tables []assignableTable) []int64 {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var ids []int64
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == '+' || r == ',' }) {
+		part = strings.TrimSpace(part)
+		found := false
+		for _, t := range tables {
+			if strings.EqualFold(t.Name, part) {
+				ids = append(ids, t.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return ids
+}
+
+// tableCandidates lists every single table plus every combination of up to
+// maxCombinedTables tables sharing a combine group on the same floor.
+func tableCandidates(tables []assignableTable) []tableCandidate {
+	out := make([]tableCandidate, 0, len(tables))
+	groups := map[string][]int{}
+	var groupKeys []string
+	for i, t := range tables {
+		out = append(out, tableCandidate{tables: []int{i}, capacity: t.Capacity, floor: t.Floor, accessible: t.Accessible})
+		if t.Group == "" {
+			continue
+		}
+		key := strconv.Itoa(t.Floor) + "/" + t.Group
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var combine func(members []int, from int, picked []int)
+	combine = func(members []int, from int, picked []int) {
+		if len(picked) >= 2 {
+			c := tableCandidate{tables: slices.Clone(picked), floor: tables[picked[0]].Floor}
+			for _, i := range picked {
+				c.capacity += tables[i].Capacity
+				c.accessible = c.accessible || tables[i].Accessible
+			}
+			out = append(out, c)
+		}
+		if len(picked) == maxCombinedTables {
+			return
+		}
+		for j := from; j < len(members); j++ {
+			combine(members, j+1, append(picked, members[j]))
+		}
+	}
+	for _, key := range groupKeys {
+		combine(groups[key], 0, nil)
+	}
+	return out
+}
+
+// tableOccupancy tracks when each table is held. A booking holds its tables
+// from its time (or when it was actually seated) for the turn of its party
+// size, or until it left, so a table that frees up early can take a second
+// seating.
+type tableOccupancy struct {
+	tables []assignableTable
+	byID   map[int64]int
+	busy   [][]tableSpan
+	turns  turnTimes
+}
+
+func newTableOccupancy(tables []assignableTable, turns turnTimes) *tableOccupancy {
+	o := &tableOccupancy{
+		tables: tables,
+		byID:   make(map[int64]int, len(tables)),
+		busy:   make([][]tableSpan, len(tables)),
+		turns:  turns,
+	}
+	for i, t := range tables {
+		o.byID[t.ID] = i
+	}
+	return o
+}
+
+func (o *tableOccupancy) span(b assignableBooking) tableSpan {
+	start := serviceHourSortKey(b.Time)
+	if b.SeatedAt != "" {
+		start = serviceHourSortKey(b.SeatedAt)
+	}
+	if b.LeftAt != "" {
+		return tableSpan{start: start, end: max(serviceHourSortKey(b.LeftAt), start)}
+	}
+	return tableSpan{start: start, end: start + o.turns.forParty(b.PartySize)}
+}
+
+func (o *tableOccupancy) hold(idx []int, span tableSpan) {
+	for _, i := range idx {
+		o.busy[i] = append(o.busy[i], span)
+	}
+}
+
+func (o *tableOccupancy) free(c tableCandidate, span tableSpan) bool {
+	for _, i := range c.tables {
+		for _, other := range o.busy[i] {
+			if span.start < other.end && other.start < span.end {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// holdKept registers the bookings that already have tables and returns them.
+// Unknown table names are kept as typed but hold nothing.
+func (o *tableOccupancy) holdKept(bookings []assignableBooking) []tableAssignment {
+	kept := []tableAssignment{}
+	for _, b := range bookings {
+		if strings.TrimSpace(b.TableNumber) == "" {
+			continue
+		}
+		var idx []int
+		for _, id := range b.TableIDs {
+			if i, ok := o.byID[id]; ok {
+				idx = append(idx, i)
+			}
+		}
+		o.hold(idx, o.span(b))
+		a := o.toAssignment(b, idx)
+		a.TableNumber = b.TableNumber
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+func (o *tableOccupancy) toAssignment(b assignableBooking, idx []int) tableAssignment {
+	a := tableAssignment{
+		BookingID:    b.ID,
+		CustomerName: b.CustomerName,
+		Time:         b.Time,
+		PartySize:    b.PartySize,
+		TableIDs:     make([]int64, 0, len(idx)),
+	}
+	names := make([]string, 0, len(idx))
+	for _, i := range idx {
+		a.TableIDs = append(a.TableIDs, o.tables[i].ID)
+		a.Capacity += o.tables[i].Capacity
+		names = append(names, o.tables[i].Name)
+	}
+	if len(idx) > 0 {
+		a.FloorNumber = o.tables[idx[0]].Floor
+	}
+	a.TableNumber = tableNumberFromNames(names)
+	return a
+}
+
+// candidateScore ranks a candidate for a booking, lower is better: preferred
+// floor, an accessible table when bringing high chairs or strollers, fewest
+// empty seats, fewest tables, not wasting an accessible table on a party that
+// doesn't need it, and display order.
+func (o *tableOccupancy) candidateScore(b assignableBooking, c tableCandidate) [6]int {
+	return [6]int{
+		boolToInt(b.PreferredFloor != nil && *b.PreferredFloor != c.floor),
+		boolToInt(b.Extras > 0 && !c.accessible),
+		c.capacity - b.PartySize,
+		len(c.tables),
+		boolToInt(b.Extras == 0 && c.accessible),
+		o.tables[c.tables[0]].Order,
+	}
+}
+
+// freeCandidates returns the candidates that can seat b for its whole turn,
+// best first.
+func (o *tableOccupancy) freeCandidates(b assignableBooking, candidates []tableCandidate) []tableCandidate {
+	span := o.span(b)
+	var out []tableCandidate
+	for _, c := range candidates {
+		if c.capacity >= b.PartySize && o.free(c, span) {
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		si, sj := o.candidateScore(b, out[i]), o.candidateScore(b, out[j])
+		return slices.Compare(si[:], sj[:]) < 0
+	})
+	return out
+}
+
+func maxCandidateCapacity(candidates []tableCandidate) int {
+	n := 0
+	for _, c := range candidates {
+		n = max(n, c.capacity)
+	}
+	return n
+}
+
+// planTableAssignments seats every booking without a table that has no seat
+// state yet. Bookings that already have one are kept and hold their tables;
+// bookings that left without a table are ignored, and those already in the
+// restaurant without one are reported as in_service rather than moved onto a
+// table. Larger parties are placed first, each on its best free candidate.
+func planTableAssignments(tables []assignableTable, bookings []assignableBooking, turns turnTimes) tableAssignmentPlan {
+	o := newTableOccupancy(tables, turns)
+	candidates := tableCandidates(tables)
+	maxCapacity := maxCandidateCapacity(candidates)
+	plan := tableAssignmentPlan{
+		Turns:       turns,
+		Assignments: []tableAssignment{},
+		Kept:        o.holdKept(bookings),
+		Unassigned:  []tableAssignmentMiss{},
+	}
+
+	var pending []assignableBooking
+	for _, b := range bookings {
+		if strings.TrimSpace(b.TableNumber) != "" || b.SeatState == bookingSeatLeft {
+			continue
+		}
+		if b.SeatState != "" {
+			plan.Unassigned = append(plan.Unassigned, tableAssignmentMiss{
+				BookingID: b.ID, CustomerName: b.CustomerName, Time: b.Time, PartySize: b.PartySize, Reason: tableAssignInService,
+			})
+			continue
+		}
+		pending = append(pending, b)
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].PartySize != pending[j].PartySize {
+			return pending[i].PartySize > pending[j].PartySize
+		}
+		ki, kj := serviceHourSortKey(pending[i].Time), serviceHourSortKey(pending[j].Time)
+		if ki != kj {
+			return ki < kj
+		}
+		return pending[i].ID < pending[j].ID
+	})
+
+	for _, b := range pending {
+		miss := tableAssignmentMiss{BookingID: b.ID, CustomerName: b.CustomerName, Time: b.Time, PartySize: b.PartySize}
+		if b.PartySize > maxCapacity {
+			miss.Reason = tableAssignTooLarge
+			plan.Unassigned = append(plan.Unassigned, miss)
+			continue
+		}
+		free := o.freeCandidates(b, candidates)
+		if len(free) == 0 {
+			miss.Reason = tableAssignNoFreeTable
+			plan.Unassigned = append(plan.Unassigned, miss)
+			continue
+		}
+
+		c := free[0]
+		o.hold(c.tables, o.span(b))
+		a := o.toAssignment(b, c.tables)
+		score := o.candidateScore(b, c)
+		if score[0] == 1 {
+			a.Warnings = append(a.Warnings, tableAssignFloorMismatch)
+		}
+		if score[1] == 1 {
+			a.Warnings = append(a.Warnings, tableAssignNotAccessible)
+		}
+		plan.Assignments = append(plan.Assignments, a)
+	}
+
+	sort.SliceStable(plan.Assignments, func(i, j int) bool {
+		return serviceHourSortKey(plan.Assignments[i].Time) < serviceHourSortKey(plan.Assignments[j].Time)
+	})
+	return plan
+}
+
+// freeTablesFor lists the tables and combinations that could take a new
+// party of partySize at hhmm for its turn, best first, after the bookings
+// that already hold tables.
+func freeTablesFor(tables []assignableTable, bookings []assignableBooking, turns turnTimes, hhmm string, partySize int) []tableAssignment {
+	o := newTableOccupancy(tables, turns)
+	o.holdKept(bookings)
+	walkIn := assignableBooking{Time: hhmm, PartySize: partySize}
+	out := []tableAssignment{}
+	for _, c := range o.freeCandidates(walkIn, tableCandidates(tables)) {
+		out = append(out, o.toAssignment(walkIn, c.tables))
+	}
+	return out
+}
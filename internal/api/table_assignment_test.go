@@ -0,0 +1,180 @@
+package api
+
+import (
+	"slices"
+	"testing"
+)
+
+func testAssignTables() []assignableTable {
+	return []assignableTable{
+		{ID: 1, Name: "1", Capacity: 2, Floor: 0, Group: "ventana", Order: 1},
+		{ID: 2, Name: "2", Capacity: 2, Floor: 0, Group: "ventana", Order: 2},
+		{ID: 3, Name: "3", Capacity: 4, Floor: 0, Accessible: true, Order: 3},
+		{ID: 4, Name: "4", Capacity: 4, Floor: 1, Order: 4},
+	}
+}
+
+func TestPlanTableAssignmentsPrefersTightFitAndFloor(t *testing.T) {
+	floor1 := 1
+	plan := planTableAssignments(testAssignTables(), []assignableBooking{
+		{ID: 10, Time: "14:00", PartySize: 2},
+		{ID: 11, Time: "14:00", PartySize: 4, PreferredFloor: &floor1},
+		{ID: 12, Time: "14:00", PartySize: 3, Extras: 1},
+	}, fixedTurnTimes(120))
+
+	got := map[int][]int64{}
+	for _, a := range plan.Assignments {
+		got[a.BookingID] = a.TableIDs
+		if len(a.Warnings) > 0 {
+			t.Fatalf("booking %d warnings = %v, want none", a.BookingID, a.Warnings)
+		}
+	}
+	if !slices.Equal(got[10], []int64{1}) || !slices.Equal(got[11], []int64{4}) || !slices.Equal(got[12], []int64{3}) {
+		t.Fatalf("assignments = %v", got)
+	}
+	if len(plan.Unassigned) != 0 {
+		t.Fatalf("unassigned = %+v, want none", plan.Unassigned)
+	}
+}
+
+func TestPlanTableAssignmentsCombinesTables(t *testing.T) {
+	tables := testAssignTables()[:2]
+	plan := planTableAssignments(tables, []assignableBooking{{ID: 20, Time: "21:00", PartySize: 4}}, turnTimes{})
+	if len(plan.Assignments) != 1 {
+		t.Fatalf("plan = %+v, want one assignment", plan)
+	}
+	a := plan.Assignments[0]
+	if a.TableNumber != "1+2" || a.Capacity != 4 || plan.Turns.forParty(4) != defaultTableTurnMinutes {
+		t.Fatalf("assignment = %+v", a)
+	}
+
+	plan = planTableAssignments(tables, []assignableBooking{{ID: 21, Time: "21:00", PartySize: 5}}, turnTimes{})
+	if len(plan.Unassigned) != 1 || plan.Unassigned[0].Reason != tableAssignTooLarge {
+		t.Fatalf("unassigned = %+v, want %s", plan.Unassigned, tableAssignTooLarge)
+	}
+}
+
+func TestPlanTableAssignmentsRespectsTurnAndKeptTables(t *testing.T) {
+	tables := []assignableTable{{ID: 3, Name: "3", Capacity: 4}}
+	bookings := []assignableBooking{
+		{ID: 30, Time: "13:30", PartySize: 4, TableNumber: "3"},
+		{ID: 31, Time: "14:30", PartySize: 2},
+		{ID: 32, Time: "15:30", PartySize: 2},
+	}
+	for i := range bookings {
+		bookings[i].TableIDs = resolveTableNumber(bookings[i].TableNumber, tables)
+	}
+
+	plan := planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if len(plan.Kept) != 1 || plan.Kept[0].BookingID != 30 {
+		t.Fatalf("kept = %+v", plan.Kept)
+	}
+	if len(plan.Assignments) != 1 || plan.Assignments[0].BookingID != 32 {
+		t.Fatalf("assignments = %+v, want booking 32", plan.Assignments)
+	}
+	if len(plan.Unassigned) != 1 || plan.Unassigned[0].BookingID != 31 || plan.Unassigned[0].Reason != tableAssignNoFreeTable {
+		t.Fatalf("unassigned = %+v, want booking 31", plan.Unassigned)
+	}
+}
+
+func TestPlanTableAssignmentsSecondSeating(t *testing.T) {
+	tables := []assignableTable{{ID: 3, Name: "3", Capacity: 4}}
+	bookings := []assignableBooking{
+		{ID: 40, Time: "13:00", PartySize: 4, TableNumber: "3", SeatState: bookingSeatLeft, SeatedAt: "13:05", LeftAt: "14:10"},
+		{ID: 41, Time: "14:30", PartySize: 4},
+	}
+	bookings[0].TableIDs = resolveTableNumber("3", tables)
+
+	plan := planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if len(plan.Assignments) != 1 || plan.Assignments[0].BookingID != 41 {
+		t.Fatalf("assignments = %+v, want booking 41 on the released table", plan.Assignments)
+	}
+
+	if got := freeTablesFor(tables, bookings[:1], fixedTurnTimes(120), "14:00", 2); len(got) != 0 {
+		t.Fatalf("freeTablesFor(14:00) = %+v, want none before the table is released", got)
+	}
+	if got := freeTablesFor(tables, bookings[:1], fixedTurnTimes(120), "14:15", 2); len(got) != 1 {
+		t.Fatalf("freeTablesFor(14:15) = %+v, want table 3", got)
+	}
+}
+
+func TestPlanTableAssignmentsSkipsBookingsInService(t *testing.T) {
+	tables := []assignableTable{{ID: 3, Name: "3", Capacity: 4}}
+	bookings := []assignableBooking{
+		{ID: 50, Time: "13:00", PartySize: 4, SeatState: bookingSeatSeated, SeatedAt: "13:05"},
+		{ID: 51, Time: "13:00", PartySize: 2, SeatState: bookingSeatArrived},
+		{ID: 52, Time: "13:00", PartySize: 2, SeatState: bookingSeatLeft},
+		{ID: 53, Time: "13:00", PartySize: 2},
+	}
+
+	plan := planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if len(plan.Assignments) != 1 || plan.Assignments[0].BookingID != 53 {
+		t.Fatalf("assignments = %+v, want only booking 53", plan.Assignments)
+	}
+	if len(plan.Unassigned) != 2 {
+		t.Fatalf("unassigned = %+v, want bookings 50 and 51", plan.Unassigned)
+	}
+	for _, miss := range plan.Unassigned {
+		if miss.Reason != tableAssignInService || (miss.BookingID != 50 && miss.BookingID != 51) {
+			t.Fatalf("unassigned = %+v", plan.Unassigned)
+		}
+	}
+}
+
+func TestScopeAssignableBookingsReassignPinsSeatedGuests(t *testing.T) {
+	tables := []assignableTable{{ID: 3, Name: "3", Capacity: 4}, {ID: 4, Name: "4", Capacity: 4}}
+	all := []assignableBooking{
+		{ID: 60, Time: "13:00", PartySize: 4, TableNumber: "3", SeatState: bookingSeatSeated, SeatedAt: "13:05"},
+		{ID: 61, Time: "13:00", PartySize: 4, TableNumber: "4", SeatState: bookingSeatPaid, SeatedAt: "13:00"},
+		{ID: 62, Time: "13:15", PartySize: 4, TableNumber: "4"},
+		{ID: 63, Time: "13:15", PartySize: 2},
+	}
+	everything := func(string) bool { return true }
+
+	bookings, previous := scopeAssignableBookings(all, tables, everything, true)
+	if bookings[0].TableNumber != "3" || bookings[1].TableNumber != "4" || bookings[2].TableNumber != "" {
+		t.Fatalf("bookings = %+v, want seated guests pinned and 62 cleared", bookings)
+	}
+	if previous[62] != "4" || previous[63] != "" {
+		t.Fatalf("previous = %v", previous)
+	}
+
+	plan := planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if len(plan.Kept) != 2 || len(plan.Assignments) != 0 {
+		t.Fatalf("plan = %+v, want both seated guests kept and nobody moved onto their tables", plan)
+	}
+}
+
+func TestReleasedTableBookings(t *testing.T) {
+	tables := []assignableTable{{ID: 3, Name: "3", Capacity: 4}}
+	all := []assignableBooking{
+		{ID: 70, Time: "13:00", PartySize: 2, TableNumber: "3"},
+		{ID: 71, Time: "13:00", PartySize: 4},
+		{ID: 72, Time: "13:00", PartySize: 8},
+	}
+	bookings, previous := scopeAssignableBookings(all, tables, func(string) bool { return true }, true)
+	plan := planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if len(plan.Assignments) != 1 || plan.Assignments[0].BookingID != 71 {
+		t.Fatalf("assignments = %+v, want booking 71 on table 3", plan.Assignments)
+	}
+	// 70 lost table 3 to 71: apply must clear it, or the table is booked twice.
+	if got := releasedTableBookings(plan, previous); len(got) != 1 || got[0] != 70 {
+		t.Fatalf("released = %v, want [70]", got)
+	}
+
+	bookings, previous = scopeAssignableBookings(all, tables, func(string) bool { return true }, false)
+	plan = planTableAssignments(tables, bookings, fixedTurnTimes(120))
+	if got := releasedTableBookings(plan, previous); len(got) != 0 {
+		t.Fatalf("released without reassign = %v", got)
+	}
+}
+
+func TestResolveTableNumber(t *testing.T) {
+	tables := testAssignTables()
+	if got := resolveTableNumber("1 + 2", tables); !slices.Equal(got, []int64{1, 2}) {
+		t.Fatalf("resolveTableNumber(1 + 2) = %v", got)
+	}
+	if got := resolveTableNumber("3,9", tables); got != nil {
+		t.Fatalf("resolveTableNumber(3,9) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Turn times are learnt from bookings that went through the floor lifecycle
+// (seated_at..left_at). Party sizes are grouped in buckets; a bucket with too
+// few samples falls back to the default turn.
+
+const (
+	minTurnSamples     = 5
+	turnHistoryDays    = 90
+	minTurnSampleMins  = 15
+	maxTurnSampleMins  = 360
+	turnRoundToMinutes = 5
+)
+
+type turnBucket struct {
+	MinParty       int `json:"minParty"`
+	MaxParty       int `json:"maxParty"` // 0 = no maximum
+	Samples        int `json:"samples"`
+	AverageMinutes int `json:"averageMinutes"`
+}
+
+func (b turnBucket) contains(partySize int) bool {
+	return partySize >= b.MinParty && (b.MaxParty <= 0 || partySize <= b.MaxParty)
+}
+
+type turnTimes struct {
+	Default int          `json:"defaultMinutes"`
+	Buckets []turnBucket `json:"buckets"`
+}
+
+// forParty returns the turn for a party: its bucket's average when there is
+// enough history, otherwise the default.
+func (t turnTimes) forParty(partySize int) int {
+	for _, b := range t.Buckets {
+		if b.contains(partySize) && b.Samples >= minTurnSamples && b.AverageMinutes > 0 {
+			return b.AverageMinutes
+		}
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return defaultTableTurnMinutes
+}
+
+func fixedTurnTimes(minutes int) turnTimes {
+	return turnTimes{Default: minutes, Buckets: []turnBucket{}}
+}
+
+type turnSample struct {
+	Count   int
+	Minutes int // sum
+}
+
+// buildTurnTimes averages the samples (keyed by party size) into the default
+// buckets, rounding to 5 minutes.
+func buildTurnTimes(samples map[int]turnSample, defaultMinutes int) turnTimes {
+	buckets := []turnBucket{
+		{MinParty: 1, MaxParty: 2},
+		{MinParty: 3, MaxParty: 4},
+		{MinParty: 5, MaxParty: 6},
+		{MinParty: 7, MaxParty: 8},
+		{MinParty: 9},
+	}
+	for i := range buckets {
+		total := 0
+		for size, s := range samples {
+			if buckets[i].contains(size) {
+				buckets[i].Samples += s.Count
+				total += s.Minutes
+			}
+		}
+		if buckets[i].Samples > 0 {
+			avg := float64(total) / float64(buckets[i].Samples)
+			buckets[i].AverageMinutes = int(math.Round(avg/turnRoundToMinutes)) * turnRoundToMinutes
+		}
+	}
+	return turnTimes{Default: defaultMinutes, Buckets: buckets}
+}
+
+// loadTurnTimes learns turn times from the last days of history. Stays
+// shorter than 15 minutes or longer than 6 hours are treated as mistakes.
+func (s *Server) loadTurnTimes(ctx context.Context, restaurantID int, days int) (turnTimes, error) {
+	since := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT party_size, COUNT(*), COALESCE(SUM(TIMESTAMPDIFF(MINUTE, seated_at, left_at)), 0)
+		FROM bookings
+		WHERE restaurant_id = ?
+		  AND reservation_date >= ?
+		  AND seated_at IS NOT NULL
+		  AND left_at IS NOT NULL
+		  AND TIMESTAMPDIFF(MINUTE, seated_at, left_at) BETWEEN ? AND ?
+		GROUP BY party_size
+	`, restaurantID, since, minTurnSampleMins, maxTurnSampleMins)
+	if err != nil {
+		if isSQLSchemaError(err) {
+			return buildTurnTimes(nil, defaultTableTurnMinutes), nil
+		}
+		return turnTimes{}, err
+	}
+	defer rows.Close()
+
+	samples := map[int]turnSample{}
+	for rows.Next() {
+		var (
+			size int
+			s    turnSample
+		)
+		if err := rows.Scan(&size, &s.Count, &s.Minutes); err != nil {
+			return turnTimes{}, err
+		}
+		samples[size] = s
+	}
+	if err := rows.Err(); err != nil {
+		return turnTimes{}, err
+	}
+	return buildTurnTimes(samples, defaultTableTurnMinutes), nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildTurnTimes(t *testing.T) {
+	turns := buildTurnTimes(map[int]turnSample{
+		2: {Count: 4, Minutes: 4 * 70},
+		1: {Count: 2, Minutes: 2 * 62},
+		4: {Count: 3, Minutes: 3 * 100},
+	}, 120)
+
+	// 1 and 2 share a bucket: (4*70 + 2*62) / 6 = 67.3, rounded to 65.
+	if got := turns.forParty(2); got != 65 {
+		t.Fatalf("forParty(2) = %d, want 65", got)
+	}
+	// Only three samples for 3-4: not enough history.
+	if got := turns.forParty(4); got != 120 {
+		t.Fatalf("forParty(4) = %d, want default 120", got)
+	}
+	if got := turns.forParty(12); got != 120 {
+		t.Fatalf("forParty(12) = %d, want default 120", got)
+	}
+	if got := (turnTimes{}).forParty(2); got != defaultTableTurnMinutes {
+		t.Fatalf("zero turnTimes forParty(2) = %d, want %d", got, defaultTableTurnMinutes)
+	}
+}
+
+func TestBookingSeatStateSQL(t *testing.T) {
+	q := bookingSeatStateSQL(bookingSeatSeated)
+	for _, want := range []string{"seated_at = COALESCE(seated_at, NOW())", "left_at = NULL", "paid_at = NULL"} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("bookingSeatStateSQL(seated) = %q, missing %q", q, want)
+		}
+	}
+	if strings.Contains(q, "arrived_at") {
+		t.Fatalf("bookingSeatStateSQL(seated) = %q, must not touch arrived_at", q)
+	}
+	if _, ok := normalizeBookingSeatState(" Main_Course "); !ok {
+		t.Fatal("normalizeBookingSeatState(Main_Course) not accepted")
+	}
+}
@@ -145,17 +145,8 @@ func (s *Server) restaurantFromRequest(r *http.Request) (int, bool, string) {
 	if raw := strings.TrimSpace(r.Header.Get("X-Restaurant-Id")); raw != "" {
 		if id, err := strconv.Atoi(raw); err == nil && id > 0 {
 			// Admin token present and valid?
-			if strings.TrimSpace(s.cfg.AdminToken) != "" {
-				adminToken := strings.TrimSpace(r.Header.Get("X-Admin-Token"))
-				if adminToken == "" {
-					authz := strings.TrimSpace(r.Header.Get("Authorization"))
-					if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
-						adminToken = strings.TrimSpace(authz[len("bearer "):])
-					}
-				}
-				if adminToken != "" && adminToken == strings.TrimSpace(s.cfg.AdminToken) {
-					return id, true, "header:admin"
-				}
+			if s.validAdminToken(r) {
+				return id, true, "header:admin"
 			}
 			// Internal token present and valid?
 			if validateInternalAPIToken(r) {
@@ -198,6 +189,26 @@ func (s *Server) restaurantFromRequest(r *http.Request) (int, bool, string) {
 
 func (s *Server) withRestaurant(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An API key pins the request to its own restaurant, whatever the host.
+		if token := apiKeyTokenFromRequest(r); token != "" {
+			k, err := s.lookupAPIKey(r.Context(), token)
+			if errors.Is(err, errAPIKeyInvalid) {
+				httpx.WriteError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			if err != nil {
+				httpx.WriteError(w, http.StatusInternalServerError, "Error validando API key")
+				return
+			}
+			if raw := strings.TrimSpace(r.Header.Get("X-Restaurant-Id")); raw != "" && raw != strconv.Itoa(k.RestaurantID) {
+				httpx.WriteError(w, http.StatusForbidden, "API key de otro restaurante")
+				return
+			}
+			ctx := withAPIKey(withRestaurantID(r.Context(), k.RestaurantID), k)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		restaurantID, ok, _ := s.restaurantFromRequest(r)
 		if !ok || restaurantID <= 0 {
 			httpx.WriteError(w, http.StatusNotFound, "Unknown restaurant")
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTP per RFC 6238 with the parameters every authenticator app supports:
+// HMAC-SHA1, 6 digits, 30 second steps.
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Accept one step either side to absorb phone clock drift.
+	totpSkew = 1
+
+	boRecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random 160-bit secret, base32 encoded.
+func newTOTPSecret() (string, error) {
+	var b [20]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b[:]), nil
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	return totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.TrimSpace(secret), "=")))
+}
+
+// Secrets are stored sealed with AES-GCM when BO_2FA_SECRET_KEY is set.
+// Rows written before the key was configured stay plain until the next
+// successful verification reseals them.
+const totpSealedPrefix = "v1:"
+
+var errTOTPSecretKeyMissing = errors.New("totp secret is sealed but BO_2FA_SECRET_KEY is not set")
+
+func totpSecretAEAD(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTOTPSecret returns what to store in bo_users.totp_secret. The user ID
+// is bound as additional data so a sealed secret can't be copied to another
+// account. Without a key the secret is stored as is.
+func sealTOTPSecret(key string, userID int, secret string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	aead, err := totpSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(strconv.Itoa(userID)))
+	return totpSealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openTOTPSecret reverses sealTOTPSecret. plain reports a legacy row that
+// should be resealed.
+func openTOTPSecret(key string, userID int, stored string) (secret string, plain bool, err error) {
+	if !strings.HasPrefix(stored, totpSealedPrefix) {
+		return stored, true, nil
+	}
+	if key == "" {
+		return "", false, errTOTPSecretKeyMissing
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, totpSealedPrefix))
+	if err != nil {
+		return "", false, err
+	}
+	aead, err := totpSecretAEAD(key)
+	if err != nil {
+		return "", false, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", false, errors.New("totp secret: sealed value too short")
+	}
+	out, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(strconv.Itoa(userID)))
+	if err != nil {
+		return "", false, err
+	}
+	return string(out), false, nil
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod)
+}
+
+// totpVerify checks code against the steps around now. Steps at or before
+// lastStep are rejected so a code can't be replayed. It returns the matched
+// step.
+func totpVerify(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) == 0 {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI is the otpauth:// URI encoded in the enrolment QR.
+func totpProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	qs := url.Values{}
+	qs.Set("secret", secret)
+	qs.Set("issuer", issuer)
+	qs.Set("algorithm", "SHA1")
+	qs.Set("digits", fmt.Sprint(totpDigits))
+	qs.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + qs.Encode()
+}
+
+// newRecoveryCodes returns single-use codes formatted as "xxxxx-xxxxx".
+func newRecoveryCodes(n int) ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567" // 32 symbols: no modulo bias
+	out := make([]string, 0, n)
+	buf := make([]byte, 10)
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := make([]byte, 0, 11)
+		for j, v := range buf {
+			if j == 5 {
+				code = append(code, '-')
+			}
+			code = append(code, alphabet[int(v)%len(alphabet)])
+		}
+		out = append(out, string(code))
+	}
+	return out, nil
+}
+
+// normalizeRecoveryCode makes codes typed with spaces, dashes or capitals
+// match the stored hash.
+func normalizeRecoveryCode(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(code) {
+		if r == '-' || r == ' ' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
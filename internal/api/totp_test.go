@@ -0,0 +1,122 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B (SHA1 seed), truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range cases {
+		if got := totpCode(key, unix/totpPeriod); got != want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	got, ok := totpVerify(secret, "050471", now, 0)
+	if !ok || got != step {
+		t.Fatalf("current code rejected: step=%d ok=%v", got, ok)
+	}
+	// Previous step is still accepted for clock drift.
+	if _, ok := totpVerify(secret, "081804", now, 0); !ok {
+		t.Fatalf("previous-step code rejected")
+	}
+	if _, ok := totpVerify(secret, "050471", now, step); ok {
+		t.Fatalf("replayed code accepted")
+	}
+	if _, ok := totpVerify(secret, "000000", now, 0); ok {
+		t.Fatalf("wrong code accepted")
+	}
+	if _, ok := totpVerify(secret, "05047", now, 0); ok {
+		t.Fatalf("short code accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	got := totpProvisioningURI("Villa Carmen", "ana@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Villa%20Carmen:ana@example.com?algorithm=SHA1&digits=6&issuer=Villa+Carmen&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Fatalf("uri = %s", got)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := newRecoveryCodes(boRecoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("bad code format %q", c)
+		}
+		seen[c] = true
+		if got := normalizeRecoveryCode(" " + strings.ToUpper(c) + " "); got != strings.ReplaceAll(c, "-", "") {
+			t.Errorf("normalizeRecoveryCode(%q) = %q", c, got)
+		}
+	}
+	if len(seen) != boRecoveryCodeCount {
+		t.Errorf("duplicate recovery codes")
+	}
+}
+
+func TestBOTwoFactorSetupPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/admin/me":                true,
+		"/api/admin/me":            true,
+		"/admin/me/2fa/setup":      true,
+		"/admin/active-restaurant": true,
+		"/admin/invoices":          false,
+		"/admin/members":           false,
+	} {
+		if got := boTwoFactorSetupPath(path); got != want {
+			t.Errorf("boTwoFactorSetupPath(%q) = %v", path, got)
+		}
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := sealTOTPSecret("k3y", 7, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, totpSealedPrefix) || strings.Contains(stored, secret) || len(stored) > 255 {
+		t.Fatalf("sealed = %q", stored)
+	}
+	if got, plain, err := openTOTPSecret("k3y", 7, stored); err != nil || plain || got != secret {
+		t.Fatalf("open = %q %v %v", got, plain, err)
+	}
+	if _, _, err := openTOTPSecret("k3y", 8, stored); err == nil {
+		t.Fatal("secret opened for another user")
+	}
+	if _, _, err := openTOTPSecret("", 7, stored); err == nil {
+		t.Fatal("sealed secret opened without a key")
+	}
+
+	if got, plain, err := openTOTPSecret("k3y", 7, secret); err != nil || !plain || got != secret {
+		t.Fatalf("legacy plain secret = %q %v %v", got, plain, err)
+	}
+	if got, _ := sealTOTPSecret("", 7, secret); got != secret {
+		t.Fatalf("no key should store the secret as is, got %q", got)
+	}
+}
@@ -0,0 +1,660 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Registration records follow the VeriFactu "RegistroAlta" layout (Orden
+// HAC/1177/2024). Each record's Huella is SHA-256 over a fixed field string
+// that includes the previous record's Huella, chaining every issued invoice
+// of a restaurant.
+
+const (
+	verifactuTypeInvoice              = "F1" // factura completa
+	verifactuTypeSimplified           = "F2" // factura simplificada (no recipient NIF)
+	verifactuTypeRectifying           = "R4" // rectificativa, resto de causas
+	verifactuTypeRectifyingSimplified = "R5"
+
+	verifactuHashTypeSHA256 = "01"
+	verifactuRecordVersion  = "1.0"
+	verifactuSystemID       = "VC"
+	verifactuSystemVersion  = "1.0"
+
+	fiscalSubmissionPending  = "pending"
+	fiscalSubmissionAccepted = "accepted"
+	fiscalSubmissionFailed   = "failed"
+
+	verifactuNSLR = "https://www2.agenciatributaria.gob.es/static_files/common/internet/dep/aplicaciones/es/aeat/tike/cont/ws/SuministroLR.xsd"
+	verifactuNSSF = "https://www2.agenciatributaria.gob.es/static_files/common/internet/dep/aplicaciones/es/aeat/tike/cont/ws/SuministroInformacion.xsd"
+)
+
+var errInvoiceIssuerMissing = errors.New("Configure the issuer NIF and name (fiscal profile) before issuing invoices")
+
+type fiscalInvoiceRef struct {
+	IssuerNIF string `json:"issuerNif"`
+	Number    string `json:"number"`
+	Date      string `json:"date"`
+}
+
+// fiscalRecordDetail holds the record fields that are not part of the hash
+// but must be reproduced in the XML exactly as they were at issue time.
+type fiscalRecordDetail struct {
+	Description   string                `json:"description"`
+	RecipientName string                `json:"recipientName,omitempty"`
+	RecipientNIF  string                `json:"recipientNif,omitempty"`
+	Rectified     *fiscalInvoiceRef     `json:"rectified,omitempty"`
+	Breakdown     []InvoiceTaxBreakdown `json:"breakdown"`
+}
+
+type fiscalRecord struct {
+	ID               int64              `json:"id"`
+	RestaurantID     int                `json:"restaurantId"`
+	InvoiceID        int                `json:"invoiceId"`
+	IssuerNIF        string             `json:"issuerNif"`
+	IssuerName       string             `json:"issuerName"`
+	InvoiceNumber    string             `json:"invoiceNumber"`
+	InvoiceDate      string             `json:"invoiceDate"`
+	TypeCode         string             `json:"typeCode"`
+	TaxAmount        float64            `json:"taxAmount"`
+	Total            float64            `json:"total"`
+	Previous         *fiscalInvoiceRef  `json:"previous"`
+	PreviousHash     string             `json:"previousHash"`
+	GeneratedAt      string             `json:"generatedAt"`
+	Hash             string             `json:"hash"`
+	Detail           fiscalRecordDetail `json:"detail"`
+	SubmissionStatus string             `json:"submissionStatus"`
+	SubmissionRef    *string            `json:"submissionRef"`
+	SubmissionError  *string            `json:"submissionError"`
+	SubmittedAt      *string            `json:"submittedAt"`
+}
+
+// fiscalDate turns YYYY-MM-DD into the DD-MM-YYYY format used by the AEAT.
+func fiscalDate(iso string) string {
+	if len(iso) >= 10 && iso[4] == '-' && iso[7] == '-' {
+		return iso[8:10] + "-" + iso[5:7] + "-" + iso[0:4]
+	}
+	return iso
+}
+
+func fiscalAmount(v float64) string {
+	return strconv.FormatFloat(round2(v), 'f', 2, 64)
+}
+
+func fiscalHashInput(rec fiscalRecord) string {
+	return "IDEmisorFactura=" + strings.TrimSpace(rec.IssuerNIF) +
+		"&NumSerieFactura=" + strings.TrimSpace(rec.InvoiceNumber) +
+		"&FechaExpedicionFactura=" + fiscalDate(rec.InvoiceDate) +
+		"&TipoFactura=" + rec.TypeCode +
+		"&CuotaTotal=" + fiscalAmount(rec.TaxAmount) +
+		"&ImporteTotal=" + fiscalAmount(rec.Total) +
+		"&Huella=" + rec.PreviousHash +
+		"&FechaHoraHusoGenRegistro=" + rec.GeneratedAt
+}
+
+func fiscalRecordHash(rec fiscalRecord) string {
+	sum := sha256.Sum256([]byte(fiscalHashInput(rec)))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// fiscalQRURL is the AEAT validation URL printed as a QR code on the invoice.
+func fiscalQRURL(baseURL string, rec fiscalRecord) string {
+	qs := url.Values{}
+	qs.Set("nif", rec.IssuerNIF)
+	qs.Set("numserie", rec.InvoiceNumber)
+	qs.Set("fecha", fiscalDate(rec.InvoiceDate))
+	qs.Set("importe", fiscalAmount(rec.Total))
+	return strings.TrimRight(baseURL, "?") + "?" + qs.Encode()
+}
+
+func fiscalTypeCode(invoiceType string, recipientNIF string) string {
+	simplified := strings.TrimSpace(recipientNIF) == ""
+	switch {
+	case invoiceType == invoiceTypeRectifying && simplified:
+		return verifactuTypeRectifyingSimplified
+	case invoiceType == invoiceTypeRectifying:
+		return verifactuTypeRectifying
+	case simplified:
+		return verifactuTypeSimplified
+	default:
+		return verifactuTypeInvoice
+	}
+}
+
+// appendFiscalRecordTx creates the registration record of a just-numbered
+// invoice and moves the restaurant's chain head to it.
+func appendFiscalRecordTx(ctx context.Context, tx *sql.Tx, restaurantID, invoiceID int, now time.Time) error {
+	var issuerNIF, issuerName string
+	err := tx.QueryRowContext(ctx, `
+		SELECT issuer_nif, issuer_name FROM restaurant_fiscal_profiles WHERE restaurant_id = ?
+	`, restaurantID).Scan(&issuerNIF, &issuerName)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && strings.TrimSpace(issuerNIF) == "") {
+		return errInvoiceIssuerMissing
+	}
+	if err != nil {
+		return err
+	}
+
+	rec := fiscalRecord{
+		RestaurantID: restaurantID,
+		InvoiceID:    invoiceID,
+		IssuerNIF:    strings.TrimSpace(issuerNIF),
+		IssuerName:   strings.TrimSpace(issuerName),
+		GeneratedAt:  now.In(boMadridTZ).Format(time.RFC3339),
+	}
+
+	var (
+		invoiceType         string
+		customerName        string
+		customerSurname     sql.NullString
+		customerNIF         sql.NullString
+		rectifiesID         sql.NullInt64
+		rectificationReason sql.NullString
+		isReservation       bool
+	)
+	if err := tx.QueryRowContext(ctx, `
+		SELECT invoice_number, DATE_FORMAT(invoice_date, '%Y-%m-%d'), invoice_type, tax_amount, amount,
+			customer_name, customer_surname, customer_dni_cif, rectifies_invoice_id, rectification_reason, is_reservation
+		FROM invoices
+		WHERE id = ? AND restaurant_id = ?
+	`, invoiceID, restaurantID).Scan(
+		&rec.InvoiceNumber, &rec.InvoiceDate, &invoiceType, &rec.TaxAmount, &rec.Total,
+		&customerName, &customerSurname, &customerNIF, &rectifiesID, &rectificationReason, &isReservation,
+	); err != nil {
+		return err
+	}
+
+	rec.Detail.Description = "Servicios de restauración"
+	if isReservation {
+		rec.Detail.Description = "Servicios de restauración (reserva)"
+	}
+	if nif := strings.TrimSpace(customerNIF.String); nif != "" {
+		rec.Detail.RecipientNIF = strings.ToUpper(nif)
+		rec.Detail.RecipientName = strings.TrimSpace(customerName + " " + customerSurname.String)
+	}
+	rec.TypeCode = fiscalTypeCode(invoiceType, rec.Detail.RecipientNIF)
+
+	if invoiceType == invoiceTypeRectifying && rectifiesID.Valid {
+		rec.Detail.Description = "Rectificación: " + strings.TrimSpace(rectificationReason.String)
+		ref := fiscalInvoiceRef{}
+		err := tx.QueryRowContext(ctx, `
+			SELECT issuer_nif, invoice_number, DATE_FORMAT(invoice_date, '%Y-%m-%d')
+			FROM invoice_fiscal_records WHERE invoice_id = ?
+		`, rectifiesID.Int64).Scan(&ref.IssuerNIF, &ref.Number, &ref.Date)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Issued before fiscal records existed.
+			ref.IssuerNIF = rec.IssuerNIF
+			err = tx.QueryRowContext(ctx, `
+				SELECT COALESCE(invoice_number, ''), DATE_FORMAT(invoice_date, '%Y-%m-%d') FROM invoices WHERE id = ?
+			`, rectifiesID.Int64).Scan(&ref.Number, &ref.Date)
+		}
+		if err != nil {
+			return err
+		}
+		rec.Detail.Rectified = &ref
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT tax_rate, SUM(tax_base), SUM(tax_amount)
+		FROM invoice_lines
+		WHERE invoice_id = ?
+		GROUP BY tax_rate
+		ORDER BY tax_rate ASC
+	`, invoiceID)
+	if err != nil {
+		return err
+	}
+	rec.Detail.Breakdown = []InvoiceTaxBreakdown{}
+	for rows.Next() {
+		var b InvoiceTaxBreakdown
+		if err := rows.Scan(&b.TaxRate, &b.TaxBase, &b.TaxAmount); err != nil {
+			rows.Close()
+			return err
+		}
+		rec.Detail.Breakdown = append(rec.Detail.Breakdown, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO invoice_fiscal_chain (restaurant_id) VALUES (?)", restaurantID); err != nil {
+		return err
+	}
+	var lastID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT last_record_id FROM invoice_fiscal_chain WHERE restaurant_id = ? FOR UPDATE
+	`, restaurantID).Scan(&lastID); err != nil {
+		return err
+	}
+	var previousID any
+	if lastID.Valid {
+		prev := fiscalInvoiceRef{}
+		if err := tx.QueryRowContext(ctx, `
+			SELECT issuer_nif, invoice_number, DATE_FORMAT(invoice_date, '%Y-%m-%d'), hash
+			FROM invoice_fiscal_records WHERE id = ?
+		`, lastID.Int64).Scan(&prev.IssuerNIF, &prev.Number, &prev.Date, &rec.PreviousHash); err != nil {
+			return err
+		}
+		rec.Previous = &prev
+		previousID = lastID.Int64
+	}
+	rec.Hash = fiscalRecordHash(rec)
+
+	detailRaw, err := json.Marshal(rec.Detail)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO invoice_fiscal_records (
+			restaurant_id, invoice_id, issuer_nif, issuer_name, invoice_number, invoice_date, invoice_type_code,
+			tax_amount, total, previous_record_id, previous_hash, generated_at, hash, detail_json
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, restaurantID, invoiceID, rec.IssuerNIF, rec.IssuerName, rec.InvoiceNumber, rec.InvoiceDate, rec.TypeCode,
+		rec.TaxAmount, rec.Total, previousID, nullableString(rec.PreviousHash), rec.GeneratedAt, rec.Hash, string(detailRaw))
+	if err != nil {
+		return err
+	}
+	recordID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE invoice_fiscal_chain SET last_record_id = ? WHERE restaurant_id = ?", recordID, restaurantID)
+	return err
+}
+
+const fiscalRecordColumns = `
+	f.id, f.restaurant_id, f.invoice_id, f.issuer_nif, f.issuer_name, f.invoice_number,
+	DATE_FORMAT(f.invoice_date, '%Y-%m-%d'), f.invoice_type_code, f.tax_amount, f.total,
+	p.issuer_nif, p.invoice_number, DATE_FORMAT(p.invoice_date, '%Y-%m-%d'),
+	f.previous_hash, f.generated_at, f.hash, f.detail_json,
+	f.submission_status, f.submission_ref, f.submission_error, f.submitted_at`
+
+const fiscalRecordFrom = `
+	FROM invoice_fiscal_records f
+	LEFT JOIN invoice_fiscal_records p ON p.id = f.previous_record_id`
+
+func scanFiscalRecord(scanner invoiceScanner) (fiscalRecord, error) {
+	var (
+		rec                         fiscalRecord
+		prevNIF, prevNumber, prevDt sql.NullString
+		prevHash                    sql.NullString
+		detailRaw                   []byte
+		submittedAt                 sql.NullTime
+	)
+	err := scanner.Scan(
+		&rec.ID, &rec.RestaurantID, &rec.InvoiceID, &rec.IssuerNIF, &rec.IssuerName, &rec.InvoiceNumber,
+		&rec.InvoiceDate, &rec.TypeCode, &rec.TaxAmount, &rec.Total,
+		&prevNIF, &prevNumber, &prevDt,
+		&prevHash, &rec.GeneratedAt, &rec.Hash, &detailRaw,
+		&rec.SubmissionStatus, &rec.SubmissionRef, &rec.SubmissionError, &submittedAt,
+	)
+	if err != nil {
+		return rec, err
+	}
+	if prevNumber.Valid {
+		rec.Previous = &fiscalInvoiceRef{IssuerNIF: prevNIF.String, Number: prevNumber.String, Date: prevDt.String}
+	}
+	rec.PreviousHash = prevHash.String
+	rec.SubmittedAt = formatNullTimeRFC3339(submittedAt)
+	if err := json.Unmarshal(detailRaw, &rec.Detail); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+func (s *Server) loadFiscalRecord(ctx context.Context, restaurantID, invoiceID int) (fiscalRecord, error) {
+	return scanFiscalRecord(s.db.QueryRowContext(ctx, "SELECT "+fiscalRecordColumns+fiscalRecordFrom+`
+		WHERE f.restaurant_id = ? AND f.invoice_id = ?
+	`, restaurantID, invoiceID))
+}
+
+// loadFiscalRecords returns a restaurant's records in chain order. from/to
+// filter on invoice_date and may be empty.
+func (s *Server) loadFiscalRecords(ctx context.Context, restaurantID int, from, to string) ([]fiscalRecord, error) {
+	query := "SELECT " + fiscalRecordColumns + fiscalRecordFrom + " WHERE f.restaurant_id = ?"
+	args := []any{restaurantID}
+	if from != "" {
+		query += " AND f.invoice_date >= ?"
+		args = append(args, from)
+	}
+	if to != "" {
+		query += " AND f.invoice_date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY f.id ASC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []fiscalRecord{}
+	for rows.Next() {
+		rec, err := scanFiscalRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// verifyFiscalChain recomputes every hash and checks that each record points
+// at the hash of the one before it. records must be the full chain in order.
+// It returns the ID of the first bad record, or 0.
+func verifyFiscalChain(records []fiscalRecord) int64 {
+	prevHash := ""
+	for _, rec := range records {
+		if rec.PreviousHash != prevHash || fiscalRecordHash(rec) != rec.Hash {
+			return rec.ID
+		}
+		prevHash = rec.Hash
+	}
+	return 0
+}
+
+type verifactuSystem struct {
+	Name string
+	NIF  string
+}
+
+func (s *Server) verifactuSystem() verifactuSystem {
+	return verifactuSystem{Name: s.cfg.VerifactuSystemName, NIF: s.cfg.VerifactuSystemNIF}
+}
+
+type vfRegFactu struct {
+	XMLName   xml.Name            `xml:"sfLR:RegFactuSistemaFacturacion"`
+	NSLR      string              `xml:"xmlns:sfLR,attr"`
+	NSSF      string              `xml:"xmlns:sf,attr"`
+	Cabecera  vfCabecera          `xml:"sfLR:Cabecera"`
+	Registros []vfRegistroFactura `xml:"sfLR:RegistroFactura"`
+}
+
+type vfCabecera struct {
+	ObligadoEmision vfPersona `xml:"sf:ObligadoEmision"`
+}
+
+type vfPersona struct {
+	NombreRazon string `xml:"sf:NombreRazon"`
+	NIF         string `xml:"sf:NIF"`
+}
+
+type vfIDFactura struct {
+	IDEmisorFactura        string `xml:"sf:IDEmisorFactura"`
+	NumSerieFactura        string `xml:"sf:NumSerieFactura"`
+	FechaExpedicionFactura string `xml:"sf:FechaExpedicionFactura"`
+}
+
+type vfRegistroFactura struct {
+	RegistroAlta vfRegistroAlta `xml:"sf:RegistroAlta"`
+}
+
+type vfRegistroAlta struct {
+	IDVersion                string                  `xml:"sf:IDVersion"`
+	IDFactura                vfIDFactura             `xml:"sf:IDFactura"`
+	NombreRazonEmisor        string                  `xml:"sf:NombreRazonEmisor"`
+	TipoFactura              string                  `xml:"sf:TipoFactura"`
+	TipoRectificativa        string                  `xml:"sf:TipoRectificativa,omitempty"`
+	FacturasRectificadas     *vfFacturasRectificadas `xml:"sf:FacturasRectificadas,omitempty"`
+	DescripcionOperacion     string                  `xml:"sf:DescripcionOperacion"`
+	Destinatarios            *vfDestinatarios        `xml:"sf:Destinatarios,omitempty"`
+	Desglose                 vfDesglose              `xml:"sf:Desglose"`
+	CuotaTotal               string                  `xml:"sf:CuotaTotal"`
+	ImporteTotal             string                  `xml:"sf:ImporteTotal"`
+	Encadenamiento           vfEncadenamiento        `xml:"sf:Encadenamiento"`
+	SistemaInformatico       vfSistemaInformatico    `xml:"sf:SistemaInformatico"`
+	FechaHoraHusoGenRegistro string                  `xml:"sf:FechaHoraHusoGenRegistro"`
+	TipoHuella               string                  `xml:"sf:TipoHuella"`
+	Huella                   string                  `xml:"sf:Huella"`
+}
+
+type vfFacturasRectificadas struct {
+	IDFacturaRectificada []vfIDFactura `xml:"sf:IDFacturaRectificada"`
+}
+
+type vfDestinatarios struct {
+	IDDestinatario []vfPersona `xml:"sf:IDDestinatario"`
+}
+
+type vfDesglose struct {
+	DetalleDesglose []vfDetalleDesglose `xml:"sf:DetalleDesglose"`
+}
+
+type vfDetalleDesglose struct {
+	ClaveRegimen                  string `xml:"sf:ClaveRegimen"`
+	CalificacionOperacion         string `xml:"sf:CalificacionOperacion"`
+	TipoImpositivo                string `xml:"sf:TipoImpositivo"`
+	BaseImponibleOimporteNoSujeto string `xml:"sf:BaseImponibleOimporteNoSujeto"`
+	CuotaRepercutida              string `xml:"sf:CuotaRepercutida"`
+}
+
+type vfEncadenamiento struct {
+	PrimerRegistro   string              `xml:"sf:PrimerRegistro,omitempty"`
+	RegistroAnterior *vfRegistroAnterior `xml:"sf:RegistroAnterior,omitempty"`
+}
+
+type vfRegistroAnterior struct {
+	IDEmisorFactura        string `xml:"sf:IDEmisorFactura"`
+	NumSerieFactura        string `xml:"sf:NumSerieFactura"`
+	FechaExpedicionFactura string `xml:"sf:FechaExpedicionFactura"`
+	Huella                 string `xml:"sf:Huella"`
+}
+
+type vfSistemaInformatico struct {
+	NombreRazon                 string `xml:"sf:NombreRazon"`
+	NIF                         string `xml:"sf:NIF"`
+	NombreSistemaInformatico    string `xml:"sf:NombreSistemaInformatico"`
+	IdSistemaInformatico        string `xml:"sf:IdSistemaInformatico"`
+	Version                     string `xml:"sf:Version"`
+	NumeroInstalacion           string `xml:"sf:NumeroInstalacion"`
+	TipoUsoPosibleSoloVerifactu string `xml:"sf:TipoUsoPosibleSoloVerifactu"`
+	TipoUsoPosibleMultiOT       string `xml:"sf:TipoUsoPosibleMultiOT"`
+	IndicadorMultiplesOT        string `xml:"sf:IndicadorMultiplesOT"`
+}
+
+func verifactuRegistroAlta(rec fiscalRecord, sys verifactuSystem) vfRegistroAlta {
+	alta := vfRegistroAlta{
+		IDVersion: verifactuRecordVersion,
+		IDFactura: vfIDFactura{
+			IDEmisorFactura:        rec.IssuerNIF,
+			NumSerieFactura:        rec.InvoiceNumber,
+			FechaExpedicionFactura: fiscalDate(rec.InvoiceDate),
+		},
+		NombreRazonEmisor:    rec.IssuerName,
+		TipoFactura:          rec.TypeCode,
+		DescripcionOperacion: rec.Detail.Description,
+		CuotaTotal:           fiscalAmount(rec.TaxAmount),
+		ImporteTotal:         fiscalAmount(rec.Total),
+		SistemaInformatico: vfSistemaInformatico{
+			NombreRazon:                 sys.Name,
+			NIF:                         sys.NIF,
+			NombreSistemaInformatico:    sys.Name,
+			IdSistemaInformatico:        verifactuSystemID,
+			Version:                     verifactuSystemVersion,
+			NumeroInstalacion:           strconv.Itoa(rec.RestaurantID),
+			TipoUsoPosibleSoloVerifactu: "S",
+			TipoUsoPosibleMultiOT:       "N",
+			IndicadorMultiplesOT:        "N",
+		},
+		FechaHoraHusoGenRegistro: rec.GeneratedAt,
+		TipoHuella:               verifactuHashTypeSHA256,
+		Huella:                   rec.Hash,
+	}
+	if rec.Detail.Rectified != nil {
+		// "I": the rectifying invoice carries the difference.
+		alta.TipoRectificativa = "I"
+		alta.FacturasRectificadas = &vfFacturasRectificadas{IDFacturaRectificada: []vfIDFactura{{
+			IDEmisorFactura:        rec.Detail.Rectified.IssuerNIF,
+			NumSerieFactura:        rec.Detail.Rectified.Number,
+			FechaExpedicionFactura: fiscalDate(rec.Detail.Rectified.Date),
+		}}}
+	}
+	if rec.Detail.RecipientNIF != "" {
+		alta.Destinatarios = &vfDestinatarios{IDDestinatario: []vfPersona{{
+			NombreRazon: rec.Detail.RecipientName,
+			NIF:         rec.Detail.RecipientNIF,
+		}}}
+	}
+	for _, b := range rec.Detail.Breakdown {
+		alta.Desglose.DetalleDesglose = append(alta.Desglose.DetalleDesglose, vfDetalleDesglose{
+			ClaveRegimen:                  "01",
+			CalificacionOperacion:         "S1",
+			TipoImpositivo:                fiscalAmount(b.TaxRate),
+			BaseImponibleOimporteNoSujeto: fiscalAmount(b.TaxBase),
+			CuotaRepercutida:              fiscalAmount(b.TaxAmount),
+		})
+	}
+	if rec.Previous == nil {
+		alta.Encadenamiento.PrimerRegistro = "S"
+	} else {
+		alta.Encadenamiento.RegistroAnterior = &vfRegistroAnterior{
+			IDEmisorFactura:        rec.Previous.IssuerNIF,
+			NumSerieFactura:        rec.Previous.Number,
+			FechaExpedicionFactura: fiscalDate(rec.Previous.Date),
+			Huella:                 rec.PreviousHash,
+		}
+	}
+	return alta
+}
+
+// buildVerifactuXML renders records of one issuer as a RegFactuSistemaFacturacion
+// document.
+func buildVerifactuXML(records []fiscalRecord, sys verifactuSystem) ([]byte, error) {
+	if len(records) == 0 {
+		return nil, errors.New("no fiscal records")
+	}
+	doc := vfRegFactu{
+		NSLR: verifactuNSLR,
+		NSSF: verifactuNSSF,
+		Cabecera: vfCabecera{ObligadoEmision: vfPersona{
+			NombreRazon: records[0].IssuerName,
+			NIF:         records[0].IssuerNIF,
+		}},
+	}
+	for _, rec := range records {
+		doc.Registros = append(doc.Registros, vfRegistroFactura{RegistroAlta: verifactuRegistroAlta(rec, sys)})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// ExportFiscalRecordsXML returns the registration XML for a restaurant's
+// records with invoice_date in [from, to] (YYYY-MM-DD, either may be empty).
+func (s *Server) ExportFiscalRecordsXML(ctx context.Context, restaurantID int, from, to string) ([]byte, error) {
+	records, err := s.loadFiscalRecords(ctx, restaurantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return buildVerifactuXML(records, s.verifactuSystem())
+}
+
+// fiscalSubmitter sends a registration record to the tax agency. The real
+// AEAT web service needs a client certificate per issuer; until that exists
+// deployments run without a submitter or with the local stub.
+type fiscalSubmitter interface {
+	Submit(ctx context.Context, rec fiscalRecord, payload []byte) (ref string, err error)
+}
+
+// stubFiscalSubmitter accepts every record and returns a fake CSV reference.
+type stubFiscalSubmitter struct{}
+
+func (stubFiscalSubmitter) Submit(_ context.Context, rec fiscalRecord, payload []byte) (string, error) {
+	if len(payload) == 0 {
+		return "", errors.New("empty payload")
+	}
+	return "STUB-" + rec.Hash[:16], nil
+}
+
+func newFiscalSubmitter(kind string) fiscalSubmitter {
+	switch kind {
+	case "stub":
+		return stubFiscalSubmitter{}
+	case "":
+		return nil
+	default:
+		log.Printf("unknown VERIFACTU_SUBMITTER %q; fiscal records will not be submitted", kind)
+		return nil
+	}
+}
+
+// submitFiscalRecord sends the invoice's record and stores the outcome.
+func (s *Server) submitFiscalRecord(ctx context.Context, restaurantID, invoiceID int) error {
+	if s.fiscalSubmitter == nil {
+		return errors.New("fiscal submission not configured")
+	}
+	rec, err := s.loadFiscalRecord(ctx, restaurantID, invoiceID)
+	if err != nil {
+		return err
+	}
+	if rec.SubmissionStatus == fiscalSubmissionAccepted {
+		return nil
+	}
+	payload, err := buildVerifactuXML([]fiscalRecord{rec}, s.verifactuSystem())
+	if err != nil {
+		return err
+	}
+
+	ref, sendErr := s.fiscalSubmitter.Submit(ctx, rec, payload)
+	if sendErr != nil {
+		_, _ = s.db.ExecContext(ctx, `
+			UPDATE invoice_fiscal_records SET submission_status = ?, submission_error = ? WHERE id = ?
+		`, fiscalSubmissionFailed, sendErr.Error(), rec.ID)
+		return sendErr
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE invoice_fiscal_records
+		SET submission_status = ?, submission_ref = ?, submission_error = NULL, submitted_at = NOW()
+		WHERE id = ?
+	`, fiscalSubmissionAccepted, ref, rec.ID)
+	return err
+}
+
+func (s *Server) submitFiscalRecordAsync(restaurantID, invoiceID int) {
+	if s.fiscalSubmitter == nil {
+		return
+	}
+	// Shutdown waits for the submission without cancelling it, so a record the
+	// agency accepted still gets its reference stored.
+	s.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := s.submitFiscalRecord(ctx, restaurantID, invoiceID); err != nil {
+			log.Printf("fiscal record submission failed (restaurant_id=%d invoice_id=%d): %v", restaurantID, invoiceID, err)
+		}
+	})
+}
+
+func (s *Server) fiscalQRPayload(ctx context.Context, restaurantID, invoiceID int) string {
+	rec, err := s.loadFiscalRecord(ctx, restaurantID, invoiceID)
+	if err != nil {
+		return ""
+	}
+	return fiscalQRURL(s.cfg.VerifactuQRBaseURL, rec)
+}
+
+func fiscalRecordFilename(restaurantID int, from, to string) string {
+	name := fmt.Sprintf("verifactu_%d", restaurantID)
+	if from != "" {
+		name += "_" + from
+	}
+	if to != "" {
+		name += "_" + to
+	}
+	return name + ".xml"
+}
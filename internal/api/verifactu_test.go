@@ -0,0 +1,112 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFiscalRecordHash(t *testing.T) {
+	// Example from the AEAT "Detalle de las especificaciones técnicas para
+	// generación de la huella" document (primer registro de alta).
+	rec := fiscalRecord{
+		IssuerNIF:     "89890001K",
+		InvoiceNumber: "12345678/G33",
+		InvoiceDate:   "2024-01-01",
+		TypeCode:      "F1",
+		TaxAmount:     12.35,
+		Total:         123.45,
+		GeneratedAt:   "2024-01-01T19:20:30+01:00",
+	}
+	wantInput := "IDEmisorFactura=89890001K&NumSerieFactura=12345678/G33&FechaExpedicionFactura=01-01-2024" +
+		"&TipoFactura=F1&CuotaTotal=12.35&ImporteTotal=123.45&Huella=&FechaHoraHusoGenRegistro=2024-01-01T19:20:30+01:00"
+	if got := fiscalHashInput(rec); got != wantInput {
+		t.Fatalf("hash input = %q", got)
+	}
+	if got, want := fiscalRecordHash(rec), "3C464DAF61ACB827C65FDA19F352A4E3BDC2C640E9E9FC4CC058073F38F12F60"; got != want {
+		t.Fatalf("hash = %s, want %s", got, want)
+	}
+}
+
+func testFiscalChain() []fiscalRecord {
+	recs := []fiscalRecord{
+		{ID: 1, IssuerNIF: "B12345678", InvoiceNumber: "F2026-00001", InvoiceDate: "2026-10-01", TypeCode: "F2", TaxAmount: 10, Total: 110, GeneratedAt: "2026-10-01T21:00:00+02:00"},
+		{ID: 2, IssuerNIF: "B12345678", InvoiceNumber: "F2026-00002", InvoiceDate: "2026-10-02", TypeCode: "F1", TaxAmount: 5, Total: 55, GeneratedAt: "2026-10-02T21:00:00+02:00"},
+		{ID: 3, IssuerNIF: "B12345678", InvoiceNumber: "R2026-00001", InvoiceDate: "2026-10-03", TypeCode: "R4", TaxAmount: -5, Total: -55, GeneratedAt: "2026-10-03T21:00:00+02:00"},
+	}
+	prevHash := ""
+	for i := range recs {
+		recs[i].PreviousHash = prevHash
+		if i > 0 {
+			p := recs[i-1]
+			recs[i].Previous = &fiscalInvoiceRef{IssuerNIF: p.IssuerNIF, Number: p.InvoiceNumber, Date: p.InvoiceDate}
+		}
+		recs[i].Hash = fiscalRecordHash(recs[i])
+		prevHash = recs[i].Hash
+	}
+	return recs
+}
+
+func TestVerifyFiscalChain(t *testing.T) {
+	recs := testFiscalChain()
+	if bad := verifyFiscalChain(recs); bad != 0 {
+		t.Fatalf("valid chain reported bad record %d", bad)
+	}
+
+	tampered := testFiscalChain()
+	tampered[1].Total = 550
+	if bad := verifyFiscalChain(tampered); bad != 2 {
+		t.Fatalf("tampered amount: bad = %d, want 2", bad)
+	}
+
+	// Dropping a record breaks the link of the one after it.
+	gap := testFiscalChain()
+	gap = append(gap[:1], gap[2:]...)
+	if bad := verifyFiscalChain(gap); bad != 3 {
+		t.Fatalf("missing record: bad = %d, want 3", bad)
+	}
+}
+
+func TestBuildVerifactuXML(t *testing.T) {
+	recs := testFiscalChain()
+	recs[1].Detail.RecipientNIF = "12345678Z"
+	recs[1].Detail.RecipientName = "Ana & Co"
+	recs[2].Detail.Rectified = &fiscalInvoiceRef{IssuerNIF: "B12345678", Number: "F2026-00002", Date: "2026-10-02"}
+	recs[2].Detail.Breakdown = []InvoiceTaxBreakdown{{TaxRate: 10, TaxBase: -50, TaxAmount: -5}}
+
+	out, err := buildVerifactuXML(recs, verifactuSystem{Name: "Villa Carmen Backoffice", NIF: "B87654321"})
+	if err != nil {
+		t.Fatalf("buildVerifactuXML: %v", err)
+	}
+	doc := string(out)
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<sfLR:RegFactuSistemaFacturacion xmlns:sfLR=`,
+		"<sf:PrimerRegistro>S</sf:PrimerRegistro>",
+		"<sf:NumSerieFactura>F2026-00001</sf:NumSerieFactura>",
+		"<sf:FechaExpedicionFactura>03-10-2026</sf:FechaExpedicionFactura>",
+		"<sf:NombreRazon>Ana &amp; Co</sf:NombreRazon>",
+		"<sf:TipoRectificativa>I</sf:TipoRectificativa>",
+		"<sf:BaseImponibleOimporteNoSujeto>-50.00</sf:BaseImponibleOimporteNoSujeto>",
+		"<sf:Huella>" + recs[1].Hash + "</sf:Huella>",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("XML missing %q", want)
+		}
+	}
+	if n := strings.Count(doc, "<sf:RegistroAnterior>"); n != 2 {
+		t.Errorf("RegistroAnterior count = %d, want 2", n)
+	}
+
+	if _, err := buildVerifactuXML(nil, verifactuSystem{}); err == nil {
+		t.Fatalf("expected error for empty export")
+	}
+}
+
+func TestFiscalQRURL(t *testing.T) {
+	rec := fiscalRecord{IssuerNIF: "B12345678", InvoiceNumber: "F2026-00042", InvoiceDate: "2026-10-16", Total: 245.5}
+	got := fiscalQRURL("https://example.test/ValidarQR", rec)
+	want := "https://example.test/ValidarQR?fecha=16-10-2026&importe=245.50&nif=B12345678&numserie=F2026-00042"
+	if got != want {
+		t.Fatalf("fiscalQRURL = %q", got)
+	}
+}
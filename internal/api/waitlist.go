@@ -0,0 +1,889 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// Waitlist entries move waiting -> offered -> claimed. An offer that is not
+// claimed in time becomes expired and the next matching entry is offered;
+// entries for past dates expire too. Staff can cancel an entry at any point.
+const (
+	waitlistWaiting   = "waiting"
+	waitlistOffered   = "offered"
+	waitlistClaimed   = "claimed"
+	waitlistExpired   = "expired"
+	waitlistCancelled = "cancelled"
+)
+
+const (
+	waitlistClaimPath   = "/waitlist_claim.php"
+	waitlistExpiryPoll  = time.Minute
+	waitlistMaxParty    = 100
+	waitlistTriggerWait = 30 * time.Second
+)
+
+var waitlistStatuses = []string{waitlistWaiting, waitlistOffered, waitlistClaimed, waitlistExpired, waitlistCancelled}
+
+type waitlistEntry struct {
+	ID                      int     `json:"id"`
+	Date                    string  `json:"date"`
+	TimeFrom                string  `json:"timeFrom"`
+	TimeTo                  string  `json:"timeTo"`
+	PartySize               int     `json:"partySize"`
+	CustomerName            string  `json:"customerName"`
+	ContactPhone            string  `json:"contactPhone"`
+	ContactPhoneCountryCode string  `json:"contactPhoneCountryCode"`
+	ContactEmail            string  `json:"contactEmail"`
+	Commentary              string  `json:"commentary"`
+	Status                  string  `json:"status"`
+	Position                int     `json:"position,omitempty"`
+	OfferedTime             *string `json:"offeredTime"`
+	OfferExpiresAt          *string `json:"offerExpiresAt"`
+	OfferCount              int     `json:"offerCount"`
+	BookingID               *int    `json:"bookingId"`
+	CreatedAt               *string `json:"createdAt"`
+	claimBaseURL            string
+}
+
+func (e waitlistEntry) phoneE164() string {
+	return e.ContactPhoneCountryCode + e.ContactPhone
+}
+
+// waitlistInput is the body of the public join endpoint and the backoffice
+// create endpoint.
+type waitlistInput struct {
+	Date         string `json:"date"`
+	TimeFrom     string `json:"timeFrom"`
+	TimeTo       string `json:"timeTo"`
+	PartySize    int    `json:"partySize"`
+	CustomerName string `json:"customerName"`
+	ContactPhone string `json:"contactPhone"`
+	CountryCode  string `json:"countryCode"`
+	ContactEmail string `json:"contactEmail"`
+	Commentary   string `json:"commentary"`
+	WebsiteURL   string `json:"website_url"` // honeypot
+}
+
+// normalizeWaitlistInput validates a join request. It returns a message for
+// the first invalid field.
+func normalizeWaitlistInput(in waitlistInput, today string) (waitlistEntry, string) {
+	e := waitlistEntry{
+		Date:         strings.TrimSpace(in.Date),
+		PartySize:    in.PartySize,
+		CustomerName: strings.TrimSpace(in.CustomerName),
+		ContactEmail: strings.TrimSpace(in.ContactEmail),
+		Commentary:   strings.TrimSpace(in.Commentary),
+		Status:       waitlistWaiting,
+	}
+	if !isValidISODate(e.Date) || e.Date < today {
+		return waitlistEntry{}, "Fecha invalida"
+	}
+	from, errFrom := normalizeHHMM(in.TimeFrom)
+	to, errTo := normalizeHHMM(in.TimeTo)
+	_, okFrom := hhmmToMinutes(from)
+	_, okTo := hhmmToMinutes(to)
+	if errFrom != nil || errTo != nil || !okFrom || !okTo || serviceHourSortKey(from) > serviceHourSortKey(to) {
+		return waitlistEntry{}, "Franja horaria invalida"
+	}
+	e.TimeFrom, e.TimeTo = from, to
+	if e.PartySize < 1 || e.PartySize > waitlistMaxParty {
+		return waitlistEntry{}, "Numero de personas invalido"
+	}
+	if e.CustomerName == "" || len(e.CustomerName) > 255 {
+		return waitlistEntry{}, "Nombre invalido"
+	}
+	cc, national, _, ok := normalizePhoneParts(in.CountryCode, in.ContactPhone)
+	if !ok {
+		return waitlistEntry{}, "Telefono invalido"
+	}
+	e.ContactPhone, e.ContactPhoneCountryCode = national, cc
+	if len(e.ContactEmail) > 255 || (e.ContactEmail != "" && !strings.Contains(e.ContactEmail, "@")) {
+		return waitlistEntry{}, "Email invalido"
+	}
+	return e, ""
+}
+
+// waitlistWindowContains reports whether hhmm falls in the entry's window,
+// in service-day order so windows can run past midnight.
+func waitlistWindowContains(from, to, hhmm string) bool {
+	k := serviceHourSortKey(hhmm)
+	return k >= serviceHourSortKey(from) && k <= serviceHourSortKey(to)
+}
+
+// pickWaitlistOfferTime returns the first available hour inside the window
+// that still seats partySize once the covers held by open offers are taken
+// out, or "" if none does.
+func pickWaitlistOfferTime(hours []availableHour, held map[string]int, from, to string, partySize int) string {
+	for _, h := range hours {
+		if !waitlistWindowContains(from, to, h.Time) {
+			continue
+		}
+		if h.Capacity-held[h.Time] >= partySize {
+			return h.Time
+		}
+	}
+	return ""
+}
+
+func newWaitlistClaimToken() (string, error) {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+func waitlistClaimURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + waitlistClaimPath + "?token=" + url.QueryEscape(token)
+}
+
+const waitlistSelectColumns = `
+	id,
+	DATE_FORMAT(reservation_date, '%Y-%m-%d'),
+	time_from,
+	time_to,
+	party_size,
+	customer_name,
+	contact_phone,
+	contact_phone_country_code,
+	COALESCE(contact_email, ''),
+	COALESCE(commentary, ''),
+	status,
+	offered_time,
+	offer_expires_at,
+	offer_count,
+	booking_id,
+	created_at,
+	claim_base_url`
+
+type waitlistScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWaitlistEntry(scanner waitlistScanner) (waitlistEntry, error) {
+	var (
+		e         waitlistEntry
+		offered   sql.NullString
+		expiresAt sql.NullTime
+		bookingID sql.NullInt64
+		createdAt sql.NullTime
+	)
+	err := scanner.Scan(&e.ID, &e.Date, &e.TimeFrom, &e.TimeTo, &e.PartySize, &e.CustomerName,
+		&e.ContactPhone, &e.ContactPhoneCountryCode, &e.ContactEmail, &e.Commentary, &e.Status,
+		&offered, &expiresAt, &e.OfferCount, &bookingID, &createdAt, &e.claimBaseURL)
+	if err != nil {
+		return waitlistEntry{}, err
+	}
+	if offered.Valid && offered.String != "" {
+		e.OfferedTime = &offered.String
+	}
+	e.OfferExpiresAt = formatNullTimeRFC3339(expiresAt)
+	if bookingID.Valid {
+		id := int(bookingID.Int64)
+		e.BookingID = &id
+	}
+	e.CreatedAt = formatNullTimeRFC3339(createdAt)
+	return e, nil
+}
+
+// loadWaitlistEntries lists a restaurant's entries matching where (an SQL
+// condition on waitlist_entries), oldest first.
+func (s *Server) loadWaitlistEntries(ctx context.Context, restaurantID int, where string, args ...any) ([]waitlistEntry, error) {
+	q := "SELECT " + waitlistSelectColumns + " FROM waitlist_entries WHERE restaurant_id = ?"
+	if where != "" {
+		q += " AND " + where
+	}
+	q += " ORDER BY created_at ASC, id ASC"
+	rows, err := s.db.QueryContext(ctx, q, append([]any{restaurantID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []waitlistEntry{}
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *Server) loadWaitlistEntry(ctx context.Context, restaurantID, id int) (waitlistEntry, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+waitlistSelectColumns+" FROM waitlist_entries WHERE restaurant_id = ? AND id = ? LIMIT 1", restaurantID, id)
+	return scanWaitlistEntry(row)
+}
+
+// setWaitlistPositions numbers the waiting entries of each date in queue
+// order. entries must be oldest first.
+func setWaitlistPositions(entries []waitlistEntry) {
+	next := map[string]int{}
+	for i := range entries {
+		if entries[i].Status != waitlistWaiting {
+			continue
+		}
+		next[entries[i].Date]++
+		entries[i].Position = next[entries[i].Date]
+	}
+}
+
+// insertWaitlistEntry stores a new entry, or returns the open entry the same
+// phone already has for that date.
+func (s *Server) insertWaitlistEntry(ctx context.Context, restaurantID int, e waitlistEntry, baseURL string) (waitlistEntry, bool, error) {
+	existing, err := s.loadWaitlistEntries(ctx, restaurantID,
+		"reservation_date = ? AND contact_phone = ? AND contact_phone_country_code = ? AND status IN (?, ?)",
+		e.Date, e.ContactPhone, e.ContactPhoneCountryCode, waitlistWaiting, waitlistOffered)
+	if err != nil {
+		return waitlistEntry{}, false, err
+	}
+	if len(existing) > 0 {
+		return existing[0], false, nil
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO waitlist_entries
+			(restaurant_id, reservation_date, time_from, time_to, party_size, customer_name,
+			 contact_phone, contact_phone_country_code, contact_email, commentary, status, claim_base_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, restaurantID, e.Date, e.TimeFrom, e.TimeTo, e.PartySize, e.CustomerName,
+		e.ContactPhone, e.ContactPhoneCountryCode, nullableString(e.ContactEmail), nullableString(e.Commentary), waitlistWaiting, baseURL)
+	if err != nil {
+		return waitlistEntry{}, false, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return waitlistEntry{}, false, err
+	}
+	created, err := s.loadWaitlistEntry(ctx, restaurantID, int(id))
+	return created, true, err
+}
+
+// waitlistPosition is the place of a waiting entry in its date's queue.
+func (s *Server) waitlistPosition(ctx context.Context, restaurantID int, e waitlistEntry) int {
+	if e.Status != waitlistWaiting {
+		return 0
+	}
+	var n int
+	_ = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM waitlist_entries
+		WHERE restaurant_id = ? AND reservation_date = ? AND status = ? AND id <= ?
+	`, restaurantID, e.Date, waitlistWaiting, e.ID).Scan(&n)
+	return n
+}
+
+// waitlistRequest builds the request the availability helpers expect from
+// outside a handler.
+func waitlistRequest(ctx context.Context, restaurantID int) (*http.Request, error) {
+	return http.NewRequestWithContext(withRestaurantID(ctx, restaurantID), http.MethodGet, "/", nil)
+}
+
+// waitlistHeldCovers sums the covers of unexpired offers per offered hour.
+// Offers are not bookings yet, so availability does not count them.
+func (s *Server) waitlistHeldCovers(ctx context.Context, restaurantID int, date string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT offered_time, COALESCE(SUM(party_size), 0)
+		FROM waitlist_entries
+		WHERE restaurant_id = ? AND reservation_date = ? AND status = ? AND offer_expires_at > NOW()
+		GROUP BY offered_time
+	`, restaurantID, date, waitlistOffered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	held := map[string]int{}
+	for rows.Next() {
+		var (
+			hour   sql.NullString
+			covers int
+		)
+		if err := rows.Scan(&hour, &covers); err != nil {
+			return nil, err
+		}
+		held[hour.String] += covers
+	}
+	return held, rows.Err()
+}
+
+// offerWaitlist offers the freed capacity of a date to waiting entries in
+// queue order. An entry that doesn't fit is skipped, so a smaller party
+// further down can take a small gap. It returns the entries offered.
+//
+// The date's open entries are locked while offers are picked, so two runs
+// (two cancellations close together, or one and the expiry loop) can't give
+// the same covers to different guests: the second one waits and then counts
+// the offers the first committed. Messages go out after the commit.
+func (s *Server) offerWaitlist(ctx context.Context, restaurantID int, date string) ([]waitlistEntry, error) {
+	if date < time.Now().In(boMadridTZ).Format("2006-01-02") {
+		return nil, nil
+	}
+	type pendingOffer struct {
+		id          int
+		hhmm, token string
+	}
+	var pending []pendingOffer
+	err := withTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id FROM waitlist_entries
+			WHERE restaurant_id = ? AND reservation_date = ? AND status IN (?, ?)
+			FOR UPDATE
+		`, restaurantID, date, waitlistWaiting, waitlistOffered)
+		if err != nil {
+			return err
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		waiting, err := s.loadWaitlistEntries(ctx, restaurantID, "reservation_date = ? AND status = ?", date, waitlistWaiting)
+		if err != nil || len(waiting) == 0 {
+			return err
+		}
+		held, err := s.waitlistHeldCovers(ctx, restaurantID, date)
+		if err != nil {
+			return err
+		}
+		req, err := waitlistRequest(ctx, restaurantID)
+		if err != nil {
+			return err
+		}
+
+		hoursBySize := map[int][]availableHour{}
+		for _, e := range waiting {
+			hours, ok := hoursBySize[e.PartySize]
+			if !ok {
+				hours, err = s.computeAvailableHoursForPartySize(req, date, e.PartySize)
+				if err != nil {
+					return err
+				}
+				hoursBySize[e.PartySize] = hours
+			}
+			hhmm := pickWaitlistOfferTime(hours, held, e.TimeFrom, e.TimeTo, e.PartySize)
+			if hhmm == "" {
+				continue
+			}
+			token, ok, err := s.markWaitlistOffered(ctx, tx, restaurantID, e.ID, hhmm)
+			if err != nil {
+				return err
+			}
+			if ok {
+				held[hhmm] += e.PartySize
+				pending = append(pending, pendingOffer{id: e.ID, hhmm: hhmm, token: token})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var offered []waitlistEntry
+	for _, p := range pending {
+		after, err := s.notifyWaitlistOffer(ctx, restaurantID, p.id, p.hhmm, p.token)
+		if err != nil {
+			return offered, err
+		}
+		offered = append(offered, after)
+	}
+	return offered, nil
+}
+
+// sendWaitlistOffer moves a waiting (or, from the backoffice, expired) entry
+// to offered at hhmm with a fresh claim token, then sends the claim link by
+// WhatsApp. It returns false when the entry was no longer in either state.
+func (s *Server) sendWaitlistOffer(ctx context.Context, restaurantID int, e waitlistEntry, hhmm string) (waitlistEntry, bool, error) {
+	token, ok, err := s.markWaitlistOffered(ctx, s.db, restaurantID, e.ID, hhmm)
+	if err != nil || !ok {
+		return waitlistEntry{}, false, err
+	}
+	after, err := s.notifyWaitlistOffer(ctx, restaurantID, e.ID, hhmm, token)
+	if err != nil {
+		return waitlistEntry{}, false, err
+	}
+	return after, true, nil
+}
+
+// markWaitlistOffered stores the offer and returns the claim token to send.
+// It returns false when the entry is no longer waiting or expired.
+func (s *Server) markWaitlistOffered(ctx context.Context, db guestDB, restaurantID, id int, hhmm string) (string, bool, error) {
+	token, err := newWaitlistClaimToken()
+	if err != nil {
+		return "", false, err
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE waitlist_entries
+		SET status = ?, offered_time = ?, offer_token_hash = ?,
+			offer_expires_at = DATE_ADD(NOW(), INTERVAL ? MINUTE), offer_count = offer_count + 1
+		WHERE restaurant_id = ? AND id = ? AND status IN (?, ?)
+	`, waitlistOffered, hhmm, sha256Hex(token), s.waitlistOfferMinutes(), restaurantID, id, waitlistWaiting, waitlistExpired)
+	if err != nil {
+		return "", false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", false, nil
+	}
+	return token, true, nil
+}
+
+func (s *Server) waitlistOfferMinutes() int {
+	minutes := int(s.cfg.WaitlistOfferTTL / time.Minute)
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return minutes
+}
+
+// notifyWaitlistOffer sends the claim link of a stored offer by WhatsApp and
+// emits the webhook.
+func (s *Server) notifyWaitlistOffer(ctx context.Context, restaurantID, id int, hhmm, token string) (waitlistEntry, error) {
+	after, err := s.loadWaitlistEntry(ctx, restaurantID, id)
+	if err != nil {
+		return waitlistEntry{}, err
+	}
+
+	link := waitlistClaimURL(after.claimBaseURL, token)
+	dateDisplay := after.Date
+	if t, err := time.Parse("2006-01-02", after.Date); err == nil {
+		dateDisplay = t.Format("02/01/2006")
+	}
+	msg := "🎉 *¡Se ha liberado una mesa!*\n\n"
+	msg += "Hola " + after.CustomerName + ", tenemos sitio para " + strconv.Itoa(after.PartySize) + " personas el " + dateDisplay + " a las " + hhmm + ".\n\n"
+	msg += "Reserve desde este enlace antes de " + strconv.Itoa(s.waitlistOfferMinutes()) + " minutos:\n" + link
+	if err := s.sendWhatsAppMessage(ctx, restaurantID, after.phoneE164(), msg); err != nil {
+		log.Printf("[waitlist] offer %d whatsapp: %v", after.ID, err)
+	}
+
+	s.emitN8nWebhookAsync(restaurantID, webhookEventWaitlistOffered, map[string]any{
+		"waitlistId":       after.ID,
+		"reservationDate":  after.Date,
+		"offeredTime":      hhmm,
+		"partySize":        after.PartySize,
+		"customerName":     after.CustomerName,
+		"contactPhone":     after.ContactPhone,
+		"contactPhoneE164": after.phoneE164(),
+		"contactEmail":     after.ContactEmail,
+		"offerExpiresAt":   after.OfferExpiresAt,
+		"offerCount":       after.OfferCount,
+		"claimUrl":         link,
+	})
+	return after, nil
+}
+
+// offerWaitlistAsync runs offerWaitlist after a cancellation frees capacity.
+func (s *Server) offerWaitlistAsync(restaurantID int, date string) {
+	if restaurantID <= 0 || !isValidISODate(date) {
+		return
+	}
+	s.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, waitlistTriggerWait)
+		defer cancel()
+		if _, err := s.offerWaitlist(ctx, restaurantID, date); err != nil && !isSQLSchemaError(err) {
+			log.Printf("[waitlist] offer restaurant_id=%d date=%s: %v", restaurantID, date, err)
+		}
+	})
+}
+
+// expireWaitlistOffers expires unclaimed offers and entries for past dates,
+// then offers the released capacity to the next entries.
+func (s *Server) expireWaitlistOffers(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT restaurant_id, DATE_FORMAT(reservation_date, '%Y-%m-%d')
+		FROM waitlist_entries
+		WHERE status = ? AND offer_expires_at <= NOW()
+	`, waitlistOffered)
+	if err != nil {
+		return err
+	}
+	type dayKey struct {
+		restaurantID int
+		date         string
+	}
+	var days []dayKey
+	for rows.Next() {
+		var k dayKey
+		if err := rows.Scan(&k.restaurantID, &k.date); err != nil {
+			rows.Close()
+			return err
+		}
+		days = append(days, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE waitlist_entries SET status = ?
+		WHERE (status = ? AND offer_expires_at <= NOW())
+		   OR (status = ? AND reservation_date < ?)
+	`, waitlistExpired, waitlistOffered, waitlistWaiting, time.Now().In(boMadridTZ).Format("2006-01-02")); err != nil {
+		return err
+	}
+
+	for _, k := range days {
+		if _, err := s.offerWaitlist(ctx, k.restaurantID, k.date); err != nil {
+			log.Printf("[waitlist] re-offer restaurant_id=%d date=%s: %v", k.restaurantID, k.date, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) runWaitlistOfferExpiryLoop(ctx context.Context) {
+	t := time.NewTicker(waitlistExpiryPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.expireWaitlistOffers(ctx); err != nil && !isSQLSchemaError(err) {
+				log.Printf("[waitlist] expire offers: %v", err)
+			}
+		}
+	}
+}
+
+// handleWaitlistJoin adds a guest to the waitlist of a full day. When the
+// window still has room it answers with the free hours instead, so the guest
+// books directly.
+func (s *Server) handleWaitlistJoin(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := restaurantIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteJSON(w, http.StatusNotFound, map[string]any{
+			"success": false,
+			"message": "Unknown restaurant",
+		})
+		return
+	}
+
+	var in waitlistInput
+	if err := readJSONBody(r, &in); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": "Invalid JSON",
+		})
+		return
+	}
+	if strings.TrimSpace(in.WebsiteURL) != "" {
+		httpx.WriteJSON(w, http.StatusForbidden, map[string]any{
+			"success": false,
+			"message": "Spam detected.",
+		})
+		return
+	}
+	e, msg := normalizeWaitlistInput(in, time.Now().In(boMadridTZ).Format("2006-01-02"))
+	if msg != "" {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+
+	hours, err := s.computeAvailableHoursForPartySize(r, e.Date, e.PartySize)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error consultando disponibilidad")
+		return
+	}
+	var free []string
+	for _, h := range hours {
+		if waitlistWindowContains(e.TimeFrom, e.TimeTo, h.Time) {
+			free = append(free, h.Time)
+		}
+	}
+	if len(free) > 0 {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"success":        false,
+			"available":      true,
+			"availableHours": free,
+			"message":        "Hay mesas disponibles en esa franja, puede reservar directamente",
+		})
+		return
+	}
+
+	entry, created, err := s.insertWaitlistEntry(r.Context(), restaurantID, e, publicBaseURL(r))
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, "Error guardando lista de espera")
+		return
+	}
+	entry.Position = s.waitlistPosition(r.Context(), restaurantID, entry)
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"created":  created,
+		"waitlist": entry,
+	})
+
+	if created {
+		s.emitN8nWebhookAsync(restaurantID, webhookEventWaitlistJoined, waitlistWebhookPayload("public", entry))
+	}
+}
+
+func waitlistWebhookPayload(source string, e waitlistEntry) map[string]any {
+	return map[string]any{
+		"source":           source,
+		"waitlistId":       e.ID,
+		"reservationDate":  e.Date,
+		"timeFrom":         e.TimeFrom,
+		"timeTo":           e.TimeTo,
+		"partySize":        e.PartySize,
+		"customerName":     e.CustomerName,
+		"contactPhone":     e.ContactPhone,
+		"contactPhoneE164": e.phoneE164(),
+		"contactEmail":     e.ContactEmail,
+		"position":         e.Position,
+	}
+}
+
+// waitlistClaimError carries the message shown on the claim page.
+type waitlistClaimError struct{ Message string }
+
+func (e *waitlistClaimError) Error() string { return e.Message }
+
+// loadWaitlistOffer finds the entry a claim token belongs to.
+func (s *Server) loadWaitlistOffer(ctx context.Context, restaurantID int, token string) (waitlistEntry, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return waitlistEntry{}, sql.ErrNoRows
+	}
+	row := s.db.QueryRowContext(ctx, "SELECT "+waitlistSelectColumns+" FROM waitlist_entries WHERE restaurant_id = ? AND offer_token_hash = ? LIMIT 1", restaurantID, sha256Hex(token))
+	return scanWaitlistEntry(row)
+}
+
+// claimWaitlistOffer turns an offer into a booking. The entry is marked
+// claimed first so a double submit can't book twice; if the slot was taken
+// meanwhile the entry goes back to the queue.
+func (s *Server) claimWaitlistOffer(r *http.Request, restaurantID int, e waitlistEntry) (int64, error) {
+	ctx := r.Context()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE waitlist_entries SET status = ?
+		WHERE restaurant_id = ? AND id = ? AND status = ? AND offer_expires_at > NOW()
+	`, waitlistClaimed, restaurantID, e.ID, waitlistOffered)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, &waitlistClaimError{"Esta oferta ya no esta disponible."}
+	}
+
+	resTime, _ := ensureHHMMSS(derefString(e.OfferedTime))
+	bookingID, err := s.insertBooking(r, bookingInsertParams{
+		ReservationDate: e.Date,
+		ReservationTime: resTime,
+		PartySize:       e.PartySize,
+		CustomerName:    e.CustomerName,
+		ContactPhone:    e.ContactPhone,
+		ContactPhoneCC:  e.ContactPhoneCountryCode,
+		ContactEmail:    e.ContactEmail,
+		Commentary:      e.Commentary,
+	})
+	if err != nil {
+		revert := waitlistOffered
+		var capErr *bookingCapacityError
+		if errors.As(err, &capErr) {
+			revert = waitlistWaiting
+			err = &waitlistClaimError{"Lo sentimos, la mesa ya ha sido reservada. Seguira en la lista de espera."}
+		}
+		_, _ = s.db.ExecContext(context.Background(), `
+			UPDATE waitlist_entries SET status = ? WHERE restaurant_id = ? AND id = ?
+		`, revert, restaurantID, e.ID)
+		return 0, err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE waitlist_entries SET booking_id = ? WHERE restaurant_id = ? AND id = ?
+	`, bookingID, restaurantID, e.ID); err != nil {
+		log.Printf("[waitlist] link booking %d to entry %d: %v", bookingID, e.ID, err)
+	}
+	return bookingID, nil
+}
+
+var waitlistClaimTmpl = template.Must(template.New("waitlist_claim").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+  <title>Lista de espera - {{.BrandName}}</title>
+  <style>
+    :root { --primary:#4a6741; --danger:#dc3545; --success:#28a745; --bg1:#e8f5e9; --bg2:#c8e6c9; --bg3:#a5d6a7; --text:#2d3748; --muted:#718096; }
+    * { box-sizing:border-box; }
+    body { margin:0; font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,Oxygen,Ubuntu,sans-serif; min-height:100vh; display:flex; align-items:center; justify-content:center; padding:16px; background:linear-gradient(135deg,var(--bg1),var(--bg2),var(--bg3)); background-attachment:fixed; color:var(--text); }
+    .card { width:100%; max-width:560px; background:rgba(255,255,255,0.75); border:1px solid rgba(255,255,255,0.35); border-radius:18px; padding:24px; box-shadow:0 8px 32px rgba(0,0,0,0.08); backdrop-filter: blur(18px); }
+    .logo { display:block; margin:0 auto 10px; width:120px; height:auto; }
+    h1 { margin:0 0 6px; font-size:22px; text-align:center; }
+    .sub { margin:0 0 16px; color:var(--muted); font-size:14px; text-align:center; }
+    .msg { padding:12px 14px; border-radius:12px; margin:14px 0; border:1px solid rgba(0,0,0,0.08); background:rgba(255,255,255,0.55); }
+    .msg.success { border-color: rgba(40,167,69,0.35); background: rgba(40,167,69,0.12); }
+    .msg.error { border-color: rgba(220,53,69,0.35); background: rgba(220,53,69,0.10); }
+    .details { background:rgba(255,255,255,0.55); border:1px solid rgba(74,103,65,0.22); border-radius:14px; padding:14px; margin:14px 0; }
+    .details h3 { margin:0 0 10px; font-size:16px; }
+    .details p { margin:6px 0; }
+    .btn { display:inline-block; width:100%; text-align:center; border:none; border-radius:12px; padding:12px 14px; cursor:pointer; font-size:16px; background:var(--success); color:white; text-decoration:none; }
+    .btn.secondary { background:rgba(74,103,65,0.12); color:var(--primary); border:1px solid rgba(74,103,65,0.35); }
+  </style>
+</head>
+<body>
+  <main class="card">
+    <img class="logo" src="{{.LogoURL}}" alt="{{.BrandName}}" />
+    <h1>Mesa disponible</h1>
+    <p class="sub">Se ha liberado una mesa para la fecha en la que estaba en lista de espera.</p>
+
+    {{if .Message}}
+      <div class="msg {{if .Success}}success{{else}}error{{end}}">{{.Message}}</div>
+    {{end}}
+
+    {{if .HasOffer}}
+      <section class="details">
+        <h3>Detalles de la oferta</h3>
+        <p><strong>Cliente:</strong> {{.CustomerName}}</p>
+        <p><strong>Fecha:</strong> {{.DateDisplay}}</p>
+        <p><strong>Hora:</strong> {{.TimeDisplay}}</p>
+        <p><strong>Personas:</strong> {{.PartySize}}</p>
+        {{if .ExpiresDisplay}}<p><strong>Disponible hasta:</strong> {{.ExpiresDisplay}}</p>{{end}}
+      </section>
+    {{end}}
+
+    {{if .ShowConfirmation}}
+      <form method="post" action="{{.Action}}">
+        <button class="btn" type="submit" name="confirm_claim" value="1">Confirmar Reserva</button>
+      </form>
+      <div style="height:10px"></div>
+    {{end}}
+    <a class="btn secondary" href="index.php">Volver a la página principal</a>
+  </main>
+</body>
+</html>`))
+
+// handleWaitlistClaimPage shows an offer sent to a waitlisted guest and
+// books it when the guest confirms.
+func (s *Server) handleWaitlistClaimPage(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := restaurantIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusNotFound, "Unknown restaurant")
+		return
+	}
+
+	branding, _ := s.loadRestaurantBranding(r.Context(), restaurantID)
+	brandName := strings.TrimSpace(branding.BrandName)
+	if brandName == "" {
+		brandName = "Restaurante"
+	}
+	logoURL := strings.TrimSpace(branding.LogoURL)
+	if logoURL == "" {
+		logoURL = "/media/logos/logo-negro.png"
+	}
+
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	data := map[string]any{
+		"BrandName":        brandName,
+		"LogoURL":          logoURL,
+		"Message":          "",
+		"Success":          false,
+		"HasOffer":         false,
+		"ShowConfirmation": false,
+		"Action":           r.URL.Path + "?token=" + url.QueryEscape(token),
+	}
+
+	e, err := s.loadWaitlistOffer(r.Context(), restaurantID, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			data["Message"] = "Enlace no válido. Por favor, contacte con el restaurante."
+		} else {
+			data["Message"] = "Error al cargar la oferta. Por favor, inténtelo de nuevo."
+		}
+		writeHTMLTemplate(w, waitlistClaimTmpl, data)
+		return
+	}
+
+	data["HasOffer"] = true
+	data["CustomerName"] = e.CustomerName
+	data["DateDisplay"] = e.Date
+	if t, err := time.Parse("2006-01-02", e.Date); err == nil {
+		data["DateDisplay"] = t.Format("02/01/2006")
+	}
+	data["TimeDisplay"] = derefString(e.OfferedTime)
+	data["PartySize"] = e.PartySize
+	data["ExpiresDisplay"] = ""
+	if e.OfferExpiresAt != nil {
+		if t, err := time.Parse(time.RFC3339, *e.OfferExpiresAt); err == nil {
+			data["ExpiresDisplay"] = t.In(boMadridTZ).Format("15:04")
+		}
+	}
+
+	switch e.Status {
+	case waitlistOffered:
+	case waitlistClaimed:
+		data["Success"] = true
+		data["Message"] = "Esta mesa ya está reservada a su nombre."
+		writeHTMLTemplate(w, waitlistClaimTmpl, data)
+		return
+	default:
+		data["Message"] = "Esta oferta ha caducado. Le avisaremos si se libera otra mesa."
+		if e.Status == waitlistCancelled {
+			data["Message"] = "Esta oferta ya no está disponible."
+		}
+		writeHTMLTemplate(w, waitlistClaimTmpl, data)
+		return
+	}
+
+	process := r.Method == http.MethodPost && strings.TrimSpace(r.FormValue("confirm_claim")) != ""
+	if !process {
+		data["ShowConfirmation"] = true
+		writeHTMLTemplate(w, waitlistClaimTmpl, data)
+		return
+	}
+
+	bookingID, err := s.claimWaitlistOffer(r, restaurantID, e)
+	if err != nil {
+		var claimErr *waitlistClaimError
+		if errors.As(err, &claimErr) {
+			data["Message"] = claimErr.Message
+		} else {
+			data["Message"] = "Error al crear la reserva. Por favor, inténtelo de nuevo."
+			data["ShowConfirmation"] = true
+		}
+		writeHTMLTemplate(w, waitlistClaimTmpl, data)
+		return
+	}
+
+	data["Success"] = true
+	data["Message"] = "Su reserva ha sido confirmada. ¡Le esperamos!"
+	writeHTMLTemplate(w, waitlistClaimTmpl, data)
+
+	resTime, _ := ensureHHMMSS(derefString(e.OfferedTime))
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingCreated, map[string]any{
+		"source":                  "waitlist",
+		"bookingId":               bookingID,
+		"waitlistId":              e.ID,
+		"reservationDate":         e.Date,
+		"reservationTime":         resTime,
+		"partySize":               e.PartySize,
+		"customerName":            e.CustomerName,
+		"contactPhone":            e.ContactPhone,
+		"contactPhoneCountryCode": e.ContactPhoneCountryCode,
+		"contactPhoneE164":        e.phoneE164(),
+		"contactEmail":            e.ContactEmail,
+		"guestLinks":              s.guestLinksForBooking(publicBaseURL(r), restaurantID, int(bookingID), e.Date),
+	})
+	s.emitN8nWebhookAsync(restaurantID, webhookEventWaitlistClaimed, map[string]any{
+		"waitlistId":      e.ID,
+		"bookingId":       bookingID,
+		"reservationDate": e.Date,
+		"reservationTime": resTime,
+		"partySize":       e.PartySize,
+		"customerName":    e.CustomerName,
+	})
+}
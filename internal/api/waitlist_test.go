@@ -0,0 +1,67 @@
+package api
+
+import "testing"
+
+func TestNormalizeWaitlistInput(t *testing.T) {
+	in := waitlistInput{
+		Date:         "2026-10-20",
+		TimeFrom:     "20:30:00",
+		TimeTo:       "00:30",
+		PartySize:    4,
+		CustomerName: " Ana ",
+		ContactPhone: "+34 600 111 222",
+	}
+	e, msg := normalizeWaitlistInput(in, "2026-10-16")
+	if msg != "" {
+		t.Fatalf("normalizeWaitlistInput() message = %q", msg)
+	}
+	if e.TimeFrom != "20:30" || e.TimeTo != "00:30" || e.CustomerName != "Ana" || e.ContactPhone != "600111222" || e.ContactPhoneCountryCode != "34" {
+		t.Fatalf("entry = %+v", e)
+	}
+
+	bad := in
+	bad.Date = "2026-10-15"
+	if _, msg := normalizeWaitlistInput(bad, "2026-10-16"); msg == "" {
+		t.Fatalf("past date accepted")
+	}
+	bad = in
+	bad.TimeFrom, bad.TimeTo = "22:00", "21:00"
+	if _, msg := normalizeWaitlistInput(bad, "2026-10-16"); msg == "" {
+		t.Fatalf("reversed window accepted")
+	}
+}
+
+func TestPickWaitlistOfferTime(t *testing.T) {
+	hours := []availableHour{
+		{Time: "13:30", Capacity: 10},
+		{Time: "14:00", Capacity: 4},
+		{Time: "14:30", Capacity: 6},
+	}
+	if got := pickWaitlistOfferTime(hours, nil, "14:00", "15:00", 4); got != "14:00" {
+		t.Fatalf("pick = %q, want 14:00", got)
+	}
+	// An open offer already holds two covers at 14:00.
+	if got := pickWaitlistOfferTime(hours, map[string]int{"14:00": 2}, "14:00", "15:00", 4); got != "14:30" {
+		t.Fatalf("pick with held covers = %q, want 14:30", got)
+	}
+	if got := pickWaitlistOfferTime(hours, nil, "21:00", "22:00", 2); got != "" {
+		t.Fatalf("pick outside window = %q, want none", got)
+	}
+}
+
+func TestSetWaitlistPositions(t *testing.T) {
+	entries := []waitlistEntry{
+		{ID: 1, Date: "2026-10-20", Status: waitlistOffered},
+		{ID: 2, Date: "2026-10-20", Status: waitlistWaiting},
+		{ID: 3, Date: "2026-10-21", Status: waitlistWaiting},
+		{ID: 4, Date: "2026-10-20", Status: waitlistWaiting},
+	}
+	setWaitlistPositions(entries)
+	got := []int{entries[0].Position, entries[1].Position, entries[2].Position, entries[3].Position}
+	want := []int{0, 1, 1, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("positions = %v, want %v", got, want)
+		}
+	}
+}
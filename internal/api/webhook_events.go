@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"preactvillacarmen/internal/httpx"
+)
+
+// Outbound webhook event names. Payload schemas are documented in ENDPOINTS.md
+// ("Webhook event catalogue"); bump the version in webhookEventCatalogue when
+// a field is removed or changes meaning. Adding fields does not need a bump.
+const (
+	webhookEventBookingCreated       = "booking.created"
+	webhookEventBookingConfirmed     = "booking.confirmed"
+	webhookEventBookingCancelled     = "booking.cancelled"
+	webhookEventBookingUpdated       = "booking.updated"
+	webhookEventBookingReactivated   = "booking.reactivated"
+	webhookEventBookingTableAssigned = "booking.table_assigned"
+	webhookEventDayClosed            = "day.closed"
+	webhookEventDayOpened            = "day.opened"
+	webhookEventMenuPublished        = "menu.published"
+	webhookEventFichajeClockStarted  = "fichaje.clock_started"
+	webhookEventFichajeClockStopped  = "fichaje.clock_stopped"
+	webhookEventInvoiceSent          = "invoice.sent"
+	webhookEventWaitlistJoined       = "waitlist.joined"
+	webhookEventWaitlistOffered      = "waitlist.offered"
+	webhookEventWaitlistClaimed      = "waitlist.claimed"
+	webhookEventPaymentCompleted     = "payment.completed"
+	webhookEventPaymentExpired       = "payment.expired"
+	webhookEventPaymentRefunded      = "payment.refunded"
+)
+
+type webhookEventSpec struct {
+	Event       string `json:"event"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+var webhookEventCatalogue = []webhookEventSpec{
+	{webhookEventBookingCreated, 1, "Nueva reserva (web, backoffice o legacy)"},
+	{webhookEventBookingConfirmed, 1, "El cliente confirma la reserva desde el enlace"},
+	{webhookEventBookingCancelled, 1, "Reserva cancelada por el cliente o el personal"},
+	{webhookEventBookingUpdated, 1, "Reserva modificada; incluye los campos cambiados"},
+	{webhookEventBookingReactivated, 1, "Reserva cancelada restaurada"},
+	{webhookEventBookingTableAssigned, 1, "Mesa asignada o retirada de una reserva"},
+	{webhookEventDayClosed, 1, "Dia cerrado a reservas"},
+	{webhookEventDayOpened, 1, "Dia abierto a reservas"},
+	{webhookEventMenuPublished, 1, "Menu de grupo publicado"},
+	{webhookEventFichajeClockStarted, 1, "Inicio de fichaje"},
+	{webhookEventFichajeClockStopped, 1, "Fin de fichaje (manual, admin o corte automatico)"},
+	{webhookEventInvoiceSent, 1, "Factura enviada al cliente"},
+	{webhookEventWaitlistJoined, 1, "Cliente apuntado a la lista de espera"},
+	{webhookEventWaitlistOffered, 1, "Mesa liberada ofrecida a un cliente en lista de espera"},
+	{webhookEventWaitlistClaimed, 1, "Oferta de lista de espera convertida en reserva"},
+	{webhookEventPaymentCompleted, 1, "Señal pagada o tarjeta de garantia autorizada"},
+	{webhookEventPaymentExpired, 1, "Pago de señal no completado a tiempo"},
+	{webhookEventPaymentRefunded, 1, "Señal devuelta o garantia liberada"},
+}
+
+func webhookEventVersion(event string) int {
+	for _, spec := range webhookEventCatalogue {
+		if spec.Event == event {
+			return spec.Version
+		}
+	}
+	return 1
+}
+
+// validWebhookSubscription accepts catalogue events, "*" and "<group>.*".
+func validWebhookSubscription(sub string) bool {
+	sub = strings.TrimSpace(sub)
+	if sub == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(sub, ".*"); ok {
+		for _, spec := range webhookEventCatalogue {
+			if strings.HasPrefix(spec.Event, prefix+".") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, spec := range webhookEventCatalogue {
+		if spec.Event == sub {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleBOWebhookEventsList(w http.ResponseWriter, r *http.Request) {
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"events":  webhookEventCatalogue,
+	})
+}
+
+// webhookBookingFields is the order of fields compared for booking.updated.
+var webhookBookingFields = []string{
+	"reservationDate",
+	"reservationTime",
+	"partySize",
+	"customerName",
+	"contactPhone",
+	"contactEmail",
+	"tableNumber",
+	"commentary",
+	"specialMenu",
+	"menuDeGrupoId",
+	"arrozType",
+	"arrozServings",
+	"status",
+}
+
+type webhookBookingSnapshot map[string]any
+
+func (s *Server) loadWebhookBookingSnapshot(ctx context.Context, restaurantID int, bookingID int) (webhookBookingSnapshot, error) {
+	var (
+		resDate, resTime, name             string
+		partySize                          int
+		phone, email, table, comment       sql.NullString
+		specialMenu, menuID                sql.NullInt64
+		arrozType, arrozServings, statusNS sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			DATE_FORMAT(reservation_date, '%Y-%m-%d'),
+			TIME_FORMAT(reservation_time, '%H:%i:%s'),
+			party_size,
+			customer_name,
+			contact_phone,
+			contact_email,
+			table_number,
+			commentary,
+			special_menu,
+			menu_de_grupo_id,
+			CAST(arroz_type AS CHAR),
+			CAST(arroz_servings AS CHAR),
+			status
+		FROM bookings
+		WHERE restaurant_id = ? AND id = ?
+		LIMIT 1
+	`, restaurantID, bookingID).Scan(&resDate, &resTime, &partySize, &name, &phone, &email, &table, &comment, &specialMenu, &menuID, &arrozType, &arrozServings, &statusNS)
+	if err != nil {
+		return nil, err
+	}
+	return webhookBookingSnapshot{
+		"reservationDate": resDate,
+		"reservationTime": resTime,
+		"partySize":       partySize,
+		"customerName":    name,
+		"contactPhone":    phone.String,
+		"contactEmail":    email.String,
+		"tableNumber":     strings.TrimSpace(table.String),
+		"commentary":      comment.String,
+		"specialMenu":     specialMenu.Valid && specialMenu.Int64 != 0,
+		"menuDeGrupoId":   nullInt64OrNil(menuID),
+		"arrozType":       webhookRawJSONOrNil(arrozType),
+		"arrozServings":   webhookRawJSONOrNil(arrozServings),
+		"status":          statusNS.String,
+	}, nil
+}
+
+func webhookRawJSONOrNil(ns sql.NullString) any {
+	v := strings.TrimSpace(ns.String)
+	if !ns.Valid || v == "" || !json.Valid([]byte(v)) {
+		return nil
+	}
+	return json.RawMessage(v)
+}
+
+// changedBookingFields compares snapshots by their JSON encoding so RawMessage
+// and numeric values compare the way receivers will see them.
+func changedBookingFields(before, after webhookBookingSnapshot) (changed []string, previous map[string]any) {
+	changed = []string{}
+	previous = map[string]any{}
+	for _, k := range webhookBookingFields {
+		a, _ := json.Marshal(before[k])
+		b, _ := json.Marshal(after[k])
+		if string(a) != string(b) {
+			changed = append(changed, k)
+			previous[k] = before[k]
+		}
+	}
+	return changed, previous
+}
+
+// emitBookingUpdatedWebhooks emits booking.updated (and booking.table_assigned
+// when the table changed) comparing before with the booking's current state.
+// A nil before means the snapshot couldn't be read and nothing is emitted.
+func (s *Server) emitBookingUpdatedWebhooks(ctx context.Context, restaurantID int, bookingID int, source string, before webhookBookingSnapshot) {
+	if before == nil {
+		return
+	}
+	after, err := s.loadWebhookBookingSnapshot(ctx, restaurantID, bookingID)
+	if err != nil {
+		return
+	}
+	changed, previous := changedBookingFields(before, after)
+	if len(changed) == 0 {
+		return
+	}
+
+	payload := map[string]any{
+		"source":        source,
+		"bookingId":     bookingID,
+		"changedFields": changed,
+		"previous":      previous,
+	}
+	for k, v := range after {
+		payload[k] = v
+	}
+	s.emitN8nWebhookAsync(restaurantID, webhookEventBookingUpdated, payload)
+
+	if _, ok := previous["tableNumber"]; ok {
+		s.emitN8nWebhookAsync(restaurantID, webhookEventBookingTableAssigned, map[string]any{
+			"source":              source,
+			"bookingId":           bookingID,
+			"reservationDate":     after["reservationDate"],
+			"reservationTime":     after["reservationTime"],
+			"partySize":           after["partySize"],
+			"customerName":        after["customerName"],
+			"tableNumber":         after["tableNumber"],
+			"previousTableNumber": previous["tableNumber"],
+		})
+	}
+}
+
+func fichajeWebhookPayload(entry *boFichajeActiveEntry, source string, actorUserID int) map[string]any {
+	payload := map[string]any{
+		"source":     source,
+		"entryId":    entry.ID,
+		"memberId":   entry.MemberID,
+		"memberName": entry.MemberName,
+		"workDate":   entry.WorkDate,
+		"startTime":  entry.StartTime,
+		"startAt":    entry.StartAtISO,
+	}
+	if actorUserID > 0 {
+		payload["actorUserId"] = actorUserID
+	} else {
+		payload["actorUserId"] = nil
+	}
+	return payload
+}
+
+func fichajeStoppedWebhookPayload(entry *boFichajeActiveEntry, source string, actorUserID int, endAt time.Time) map[string]any {
+	payload := fichajeWebhookPayload(entry, source, actorUserID)
+	payload["endTime"] = endAt.Format("15:04")
+	payload["endAt"] = endAt.Format(time.RFC3339)
+	return payload
+}
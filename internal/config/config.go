@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
 	"strings"
@@ -18,8 +19,31 @@ type MySQLConfig struct {
 type Config struct {
 	Addr                   string
 	StaticDir              string
+	ShutdownTimeout        time.Duration
 	CORSAllowOrigins       string
 	AdminToken             string
+	AdminOpen              bool
+	GuestLinkSecret        string
+	GuestLinkAllowLegacyID bool
+	BOLoginMaxFailures     int
+	BOLoginIPMaxFailures   int
+	BOLoginLockout         time.Duration
+	BOTwoFactorImportance  int
+	BOTwoFactorIssuer      string
+	BOTwoFactorSecretKey   string
+	BOAuthCacheTTL         time.Duration
+	BOSessionHeartbeat     time.Duration
+	WaitlistOfferTTL       time.Duration
+	PaymentProvider        string
+	StripeSecretKey        string
+	StripeWebhookSecret    string
+	DepositHoldTTL         time.Duration
+	MarketingEmailRate     int
+	MarketingWhatsAppRate  int
+	VerifactuSubmitter     string
+	VerifactuQRBaseURL     string
+	VerifactuSystemNIF     string
+	VerifactuSystemName    string
 	BunnyPullBaseURL       string
 	BunnyStorageZone       string
 	BunnyStorageKey        string
@@ -49,8 +73,31 @@ func Load() Config {
 	return Config{
 		Addr:                   ":" + port,
 		StaticDir:              os.Getenv("STATIC_DIR"),
+		ShutdownTimeout:        time.Duration(getenvInt("SHUTDOWN_TIMEOUT_SECONDS", 25, 1, 300)) * time.Second,
 		CORSAllowOrigins:       os.Getenv("CORS_ALLOW_ORIGINS"),
 		AdminToken:             os.Getenv("ADMIN_TOKEN"),
+		AdminOpen:              getenvBool("ADMIN_OPEN", false),
+		GuestLinkSecret:        strings.TrimSpace(os.Getenv("GUEST_LINK_SECRET")),
+		GuestLinkAllowLegacyID: getenvBool("GUEST_LINK_ALLOW_LEGACY_ID", false),
+		BOLoginMaxFailures:     getenvInt("BO_LOGIN_MAX_FAILURES", 10, 3, 100),
+		BOLoginIPMaxFailures:   getenvInt("BO_LOGIN_IP_MAX_FAILURES", 50, 5, 10000),
+		BOLoginLockout:         time.Duration(getenvInt("BO_LOGIN_LOCKOUT_MINUTES", 15, 1, 1440)) * time.Minute,
+		BOTwoFactorImportance:  getenvInt("BO_2FA_REQUIRED_IMPORTANCE", 90, 0, 1000),
+		BOTwoFactorIssuer:      getenv("BO_2FA_ISSUER", "Villa Carmen"),
+		BOTwoFactorSecretKey:   strings.TrimSpace(os.Getenv("BO_2FA_SECRET_KEY")),
+		BOAuthCacheTTL:         time.Duration(getenvInt("BO_AUTH_CACHE_TTL_SECONDS", 10, 0, 300)) * time.Second,
+		BOSessionHeartbeat:     time.Duration(getenvInt("BO_SESSION_HEARTBEAT_SECONDS", 60, 0, 3600)) * time.Second,
+		WaitlistOfferTTL:       time.Duration(getenvInt("WAITLIST_OFFER_MINUTES", 30, 5, 1440)) * time.Minute,
+		PaymentProvider:        strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_PROVIDER"))),
+		StripeSecretKey:        strings.TrimSpace(os.Getenv("STRIPE_SECRET_KEY")),
+		StripeWebhookSecret:    strings.TrimSpace(os.Getenv("STRIPE_WEBHOOK_SECRET")),
+		DepositHoldTTL:         time.Duration(getenvInt("DEPOSIT_HOLD_MINUTES", 30, 30, 1440)) * time.Minute,
+		MarketingEmailRate:     getenvInt("MARKETING_EMAIL_PER_MINUTE", 60, 1, 6000),
+		MarketingWhatsAppRate:  getenvInt("MARKETING_WHATSAPP_PER_MINUTE", 20, 1, 600),
+		VerifactuSubmitter:     strings.ToLower(strings.TrimSpace(os.Getenv("VERIFACTU_SUBMITTER"))),
+		VerifactuQRBaseURL:     getenv("VERIFACTU_QR_BASE_URL", "https://www2.agenciatributaria.gob.es/wlpl/TIKE-CONT/ValidarQR"),
+		VerifactuSystemNIF:     strings.TrimSpace(os.Getenv("VERIFACTU_SYSTEM_NIF")),
+		VerifactuSystemName:    getenv("VERIFACTU_SYSTEM_NAME", "Villa Carmen Backoffice"),
 		BunnyPullBaseURL:       defaultPull,
 		BunnyStorageZone:       getenv("BUNNY_STORAGE_ZONE", "villacarmen"),
 		BunnyStorageKey:        defaultKey,
@@ -78,6 +125,22 @@ func Load() Config {
 	}
 }
 
+// Validate reports settings the server can't run with.
+func (c Config) Validate() error {
+	// Guest pages only accept unsigned links in legacy mode, so without a
+	// secret every confirm, cancel, rice and payment link sent out would
+	// be rejected when the guest opens it.
+	if c.GuestLinkSecret == "" && !c.GuestLinkAllowLegacyID {
+		return errors.New("GUEST_LINK_SECRET is required to sign guest links (or set GUEST_LINK_ALLOW_LEGACY_ID=true to send unsigned ID-only links)")
+	}
+	// Roles that must enrol in 2FA would otherwise keep their TOTP secrets
+	// in plain text in bo_users.
+	if c.BOTwoFactorImportance > 0 && c.BOTwoFactorSecretKey == "" {
+		return errors.New("BO_2FA_SECRET_KEY is required to encrypt TOTP secrets while BO_2FA_REQUIRED_IMPORTANCE enforces 2FA (set it to 0 to turn enforcement off)")
+	}
+	return nil
+}
+
 func getenv(key, fallback string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -96,6 +159,14 @@ func getenvFirst(keys []string, fallback string) string {
 	return fallback
 }
 
+func getenvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
 func getenvInt(key string, fallback int, min int, max int) int {
 	raw := strings.TrimSpace(os.Getenv(key))
 	if raw == "" {
@@ -0,0 +1,11 @@
+-- One row per restaurant/date used as a mutex by the booking insert path.
+-- Bookings for the same day lock this row (INSERT ... ON DUPLICATE KEY UPDATE)
+-- before re-checking capacity, so concurrent inserts can't both take the last seats.
+
+CREATE TABLE IF NOT EXISTS booking_capacity_locks (
+  restaurant_id INT NOT NULL,
+  reservation_date DATE NOT NULL,
+  locked_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id, reservation_date),
+  CONSTRAINT fk_booking_capacity_locks_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,99 @@
+-- Outbound webhooks: per-restaurant HMAC secret and a retry queue on message_deliveries.
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'restaurant_integrations' AND COLUMN_NAME = 'n8n_webhook_secret'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `restaurant_integrations` ADD COLUMN `n8n_webhook_secret` VARCHAR(255) DEFAULT NULL AFTER `n8n_webhook_url`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND COLUMN_NAME = 'event_id'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD COLUMN `event_id` VARCHAR(64) DEFAULT NULL AFTER `event`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND COLUMN_NAME = 'attempts'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD COLUMN `attempts` INT NOT NULL DEFAULT 0 AFTER `status`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND COLUMN_NAME = 'next_attempt_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD COLUMN `next_attempt_at` DATETIME DEFAULT NULL AFTER `attempts`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND COLUMN_NAME = 'last_attempt_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD COLUMN `last_attempt_at` DATETIME DEFAULT NULL AFTER `next_attempt_at`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.statistics
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND INDEX_NAME = 'idx_message_deliveries_status_next_attempt'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD KEY `idx_message_deliveries_status_next_attempt` (`status`, `next_attempt_at`)",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.statistics
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND INDEX_NAME = 'idx_message_deliveries_event_id'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  "ALTER TABLE `message_deliveries` ADD KEY `idx_message_deliveries_event_id` (`event_id`)",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,214 @@
+-- Spanish invoicing: gapless per-restaurant/series/year numbering assigned on
+-- issue, line items with VAT breakdown, and rectifying invoices.
+--
+-- invoices.amount keeps the invoice total (tax included) so existing readers
+-- keep working; tax_base/tax_amount are the computed breakdown.
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'invoice_type'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `invoice_type` VARCHAR(16) NOT NULL DEFAULT 'ordinaria' AFTER `status`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'invoice_series'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `invoice_series` VARCHAR(8) DEFAULT NULL AFTER `invoice_type`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'invoice_year'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `invoice_year` SMALLINT DEFAULT NULL AFTER `invoice_series`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'invoice_sequence'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `invoice_sequence` INT DEFAULT NULL AFTER `invoice_year`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'invoice_number'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `invoice_number` VARCHAR(32) DEFAULT NULL AFTER `invoice_sequence`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'issued_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `issued_at` DATETIME DEFAULT NULL AFTER `invoice_number`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'rectifies_invoice_id'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `rectifies_invoice_id` INT DEFAULT NULL AFTER `issued_at`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'rectification_reason'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `rectification_reason` VARCHAR(255) DEFAULT NULL AFTER `rectifies_invoice_id`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'tax_base'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `tax_base` DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER `amount`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'tax_amount'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `invoices` ADD COLUMN `tax_amount` DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER `tax_base`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.statistics
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND INDEX_NAME = 'uniq_invoices_series_sequence'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  "ALTER TABLE `invoices` ADD UNIQUE KEY `uniq_invoices_series_sequence` (`restaurant_id`, `invoice_series`, `invoice_year`, `invoice_sequence`)",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.statistics
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND INDEX_NAME = 'idx_invoices_rectifies'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  "ALTER TABLE `invoices` ADD KEY `idx_invoices_rectifies` (`rectifies_invoice_id`)",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Last number handed out per series and year. Numbers are taken inside the
+-- issuing transaction, so a rollback doesn't leave a gap.
+CREATE TABLE IF NOT EXISTS invoice_series_counters (
+  restaurant_id INT NOT NULL,
+  series VARCHAR(8) NOT NULL,
+  year SMALLINT NOT NULL,
+  last_sequence INT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id, series, year),
+  CONSTRAINT fk_invoice_series_counters_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  invoice_id INT NOT NULL,
+  restaurant_id INT NOT NULL,
+  position INT NOT NULL DEFAULT 0,
+  description VARCHAR(255) NOT NULL,
+  quantity DECIMAL(10,3) NOT NULL DEFAULT 1,
+  unit_price DECIMAL(10,2) NOT NULL,
+  tax_rate DECIMAL(5,2) NOT NULL,
+  tax_base DECIMAL(10,2) NOT NULL,
+  tax_amount DECIMAL(10,2) NOT NULL,
+  line_total DECIMAL(10,2) NOT NULL,
+  KEY idx_invoice_lines_invoice (invoice_id, position),
+  CONSTRAINT fk_invoice_lines_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE,
+  CONSTRAINT fk_invoice_lines_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Existing invoices only have a total; treat it as restaurant VAT (10%) included.
+UPDATE invoices
+SET tax_base = ROUND(amount / 1.10, 2), tax_amount = amount - ROUND(amount / 1.10, 2)
+WHERE tax_base = 0 AND tax_amount = 0 AND amount <> 0;
+
+INSERT INTO invoice_lines (invoice_id, restaurant_id, position, description, quantity, unit_price, tax_rate, tax_base, tax_amount, line_total)
+SELECT i.id, i.restaurant_id, 0,
+  IF(i.is_reservation = 1, 'Reserva', 'Servicios de restauración'),
+  1, i.tax_base, 10.00, i.tax_base, i.tax_amount, i.amount
+FROM invoices i
+WHERE NOT EXISTS (SELECT 1 FROM invoice_lines l WHERE l.invoice_id = i.id);
@@ -0,0 +1,51 @@
+-- VeriFactu-style fiscal records: one hash-chained registration record per
+-- issued invoice, plus the issuer identity the records are signed for.
+
+CREATE TABLE IF NOT EXISTS restaurant_fiscal_profiles (
+  restaurant_id INT NOT NULL,
+  issuer_nif VARCHAR(16) NOT NULL,
+  issuer_name VARCHAR(120) NOT NULL,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id),
+  CONSTRAINT fk_restaurant_fiscal_profiles_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS invoice_fiscal_records (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  invoice_id INT NOT NULL,
+  issuer_nif VARCHAR(16) NOT NULL,
+  issuer_name VARCHAR(120) NOT NULL,
+  invoice_number VARCHAR(32) NOT NULL,
+  invoice_date DATE NOT NULL,
+  invoice_type_code VARCHAR(2) NOT NULL,
+  tax_amount DECIMAL(12,2) NOT NULL,
+  total DECIMAL(12,2) NOT NULL,
+  previous_record_id BIGINT DEFAULT NULL,
+  previous_hash CHAR(64) DEFAULT NULL,
+  -- Exact timestamp string that went into the hash.
+  generated_at VARCHAR(32) NOT NULL,
+  hash CHAR(64) NOT NULL,
+  detail_json JSON NOT NULL,
+  submission_status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  submission_ref VARCHAR(128) DEFAULT NULL,
+  submission_error TEXT DEFAULT NULL,
+  submitted_at DATETIME DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_invoice_fiscal_records_invoice (invoice_id),
+  KEY idx_invoice_fiscal_records_restaurant (restaurant_id, id),
+  KEY idx_invoice_fiscal_records_submission (restaurant_id, submission_status),
+  CONSTRAINT fk_invoice_fiscal_records_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE,
+  CONSTRAINT fk_invoice_fiscal_records_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Head of each restaurant's chain. Locked while a record is appended so two
+-- concurrent issues can't both chain to the same previous record.
+CREATE TABLE IF NOT EXISTS invoice_fiscal_chain (
+  restaurant_id INT NOT NULL,
+  last_record_id BIGINT DEFAULT NULL,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id),
+  CONSTRAINT fk_invoice_fiscal_chain_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,28 @@
+-- Persisted login throttling for the backoffice. Counters live in the DB so
+-- every server instance sees the same failures and lockouts.
+
+CREATE TABLE IF NOT EXISTS bo_login_throttles (
+  -- 'account' (key user:<id> or id:<identifier> when no user matches) or 'ip'.
+  scope VARCHAR(16) NOT NULL,
+  throttle_key VARCHAR(191) NOT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at DATETIME NOT NULL,
+  locked_until DATETIME DEFAULT NULL,
+  PRIMARY KEY (scope, throttle_key),
+  KEY idx_bo_login_throttles_last_failure (last_failure_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS bo_login_events (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  event VARCHAR(16) NOT NULL, -- locked | unlocked
+  scope VARCHAR(16) NOT NULL,
+  throttle_key VARCHAR(191) NOT NULL,
+  user_id INT DEFAULT NULL,
+  actor_user_id INT DEFAULT NULL,
+  ip VARCHAR(64) DEFAULT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_bo_login_events_user_created (user_id, created_at),
+  KEY idx_bo_login_events_created (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,86 @@
+-- TOTP two-factor authentication for backoffice users.
+--
+-- totp_secret is set by /me/2fa/setup and only counts once totp_enabled_at is
+-- set. totp_last_step stops a code from being used twice.
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bo_users' AND COLUMN_NAME = 'totp_secret'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `bo_users` ADD COLUMN `totp_secret` VARCHAR(64) DEFAULT NULL",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bo_users' AND COLUMN_NAME = 'totp_enabled_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `bo_users` ADD COLUMN `totp_enabled_at` DATETIME DEFAULT NULL AFTER `totp_secret`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bo_users' AND COLUMN_NAME = 'totp_last_step'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `bo_users` ADD COLUMN `totp_last_step` BIGINT DEFAULT NULL AFTER `totp_enabled_at`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Last time the session proved possession of the second factor.
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bo_sessions' AND COLUMN_NAME = 'mfa_verified_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `bo_sessions` ADD COLUMN `mfa_verified_at` DATETIME DEFAULT NULL",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+CREATE TABLE IF NOT EXISTS bo_user_recovery_codes (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  code_sha256 CHAR(64) NOT NULL,
+  used_at DATETIME DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_bo_user_recovery_codes_code (user_id, code_sha256),
+  CONSTRAINT fk_bo_user_recovery_codes_user FOREIGN KEY (user_id) REFERENCES bo_users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Password-verified logins waiting for the TOTP code.
+CREATE TABLE IF NOT EXISTS bo_login_challenges (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  token_sha256 CHAR(64) NOT NULL,
+  user_id INT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_bo_login_challenges_token (token_sha256),
+  KEY idx_bo_login_challenges_expires (expires_at),
+  CONSTRAINT fk_bo_login_challenges_user FOREIGN KEY (user_id) REFERENCES bo_users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,19 @@
+-- Per-section action scopes for backoffice roles.
+--
+-- actions is a comma-separated subset of view,create,edit,delete,export.
+-- NULL keeps the built-in defaults for the role (every action for custom
+-- roles).
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bo_role_permissions' AND COLUMN_NAME = 'actions'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `bo_role_permissions` ADD COLUMN `actions` VARCHAR(64) DEFAULT NULL AFTER `is_allowed`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
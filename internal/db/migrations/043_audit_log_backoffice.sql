@@ -0,0 +1,60 @@
+-- Backoffice audit trail on top of audit_log (003).
+--
+-- Rows are only ever inserted; nothing in the app updates or deletes them.
+-- diff_json holds the changed top-level keys as {key: {before, after}}.
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'audit_log' AND COLUMN_NAME = 'actor_name'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `audit_log` ADD COLUMN `actor_name` VARCHAR(255) DEFAULT NULL AFTER `actor_user_id`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'audit_log' AND COLUMN_NAME = 'diff_json'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `audit_log` ADD COLUMN `diff_json` JSON DEFAULT NULL AFTER `after_json`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'audit_log' AND COLUMN_NAME = 'ip'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `audit_log` ADD COLUMN `ip` VARCHAR(64) DEFAULT NULL AFTER `diff_json`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.statistics
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'audit_log' AND INDEX_NAME = 'idx_audit_log_restaurant_entity'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  "ALTER TABLE `audit_log` ADD KEY `idx_audit_log_restaurant_entity` (`restaurant_id`, `entity`, `entity_id`, `id`)",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,20 @@
+-- Per-restaurant API keys for third-party integrations (n8n, legacy admin
+-- tools). Only the SHA-256 of the key is stored; key_prefix is kept so the
+-- backoffice can tell keys apart.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  name VARCHAR(120) NOT NULL,
+  key_prefix VARCHAR(16) NOT NULL,
+  key_hash CHAR(64) NOT NULL,
+  -- Comma separated, e.g. 'bookings:read,availability:read'.
+  scopes VARCHAR(255) NOT NULL,
+  created_by_user_id INT DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at DATETIME DEFAULT NULL,
+  revoked_at DATETIME DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_api_keys_hash (key_hash),
+  KEY idx_api_keys_restaurant (restaurant_id, revoked_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,37 @@
+-- Reservation services (e.g. comida / cena). When a restaurant has active
+-- services, each one has its own covers limit and replaces the single daily
+-- limit for the hours it covers.
+
+CREATE TABLE IF NOT EXISTS restaurant_services (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  service_key VARCHAR(32) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  -- First and last bookable slot (HH:MM, both inclusive). end_time may be
+  -- past midnight (service-day order runs 08:00..07:59).
+  start_time CHAR(5) NOT NULL,
+  end_time CHAR(5) NOT NULL,
+  covers_limit INT NOT NULL,
+  -- Max covers starting in the same slot; NULL = no pacing.
+  pacing_limit INT DEFAULT NULL,
+  min_party_size INT DEFAULT NULL,
+  max_party_size INT DEFAULT NULL,
+  sort_order INT NOT NULL DEFAULT 0,
+  is_active TINYINT(1) NOT NULL DEFAULT 1,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_restaurant_services_key (restaurant_id, service_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Per-date overrides: a different covers limit or a closed service.
+CREATE TABLE IF NOT EXISTS restaurant_service_days (
+  restaurant_id INT NOT NULL,
+  service_id INT NOT NULL,
+  date DATE NOT NULL,
+  covers_limit INT DEFAULT NULL,
+  is_closed TINYINT(1) NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id, service_id, date),
+  KEY idx_restaurant_service_days_date (restaurant_id, date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
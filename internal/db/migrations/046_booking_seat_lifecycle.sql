@@ -0,0 +1,93 @@
+-- Booking lifecycle on the floor: arrived -> seated -> main_course -> paid ->
+-- left. seat_status is the current step; each step keeps the time it was
+-- reached so turn durations (seated_at..left_at) can be learnt from history.
+-- Unrelated to bookings.status, which is the confirmation state.
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings'
+);
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'seat_status'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `seat_status` VARCHAR(16) NULL AFTER `preferred_floor_number`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'arrived_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `arrived_at` DATETIME NULL AFTER `seat_status`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'seated_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `seated_at` DATETIME NULL AFTER `arrived_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'main_course_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `main_course_at` DATETIME NULL AFTER `seated_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'paid_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `paid_at` DATETIME NULL AFTER `main_course_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'left_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `left_at` DATETIME NULL AFTER `paid_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
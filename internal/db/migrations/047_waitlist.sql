@@ -0,0 +1,34 @@
+-- Waitlist for fully booked days. Guests leave a time window; when a
+-- cancellation frees capacity inside it the oldest matching entry gets a
+-- claim link that expires after WAITLIST_OFFER_MINUTES.
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  reservation_date DATE NOT NULL,
+  -- Preferred window (HH:MM, both inclusive).
+  time_from CHAR(5) NOT NULL,
+  time_to CHAR(5) NOT NULL,
+  party_size INT NOT NULL,
+  customer_name VARCHAR(255) NOT NULL,
+  contact_phone VARCHAR(32) NOT NULL,
+  contact_phone_country_code VARCHAR(8) NOT NULL DEFAULT '34',
+  contact_email VARCHAR(255) DEFAULT NULL,
+  commentary TEXT DEFAULT NULL,
+  -- waiting | offered | claimed | expired | cancelled
+  status VARCHAR(16) NOT NULL DEFAULT 'waiting',
+  offered_time CHAR(5) DEFAULT NULL,
+  -- sha256 of the claim token sent to the guest.
+  offer_token_hash CHAR(64) DEFAULT NULL,
+  offer_expires_at DATETIME DEFAULT NULL,
+  offer_count INT NOT NULL DEFAULT 0,
+  booking_id INT DEFAULT NULL,
+  -- Public base URL the guest joined from, used for links sent in background.
+  claim_base_url VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_waitlist_offer_token (offer_token_hash),
+  KEY idx_waitlist_restaurant_date_status (restaurant_id, reservation_date, status),
+  KEY idx_waitlist_offer_expiry (status, offer_expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
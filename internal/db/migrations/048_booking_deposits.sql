@@ -0,0 +1,83 @@
+-- Deposits and card guarantees. A matching deposit rule puts a web booking
+-- in payment_status 'pending_payment' until the guest pays at the provider's
+-- checkout; unpaid bookings are cancelled when the hold expires.
+
+CREATE TABLE IF NOT EXISTS deposit_rules (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  name VARCHAR(120) NOT NULL,
+  -- deposit: charged at booking, refunded on timely cancellation.
+  -- guarantee: card authorised only, released on timely cancellation.
+  kind VARCHAR(16) NOT NULL DEFAULT 'deposit',
+  -- Conditions; NULL / 0 = any.
+  min_party_size INT DEFAULT NULL,
+  group_menu_only TINYINT(1) NOT NULL DEFAULT 0,
+  menu_de_grupo_id INT DEFAULT NULL,
+  date_from DATE DEFAULT NULL,
+  date_to DATE DEFAULT NULL,
+  -- Comma-separated weekdays, 0 = Sunday.
+  weekdays VARCHAR(16) DEFAULT NULL,
+  amount_cents INT NOT NULL,
+  per_person TINYINT(1) NOT NULL DEFAULT 0,
+  refund_cutoff_hours INT NOT NULL DEFAULT 48,
+  sort_order INT NOT NULL DEFAULT 0,
+  is_active TINYINT(1) NOT NULL DEFAULT 1,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_deposit_rules_restaurant (restaurant_id, sort_order)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- One row per checkout. The rule terms are copied so later rule edits don't
+-- change the policy of existing bookings. Rows outlive the booking, which is
+-- deleted from bookings when cancelled.
+CREATE TABLE IF NOT EXISTS booking_payments (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  booking_id INT NOT NULL,
+  rule_id INT DEFAULT NULL,
+  kind VARCHAR(16) NOT NULL,
+  provider VARCHAR(32) NOT NULL,
+  -- Checkout session and, once paid, the payment (intent) it produced.
+  provider_ref VARCHAR(255) NOT NULL,
+  provider_payment_ref VARCHAR(255) DEFAULT NULL,
+  amount_cents INT NOT NULL,
+  currency CHAR(3) NOT NULL DEFAULT 'eur',
+  refund_cutoff_hours INT NOT NULL DEFAULT 48,
+  -- pending | paid | authorized | captured | refunded | released | expired
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  checkout_url TEXT DEFAULT NULL,
+  hold_expires_at DATETIME NOT NULL,
+  paid_at DATETIME DEFAULT NULL,
+  refunded_cents INT NOT NULL DEFAULT 0,
+  refund_ref VARCHAR(255) DEFAULT NULL,
+  closed_at DATETIME DEFAULT NULL,
+  last_error VARCHAR(512) DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_booking_payments_ref (provider, provider_ref),
+  KEY idx_booking_payments_booking (restaurant_id, booking_id),
+  KEY idx_booking_payments_payment_ref (provider, provider_payment_ref),
+  KEY idx_booking_payments_hold (status, hold_expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- NULL = no payment involved; otherwise pending_payment | paid | guaranteed.
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'payment_status'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `payment_status` VARCHAR(16) NULL AFTER `seat_status`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,100 @@
+-- Guest profiles. Bookings link to a guest on insert, matched by phone
+-- (E.164 digits, country code first) or, for guests without one, by email.
+-- Counters are derived from bookings and cancelled_bookings and refreshed
+-- whenever those change.
+
+CREATE TABLE IF NOT EXISTS guests (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  phone_e164 VARCHAR(20) DEFAULT NULL,
+  phone_country_code VARCHAR(8) DEFAULT NULL,
+  phone_national VARCHAR(20) DEFAULT NULL,
+  -- Lowercased.
+  email VARCHAR(255) DEFAULT NULL,
+  booking_count INT NOT NULL DEFAULT 0,
+  visit_count INT NOT NULL DEFAULT 0,
+  no_show_count INT NOT NULL DEFAULT 0,
+  cancel_count INT NOT NULL DEFAULT 0,
+  first_visit_date DATE DEFAULT NULL,
+  last_visit_date DATE DEFAULT NULL,
+  -- JSON array of strings.
+  tags TEXT DEFAULT NULL,
+  allergies TEXT DEFAULT NULL,
+  notes TEXT DEFAULT NULL,
+  -- Set on guests merged into another one. The row is kept so its phone
+  -- and email keep resolving to the surviving guest.
+  merged_into_id INT DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_guests_phone (restaurant_id, phone_e164),
+  KEY idx_guests_email (restaurant_id, email),
+  KEY idx_guests_last_visit (restaurant_id, last_visit_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'guest_id'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `guest_id` INT NULL AFTER `restaurant_id`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.STATISTICS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND INDEX_NAME = 'idx_bookings_guest'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @idx_exists = 0,
+  'ALTER TABLE `bookings` ADD KEY idx_bookings_guest (restaurant_id, guest_id)',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cancelled_bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cancelled_bookings' AND COLUMN_NAME = 'guest_id'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `cancelled_bookings` ADD COLUMN `guest_id` INT NULL AFTER `restaurant_id`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.STATISTICS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cancelled_bookings' AND INDEX_NAME = 'idx_cancelled_bookings_guest'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @idx_exists = 0,
+  'ALTER TABLE `cancelled_bookings` ADD KEY idx_cancelled_bookings_guest (restaurant_id, guest_id)',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,85 @@
+-- Whether a booking's guest turned up. attendance is NULL until staff mark
+-- it: 'arrived' (also set by any floor step) or 'no_show'. Guests' no-show
+-- counts come from it, and restaurants can hold repeat no-shows to stricter
+-- terms when they book online.
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'attendance'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `attendance` VARCHAR(16) NULL AFTER `seat_status`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'attendance_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `attendance_at` DATETIME NULL AFTER `attendance`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Set on online bookings of guests under a 'confirm' policy: the guest's
+-- own confirmation link doesn't confirm them, staff do after calling.
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'confirmation_required'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `confirmation_required` TINYINT(1) NOT NULL DEFAULT 0 AFTER `attendance_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.STATISTICS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND INDEX_NAME = 'idx_bookings_guest_attendance'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @idx_exists = 0,
+  'ALTER TABLE `bookings` ADD KEY `idx_bookings_guest_attendance` (`restaurant_id`, `guest_id`, `attendance`)',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- What happens when a guest with at least min_no_shows books online. The
+-- policy with the highest threshold reached applies. action is
+-- confirm | deposit | block; deposits use amount_cents (per person when
+-- per_person).
+CREATE TABLE IF NOT EXISTS no_show_policies (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  min_no_shows INT NOT NULL,
+  action VARCHAR(16) NOT NULL,
+  amount_cents INT DEFAULT NULL,
+  per_person TINYINT(1) NOT NULL DEFAULT 0,
+  refund_cutoff_hours INT NOT NULL DEFAULT 48,
+  is_active TINYINT(1) NOT NULL DEFAULT 1,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_no_show_policies_threshold (restaurant_id, min_no_shows)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,107 @@
+-- Personal data retention. anonymized_at marks rows whose guest details
+-- were scrubbed, either on a subject's request or by the retention job;
+-- the rows stay so counts, stats and fiscal records keep adding up.
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'bookings' AND COLUMN_NAME = 'anonymized_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `bookings` ADD COLUMN `anonymized_at` DATETIME NULL, ADD KEY `idx_bookings_anonymized` (`restaurant_id`, `anonymized_at`, `reservation_date`)',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @table_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cancelled_bookings'
+);
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cancelled_bookings' AND COLUMN_NAME = 'anonymized_at'
+);
+SET @ddl := IF(
+  @table_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE `cancelled_bookings` ADD COLUMN `anonymized_at` DATETIME NULL',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'guests' AND COLUMN_NAME = 'anonymized_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `guests` ADD COLUMN `anonymized_at` DATETIME NULL AFTER `merged_into_id`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'invoices' AND COLUMN_NAME = 'anonymized_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `invoices` ADD COLUMN `anonymized_at` DATETIME NULL',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'restaurant_members' AND COLUMN_NAME = 'anonymized_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `restaurant_members` ADD COLUMN `anonymized_at` DATETIME NULL',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Per-restaurant retention periods. The nightly job only runs for
+-- restaurants with a row; 0 turns off one kind of purge. invoice_years is
+-- never below the 6 years invoices must be kept for.
+CREATE TABLE IF NOT EXISTS privacy_retention_settings (
+  restaurant_id INT NOT NULL,
+  -- Guest details on bookings, cancellations, waitlist entries and guests
+  -- with no booking since.
+  booking_months INT NOT NULL DEFAULT 36,
+  -- WhatsApp bot transcripts and states.
+  conversation_days INT NOT NULL DEFAULT 90,
+  -- Sent or failed message_deliveries (webhook and message payloads).
+  delivery_days INT NOT NULL DEFAULT 365,
+  -- DNI, bank account and contact details of inactive members.
+  former_member_months INT NOT NULL DEFAULT 48,
+  -- Customer details on invoices, counted from the invoice date.
+  invoice_years INT NOT NULL DEFAULT 6,
+  last_run_at DATETIME DEFAULT NULL,
+  -- Rows touched by the last run, per kind.
+  last_run_json JSON DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (restaurant_id),
+  CONSTRAINT fk_privacy_retention_settings_restaurant FOREIGN KEY (restaurant_id) REFERENCES restaurants(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,34 @@
+-- Marketing consent per guest and channel. marketing_consents is the
+-- ledger: one row per grant or withdrawal, never updated. The guests
+-- columns hold the current state for targeting: when consent was last
+-- granted, NULL when the guest hasn't consented or withdrew.
+CREATE TABLE IF NOT EXISTS marketing_consents (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  guest_id INT NOT NULL,
+  -- email | whatsapp
+  channel VARCHAR(16) NOT NULL,
+  granted TINYINT(1) NOT NULL,
+  -- booking_form | backoffice | unsubscribe_link | whatsapp_stop
+  source VARCHAR(32) NOT NULL,
+  booking_id INT DEFAULT NULL,
+  actor_user_id INT DEFAULT NULL,
+  ip VARCHAR(64) DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_marketing_consents_guest (restaurant_id, guest_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'guests' AND COLUMN_NAME = 'marketing_email_at'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `guests` ADD COLUMN `marketing_email_at` DATETIME NULL AFTER `notes`, ADD COLUMN `marketing_whatsapp_at` DATETIME NULL AFTER `marketing_email_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,87 @@
+-- Marketing campaigns. A campaign copies its template's subject and body
+-- when it is saved, so editing a template never changes a campaign that is
+-- already scheduled. When a campaign is due, its audience is resolved once
+-- into message_deliveries rows (one per recipient), which the per-channel
+-- senders work through.
+CREATE TABLE IF NOT EXISTS marketing_templates (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  name VARCHAR(120) NOT NULL,
+  -- email | whatsapp
+  channel VARCHAR(16) NOT NULL,
+  -- Email only.
+  subject VARCHAR(255) DEFAULT NULL,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_marketing_templates_restaurant (restaurant_id, channel)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS marketing_campaigns (
+  id INT NOT NULL AUTO_INCREMENT,
+  restaurant_id INT NOT NULL,
+  name VARCHAR(120) NOT NULL,
+  channel VARCHAR(16) NOT NULL,
+  template_id INT DEFAULT NULL,
+  subject VARCHAR(255) DEFAULT NULL,
+  body TEXT NOT NULL,
+  -- Audience filters, see marketingAudience.
+  audience_json JSON DEFAULT NULL,
+  -- draft | scheduled | sending | sent | cancelled
+  status VARCHAR(16) NOT NULL DEFAULT 'draft',
+  scheduled_at DATETIME DEFAULT NULL,
+  started_at DATETIME DEFAULT NULL,
+  finished_at DATETIME DEFAULT NULL,
+  recipients INT NOT NULL DEFAULT 0,
+  -- Public base URL for the links in the messages, captured on save.
+  base_url VARCHAR(255) DEFAULT NULL,
+  created_by_user_id INT DEFAULT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_marketing_campaigns_restaurant (restaurant_id, created_at),
+  KEY idx_marketing_campaigns_due (status, scheduled_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND COLUMN_NAME = 'campaign_id'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `message_deliveries` ADD COLUMN `campaign_id` INT NULL AFTER `restaurant_id`, ADD COLUMN `guest_id` INT NULL AFTER `campaign_id`, ADD COLUMN `clicked_at` DATETIME NULL AFTER `sent_at`, ADD COLUMN `click_count` INT NOT NULL DEFAULT 0 AFTER `clicked_at`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @idx_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.STATISTICS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'message_deliveries' AND INDEX_NAME = 'idx_message_deliveries_campaign'
+);
+SET @ddl := IF(
+  @idx_exists = 0,
+  'ALTER TABLE `message_deliveries` ADD KEY `idx_message_deliveries_campaign` (`campaign_id`, `status`)',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'guests' AND COLUMN_NAME = 'birthday'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  'ALTER TABLE `guests` ADD COLUMN `birthday` DATE NULL AFTER `email`',
+  'SELECT 1'
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
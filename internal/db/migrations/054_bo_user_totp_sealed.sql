@@ -0,0 +1,3 @@
+-- Room for TOTP secrets sealed with BO_2FA_SECRET_KEY ("v1:" + base64 of
+-- nonce, ciphertext and tag). Plain secrets keep fitting.
+ALTER TABLE `bo_users` MODIFY COLUMN `totp_secret` VARCHAR(255) DEFAULT NULL;
@@ -0,0 +1,15 @@
+-- Registered address of the issuer, printed with its NIF and legal name on
+-- every invoice.
+SET @col_exists := (
+  SELECT COUNT(*)
+  FROM information_schema.columns
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'restaurant_fiscal_profiles' AND COLUMN_NAME = 'issuer_address'
+);
+SET @ddl := IF(
+  @col_exists = 0,
+  "ALTER TABLE `restaurant_fiscal_profiles` ADD COLUMN `issuer_address` VARCHAR(255) DEFAULT NULL AFTER `issuer_name`",
+  "SELECT 1"
+);
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
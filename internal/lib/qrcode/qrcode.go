@@ -0,0 +1,491 @@
+// Package qrcode encodes short byte payloads as QR Code symbols (ISO/IEC
+// 18004, byte mode, error correction level M). It covers versions 1-20,
+// i.e. up to 666 bytes, which is plenty for URLs printed on invoices.
+package qrcode
+
+import (
+	"errors"
+)
+
+// ErrTooLong is returned when the payload doesn't fit in version 20-M.
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// Code is an encoded symbol. Size is the number of modules per side, without
+// the quiet zone.
+type Code struct {
+	Size    int
+	Version int
+	Mask    int
+	modules []bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y*c.Size+x]
+}
+
+// Level M block structure per version: EC codewords per block, then
+// (blocks, data codewords per block) for the two block groups.
+var eccLevelM = [21][5]int{
+	{},
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+	{30, 1, 50, 4, 51},
+	{22, 6, 36, 2, 37},
+	{22, 8, 37, 1, 38},
+	{24, 4, 40, 5, 41},
+	{24, 5, 41, 5, 42},
+	{28, 7, 45, 3, 46},
+	{28, 10, 46, 1, 47},
+	{26, 9, 43, 4, 44},
+	{26, 3, 44, 11, 45},
+	{26, 3, 41, 13, 42},
+}
+
+const (
+	maxVersion = 20
+	// Format info bits for level M are 00.
+	formatBitsLevelM = 0
+)
+
+func dataCodewords(version int) int {
+	e := eccLevelM[version]
+	return e[1]*e[2] + e[3]*e[4]
+}
+
+// Encode returns the smallest symbol that holds data in byte mode.
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= dataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(version, encodeData(version, data))
+
+	q := newMatrix(version)
+	q.drawFunctionPatterns()
+	q.drawCodewords(codewords)
+
+	best, bestPenalty := -1, 0
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); best < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // XOR again to undo
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+
+	return &Code{Size: q.size, Version: version, Mask: best, modules: q.modules}, nil
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (v>>i)&1 == 1)
+	}
+}
+
+func encodeData(version int, data []byte) []byte {
+	capacity := dataCodewords(version) * 8
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+
+	var bb bitBuffer
+	bb.append(0x4, 4) // byte mode
+	bb.append(len(data), countBits)
+	for _, c := range data {
+		bb.append(int(c), 8)
+	}
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	out := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			out[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+	return out
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords
+// to each and interleaves the result.
+func addErrorCorrection(version int, data []byte) []byte {
+	e := eccLevelM[version]
+	eccLen := e[0]
+	divisor := rsDivisor(eccLen)
+
+	var blocks, eccs [][]byte
+	pos := 0
+	for g := 0; g < 2; g++ {
+		count, size := e[1+2*g], e[2+2*g]
+		for i := 0; i < count; i++ {
+			block := data[pos : pos+size]
+			pos += size
+			blocks = append(blocks, block)
+			eccs = append(eccs, rsRemainder(block, divisor))
+		}
+	}
+
+	var out []byte
+	maxLen := e[2]
+	if e[3] > 0 {
+		maxLen = e[4]
+	}
+	for i := 0; i < maxLen; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for _, b := range eccs {
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		hi := z >> 7
+		z <<= 1
+		if hi == 1 {
+			z ^= 0x1D
+		}
+		if (y>>uint(i))&1 == 1 {
+			z ^= x
+		}
+	}
+	return z
+}
+
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMul(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+type matrix struct {
+	version    int
+	size       int
+	modules    []bool
+	isFunction []bool
+}
+
+func newMatrix(version int) *matrix {
+	size := version*4 + 17
+	return &matrix{
+		version:    version,
+		size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+func (q *matrix) get(x, y int) bool { return q.modules[y*q.size+x] }
+
+func (q *matrix) setFunction(x, y int, dark bool) {
+	q.modules[y*q.size+x] = dark
+	q.isFunction[y*q.size+x] = true
+}
+
+func (q *matrix) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	pos := alignmentPositions(q.version)
+	n := len(pos)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			q.drawAlignment(pos[i], pos[j])
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn per mask.
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func (q *matrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= q.size || y >= q.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			q.setFunction(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (q *matrix) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	num := version/7 + 2
+	step := (version*4 + num*2 + 1) / (num*2 - 2) * 2
+	size := version*4 + 17
+	out := make([]int, num)
+	out[0] = 6
+	for i, pos := num-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		out[i] = pos
+	}
+	return out
+}
+
+func formatBits(mask int) int {
+	data := formatBitsLevelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (q *matrix) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true) // dark module
+}
+
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func (q *matrix) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	bits := versionBits(q.version)
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 == 1
+		a, b := q.size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+func (q *matrix) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if q.isFunction[y*q.size+x] || i >= len(data)*8 {
+					continue
+				}
+				q.modules[y*q.size+x] = (data[i>>3]>>(7-uint(i&7)))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (q *matrix) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.isFunction[y*q.size+x] && maskBit(mask, x, y) {
+				q.modules[y*q.size+x] = !q.modules[y*q.size+x]
+			}
+		}
+	}
+}
+
+var (
+	finderLikeA = []bool{true, false, true, true, true, false, true, false, false, false, false}
+	finderLikeB = []bool{false, false, false, false, true, false, true, true, true, false, true}
+)
+
+// penalty scores the symbol with the four rules of ISO/IEC 18004 §7.8.3.
+func (q *matrix) penalty() int {
+	total := 0
+	n := q.size
+	for pass := 0; pass < 2; pass++ {
+		at := func(i, j int) bool {
+			if pass == 0 {
+				return q.get(j, i)
+			}
+			return q.get(i, j)
+		}
+		for i := 0; i < n; i++ {
+			run := 1
+			for j := 1; j <= n; j++ {
+				if j < n && at(i, j) == at(i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					total += 3 + run - 5
+				}
+				run = 1
+			}
+			for j := 0; j+11 <= n; j++ {
+				matchA, matchB := true, true
+				for k := 0; k < 11; k++ {
+					v := at(i, j+k)
+					if v != finderLikeA[k] {
+						matchA = false
+					}
+					if v != finderLikeB[k] {
+						matchB = false
+					}
+				}
+				if matchA {
+					total += 40
+				}
+				if matchB {
+					total += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.get(x, y) {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.get(x, y)
+				if c == q.get(x+1, y) && c == q.get(x, y+1) && c == q.get(x+1, y+1) {
+					total += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (n * n)
+	dev := abs(percent - 50)
+	total += dev / 5 * 10
+	return total
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package qrcode
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M (ISO/IEC 18004 worked example).
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Fatalf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	for mask, want := range map[int]string{0: "101010000010010", 4: "100010111111001", 7: "100101010100000"} {
+		if got := strconv.FormatInt(int64(formatBits(mask)), 2); got != want {
+			t.Errorf("formatBits(%d) = %s, want %s", mask, got, want)
+		}
+	}
+	if got := versionBits(7); got != 0x07C94 {
+		t.Errorf("versionBits(7) = %#x", got)
+	}
+	if got := alignmentPositions(7); len(got) != 3 || got[1] != 22 || got[2] != 38 {
+		t.Errorf("alignmentPositions(7) = %v", got)
+	}
+}
+
+func TestEncodeStructure(t *testing.T) {
+	payload := "https://www2.agenciatributaria.gob.es/wlpl/TIKE-CONT/ValidarQR?nif=B12345678&numserie=F2026-00042&fecha=16-10-2026&importe=183.03"
+	c, err := Encode([]byte(payload))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if c.Size != c.Version*4+17 || c.Version < 7 {
+		t.Fatalf("unexpected symbol: version %d size %d", c.Version, c.Size)
+	}
+
+	// Finder patterns: dark outer ring, light ring, dark 3x3 core.
+	for _, o := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		if !c.Dark(o[0], o[1]) || c.Dark(o[0]+1, o[1]+1) || !c.Dark(o[0]+3, o[1]+3) {
+			t.Errorf("finder at %v malformed", o)
+		}
+	}
+	for i := 8; i < c.Size-8; i++ {
+		if c.Dark(i, 6) != (i%2 == 0) || c.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+	if !c.Dark(8, c.Size-8) {
+		t.Fatalf("dark module missing")
+	}
+
+	// Both copies of the format info must agree.
+	var a, b strings.Builder
+	for i := 0; i <= 5; i++ {
+		a.WriteString(bit(c.Dark(8, i)))
+	}
+	a.WriteString(bit(c.Dark(8, 7)) + bit(c.Dark(8, 8)) + bit(c.Dark(7, 8)))
+	for i := 9; i < 15; i++ {
+		a.WriteString(bit(c.Dark(14-i, 8)))
+	}
+	for i := 0; i < 8; i++ {
+		b.WriteString(bit(c.Dark(c.Size-1-i, 8)))
+	}
+	for i := 8; i < 15; i++ {
+		b.WriteString(bit(c.Dark(8, c.Size-15+i)))
+	}
+	if a.String() != b.String() {
+		t.Fatalf("format copies differ: %s vs %s", a.String(), b.String())
+	}
+
+	if _, err := Encode(bytes.Repeat([]byte("x"), 700)); err != ErrTooLong {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func bit(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,36 @@
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SVG renders the code as a standalone SVG image with a 4-module quiet zone.
+// moduleSize is the side of one module in pixels.
+func (c *Code) SVG(moduleSize int) string {
+	if moduleSize <= 0 {
+		moduleSize = 4
+	}
+	const quiet = 4
+	side := (c.Size + 2*quiet) * moduleSize
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		side, side, c.Size+2*quiet, c.Size+2*quiet)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < c.Size && c.Dark(x, y) {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start+quiet, y+quiet, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}